@@ -0,0 +1,288 @@
+package benchmarks
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/cclcorpus"
+	"roseh.moe/pkg/ccl/x/ccllint"
+)
+
+type config struct {
+	Name    string            `ccl:"name" json:"name"`
+	Debug   bool              `ccl:"debug" json:"debug"`
+	Servers []server          `ccl:"server" json:"server"`
+	Labels  map[string]string `ccl:"labels" json:"labels"`
+}
+
+type server struct {
+	Host   string   `ccl:"host" json:"host"`
+	Port   int32    `ccl:"port" json:"port"`
+	Weight float64  `ccl:"weight" json:"weight"`
+	Tags   []string `ccl:"tags" json:"tags"`
+}
+
+// newConfig returns a config with n servers and n labels.
+func newConfig(n int) *config {
+	c := &config{Name: "frontend", Debug: true, Labels: make(map[string]string)}
+	for i := range n {
+		c.Servers = append(c.Servers, server{
+			Host:   fmt.Sprintf("backend-%d.example.com", i),
+			Port:   int32(8000 + i),
+			Weight: 1.5,
+			Tags:   []string{"prod", "us-east"},
+		})
+		c.Labels[fmt.Sprintf("label%d", i)] = fmt.Sprintf("value %d", i)
+	}
+	return c
+}
+
+// configDescriptor describes config as a protobuf message, with the same
+// field names.
+var configDescriptor = func() protoreflect.MessageDescriptor {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     typ.Enum(),
+			Label:    label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	const (
+		optional = descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		repeated = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		str      = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		message  = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	)
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("benchmarks/config.proto"),
+		Package: proto.String("benchmarks"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Config"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, str, optional, ""),
+				field("debug", 2, descriptorpb.FieldDescriptorProto_TYPE_BOOL, optional, ""),
+				field("server", 3, message, repeated, ".benchmarks.Server"),
+				field("labels", 4, message, repeated, ".benchmarks.Config.LabelsEntry"),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("LabelsEntry"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("key", 1, str, optional, ""),
+					field("value", 2, str, optional, ""),
+				},
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+			}},
+		}, {
+			Name: proto.String("Server"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("host", 1, str, optional, ""),
+				field("port", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, optional, ""),
+				field("weight", 3, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, optional, ""),
+				field("tags", 4, str, repeated, ""),
+			},
+		}},
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		panic(err)
+	}
+	return fd.Messages().ByName("Config")
+}()
+
+// documents returns the config c written in each format.
+func documents(tb testing.TB, c *config) (cclDoc, jsonDoc, textDoc []byte) {
+	tb.Helper()
+
+	cclDoc, err := ccl.Marshal(c)
+	if err != nil {
+		tb.Fatalf("ccl.Marshal failed: %s", err)
+	}
+	jsonDoc, err = json.Marshal(c)
+	if err != nil {
+		tb.Fatalf("json.Marshal failed: %s", err)
+	}
+	m := dynamicpb.NewMessage(configDescriptor)
+	if err := protojson.Unmarshal(jsonDoc, m); err != nil {
+		tb.Fatalf("protojson.Unmarshal failed: %s", err)
+	}
+	textDoc, err = prototext.Marshal(m)
+	if err != nil {
+		tb.Fatalf("prototext.Marshal failed: %s", err)
+	}
+	return cclDoc, jsonDoc, textDoc
+}
+
+var sizes = []int{1, 10, 100, 1000}
+
+// TestEquivalent checks that the documents used by the benchmarks hold the
+// same config.
+func TestEquivalent(t *testing.T) {
+	t.Parallel()
+
+	want := newConfig(10)
+	cclDoc, jsonDoc, textDoc := documents(t, want)
+	var fromCCL config
+	if err := ccl.Unmarshal(cclDoc, &fromCCL); err != nil {
+		t.Fatalf("ccl.Unmarshal failed: %s", err)
+	}
+	m := dynamicpb.NewMessage(configDescriptor)
+	if err := prototext.Unmarshal(textDoc, m); err != nil {
+		t.Fatalf("prototext.Unmarshal failed: %s", err)
+	}
+	fromTextJSON, err := protojson.Marshal(m)
+	if err != nil {
+		t.Fatalf("protojson.Marshal failed: %s", err)
+	}
+	var fromText config
+	if err := json.Unmarshal(fromTextJSON, &fromText); err != nil {
+		t.Fatalf("json.Unmarshal failed: %s", err)
+	}
+	var fromJSON config
+	if err := json.Unmarshal(jsonDoc, &fromJSON); err != nil {
+		t.Fatalf("json.Unmarshal failed: %s", err)
+	}
+	wantJSON, _ := json.Marshal(want)
+	for _, got := range []struct {
+		format string
+		c      config
+	}{{"ccl", fromCCL}, {"json", fromJSON}, {"prototext", fromText}} {
+		if gotJSON, _ := json.Marshal(got.c); string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s document decoded to %s, want %s", got.format, gotJSON, wantJSON)
+		}
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	for _, n := range sizes {
+		cclDoc, jsonDoc, textDoc := documents(b, newConfig(n))
+		b.Run(fmt.Sprintf("ccl/%d", n), func(b *testing.B) {
+			b.SetBytes(int64(len(cclDoc)))
+			for b.Loop() {
+				var c config
+				if err := ccl.Unmarshal(cclDoc, &c); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("json/%d", n), func(b *testing.B) {
+			b.SetBytes(int64(len(jsonDoc)))
+			for b.Loop() {
+				var c config
+				if err := json.Unmarshal(jsonDoc, &c); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("prototext/%d", n), func(b *testing.B) {
+			b.SetBytes(int64(len(textDoc)))
+			for b.Loop() {
+				m := dynamicpb.NewMessage(configDescriptor)
+				if err := prototext.Unmarshal(textDoc, m); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	for _, n := range sizes {
+		cclDoc, _, _ := documents(b, newConfig(n))
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.SetBytes(int64(len(cclDoc)))
+			for b.Loop() {
+				if _, err := ccl.Parse(cclDoc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	for _, n := range sizes {
+		c := newConfig(n)
+		m := dynamicpb.NewMessage(configDescriptor)
+		_, jsonDoc, _ := documents(b, c)
+		if err := protojson.Unmarshal(jsonDoc, m); err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("ccl/%d", n), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := ccl.Marshal(c); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("json/%d", n), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := json.Marshal(c); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("prototext/%d", n), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := prototext.Marshal(m); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCorpus parses, formats and lints the documents in cclcorpus,
+// which have the shapes of real-world configs.
+func BenchmarkCorpus(b *testing.B) {
+	for _, doc := range cclcorpus.Documents() {
+		b.Run("parse/"+doc.Name, func(b *testing.B) {
+			b.SetBytes(int64(len(doc.Data)))
+			for b.Loop() {
+				if _, err := ccl.Parse(doc.Data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run("events/"+doc.Name, func(b *testing.B) {
+			b.SetBytes(int64(len(doc.Data)))
+			for b.Loop() {
+				if err := ccl.ParseEvents(doc.Data, ccl.Handler{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run("format/"+doc.Name, func(b *testing.B) {
+			b.SetBytes(int64(len(doc.Data)))
+			for b.Loop() {
+				if _, err := ccl.Format(doc.Data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		n, err := ccl.Parse(doc.Data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run("lint/"+doc.Name, func(b *testing.B) {
+			for b.Loop() {
+				ccllint.Lint(n)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+// Package benchmarks compares the speed of ccl with encoding/json and the
+// protobuf text format, by decoding and encoding the same config written in
+// each of them. It has no code of its own; run the benchmarks with
+//
+//	go test -bench . roseh.moe/pkg/ccl/benchmarks
+//
+// and compare runs with benchstat to track how optimizations change the
+// results. The benchmarks are in their own module so that ccl doesn't
+// depend on protobuf.
+//
+// The protobuf messages are dynamic, built from a descriptor at run time
+// rather than generated by protoc, which makes prototext slower than it
+// would be with generated code.
+package benchmarks
@@ -0,0 +1,9 @@
+module roseh.moe/pkg/ccl/benchmarks
+
+go 1.24
+
+require roseh.moe/pkg/ccl v0.0.0
+
+require google.golang.org/protobuf v1.36.6
+
+replace roseh.moe/pkg/ccl => ../
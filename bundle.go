@@ -0,0 +1,109 @@
+package ccl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ReadBundle splits a bundle into its documents. A bundle holds a set of
+// named ccl documents in one file, so that all of an app's configs can be
+// shipped together. Each document starts with a line that has three dashes
+// and its name:
+//
+//	--- frontend
+//	listen: ":443"
+//
+//	--- backend
+//	listen: ":8080"
+//	workers: 8
+//
+// Nothing but comments and blank lines may come before the first
+// document, and no two documents may have the same name. The documents are
+// returned in order as Layers, so they can be merged with
+// [MergeOptions.Merge], which reports errors with the document's name and
+// the position in the document, as in "backend:3:10 syntax error: ...".
+// The documents themselves aren't parsed.
+func ReadBundle(data []byte) ([]Layer, error) {
+	var layers []Layer
+	seen := make(map[string]bool)
+	start := 0 // the start of the current document's data
+	for i := 0; i < len(data); {
+		end := len(data)
+		next := end
+		if j := bytes.IndexByte(data[i:], '\n'); j >= 0 {
+			end, next = i+j, i+j+1
+		}
+		line := bytes.TrimSuffix(data[i:end], []byte("\r"))
+		if rest, ok := bytes.CutPrefix(line, []byte("---")); ok {
+			name := string(bytes.TrimSpace(rest))
+			switch {
+			case len(rest) > 0 && rest[0] != ' ' && rest[0] != '\t':
+				return nil, newSyntaxError(data, i, "expecting a space after ---")
+			case name == "":
+				return nil, newSyntaxError(data, i, "document needs a name after ---")
+			case seen[name]:
+				return nil, newSyntaxError(data, i, "duplicate document %q", name)
+			}
+			seen[name] = true
+			if len(layers) > 0 {
+				layers[len(layers)-1].Data = data[start:i]
+			} else if err := checkPreamble(data[:i]); err != nil {
+				return nil, err
+			}
+			layers = append(layers, Layer{Name: name})
+			start = next
+		}
+		i = next
+	}
+	if len(layers) == 0 {
+		if err := checkPreamble(data); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	layers[len(layers)-1].Data = data[start:]
+	return layers, nil
+}
+
+// checkPreamble returns an error if the part of a bundle before its first
+// document has anything but comments and space.
+func checkPreamble(data []byte) error {
+	l := lexer{data: data}
+	if err := l.skipSpace(); err != nil {
+		return err
+	}
+	if l.i < len(data) {
+		return newSyntaxError(data, l.i, "expecting \"--- name\" before the first document")
+	}
+	return nil
+}
+
+// WriteBundle writes the layers to w as a bundle that can be read with
+// [ReadBundle]. Each layer's data is written as it is, followed by a
+// newline if it doesn't end with one. A layer's name can't be empty or have
+// a line break, and its data can't have a line that starts with ---, since
+// it would be read as the start of another document.
+func WriteBundle(w io.Writer, layers []Layer) error {
+	var b bytes.Buffer
+	seen := make(map[string]bool)
+	for _, l := range layers {
+		switch {
+		case l.Name == "" || l.Name != strings.TrimSpace(l.Name) || strings.ContainsAny(l.Name, "\r\n"):
+			return fmt.Errorf("invalid document name %q", l.Name)
+		case seen[l.Name]:
+			return fmt.Errorf("duplicate document %q", l.Name)
+		case bytes.HasPrefix(l.Data, []byte("---")) || bytes.Contains(l.Data, []byte("\n---")):
+			return fmt.Errorf("document %q has a line that starts with ---", l.Name)
+		}
+		seen[l.Name] = true
+		fmt.Fprintf(&b, "--- %s\n", l.Name)
+		b.Write(l.Data)
+		if len(l.Data) > 0 && l.Data[len(l.Data)-1] != '\n' {
+			b.WriteByte('\n')
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,167 @@
+package ccl
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestReadBundle(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		data string
+		want []Layer
+	}{{
+		desc: "Empty",
+		data: ``,
+		want: nil,
+	}, {
+		desc: "Documents",
+		data: `# The app's configs.
+
+--- frontend
+listen: ":443"
+
+---	backend api
+listen: ":8080"
+--- empty
+`,
+		want: []Layer{
+			{Name: "frontend", Data: []byte("listen: \":443\"\n\n")},
+			{Name: "backend api", Data: []byte("listen: \":8080\"\n")},
+			{Name: "empty", Data: []byte("")},
+		},
+	}, {
+		desc: "CRLF",
+		data: "--- a\r\nx: 1\r\n--- b \r\ny: 2",
+		want: []Layer{
+			{Name: "a", Data: []byte("x: 1\r\n")},
+			{Name: "b", Data: []byte("y: 2")},
+		},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ReadBundle([]byte(tc.data))
+			if err != nil {
+				t.Fatalf("ReadBundle failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("ReadBundle returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadBundle_Error(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		data string
+		want string
+	}{{
+		desc: "Preamble",
+		data: "# comment\nx: 1\n--- a\n",
+		want: `2:1 syntax error: expecting "--- name" before the first document`,
+	}, {
+		desc: "NoDocuments",
+		data: "x: 1\n",
+		want: `1:1 syntax error: expecting "--- name" before the first document`,
+	}, {
+		desc: "NoName",
+		data: "--- a\n---\n",
+		want: "2:1 syntax error: document needs a name after ---",
+	}, {
+		desc: "NoSpace",
+		data: "---a\n",
+		want: "1:1 syntax error: expecting a space after ---",
+	}, {
+		desc: "Duplicate",
+		data: "--- a\n--- b\n--- a\n",
+		want: `3:1 syntax error: duplicate document "a"`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := ReadBundle([]byte(tc.data)); err == nil || err.Error() != tc.want {
+				t.Errorf("ReadBundle returned error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestWriteBundle(t *testing.T) {
+	t.Parallel()
+
+	layers := []Layer{
+		{Name: "frontend", Data: []byte("listen: \":443\"\n")},
+		{Name: "backend", Data: []byte("listen: \":8080\"")},
+		{Name: "empty"},
+	}
+	var b bytes.Buffer
+	if err := WriteBundle(&b, layers); err != nil {
+		t.Fatalf("WriteBundle failed: %s", err)
+	}
+	want := "--- frontend\nlisten: \":443\"\n--- backend\nlisten: \":8080\"\n--- empty\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("WriteBundle returned unexpected diff (-want +got):\n%s", diff)
+	}
+	got, err := ReadBundle(b.Bytes())
+	if err != nil {
+		t.Fatalf("ReadBundle failed: %s", err)
+	}
+	layers[1].Data = append(layers[1].Data, '\n')
+	if diff := cmp.Diff(layers, got, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("ReadBundle(WriteBundle(layers)) returned unexpected diff (-want +got):\n%s", diff)
+	}
+
+	// The documents can be merged into one config.
+	var cfg struct {
+		Listen string `ccl:"listen"`
+	}
+	if err := (MergeOptions{}).Merge(&cfg, got...); err != nil {
+		t.Fatalf("Merge failed: %s", err)
+	}
+	if cfg.Listen != ":8080" {
+		t.Errorf("Merge set listen to %q, want %q", cfg.Listen, ":8080")
+	}
+}
+
+func TestWriteBundle_Error(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc   string
+		layers []Layer
+		want   string
+	}{{
+		desc:   "NoName",
+		layers: []Layer{{Name: ""}},
+		want:   `invalid document name ""`,
+	}, {
+		desc:   "Newline",
+		layers: []Layer{{Name: "a\nb"}},
+		want:   `invalid document name "a\nb"`,
+	}, {
+		desc:   "Duplicate",
+		layers: []Layer{{Name: "a"}, {Name: "a"}},
+		want:   `duplicate document "a"`,
+	}, {
+		desc:   "Separator",
+		layers: []Layer{{Name: "a", Data: []byte("s: \"\"\"\n--- b\n\"\"\"")}},
+		want:   `document "a" has a line that starts with ---`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if err := WriteBundle(new(bytes.Buffer), tc.layers); err == nil || err.Error() != tc.want {
+				t.Errorf("WriteBundle returned error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -32,6 +32,10 @@
 // Leading zeros are not permitted in decimal numbers, due to potential
 // confusion with octal (which is not supported).
 //
+// Infinity and NaN can't be written, unless they're enabled with
+// [UnmarshalOptions.AllowNonFinite] in which case they're written as inf,
+// -inf, and nan.
+//
 // As a lexical matter, numbers must be separated from subsequent field names by
 // intervening whitespace or comments:
 //
@@ -55,8 +59,12 @@
 //	'a multiline
 //	string'
 //
-// Carriage returns (0x0d) are discarded from the string value. If you need a
-// string to contain carriage return, use the \r escape sequence.
+// A carriage return (0x0d) before a newline is discarded from the string
+// value, so that a multiline string has the same value whether the file was
+// written with Unix or Windows line endings. It's kept instead with
+// [UnmarshalOptions.PreserveCarriageReturns]. A carriage return that isn't
+// before a newline is an error. If you need a string to contain carriage
+// return, use the \r escape sequence.
 //
 // Backslash characters inside a string are interpreted as an escape sequence.
 // Any escape sequence not described below is an error. The escape sequences
@@ -80,6 +88,9 @@
 //	\unnnn        unicode code point U+nnnn
 //	\Unnnnnnnn    unicode code point U+nnnnnnnn (UTF8)
 //
+// The \? and octal escapes, which few other languages have, can be rejected
+// with [UnmarshalOptions.StrictEscapes].
+//
 // As an extension to the C11 escapes, a backslash immediately before a newline
 // character (0x0a) will remove the newline character from the resulting string
 // (and for you Microsoft Windows users, backslash followed by \r\n is
@@ -97,6 +108,9 @@
 //	# equivalent to
 //	'multiple strings concatenated'
 //
+// Since a missing comma in a list of strings also concatenates them, this can
+// be made an error with [UnmarshalOptions.DisableStringConcatenation].
+//
 // # Bool
 //
 // Bool values can be true or false (classic).
@@ -125,14 +139,18 @@
 //
 //	{key1: "value1" key2: "value2"}
 //
-// Keys can be alphanumeric or use underscore; no other characters are
-// permitted. Values can be any of the value types here described. Key-value
-// pairs must be written with a : between the key and value, except when the
-// value is syntactically a message (in that case the colon is optional)
+// Keys can be alphanumeric or use underscore. A key that needs any other
+// characters can be written as a string instead, which is mostly useful when
+// decoding into a map. A string followed by : or { is always a key, rather
+// than being concatenated with the string before it (see above). Values can be
+// any of the value types here described. Key-value pairs must be written with
+// a : between the key and value, except when the value is syntactically a
+// message (in that case the colon is optional)
 //
 //	{
 //	  key1: "value1"
 //	  key2 {}
+//	  "example.com": "value3"
 //	}
 //
 // As a special case, when a key is written more than once in a message, it's
@@ -154,19 +172,46 @@
 //
 // This package is not designed to be hardened against adversarial inputs.
 // Unmarshal may consume significant resources and should only be called on
-// trusted hand-written configuration files.
+// trusted hand-written configuration files. [UnmarshalOptions] has some limits
+// that can help contain the damage if you really must decode untrusted input.
+// Documents larger than [MaxSize] are always rejected with a [TooLargeError].
+//
+// # Compatibility
+//
+// The language described here and [Unmarshal] are stable: documents that
+// decode today will keep decoding to the same values, and Unmarshal won't
+// change in incompatible ways without a new major version. Error messages
+// may be reworded, so programs shouldn't match on the text of errors.
+//
+// The rest of the API, such as [Marshal], [Decoder], [Encoder], the option
+// structs, [MergeOptions.Merge], and the syntax tree used by tools ([Parse],
+// [Node], [Format], [FormatEdited], [Tokens], and [ParseEvents]), is new and
+// may still change until it has shipped in a release. After that it is
+// stable in the same way, except that options and fields of Node may be
+// added and formatting may change in minor ways. The syntax tree stays in
+// this package rather than a separate ast package because [Marshal] is
+// built on it.
+//
+// The packages under x/, such as x/cclwkt and x/cclschema, are experimental
+// and may change between minor versions.
 package ccl
 
 import (
 	"bytes"
+	"context"
 	"encoding"
 	"encoding/base64"
 	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"math"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
@@ -174,88 +219,504 @@ import (
 type syntaxError struct {
 	line, col int
 	reason    string
+	// err is the error returned by UnmarshalText, if there was one.
+	err error
 }
 
 func newSyntaxError(data []byte, idx int, reason string, args ...any) error {
-	line, col := 1, 1
-	for _, b := range data[:idx] {
-		if b == '\n' {
-			line++
-			col = 1
-		} else {
-			col++
-		}
-	}
-	return &syntaxError{line, col, fmt.Sprintf(reason, args...)}
+	line, col := Position(data, idx)
+	return &syntaxError{line: line, col: col, reason: fmt.Sprintf(reason, args...)}
 }
 
 func (e *syntaxError) Error() string {
 	return fmt.Sprintf("%d:%d syntax error: %s", e.line, e.col, e.reason)
 }
 
+func (e *syntaxError) Unwrap() error {
+	return e.err
+}
+
+// MaxSize is the size in bytes of the largest document that this package
+// reads. Larger documents are rejected with a [TooLargeError] before they're
+// parsed. The limit keeps byte offsets, line numbers, and columns well within
+// the range of an int, even on 32-bit platforms.
+const MaxSize = 1<<31 - 1
+
+// A TooLargeError is returned for a document that's larger than [MaxSize].
+type TooLargeError struct {
+	// Size is the size of the document in bytes. If the document was read
+	// from an io.Reader, it's only known to be at least this large.
+	Size int64
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("document of %d bytes is larger than the maximum of %d bytes", e.Size, MaxSize)
+}
+
+// checkSize returns a TooLargeError if a document of n bytes is too large.
+func checkSize(n int64) error {
+	if n > MaxSize {
+		return &TooLargeError{Size: n}
+	}
+	return nil
+}
+
 type structField struct {
 	ty   reflect.Type
 	name string
 }
 
-func fieldMap(out map[structField]int, types map[reflect.Type]bool, s reflect.Type) error {
+// tagOptions holds the options of a ccl struct tag, which follow the name
+// after commas.
+type tagOptions struct {
+	// percent allows percent literals such as 2.5%.
+	percent bool
+	// merge is the strategy for merging the field over an earlier value.
+	merge mergeStrategy
+	// explicit requires a bool field to be written in every message that
+	// has it, even though false is its zero value.
+	explicit bool
+	// enum, if not empty, lists the values that a string field may have.
+	enum []string
+	// flags, if not empty, names the bits of an integer field, so that it
+	// can be written as a list of names.
+	flags []bitFlag
+	// unit, if not zero, is the unit of the numbers written in a duration
+	// field, and unitName is its name.
+	unit     time.Duration
+	unitName string
+}
+
+// durationUnits holds the units allowed by the unit option.
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// A bitFlag is a named bit, or bits, of an integer field with the flags option.
+type bitFlag struct {
+	name  string
+	value uint64
+}
+
+// A mergeStrategy says how a field written in a config combines with the
+// value it already has from an earlier layer, as with [LoadWithDefaults].
+type mergeStrategy uint8
+
+const (
+	// mergeDefault merges messages and maps field by field, and replaces
+	// everything else, including lists, unless MergeOptions.AppendLists is
+	// set.
+	mergeDefault mergeStrategy = iota
+	// mergeReplace replaces the earlier value as a whole.
+	mergeReplace
+	// mergeAppend appends the values of a repeated field to the earlier
+	// ones.
+	mergeAppend
+	// mergeDeep merges a message or map field by field.
+	mergeDeep
+)
+
+// A fieldInfo describes a struct field that appears in ccl documents.
+type fieldInfo struct {
+	index int
+	tag   tagOptions
+}
+
+// parseTag returns the name and options of a struct field, or "" if the
+// field is ignored.
+func parseTag(field reflect.StructField) (string, tagOptions, error) {
+	var opts tagOptions
+	if !field.IsExported() {
+		return "", opts, nil
+	}
+	tag, ok := field.Tag.Lookup("ccl")
+	if !ok {
+		return field.Name, opts, nil
+	}
+	if tag == "-" {
+		return "", opts, nil
+	}
+	name, rest, _ := strings.Cut(tag, ",")
+	for opt := range strings.FieldsFuncSeq(rest, func(r rune) bool { return r == ',' }) {
+		if values, ok := strings.CutPrefix(opt, "enum="); ok {
+			t := indirect(field.Type)
+			if t.Kind() == reflect.Slice {
+				t = indirect(t.Elem())
+			}
+			if t.Kind() != reflect.String {
+				return "", opts, fmt.Errorf("option %q needs a string field", opt)
+			}
+			if values == "" {
+				return "", opts, fmt.Errorf("option %q needs at least one value", opt)
+			}
+			opts.enum = strings.Split(values, "|")
+			continue
+		}
+		if values, ok := strings.CutPrefix(opt, "flags="); ok {
+			if _, _, ok := intLimits(indirect(field.Type).Kind()); !ok {
+				return "", opts, fmt.Errorf("option %q needs an integer field", opt)
+			}
+			for f := range strings.SplitSeq(values, "|") {
+				name, value, _ := strings.Cut(f, ":")
+				n, err := strconv.ParseUint(value, 0, 64)
+				if name == "" || err != nil {
+					return "", opts, fmt.Errorf("option %q: flag %q should be written as NAME:value", opt, f)
+				}
+				opts.flags = append(opts.flags, bitFlag{name, n})
+			}
+			continue
+		}
+		if name, ok := strings.CutPrefix(opt, "unit="); ok {
+			t := indirect(field.Type)
+			if t.Kind() == reflect.Slice {
+				t = t.Elem()
+			}
+			if t.Kind() != reflect.Int64 {
+				return "", opts, fmt.Errorf("option %q needs a time.Duration field", opt)
+			}
+			unit, ok := durationUnits[name]
+			if !ok {
+				return "", opts, fmt.Errorf("option %q: unknown unit %q, want one of ns, us, ms, s, m, or h", opt, name)
+			}
+			opts.unit, opts.unitName = unit, name
+			continue
+		}
+		switch opt {
+		case "percent":
+			opts.percent = true
+		case "merge=replace":
+			opts.merge = mergeReplace
+		case "merge=append":
+			if !isRepeatedType(field.Type) {
+				return "", opts, fmt.Errorf("option %q needs a slice field", opt)
+			}
+			opts.merge = mergeAppend
+		case "merge=deep":
+			if t := indirect(field.Type); t.Kind() != reflect.Struct && t.Kind() != reflect.Map {
+				return "", opts, fmt.Errorf("option %q needs a struct or map field", opt)
+			}
+			opts.merge = mergeDeep
+		case "explicit":
+			if indirect(field.Type).Kind() != reflect.Bool {
+				return "", opts, fmt.Errorf("option %q needs a bool field", opt)
+			}
+			opts.explicit = true
+		default:
+			return "", opts, fmt.Errorf("unknown option %q", opt)
+		}
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, opts, nil
+}
+
+// A StructField describes a field of a Go struct that's read by [Unmarshal]
+// and written by [Marshal].
+type StructField struct {
+	// Name is the key of the field in a ccl document.
+	Name  string
+	Field reflect.StructField
+	// Explicit is set if the field has the explicit option, so it must
+	// always be written.
+	Explicit bool
+	// Enum holds the values allowed by the field's enum option, if it has
+	// one.
+	Enum []string
+	// Flags holds the names in the field's flags option, if it has one.
+	Flags []string
+}
+
+// TypeFields returns the fields of the struct type t that appear in ccl
+// documents, in the order they're declared. It's intended for tools that
+// describe Go types, such as schema generators. The struct tags of t are
+// checked in the same way as by [Unmarshal].
+func TypeFields(t reflect.Type) ([]StructField, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("type %s is not a struct", t)
+	}
+	var fields []StructField
+	seen := make(map[string]bool)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, tag, err := parseTag(field)
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %s: %w", field.Name, t, err)
+		}
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("multiple fields with name %q", name)
+		}
+		seen[name] = true
+		sf := StructField{Name: name, Field: field, Explicit: tag.explicit, Enum: tag.enum}
+		for _, f := range tag.flags {
+			sf.Flags = append(sf.Flags, f.name)
+		}
+		fields = append(fields, sf)
+	}
+	return fields, nil
+}
+
+// fieldMap adds the fields of the struct type s, and of any structs nested
+// in it, to out. Fields are looked up by the type of the struct they're in,
+// since a struct's tags are the same wherever it's used; the options that
+// depend on where it's used, such as merge, are on the parent's field and
+// are kept with it. path holds the names of the fields that s was reached
+// through, so that a problem with a nested struct names the field it's in.
+func fieldMap(out map[structField]fieldInfo, types map[reflect.Type]bool, s reflect.Type, path ...string) error {
 	if types[s] {
 		// Already processed
 		return nil
 	}
 	types[s] = true
+	wrap := func(err error) error {
+		if len(path) == 0 {
+			return err
+		}
+		return fmt.Errorf("field %q: %w", strings.Join(path, "."), err)
+	}
 	for i := range s.NumField() {
 		field := s.Field(i)
-		if !field.IsExported() {
-			continue
+		fieldName, tag, err := parseTag(field)
+		if err != nil {
+			return wrap(err)
 		}
-		fieldName := field.Name
-		if tag, ok := field.Tag.Lookup("ccl"); ok {
-			var opts string
-			fieldName, opts, _ = strings.Cut(tag, ",")
-			if fieldName == "-" {
-				continue
-			}
-			for opt := range strings.FieldsFuncSeq(opts, func(r rune) bool { return r == ',' }) {
-				return fmt.Errorf("unknown option %q", opt)
-			}
+		if fieldName == "" {
+			continue
 		}
 		if _, ok := out[structField{s, fieldName}]; ok {
-			return fmt.Errorf("multiple fields with name %q", fieldName)
+			return wrap(fmt.Errorf("multiple fields with name %q", fieldName))
 		}
-		out[structField{s, fieldName}] = i
-		if field.Type.Kind() == reflect.Struct {
-			if err := fieldMap(out, types, field.Type); err != nil {
-				return err
-			}
-		} else if (field.Type.Kind() == reflect.Pointer || field.Type.Kind() == reflect.Slice) && field.Type.Elem().Kind() == reflect.Struct {
-			if err := fieldMap(out, types, field.Type.Elem()); err != nil {
-				return err
-			}
-		} else if field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Pointer && field.Type.Elem().Elem().Kind() == reflect.Struct {
-			if err := fieldMap(out, types, field.Type.Elem().Elem()); err != nil {
-				return err
-			}
+		out[structField{s, fieldName}] = fieldInfo{i, tag}
+		if err := fieldMapElem(out, types, field.Type, append(path[:len(path):len(path)], fieldName)...); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+// maxPointers is the most levels of pointers that a field's type can have,
+// as in ****T. It rules out recursive pointer types such as
+// "type P *P", which would otherwise never be done being dereferenced.
+const maxPointers = 4
+
+// fieldMapElem adds the fields of any structs that can be nested inside a
+// value of type t.
+func fieldMapElem(out map[structField]fieldInfo, types map[reflect.Type]bool, t reflect.Type, path ...string) error {
+	if factory(t) != nil {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return fieldMap(out, types, t, path...)
+	case reflect.Pointer:
+		elem := indirect(t)
+		if elem.Kind() == reflect.Pointer {
+			return fmt.Errorf("field %q: type %s has more than %d levels of pointers", strings.Join(path, "."), t, maxPointers)
+		}
+		return fieldMapElem(out, types, elem, path...)
+	case reflect.Slice, reflect.Map:
+		return fieldMapElem(out, types, t.Elem(), path...)
+	}
+	return nil
+}
+
+// explicitCache holds the names of the fields of each struct type with the
+// explicit option.
+var explicitCache sync.Map // map[reflect.Type][]string
+
+// explicitFields returns the names of the fields of the struct type t with
+// the explicit option. The tags of t must have been checked by fieldMap.
+func explicitFields(t reflect.Type) []string {
+	if names, ok := explicitCache.Load(t); ok {
+		return names.([]string)
+	}
+	var names []string
+	for i := range t.NumField() {
+		if name, tag, _ := parseTag(t.Field(i)); name != "" && tag.explicit {
+			names = append(names, name)
+		}
+	}
+	explicitCache.Store(t, names)
+	return names
+}
+
 type parser struct {
 	lexer    lexer
 	tok      []byte
 	err      error
 	data     []byte
 	i        int
-	fieldMap map[structField]int
+	fieldMap map[structField]fieldInfo
+	opts     UnmarshalOptions
+
+	allocated int
+	tokens    int
+	deadline  time.Time
+	depth     int
+	stats     Stats
+	// seenFree holds maps that can be reused by newSeen.
+	seenFree []map[string]bool
+
+	// If recovering is set, Parse records syntax errors in errs and carries on
+	// after them instead of stopping.
+	recovering bool
+	errs       []error
+
+	// If overlay is set, the document is decoded over the values of an
+	// earlier one, so repeated fields replace the values they already have
+	// instead of being appended to, unless appendLists is also set.
+	overlay     bool
+	appendLists bool
+	// If provenance is non-nil, the position of each field is recorded in
+	// it, for the layer with the given name.
+	provenance Provenance
+	layer      string
+	// If explicit is non-nil, fields with the explicit option that are
+	// missing from a message aren't an error. Instead, the path of each
+	// one is recorded in it as false, unless it's already there, and each
+	// one that's written is recorded as true, so that the layers of a
+	// merged config can be checked together.
+	explicit map[string]bool
+
+	// path holds the names of the fields being parsed, from the top
+	// level down, for error messages.
+	path [][]byte
+
+	// prevEnd is the end of the last token returned by next, and
+	// nextComment is the index of the first comment in lexer.comments that
+	// hasn't been attached to a Node yet. They're only used by Parse.
+	prevEnd     int
+	nextComment int
+
+	// logger is UnmarshalOptions.Logger if it's enabled for debug logs,
+	// or nil. traceOff and traceLine are the last offset that was traced
+	// and its line, so that positions can be found without rescanning the
+	// document.
+	logger    *slog.Logger
+	traceOff  int
+	traceLine int
+}
+
+func newParser(data []byte, fields map[structField]fieldInfo, opts UnmarshalOptions) *parser {
+	p := &parser{lexer: lexer{data: data}, data: data, fieldMap: fields, opts: opts}
+	if opts.Timeout > 0 {
+		p.deadline = time.Now().Add(opts.Timeout)
+	}
+	if opts.Logger != nil && opts.Logger.Enabled(context.Background(), slog.LevelDebug) {
+		p.logger = opts.Logger
+		p.traceLine = 1
+	}
+	return p
+}
+
+// newSeen returns an empty map for tracking the fields seen in a message.
+// It should be returned with freeSeen when the message is done.
+func (p *parser) newSeen() map[string]bool {
+	if n := len(p.seenFree); n > 0 {
+		seen := p.seenFree[n-1]
+		p.seenFree = p.seenFree[:n-1]
+		return seen
+	}
+	return make(map[string]bool)
+}
+
+func (p *parser) freeSeen(seen map[string]bool) {
+	clear(seen)
+	p.seenFree = append(p.seenFree, seen)
+}
+
+// enter and leave track the nesting depth of messages and lists. enter
+// returns an error if the depth is over UnmarshalOptions.MaxDepth.
+func (p *parser) enter() error {
+	p.depth++
+	p.stats.MaxDepth = max(p.stats.MaxDepth, p.depth)
+	if p.opts.MaxDepth > 0 && p.depth > p.opts.MaxDepth {
+		return p.error("document is nested more than %d deep", p.opts.MaxDepth)
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
 }
 
 func (p *parser) error(reason string, args ...any) error {
 	return newSyntaxError(p.data, p.i, reason, args...)
 }
 
+func (p *parser) errorAt(i int, reason string, args ...any) error {
+	return newSyntaxError(p.data, i, reason, args...)
+}
+
+// warn records a warning at offset i, if the options ask for warnings.
+func (p *parser) warn(i int, format string, args ...any) {
+	if p.opts.Warnings == nil {
+		return
+	}
+	line, col := Position(p.data, i)
+	*p.opts.Warnings = append(*p.opts.Warnings, Warning{Layer: p.layer, Line: line, Col: col, Message: fmt.Sprintf(format, args...)})
+}
+
+// trace logs a debug message about the document at offset i, if the options
+// ask for tracing.
+func (p *parser) trace(i int, msg string, attrs ...slog.Attr) {
+	if p.logger == nil {
+		return
+	}
+	if i >= p.traceOff {
+		p.traceLine += bytes.Count(p.data[p.traceOff:i], []byte("\n"))
+	} else {
+		p.traceLine -= bytes.Count(p.data[i:p.traceOff], []byte("\n"))
+	}
+	p.traceOff = i
+	col := i - bytes.LastIndexByte(p.data[:i], '\n')
+	attrs = append([]slog.Attr{slog.String("pos", fmt.Sprintf("%d:%d", p.traceLine, col))}, attrs...)
+	if p.layer != "" {
+		attrs = append(attrs, slog.String("layer", p.layer))
+	}
+	p.logger.LogAttrs(context.Background(), slog.LevelDebug, msg, attrs...)
+}
+
+// textError wraps an error returned by UnmarshalText for the value at offset
+// i with its position and the path of its field.
+func (p *parser) textError(i int, err error) error {
+	e := p.errorAt(i, "field %q: %s", bytes.Join(p.path, []byte(".")), err).(*syntaxError)
+	e.err = err
+	return e
+}
+
 var errEOF = errors.New("premature EOF")
 
+// deadlineInterval is how many tokens are parsed between checks of
+// UnmarshalOptions.Timeout, so that we're not constantly reading the clock.
+const deadlineInterval = 256
+
+// alloc records that n bytes are about to be allocated in the output value.
+func (p *parser) alloc(n int) error {
+	p.allocated += n
+	if p.opts.MaxBytes > 0 && p.allocated > p.opts.MaxBytes {
+		return p.error("decoded value exceeds %d bytes", p.opts.MaxBytes)
+	}
+	return nil
+}
+
+// appendZero appends a zero value to a slice.
+func (p *parser) appendZero(slice reflect.Value) error {
+	if err := p.alloc(int(slice.Type().Elem().Size())); err != nil {
+		return err
+	}
+	slice.Set(reflect.Append(slice, reflect.Zero(slice.Type().Elem())))
+	return nil
+}
+
 func (p *parser) peek() ([]byte, error) {
 	if p.err != nil || p.tok != nil {
 		return p.tok, p.err
@@ -266,6 +727,14 @@ func (p *parser) peek() ([]byte, error) {
 		return nil, p.err
 	}
 	p.i = i
+	p.tokens++
+	if p.logger != nil {
+		p.trace(i, "ccl token", slog.String("token", string(tok)))
+	}
+	if !p.deadline.IsZero() && p.tokens%deadlineInterval == 0 && time.Now().After(p.deadline) {
+		p.err = p.error("parse took longer than %s", p.opts.Timeout)
+		return nil, p.err
+	}
 	p.tok = tok
 	return p.tok, nil
 }
@@ -276,6 +745,7 @@ func (p *parser) nextEOF() ([]byte, error) {
 		return nil, err
 	}
 	p.tok = nil
+	p.prevEnd = p.i + len(tok)
 	return tok, nil
 }
 
@@ -328,6 +798,30 @@ func checkNum(b []byte) bool {
 	return len(b) == 0
 }
 
+// isFloat reports whether a number literal has a fractional part or exponent.
+func isFloat(b []byte) bool {
+	if b[0] == '-' || b[0] == '+' {
+		b = b[1:]
+	}
+	if len(b) > 1 && b[0] == '0' && (b[1] == 'x' || b[1] == 'X') {
+		return false
+	}
+	return bytes.ContainsAny(b, ".eE")
+}
+
+// nonFinite parses the literals allowed by UnmarshalOptions.AllowNonFinite.
+func nonFinite(tok []byte) (float64, bool) {
+	switch string(tok) {
+	case "inf", "+inf":
+		return math.Inf(1), true
+	case "-inf":
+		return math.Inf(-1), true
+	case "nan":
+		return math.NaN(), true
+	}
+	return 0, false
+}
+
 type integer struct {
 	n   uint64
 	sgn int8
@@ -377,12 +871,50 @@ func (p *parser) parseFloat(nBytes []byte) (float64, error) {
 	return n, nil
 }
 
+// isPercent reports whether a number literal is a percentage, such as 2.5%.
+func isPercent(b []byte) bool {
+	return b[len(b)-1] == '%'
+}
+
+// parsePercent parses a percentage and returns its value divided by 100.
+// The division is done by adjusting the exponent, so 0.1% is exactly the
+// same float as .001.
+func (p *parser) parsePercent(tok []byte) (float64, error) {
+	num := tok[:len(tok)-1]
+	if len(num) == 0 || !checkNum(num) {
+		return 0, p.error("invalid number")
+	}
+	exp := 0
+	if i := bytes.IndexAny(num, "eE"); i >= 0 {
+		var err error
+		if exp, err = strconv.Atoi(string(num[i+1:])); err != nil {
+			// The exponent is huge, so the result is 0 or out of range
+			// either way.
+			exp = 1e9
+			if num[i+1] == '-' {
+				exp = -1e9
+			}
+		}
+		num = num[:i]
+	}
+	n, err := strconv.ParseFloat(fmt.Sprintf("%se%d", num, exp-2), 64)
+	if err != nil {
+		return 0, p.error("%s", err)
+	}
+	return n, nil
+}
+
 func (p *parser) unescape(rawStr []byte) ([]byte, error) {
 	tokStart := p.i
 	var escaped []byte
 	for i := 0; i < len(rawStr); i++ {
-		p.i++
+		// Errors are reported at the character or escape sequence that
+		// starts at rawStr[i], which comes after the opening quote.
+		p.i = tokStart + 1 + i
 		if i+1 < len(rawStr) && rawStr[i] == '\r' && rawStr[i+1] == '\n' {
+			if p.opts.PreserveCarriageReturns {
+				escaped = append(escaped, '\r')
+			}
 			continue
 		}
 		if rawStr[i] != '\\' {
@@ -402,6 +934,9 @@ func (p *parser) unescape(rawStr []byte) ([]byte, error) {
 		case '"':
 			b = []byte(`"`)
 		case '?':
+			if p.opts.StrictEscapes {
+				return nil, p.error("escape sequence %q isn't allowed; write \"?\" instead", rawStr[i-1:i+1])
+			}
 			b = []byte("?")
 		case '\\':
 			b = []byte(`\`)
@@ -468,6 +1003,9 @@ func (p *parser) unescape(rawStr []byte) ([]byte, error) {
 			if err != nil {
 				return nil, p.error("invalid octal escape %q: %s", rawStr[i-1:end], err)
 			}
+			if p.opts.StrictEscapes {
+				return nil, p.error("octal escape %q isn't allowed; write %q instead", rawStr[i-1:end], fmt.Sprintf(`\x%02x`, n))
+			}
 			i = end - 1
 			b = []byte{byte(n)}
 		}
@@ -481,63 +1019,155 @@ func (p *parser) unescape(rawStr []byte) ([]byte, error) {
 }
 
 func (p *parser) parseString(tok []byte) (string, error) {
+	s, _, err := p.parseStrings(tok)
+	return s, err
+}
+
+// parseStrings is like parseString, but also reports whether the string was
+// concatenated from more than one literal.
+func (p *parser) parseStrings(tok []byte) (string, bool, error) {
 	s := new(strings.Builder)
-	for {
+	for i := 0; ; i++ {
 		ss, err := p.unescape(tok[1 : len(tok)-1])
 		if err != nil {
-			return "", err
+			return "", false, err
 		}
 		s.Write(ss)
 		nextTok, err := p.peek()
-		if err != nil || nextTok[0] != '\'' && nextTok[0] != '"' {
-			return s.String(), nil
+		if err != nil || nextTok[0] != '\'' && nextTok[0] != '"' || p.quotedKey() {
+			return s.String(), i > 0, nil
 		}
 		p.next()
+		if p.opts.DisableStringConcatenation {
+			return "", false, p.error("strings can't be concatenated; if they're separate values, add a comma between them")
+		}
 		tok = nextTok
 	}
 }
 
+// quotedKey reports whether the peeked token is a string being used as a
+// key, which is the case when it's followed by : or {.
+func (p *parser) quotedKey() bool {
+	l := p.lexer
+	_, tok, err := l.next()
+	return err == nil && (tok[0] == ':' || tok[0] == '{')
+}
+
 func (p *parser) parseMessage(out reflect.Value, field []byte) error {
+	start := p.i
+	// Setting a pointer to an empty message has an effect, so it's only
+	// suspicious for other values.
+	ptr := out.Kind() == reflect.Pointer
 	out = setPtr(out)
-	if out.Kind() != reflect.Struct {
+	switch out.Kind() {
+	case reflect.Struct:
+	case reflect.Map:
+		if out.Type().Key().Kind() != reflect.String && !reflect.PointerTo(out.Type().Key()).Implements(textUnmarshalerType) {
+			return p.error("field %q should be a map with string keys", field)
+		}
+		if out.IsNil() {
+			out.Set(reflect.MakeMap(out.Type()))
+		}
+	default:
 		return p.error("field %q should be a struct", field)
 	}
-	seen := make(map[string]bool)
-	for {
+	if err := p.enter(); err != nil {
+		return err
+	}
+	defer p.leave()
+	seen := p.newSeen()
+	defer p.freeSeen(seen)
+	for i := 0; ; i++ {
 		tok, err := p.next()
-		if err != nil || tok[0] == '}' {
+		if err != nil {
 			return err
 		}
+		if tok[0] == '}' {
+			if i == 0 && !ptr {
+				p.warn(start, "field %q is an empty message, which has no effect", field)
+			}
+			if out.Kind() == reflect.Struct {
+				return p.checkExplicit(out, seen, p.i)
+			}
+			return nil
+		}
 		if err := p.parseFieldVal(out, seen, tok); err != nil {
 			return err
 		}
 	}
 }
 
-func (p *parser) parseVal(fieldVal reflect.Value, tok, field []byte) error {
+func (p *parser) parseVal(fieldVal reflect.Value, tok, field []byte, tag tagOptions) error {
+	fieldVal = singlePtr(fieldVal)
+	if ok, err := p.parseFactory(fieldVal, tok); ok {
+		return err
+	}
+	if t := indirect(fieldVal.Type()); t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		return p.parseAny(setPtr(fieldVal), tok)
+	}
 	switch tok[0] {
 	case '[':
+		if len(tag.flags) > 0 {
+			return p.parseFlags(fieldVal, tok, field, tag)
+		}
 		return p.error("invalid repeated value")
 	case '{':
 		return p.parseMessage(fieldVal, field)
 	case '\'', '"':
+		if len(tag.flags) > 0 {
+			return p.parseFlags(fieldVal, tok, field, tag)
+		}
+		start := p.i
 		s, err := p.parseString(tok)
 		if err != nil {
 			return err
 		}
-		if _, ok := fieldVal.Interface().(encoding.TextUnmarshaler); ok {
+		if tag.unit != 0 {
+			// A field with a unit can also be written as a duration with
+			// its own unit.
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return p.errorAt(start, "field %q: invalid duration %q, want a number of %s or a number with a unit, such as \"1.5s\"", field, s, tag.unitName)
+			}
+			setPtr(fieldVal).SetInt(int64(d))
+			return nil
+		}
+		if err := p.alloc(len(s)); err != nil {
+			return err
+		}
+		p.stats.StringBytes += len(s)
+		if ok, err := p.unmarshalText(fieldVal, []byte(s), start); ok {
+			return err
+		}
+		if _, ok := fieldVal.Interface().(flag.Value); ok {
 			if fieldVal.Kind() == reflect.Pointer && fieldVal.IsNil() {
 				fieldVal.Set(reflect.New(fieldVal.Type().Elem()))
 			}
-			return fieldVal.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+			if err := fieldVal.Interface().(flag.Value).Set(s); err != nil {
+				return p.textError(start, err)
+			}
+			return nil
 		}
-		if unmarshaler, ok := fieldVal.Addr().Interface().(encoding.TextUnmarshaler); ok {
-			return unmarshaler.UnmarshalText([]byte(s))
+		if value, ok := fieldVal.Addr().Interface().(flag.Value); ok {
+			if err := value.Set(s); err != nil {
+				return p.textError(start, err)
+			}
+			return nil
 		}
 		fieldVal := setPtr(fieldVal)
 		switch {
 		case fieldVal.Kind() == reflect.String:
+			if len(tag.enum) > 0 && !slices.Contains(tag.enum, s) {
+				return p.errorAt(start, "field %q: %s", field, enumError(s, tag.enum))
+			}
 			fieldVal.SetString(s)
+		case fieldVal.Kind() == reflect.Bool && p.opts.LooseBooleans:
+			b, ok := looseBool(s)
+			if !ok {
+				return p.errorAt(start, "field %q: %q isn't a boolean", field, s)
+			}
+			p.stats.LooseBooleans++
+			fieldVal.SetBool(b)
 		case fieldVal.Type() == reflect.TypeFor[[]byte]():
 			b, err := base64.StdEncoding.DecodeString(s)
 			if err != nil {
@@ -545,7 +1175,7 @@ func (p *parser) parseVal(fieldVal reflect.Value, tok, field []byte) error {
 			}
 			fieldVal.Set(reflect.ValueOf(b))
 		default:
-			return p.error("field %q should have type string (got %s)", field, fieldVal.Type())
+			return p.typeError(field, fieldVal.Type(), "string "+quoteLiteral(s))
 		}
 		return nil
 	}
@@ -555,7 +1185,58 @@ func (p *parser) parseVal(fieldVal reflect.Value, tok, field []byte) error {
 	case "false":
 		return p.unpackBool(fieldVal, false, field)
 	}
-	if bytes.ContainsAny(tok, ".eE") {
+	if tok[0] == '+' {
+		p.warn(p.i, "number %s is written with a leading +", tok)
+	}
+	if tag.unit == 0 && !tag.percent && len(tag.flags) == 0 {
+		// A type with its own text format, such as a duration that needs
+		// a unit, decides for itself which numbers it accepts.
+		if ok, err := p.unmarshalText(fieldVal, tok, p.i); ok {
+			return err
+		}
+	}
+	if t := fieldVal.Type(); t == reflect.TypeFor[Number]() || t == reflect.TypeFor[*Number]() {
+		if isPercent(tok) && !tag.percent {
+			return p.error("field %q doesn't allow percentages", field)
+		}
+		if _, err := Number(tok).Float64(); err != nil {
+			return p.error("%s", err)
+		}
+		setPtr(fieldVal).SetString(string(tok))
+		return nil
+	}
+	if isPercent(tok) {
+		if !tag.percent {
+			return p.error("field %q doesn't allow percentages", field)
+		}
+		n, err := p.parsePercent(tok)
+		if err != nil {
+			return err
+		}
+		fieldVal := setPtr(fieldVal)
+		switch fieldVal.Kind() {
+		case reflect.Float32, reflect.Float64:
+			fieldVal.SetFloat(n)
+		default:
+			return p.typeError(field, fieldVal.Type(), "number "+string(tok))
+		}
+		return nil
+	}
+	if tag.unit != 0 {
+		return p.parseUnit(fieldVal, tok, tag.unit)
+	}
+	if n, ok := nonFinite(tok); ok && p.opts.AllowNonFinite {
+		p.stats.NonFinite++
+		fieldVal := setPtr(fieldVal)
+		switch fieldVal.Kind() {
+		case reflect.Float32, reflect.Float64:
+			fieldVal.SetFloat(n)
+		default:
+			return p.typeError(field, fieldVal.Type(), "number "+string(tok))
+		}
+		return nil
+	}
+	if isFloat(tok) {
 		n, err := p.parseFloat(tok)
 		if err != nil {
 			return err
@@ -565,7 +1246,7 @@ func (p *parser) parseVal(fieldVal reflect.Value, tok, field []byte) error {
 		case reflect.Float32, reflect.Float64:
 			fieldVal.SetFloat(n)
 		default:
-			return p.error("field %q should have type float64 or float32", field)
+			return p.typeError(field, fieldVal.Type(), "number "+string(tok))
 		}
 		return nil
 	}
@@ -578,10 +1259,17 @@ func (p *parser) parseVal(fieldVal reflect.Value, tok, field []byte) error {
 	case reflect.Float32, reflect.Float64:
 		fieldVal.SetFloat(float64(n.sgn) * float64(n.n))
 		return nil
+	case reflect.Bool:
+		if p.opts.LooseBooleans && (n.n == 0 || n.n == 1 && n.sgn > 0) {
+			p.stats.LooseBooleans++
+			fieldVal.SetBool(n.n == 1)
+			return nil
+		}
+		return p.typeError(field, fieldVal.Type(), "number "+string(tok))
 	}
 	min, max, ok := intLimits(fieldVal.Kind())
 	if !ok {
-		return p.error("field %q should have type int", field)
+		return p.typeError(field, fieldVal.Type(), "number "+string(tok))
 	}
 	if n.sgn < 0 && n.n > min || n.sgn > 0 && n.n > max {
 		return p.error("number %d is out of range for %s", n, fieldVal.Kind())
@@ -594,7 +1282,11 @@ func (p *parser) parseVal(fieldVal reflect.Value, tok, field []byte) error {
 	return nil
 }
 
-func (p *parser) parseList(fieldVal reflect.Value, field []byte) error {
+func (p *parser) parseList(fieldVal reflect.Value, field []byte, tag tagOptions) error {
+	if err := p.enter(); err != nil {
+		return err
+	}
+	defer p.leave()
 	if fieldVal.IsNil() {
 		fieldVal.Set(reflect.MakeSlice(fieldVal.Type(), 0, 0))
 	}
@@ -612,28 +1304,235 @@ func (p *parser) parseList(fieldVal reflect.Value, field []byte) error {
 				return err
 			}
 		}
-		fieldVal.Set(reflect.Append(fieldVal, reflect.Zero(fieldVal.Type().Elem())))
-		if err := p.parseVal(fieldVal.Index(fieldVal.Len()-1), tok, field); err != nil {
+		if tok[0] == '[' {
+			return p.error("invalid repeated value")
+		}
+		if err := p.appendZero(fieldVal); err != nil {
+			return err
+		}
+		if err := p.parseVal(fieldVal.Index(fieldVal.Len()-1), tok, field, tag); err != nil {
+			return err
+		}
+	}
+}
+
+// parseUnit parses the number tok, which counts the given unit, into the
+// duration field fieldVal.
+func (p *parser) parseUnit(fieldVal reflect.Value, tok []byte, unit time.Duration) error {
+	fieldVal = setPtr(fieldVal)
+	if isFloat(tok) {
+		f, err := p.parseFloat(tok)
+		if err != nil {
 			return err
 		}
+		d := math.Round(f * float64(unit))
+		if d < math.MinInt64 || d >= math.MaxInt64 {
+			return p.error("duration %s is out of range", tok)
+		}
+		fieldVal.SetInt(int64(d))
+		return nil
+	}
+	n, err := p.parseInt(tok)
+	if err != nil {
+		return err
+	}
+	if n.n > math.MaxInt64/uint64(unit) {
+		return p.error("duration %s is out of range", tok)
+	}
+	fieldVal.SetInt(int64(n.sgn) * int64(n.n) * int64(unit))
+	return nil
+}
+
+// parseFlags parses the value of an integer field with the flags option,
+// which is a flag name or a list of them, and sets the field to the bitwise
+// OR of their values. tok is the first token of the value.
+func (p *parser) parseFlags(fieldVal reflect.Value, tok, field []byte, tag tagOptions) error {
+	fieldVal = setPtr(fieldVal)
+	names := make([]string, len(tag.flags))
+	for i, f := range tag.flags {
+		names[i] = f.name
+	}
+	var bits uint64
+	addFlag := func(tok []byte) error {
+		if tok[0] != '\'' && tok[0] != '"' {
+			return p.error("field %q: expecting a flag name", field)
+		}
+		start := p.i
+		s, err := p.parseString(tok)
+		if err != nil {
+			return err
+		}
+		i := slices.Index(names, s)
+		if i < 0 {
+			return p.errorAt(start, "field %q: %s", field, enumError(s, names))
+		}
+		bits |= tag.flags[i].value
+		return nil
+	}
+	if tok[0] != '[' {
+		if err := addFlag(tok); err != nil {
+			return err
+		}
+	} else {
+		if err := p.enter(); err != nil {
+			return err
+		}
+		defer p.leave()
+		for i := 0; ; i++ {
+			tok, err := p.next()
+			if err != nil {
+				return err
+			}
+			if tok[0] == ']' {
+				break
+			}
+			if i > 0 {
+				if tok[0] != ',' {
+					return p.error("expecting comma")
+				}
+				if tok, err = p.next(); err != nil {
+					return err
+				}
+				if tok[0] == ']' { // allow trailing comma
+					break
+				}
+			}
+			if err := addFlag(tok); err != nil {
+				return err
+			}
+		}
+	}
+	min, max, _ := intLimits(fieldVal.Kind())
+	if bits > max {
+		return p.error("flags %#x are out of range for %s", bits, fieldVal.Kind())
+	}
+	if min == 0 { // unsigned
+		fieldVal.SetUint(bits)
+	} else {
+		fieldVal.SetInt(int64(bits))
+	}
+	return nil
+}
+
+// parseKey parses the key of a field, which is either a bare word or a
+// string.
+func (p *parser) parseKey(tok []byte) ([]byte, error) {
+	switch b := tok[0]; {
+	case b == '\'' || b == '"':
+		key, err := p.parseString(tok)
+		return []byte(key), err
+	case b == '_' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z':
+		return tok, nil
 	}
+	return nil, p.error("expecting field")
 }
 
-func (p *parser) parseFieldVal(out reflect.Value, parsedFields map[string]bool, field []byte) error {
-	if b := field[0]; !(b == '_' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z') {
-		return p.error("expecting field")
+var (
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	flagValueType       = reflect.TypeFor[flag.Value]()
+)
+
+func (p *parser) parseFieldVal(out reflect.Value, parsedFields map[string]bool, tok []byte) error {
+	fieldPos := p.i
+	field, err := p.parseKey(tok)
+	if err != nil {
+		return err
 	}
-	fieldIdx, ok := p.fieldMap[structField{out.Type(), string(field)}]
+	if out.Kind() == reflect.Map {
+		var key reflect.Value
+		if reflect.PointerTo(out.Type().Key()).Implements(textUnmarshalerType) {
+			key = reflect.New(out.Type().Key())
+			if err := key.Interface().(encoding.TextUnmarshaler).UnmarshalText(field); err != nil {
+				return p.textError(fieldPos, err)
+			}
+			key = key.Elem()
+		} else {
+			key = reflect.ValueOf(string(field)).Convert(out.Type().Key())
+		}
+		elem := reflect.New(out.Type().Elem()).Elem()
+		if v := out.MapIndex(key); v.IsValid() {
+			elem.Set(v)
+		}
+		if err := p.parseFieldValue(elem, parsedFields, field, fieldPos, tagOptions{}); err != nil {
+			return err
+		}
+		out.SetMapIndex(key, elem)
+		return nil
+	}
+	info, ok := p.fieldMap[structField{out.Type(), string(field)}]
 	if !ok {
-		return p.error("no field named %q", field)
+		if p.opts.DiscardUnknown {
+			p.stats.UnknownFields++
+			p.trace(fieldPos, "ccl unknown field skipped", slog.String("field", string(field)))
+			return p.skipField()
+		}
+		return p.errorAt(fieldPos, "no field named %q", field)
+	}
+	return p.parseFieldValue(out.Field(info.index), parsedFields, field, fieldPos, info.tag)
+}
+
+// parseFieldValue parses the part of a field after its name into fieldVal.
+func (p *parser) parseFieldValue(fieldVal reflect.Value, parsedFields map[string]bool, field []byte, fieldPos int, tag tagOptions) (err error) {
+	if fieldVal.Kind() == reflect.Pointer && isRepeatedType(fieldVal.Type()) {
+		// A pointer to a slice is repeated like the slice.
+		fieldVal = setPtr(fieldVal)
 	}
-	fieldVal := out.Field(fieldIdx)
-	repeated := fieldVal.Kind() == reflect.Slice && fieldVal.Type() != reflect.TypeFor[[]byte]()
-	if !repeated {
-		if parsedFields[string(field)] {
-			return p.error("duplicate field %q but type is not repeated", field)
+	repeated := isRepeatedType(fieldVal.Type())
+	if parsedFields[string(field)] {
+		switch {
+		case !repeated && !p.opts.AllowDuplicates:
+			return p.errorAt(fieldPos, "duplicate field %q but type is not repeated", field)
+		case repeated && p.opts.DisallowRepeatedKeys:
+			return p.errorAt(fieldPos, "field %q is written more than once; write its values in one list instead", field)
+		}
+		if repeated {
+			p.stats.Duplicates++
+		} else {
+			p.stats.Overwritten++
 		}
-		parsedFields[string(field)] = true
+	}
+	replaced := 0 // the number of values from earlier layers that are replaced
+	if p.overlay && !parsedFields[string(field)] {
+		// This is the first time the field is written in the layer, so
+		// drop the value it had from the earlier layers if it's replaced.
+		switch {
+		case tag.merge == mergeReplace,
+			repeated && tag.merge == mergeDefault && !p.appendLists:
+			if repeated {
+				replaced = fieldVal.Len()
+			}
+			fieldVal.SetZero()
+			if p.provenance != nil {
+				p.provenance.remove(string(bytes.Join(append(p.path, field), []byte("."))))
+			}
+		}
+	}
+	parsedFields[string(field)] = true
+	p.stats.Fields++
+	p.path = append(p.path, field)
+	defer func() { p.path = p.path[:len(p.path)-1] }()
+	if tag.explicit && p.explicit != nil {
+		p.explicit[string(bytes.Join(p.path, []byte(".")))] = true
+	}
+	if p.provenance != nil {
+		line, col := Position(p.data, fieldPos)
+		p.provenance[string(bytes.Join(p.path, []byte(".")))] = Source{p.layer, line, col}
+	}
+	if p.opts.Ranges != nil {
+		path := string(bytes.Join(p.path, []byte(".")))
+		defer func() {
+			if err == nil {
+				p.opts.Ranges[path] = Range{fieldPos, p.prevEnd}
+			}
+		}()
+	}
+	if p.logger != nil {
+		path := string(bytes.Join(p.path, []byte(".")))
+		defer func() {
+			if err == nil && fieldVal.CanInterface() {
+				p.trace(fieldPos, "ccl field set", slog.String("field", path), slog.Any("value", fieldVal.Interface()))
+			}
+		}()
 	}
 	tok, err := p.next()
 	if err != nil {
@@ -651,20 +1550,95 @@ func (p *parser) parseFieldVal(out reflect.Value, parsedFields map[string]bool,
 	}
 	if repeated {
 		if tok[0] == '[' {
-			return p.parseList(fieldVal, field)
+			if err := p.parseList(fieldVal, field, tag); err != nil {
+				return err
+			}
+			if replaced > 0 && fieldVal.Len() == 0 {
+				p.warn(fieldPos, "empty list replaces the %d values of field %q from earlier layers", replaced, field)
+			}
+			return nil
 		}
-		fieldVal.Set(reflect.Append(fieldVal, reflect.Zero(fieldVal.Type().Elem())))
-		return p.parseVal(fieldVal.Index(fieldVal.Len()-1), tok, field)
+		if err := p.appendZero(fieldVal); err != nil {
+			return err
+		}
+		return p.parseVal(fieldVal.Index(fieldVal.Len()-1), tok, field, tag)
+	}
+	return p.parseVal(fieldVal, tok, field, tag)
+}
+
+// isRepeatedType reports whether a field of type t is repeated, so that it
+// can be written as a list or more than once. A pointer to a slice is
+// repeated like the slice. A slice type that's decoded from a string, such
+// as net.IP, isn't repeated.
+func isRepeatedType(t reflect.Type) bool {
+	t = indirect(t)
+	if t.Kind() != reflect.Slice || t == reflect.TypeFor[[]byte]() {
+		return false
+	}
+	pt := reflect.PointerTo(t)
+	return !pt.Implements(flagValueType) && !pt.Implements(textUnmarshalerType)
+}
+
+// indirect returns the type that t points to, through up to maxPointers
+// pointers, or t if it's not a pointer.
+func indirect(t reflect.Type) reflect.Type {
+	for i := 0; i < maxPointers && t.Kind() == reflect.Pointer; i++ {
+		t = t.Elem()
+	}
+	return t
+}
+
+// skipField parses the rest of a field that isn't decoded, after its name.
+func (p *parser) skipField() error {
+	tok, err := p.next()
+	if err != nil {
+		return err
+	}
+	switch tok[0] {
+	case '{':
+	case ':':
+		tok, err = p.next()
+		if err != nil {
+			return err
+		}
+	default:
+		return p.error("expecting colon")
 	}
-	return p.parseVal(fieldVal, tok, field)
+	_, err = p.parseNode(tok)
+	return err
+}
+
+// checkExplicit returns an error at offset end if a field of the struct out
+// with the explicit option isn't in seen, which holds the fields of its
+// message.
+func (p *parser) checkExplicit(out reflect.Value, seen map[string]bool, end int) error {
+	for _, name := range explicitFields(out.Type()) {
+		if seen[name] {
+			continue
+		}
+		path := string(bytes.Join(append(p.path[:len(p.path):len(p.path)], []byte(name)), []byte(".")))
+		if p.explicit != nil {
+			if _, ok := p.explicit[path]; !ok {
+				p.explicit[path] = false
+			}
+			continue
+		}
+		return p.errorAt(end, "field %q must be set explicitly", path)
+	}
+	return nil
 }
 
 func (p *parser) parse(out reflect.Value) error {
-	seen := make(map[string]bool)
+	seen := p.newSeen()
+	defer p.freeSeen(seen)
 	for {
 		tok, err := p.nextEOF()
 		if err != nil {
 			if err == errEOF {
+				if err := p.checkExplicit(out, seen, len(p.data)); err != nil {
+					return err
+				}
+				p.saveStats()
 				return nil
 			}
 			return err
@@ -675,14 +1649,69 @@ func (p *parser) parse(out reflect.Value) error {
 	}
 }
 
+// parseFrame is like parse, but if the document is a single message in
+// braces, it stops after the closing brace. It returns the number of bytes
+// of data that were parsed.
+func (p *parser) parseFrame(out reflect.Value) (int, error) {
+	if tok, err := p.peek(); err != nil || tok[0] != '{' {
+		if err := p.parse(out); err != nil {
+			return 0, err
+		}
+		return len(p.data), nil
+	}
+	p.next()
+	seen := p.newSeen()
+	defer p.freeSeen(seen)
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return 0, err
+		}
+		if tok[0] == '}' {
+			if err := p.checkExplicit(out, seen, p.i); err != nil {
+				return 0, err
+			}
+			p.saveStats()
+			return p.prevEnd, nil
+		}
+		if err := p.parseFieldVal(out, seen, tok); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// saveStats fills in UnmarshalOptions.Stats after a successful parse.
+func (p *parser) saveStats() {
+	if p.opts.Stats != nil {
+		*p.opts.Stats = p.stats
+		p.opts.Stats.Tokens = p.tokens
+	}
+}
+
+// setPtr returns the value that val points to, through any number of
+// pointers, setting the ones that are nil to new values. It returns val if
+// it's not a pointer.
 func setPtr(val reflect.Value) reflect.Value {
-	if val.Kind() != reflect.Pointer {
-		return val
+	for val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			val.Set(reflect.New(val.Type().Elem()))
+		}
+		val = val.Elem()
 	}
-	if val.IsNil() {
-		val.Set(reflect.New(val.Type().Elem()))
+	return val
+}
+
+// singlePtr is like setPtr, but stops at the last pointer, so that a value
+// of type **T becomes one of type *T. The rest of the parser only has to
+// handle one level of pointers.
+func singlePtr(val reflect.Value) reflect.Value {
+	for val.Kind() == reflect.Pointer && val.Type().Elem().Kind() == reflect.Pointer {
+		if val.IsNil() {
+			val.Set(reflect.New(val.Type().Elem()))
+		}
+		val = val.Elem()
 	}
-	return val.Elem()
+	return val
 }
 
 func intLimits(kind reflect.Kind) (min, max uint64, ok bool) {
@@ -712,10 +1741,113 @@ func intLimits(kind reflect.Kind) (min, max uint64, ok bool) {
 	}
 }
 
+// looseBool parses the strings allowed by UnmarshalOptions.LooseBooleans.
+func looseBool(s string) (b, ok bool) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "on":
+		return true, true
+	case "false", "no", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// enumError describes the string s, which isn't one of the values of an
+// enum, suggesting the value it's closest to if it looks like a typo.
+func enumError(s string, values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	msg := fmt.Sprintf("%q is not one of %s", s, strings.Join(quoted, ", "))
+	best, bestDist := "", math.MaxInt
+	for _, v := range values {
+		if d := editDistance(strings.ToLower(s), strings.ToLower(v)); d < bestDist {
+			best, bestDist = v, d
+		}
+	}
+	// Only suggest a value that's about as close as a typo would make it,
+	// where swapping two letters counts as two edits.
+	if bestDist <= max(2, len(best)/3) && bestDist < len(best) {
+		msg += fmt.Sprintf("; did you mean %q?", best)
+	}
+	return msg
+}
+
+// editDistance returns the number of single byte insertions, deletions, and
+// substitutions that turn a into b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := range len(a) {
+		cur[0] = i + 1
+		for j := range len(b) {
+			cost := 1
+			if a[i] == b[j] {
+				cost = 0
+			}
+			cur[j+1] = min(prev[j+1]+1, cur[j]+1, prev[j]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// typeError returns an error for a value that can't be stored in a field of
+// type t. what describes the value, as in `string "eighty"` or `number 1.5`.
+func (p *parser) typeError(field []byte, t reflect.Type, what string) error {
+	return p.error("field %q has type %s, got %s", field, t, what)
+}
+
+// quoteLiteral quotes the string s for an error message, cutting it short if
+// it's long.
+func quoteLiteral(s string) string {
+	const maxLen = 40
+	if len(s) <= maxLen {
+		return strconv.Quote(s)
+	}
+	i := maxLen
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return strconv.Quote(s[:i]) + "..."
+}
+
+// unmarshalText decodes text into fieldVal with UnmarshalText, and reports
+// whether its type implements [encoding.TextUnmarshaler]. An error from
+// UnmarshalText is reported at offset start.
+func (p *parser) unmarshalText(fieldVal reflect.Value, text []byte, start int) (bool, error) {
+	if _, ok := fieldVal.Interface().(encoding.TextUnmarshaler); ok {
+		if fieldVal.Kind() == reflect.Pointer && fieldVal.IsNil() {
+			fieldVal.Set(reflect.New(fieldVal.Type().Elem()))
+		}
+		if err := fieldVal.Interface().(encoding.TextUnmarshaler).UnmarshalText(text); err != nil {
+			return true, p.textError(start, err)
+		}
+		return true, nil
+	}
+	if unmarshaler, ok := fieldVal.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := unmarshaler.UnmarshalText(text); err != nil {
+			return true, p.textError(start, err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
 func (p *parser) unpackBool(fieldVal reflect.Value, b bool, field []byte) error {
 	fieldVal = setPtr(fieldVal)
 	if fieldVal.Kind() != reflect.Bool {
-		return p.error("field %q should have type bool", field)
+		if unmarshaler, ok := fieldVal.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if err := unmarshaler.UnmarshalText(strconv.AppendBool(nil, b)); err != nil {
+				return p.textError(p.i, err)
+			}
+			return nil
+		}
+		return p.typeError(field, fieldVal.Type(), "bool "+strconv.FormatBool(b))
 	}
 	fieldVal.SetBool(b)
 	return nil
@@ -733,15 +1865,35 @@ func (p *parser) unpackBool(fieldVal reflect.Value, b bool, field []byte) error
 // The following rules describe how ccl types are mapped to Go types:
 //
 //   - For a pointer type, the field will be set to a non-nil value and the
-//     value will be unmarshaled into the inner type.
+//     value will be unmarshaled into the inner type. The same goes for a
+//     pointer to a pointer, up to four levels of pointers, as in ****int.
+//     A pointer that's already non-nil isn't replaced; the value is
+//     unmarshaled into the value it points to, so that defaults set
+//     beforehand are kept unless the document overrides them. The same
+//     goes for the values of a map that already has the key.
 //   - A number can be unmarshaled into any integral type (i.e. int, uint,
-//     int8, etc.), float32 or float64. If the number has a fractional part or
-//     exponent, then only float32 and float64 are allowed.
-//   - A boolean must be unmarshaled as bool
-//   - A list must be unmarshaled into a slice where the slice element type
-//     matches the inner values inside the list.
+//     int8, etc.), float32, float64, or [Number]. If the number has a
+//     fractional part or exponent, then only float32, float64, and Number are
+//     allowed. A type that implements [encoding.TextUnmarshaler] decodes
+//     numbers itself, as described below.
+//   - A boolean must be unmarshaled as bool, or into a type that implements
+//     [encoding.TextUnmarshaler], in which case UnmarshalText is called with
+//     "true" or "false".
+//   - A list must be unmarshaled into a slice, or a pointer to one, where the
+//     slice element type matches the inner values inside the list.
 //   - A message is unmarshaled into a struct where the fields of the struct
-//     match the message fields.
+//     match the message fields, or into a map. The map's key type must be
+//     a string type or implement [encoding.TextUnmarshaler]. The struct
+//     may be recursive, as in a tree whose nodes have a field of type
+//     []*Node, in which case documents of any depth are decoded unless
+//     [UnmarshalOptions.MaxDepth] is set.
+//   - A value of a type with a factory registered by [RegisterFactory] is
+//     built by the factory, whatever its kind.
+//   - Any value can be unmarshaled into an empty interface, such as a field
+//     of type any. A bool and a string are stored as bool and string, and a
+//     number as [Number], unless [UnmarshalOptions.Numbers] says otherwise. A
+//     list is stored as []any, and a message as map[string]any, where keys
+//     written more than once are combined into a list.
 //
 // You can override a field's name using a struct tag "ccl", for example
 //
@@ -751,19 +1903,300 @@ func (p *parser) unpackBool(fieldVal reflect.Value, b bool, field []byte) error
 //
 // This message could decode, for example `my_field:5`
 //
+// A field with the tag `ccl:"-"` is ignored. As with encoding/json, the tag
+// `ccl:"-,"` instead names the field "-", which is written as the quoted
+// key `"-": 5`.
+//
+// The name in the tag can be followed by options. The percent option allows
+// a float field to be written as a percentage, which is divided by 100:
+//
+//	type message struct {
+//	    SampleRate float64 `ccl:"sample_rate,percent"`
+//	}
+//
+// Here `sample_rate: 2.5%` sets SampleRate to 0.025, and so does
+// `sample_rate: .025`. Percentages are an error in fields without the
+// option, so that a value meant as 2.5% can't be silently read as 250%;
+// a [Number] field with the option keeps the percentage as written.
+// [Marshal] writes fields with the option as percentages. The merge option,
+// as in `ccl:"hosts,merge=append"`, says how the field is merged when a
+// config is put together from layers with [MergeOptions.Merge]. The
+// explicit option, for a bool field, makes it an error to leave the field
+// out of its message, so that a setting that matters can't silently default
+// to false:
+//
+//	type message struct {
+//	    AllowDeletes bool `ccl:"allow_deletes,explicit"`
+//	}
+//
+// The enum option lists the values a string field may have, separated by
+// |, and any other value is an error:
+//
+//	type message struct {
+//	    Mode string `ccl:"mode,enum=fast|safe|auto"`
+//	}
+//
+// The flags option names the bits of an integer field, which can then be
+// written as a list of names whose values are ORed together, as in
+// `perms: ["READ", "WRITE"]`, or as a single name or a number:
+//
+//	type message struct {
+//	    Perms uint32 `ccl:"perms,flags=READ:4|WRITE:2|EXEC:1"`
+//	}
+//
+// [Marshal] writes such a field as a list of names if every bit that's set
+// has one.
+//
+// The unit option lets a [time.Duration] field be written as a plain number
+// of the given unit, which is one of ns, us, ms, s, m, or h, as is common in
+// formats that leave the unit implicit:
+//
+//	type message struct {
+//	    Timeout time.Duration `ccl:"timeout_ms,unit=ms"`
+//	}
+//
+// Here `timeout_ms: 1500` and `timeout_ms: "1.5s"` both set Timeout to
+// 1.5s. [Marshal] writes the number of units.
+//
 // A ccl string field can be decoded into a string or []byte, where []byte
 // expects a base64-encoded string. If a field has type T where T or *T
 // implements [encoding.TextUnmarshaler], then a string value will be decoded
-// by calling UnmarshalText. No other customization is supported, this
-// isn't encoding/json.
+// by calling UnmarshalText. So is a number, which is passed exactly as it's
+// written, such as "2.5%" or "0x10", unless the field has the unit, percent,
+// or flags option. This lets a type reject numbers that would be ambiguous,
+// such as a duration without a unit. An error from UnmarshalText is
+// reported with the position of the value and the dotted path of its field,
+// and can be retrieved with [errors.Unwrap]. Otherwise, if T or *T implements
+// [flag.Value], a string value is decoded by calling Set, so types written
+// for command-line flags can be used as is. Such a field takes a single
+// string even if its type is a slice, such as net.IP. A slice of such a
+// type, such as []time.Time, []*netip.Addr, or []net.IP, is repeated like
+// any other slice, and each of its elements is decoded from a string. No
+// other customization is supported, this isn't encoding/json.
 func Unmarshal(data []byte, v any) error {
+	return UnmarshalOptions{}.Unmarshal(data, v)
+}
+
+// UnmarshalTo is like [Unmarshal], but allocates and returns a new value of
+// type T, which must be a struct type.
+func UnmarshalTo[T any](data []byte) (T, error) {
+	var v T
+	if err := Unmarshal(data, &v); err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+// MustUnmarshal is like [UnmarshalTo], but takes the document as a string
+// and panics if it can't be unmarshaled. It's meant for documents written
+// into the program, such as fixtures in tests.
+func MustUnmarshal[T any](data string) T {
+	v, err := UnmarshalTo[T]([]byte(data))
+	if err != nil {
+		panic("ccl: " + err.Error())
+	}
+	return v
+}
+
+// UnmarshalOptions configures how a ccl document is unmarshaled. The zero
+// value gives the same behavior as [Unmarshal]. [Strict] and [Lenient] return
+// combinations of options that suit most uses.
+type UnmarshalOptions struct {
+	// MaxBytes limits the approximate number of bytes that are allocated for
+	// strings and slice elements while decoding, and returns an error when
+	// the limit is exceeded. Zero means no limit. This puts a bound on the
+	// memory used by decoding an untrusted document in addition to the size
+	// of the document itself.
+	MaxBytes int
+	// Timeout limits the wall-clock time spent parsing. The clock is only
+	// checked periodically, so parsing may run somewhat over the limit
+	// before failing. Zero means no limit.
+	Timeout time.Duration
+	// AllowNonFinite allows the literals inf, +inf, -inf, and nan to be
+	// decoded into float32 and float64.
+	AllowNonFinite bool
+	// If Stats is non-nil, it's filled in with statistics about the document
+	// when unmarshaling succeeds.
+	Stats *Stats
+	// DiscardUnknown ignores fields that don't match a struct field, instead
+	// of returning an error. Their values must still be valid ccl.
+	DiscardUnknown bool
+	// AllowDuplicates allows a field that isn't repeated to be written more
+	// than once in a message. The last value wins, except that the fields
+	// of a message are merged into the earlier ones.
+	AllowDuplicates bool
+	// DisallowRepeatedKeys returns an error when a repeated field is written
+	// more than once in a message, so that its values have to be written in
+	// a single list.
+	DisallowRepeatedKeys bool
+	// Numbers selects the type of numbers decoded into interface values. By
+	// default, they're decoded as [Number].
+	Numbers NumberMode
+	// LooseBooleans also decodes the strings "true", "false", "yes", "no",
+	// "on", and "off", in any case, and the numbers 1 and 0 into bool fields.
+	LooseBooleans bool
+	// DisableStringConcatenation makes adjacent string literals an error
+	// instead of concatenating them, so that a missing comma in a list of
+	// strings can't silently join two elements into one.
+	DisableStringConcatenation bool
+	// StrictEscapes rejects the escape sequences that are only there for
+	// compatibility with C, \? and octal escapes such as \101, so that
+	// documents stick to the escapes that most languages share. A byte
+	// can still be written as a hex escape, such as \x41.
+	StrictEscapes bool
+	// MaxDepth limits how deeply messages and lists can be nested, and
+	// returns an error for a document that's nested deeper. Zero means no
+	// limit. A recursive type, such as a struct with a field of type []*T,
+	// decodes documents of any depth, so this puts a bound on the stack
+	// and the time used by decoding an untrusted document.
+	MaxDepth int
+	// PreserveCarriageReturns keeps the carriage return of each CRLF line
+	// break inside a string, so that a multiline string in a file written
+	// with Windows line endings has them in its value. By default, line
+	// breaks in strings are normalized to a single newline. Either way, a
+	// carriage return that isn't part of a line break is an error, and a
+	// backslash before a line break removes all of it.
+	PreserveCarriageReturns bool
+	// If Warnings is non-nil, a warning is appended to it for each
+	// construct in the document that's legal but suspicious, as they're
+	// found. See [Warning] for what's reported. Warnings never make
+	// unmarshaling fail.
+	Warnings *[]Warning
+	// If Ranges is non-nil, it's filled in with where each decoded field
+	// was written in the document, keyed by its dotted path, as in
+	// "server.listen", so that data[r.Start:r.End] is the field exactly as
+	// it was written, from its key to the end of its value. This allows
+	// audit logs to quote what an operator wrote for a setting. A field
+	// written more than once, or in more than one element of a list of
+	// messages, has the range of the last time. With [MergeOptions.Merge],
+	// a range is in the layer that the field was last written in, which
+	// MergeOptions.Provenance records.
+	Ranges map[string]Range
+	// If Logger is non-nil and enabled for [slog.LevelDebug], each token of
+	// the document and each field that's decoded is logged to it at debug
+	// level, with its position in the document. A field's value is logged
+	// once it's decoded, and fields that are skipped by DiscardUnknown are
+	// logged too, so a trace shows why a field ended up with the value it
+	// has. Tracing is meant for debugging, since it slows decoding down a
+	// lot.
+	Logger *slog.Logger
+}
+
+// A Warning is a construct in a document that's legal but suspicious, as
+// reported in UnmarshalOptions.Warnings. These are:
+//
+//   - A number written with a leading +, such as +10, which may be a typo.
+//   - A field that isn't a pointer set to an empty message, such as tls {},
+//     which has no effect.
+//   - An empty list, such as hosts: [], that replaces the values of a field
+//     from an earlier layer of a merged config, such as its defaults.
+type Warning struct {
+	// Layer is the name of the layer that the warning is in, when the
+	// document is merged by [MergeOptions.Merge].
+	Layer     string
+	Line, Col int
+	Message   string
+}
+
+// String returns the warning in the form "line:col warning: message",
+// prefixed with its layer if it has one.
+func (w Warning) String() string {
+	s := fmt.Sprintf("%d:%d warning: %s", w.Line, w.Col, w.Message)
+	if w.Layer != "" {
+		s = w.Layer + ":" + s
+	}
+	return s
+}
+
+// A Range is the offsets of a field in a document, as recorded in
+// UnmarshalOptions.Ranges.
+type Range struct {
+	Start, End int
+}
+
+// Strict returns options for configs where mistakes should be caught as
+// early as possible. Unknown fields and duplicated fields are already errors
+// by default; in addition, a repeated field has to be written as a single
+// list. Booleans must be written as true or false, and inf and nan aren't
+// allowed.
+func Strict() UnmarshalOptions {
+	return UnmarshalOptions{DisallowRepeatedKeys: true}
+}
+
+// Lenient returns options that tolerate as much as they can: unknown fields
+// are ignored, a field written more than once takes its last value, booleans
+// can be written in other common forms, and inf and nan are allowed.
+func Lenient() UnmarshalOptions {
+	return UnmarshalOptions{
+		AllowNonFinite:  true,
+		DiscardUnknown:  true,
+		AllowDuplicates: true,
+		LooseBooleans:   true,
+	}
+}
+
+// Stats describes a successfully unmarshaled document. It's useful for
+// keeping an eye on configs that grow over time.
+type Stats struct {
+	// Tokens is the number of tokens in the document, not counting
+	// comments.
+	Tokens int
+	// MaxDepth is the deepest nesting of messages and lists. A document
+	// with only scalar fields has depth 0.
+	MaxDepth int
+	// Fields is the number of fields written in the document, including
+	// fields of nested messages.
+	Fields int
+	// Duplicates is the number of times a repeated field was written again
+	// in the same message.
+	Duplicates int
+	// StringBytes is the total length of all strings after expanding
+	// escape sequences.
+	StringBytes int
+
+	// The rest of the counts are of things that are only accepted by
+	// lenient options, such as those of [Lenient]. They show how far a
+	// config is from being accepted by the default options, so that strict
+	// checking can be turned on once they're all zero.
+
+	// UnknownFields is the number of unknown fields that were skipped,
+	// along with anything nested in them, because of DiscardUnknown.
+	UnknownFields int
+	// Overwritten is the number of times a field that isn't repeated was
+	// written again, replacing its earlier value, because of
+	// AllowDuplicates.
+	Overwritten int
+	// LooseBooleans is the number of booleans that were written as
+	// something other than true or false, because of LooseBooleans.
+	LooseBooleans int
+	// NonFinite is the number of infs and nans, which are allowed by
+	// AllowNonFinite.
+	NonFinite int
+}
+
+// Unmarshal is like [Unmarshal] but uses the given options.
+func (o UnmarshalOptions) Unmarshal(data []byte, v any) error {
+	return o.unmarshal(data, v, nil)
+}
+
+// unmarshal is Unmarshal, but calls init, if it's not nil, to set up the
+// parser before it starts.
+func (o UnmarshalOptions) unmarshal(data []byte, v any, init func(*parser)) error {
 	val := reflect.ValueOf(v)
 	if val.Kind() != reflect.Pointer || val.IsNil() || val.Type().Elem().Kind() != reflect.Struct {
 		return fmt.Errorf("value must be a non-nil pointer to a struct")
 	}
-	fields := make(map[structField]int)
+	if err := checkSize(int64(len(data))); err != nil {
+		return err
+	}
+	fields := make(map[structField]fieldInfo)
 	if err := fieldMap(fields, make(map[reflect.Type]bool), val.Type().Elem()); err != nil {
 		return err
 	}
-	return (&parser{lexer: lexer{data: data}, data: data, fieldMap: fields}).parse(val.Elem())
+	p := newParser(data, fields, o)
+	if init != nil {
+		init(p)
+	}
+	return p.parse(val.Elem())
 }
@@ -1,12 +1,21 @@
 package ccl
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"math/big"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"roseh.moe/pkg/ccl/x/cclcorpus"
 )
 
 func ptr[T any](v T) *T {
@@ -21,32 +30,35 @@ func TestUnmarshal(t *testing.T) {
 		Field int64 `ccl:"field"`
 	}
 	type message struct {
-		String          string           `ccl:"string"`
-		String2         string           `ccl:"string2"`
-		Int             int              `ccl:"int"`
-		Int8            int8             `ccl:"int8"`
-		Int16           int16            `ccl:"int16"`
-		Int32           int32            `ccl:"int32"`
-		Int64           int64            `ccl:"int64"`
-		Uint            uint             `ccl:"uint"`
-		Uint8           uint8            `ccl:"uint8"`
-		Uint16          uint16           `ccl:"uint16"`
-		Uint32          uint32           `ccl:"uint32"`
-		Uint64          uint64           `ccl:"uint64"`
-		Float           float64          `ccl:"float"`
-		Bool            bool             `ccl:"bool"`
-		Bool2           bool             `ccl:"bool2"`
-		Message         *nestedMessage   `ccl:"message"`
-		Repeated        []int64          `ccl:"repeated"`
-		RepeatedMessage []*nestedMessage `ccl:"repeated_message"`
-		Bytes           []byte           `ccl:"bytes"`
-		BytesWrapper    byteSliceWrapper `ccl:"bytes_wrapper"`
-		Time            time.Time        `ccl:"time"`
-		TimePointer     *time.Time       `ccl:"time_pointer"`
-		IntPointer      *int             `ccl:"int_pointer"`
-		RepeatedPointer []*int           `ccl:"repeated_pointer"`
-
-		Ignore     map[int]int `ccl:"-,"` // unlike JSON this also means ignore
+		String          string                    `ccl:"string"`
+		String2         string                    `ccl:"string2"`
+		Int             int                       `ccl:"int"`
+		Int8            int8                      `ccl:"int8"`
+		Int16           int16                     `ccl:"int16"`
+		Int32           int32                     `ccl:"int32"`
+		Int64           int64                     `ccl:"int64"`
+		Uint            uint                      `ccl:"uint"`
+		Uint8           uint8                     `ccl:"uint8"`
+		Uint16          uint16                    `ccl:"uint16"`
+		Uint32          uint32                    `ccl:"uint32"`
+		Uint64          uint64                    `ccl:"uint64"`
+		Float           float64                   `ccl:"float"`
+		Bool            bool                      `ccl:"bool"`
+		Bool2           bool                      `ccl:"bool2"`
+		Message         *nestedMessage            `ccl:"message"`
+		Repeated        []int64                   `ccl:"repeated"`
+		RepeatedMessage []*nestedMessage          `ccl:"repeated_message"`
+		Bytes           []byte                    `ccl:"bytes"`
+		BytesWrapper    byteSliceWrapper          `ccl:"bytes_wrapper"`
+		Time            time.Time                 `ccl:"time"`
+		TimePointer     *time.Time                `ccl:"time_pointer"`
+		IntPointer      *int                      `ccl:"int_pointer"`
+		RepeatedPointer []*int                    `ccl:"repeated_pointer"`
+		Map             map[string]int64          `ccl:"map"`
+		MapRepeated     map[string][]int          `ccl:"map_repeated"`
+		MapMessage      map[string]*nestedMessage `ccl:"map_message"`
+
+		Ignore     map[int]int `ccl:"-"`
 		unexported int64
 	}
 
@@ -96,6 +108,10 @@ can just span multiple lines"`,
 		desc: "CapitalHex",
 		msg:  `int: 0XfF`,
 		want: message{Int: 255},
+	}, {
+		desc: "HexWithE",
+		msg:  `int: -0xdef`,
+		want: message{Int: -0xdef},
 	}, {
 		desc: "HexLeadingZero",
 		msg:  `int: 0x0f`,
@@ -370,6 +386,34 @@ from string'`,
 		desc: "RepeatedPointer",
 		msg:  `repeated_pointer: [1, 2, 3]`,
 		want: message{RepeatedPointer: []*int{ptr(1), ptr(2), ptr(3)}},
+	}, {
+		desc: "Map",
+		msg:  `map { a: 1 b: 2 }`,
+		want: message{Map: map[string]int64{"a": 1, "b": 2}},
+	}, {
+		desc: "MapQuotedKey",
+		msg:  `map { "example.com": 1 'a': 2 }`,
+		want: message{Map: map[string]int64{"example.com": 1, "a": 2}},
+	}, {
+		desc: "QuotedKeyAfterString",
+		msg:  `map_message { "a" { field: 1 } } string: "a" 'b' "string2": "c"`,
+		want: message{MapMessage: map[string]*nestedMessage{"a": {Field: 1}}, String: "ab", String2: "c"},
+	}, {
+		desc: "QuotedField",
+		msg:  `"int": 1`,
+		want: message{Int: 1},
+	}, {
+		desc: "EmptyMap",
+		msg:  `map {}`,
+		want: message{Map: map[string]int64{}},
+	}, {
+		desc: "MapRepeated",
+		msg:  `map_repeated { a: [1, 2] a: 3 }`,
+		want: message{MapRepeated: map[string][]int{"a": {1, 2, 3}}},
+	}, {
+		desc: "MapMessage",
+		msg:  `map_message { a { field: 1 } b: {} }`,
+		want: message{MapMessage: map[string]*nestedMessage{"a": {Field: 1}, "b": {}}},
 	}} {
 		t.Run(tc.desc, func(t *testing.T) {
 			t.Parallel()
@@ -401,6 +445,7 @@ func TestUnmarshal_Invalid(t *testing.T) {
 		RepeatedMsg    []nestedMessage   `ccl:"repeated_msg"`
 		Bytes          []byte            `ccl:"bytes"`
 		NestedRepeated [][]nestedMessage `ccl:"nested_repeated"`
+		Map            map[string]int    `ccl:"map"`
 	}
 
 	for _, tc := range []struct {
@@ -559,6 +604,26 @@ int:12345; # oops typo
 		desc: "FloatRange",
 		msg:  `float:1e309`,
 		want: &syntaxError{line: 1, col: 7},
+	}, {
+		desc: "MapDuplicate",
+		msg:  `map { a: 1 a: 2 }`,
+		want: &syntaxError{line: 1, col: 12},
+	}, {
+		desc: "MapBadValue",
+		msg:  `map { a: true }`,
+		want: &syntaxError{line: 1, col: 10},
+	}, {
+		desc: "MapDuplicateQuoted",
+		msg:  `map { a: 1 "a": 2 }`,
+		want: &syntaxError{line: 1, col: 12},
+	}, {
+		desc: "QuotedFieldMissing",
+		msg:  `"asdf": 1`,
+		want: &syntaxError{line: 1, col: 1},
+	}, {
+		desc: "Inf",
+		msg:  `float: inf`,
+		want: &syntaxError{line: 1, col: 8},
 	}, {
 		desc: "IntLetter",
 		msg:  `int: 1A`,
@@ -679,6 +744,14 @@ func TestUnmarshal_InvalidType(t *testing.T) {
 		desc: "RepeatedSingular",
 		msg:  `F:[1]`,
 		out:  new(struct{ F int }),
+	}, {
+		desc: "MapBadTextKey",
+		msg:  `F{"not an IP": 1}`,
+		out:  new(struct{ F map[netip.Addr]int }),
+	}, {
+		desc: "MapIntKeys",
+		msg:  `F{}`,
+		out:  new(struct{ F map[int]int }),
 	}, {
 		desc: "IntTrue",
 		msg:  `int:true`,
@@ -715,233 +788,2126 @@ func TestUnmarshal_InvalidType(t *testing.T) {
 	}
 }
 
-func ExampleUnmarshal() {
-	// Pretend this was loaded from a file
-	msg := []byte(`
-		server {
-		    listen: "0.0.0.0:80"
-		    listen: "[::0]:80"
-		    location {
-		        path: "/"
-		        return: "301 https://$host$request_uri" # redirect to https
-		    }
-		    location {
-		        path: "/.well-known/acme-challenge/"
-		        root: "/var/lib/acme/acme-challenge"
-		        auth_basic: false
-		        auth_request: false
-		    }
-		}
-	`)
-	var serverConfig struct {
-		Server struct {
-			Listen   []string `ccl:"listen"`
-			Location []struct {
-				Path        string `ccl:"path"`
-				Root        string `ccl:"root"`
-				AuthBasic   bool   `ccl:"auth_basic"`
-				AuthRequest bool   `ccl:"auth_request"`
-				Return      string `ccl:"return"`
-			} `ccl:"location"`
-		} `ccl:"server"`
+func TestUnmarshal_TypeError(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Port  int      `ccl:"port"`
+		Name  string   `ccl:"name"`
+		Ports []uint16 `ccl:"ports"`
+		Debug *bool    `ccl:"debug"`
 	}
-	if err := Unmarshal(msg, &serverConfig); err != nil {
-		panic(err)
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want string
+	}{{
+		desc: "String",
+		msg:  `port: "eighty"`,
+		want: `1:7 syntax error: field "port" has type int, got string "eighty"`,
+	}, {
+		desc: "LongString",
+		msg:  `port: "` + strings.Repeat("é", 30) + `"`,
+		want: `1:7 syntax error: field "port" has type int, got string "` + strings.Repeat("é", 20) + `"...`,
+	}, {
+		desc: "Bool",
+		msg:  `ports: [80, true]`,
+		want: `1:13 syntax error: field "ports" has type uint16, got bool true`,
+	}, {
+		desc: "Float",
+		msg:  `port: 80.5`,
+		want: `1:7 syntax error: field "port" has type int, got number 80.5`,
+	}, {
+		desc: "Int",
+		msg:  `name: 0x50`,
+		want: `1:7 syntax error: field "name" has type string, got number 0x50`,
+	}, {
+		desc: "Pointer",
+		msg:  `debug: 1`,
+		want: `1:8 syntax error: field "debug" has type bool, got number 1`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if err := Unmarshal([]byte(tc.msg), new(message)); err == nil || err.Error() != tc.want {
+				t.Errorf("Unmarshal(%q) returned error %v, want %q", tc.msg, err, tc.want)
+			}
+		})
 	}
-	fmt.Println(serverConfig.Server.Location[0].Return)
-	// Output:
-	// 301 https://$host$request_uri
 }
 
-func BenchmarkLex(b *testing.B) {
-	msg := []byte(`
-		# This is a comment
-		string: 'asdf\n' # comment end of line
-		string2: "asdf\n"
-		int: 10
-		float: 10.5e13
-		bool: true
-		bool2: false
-		message { field: 10 }
-		repeated: [1, 2, 3]
-		repeated: 4
-		repeated: [5, 6]
-	`)
-	for b.Loop() {
-		l := &lexer{data: msg}
-		for {
-			_, _, err := l.next()
+func TestUnmarshal_DashTag(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Ignored int `ccl:"-"`
+		Dash    int `ccl:"-,"`
+	}
+	if err := Unmarshal([]byte(`Ignored: 1`), new(message)); err == nil {
+		t.Errorf("Unmarshal of a field tagged - succeeded, want an error")
+	}
+	type ignored struct {
+		Ignored int `ccl:"-"`
+	}
+	if err := Unmarshal([]byte(`"-": 1`), new(ignored)); err == nil {
+		t.Errorf("Unmarshal of key - into a struct whose only field is tagged - succeeded, want an error")
+	}
+	type rate struct {
+		Rate float64 `ccl:"-,percent"`
+	}
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		out  any
+		want any
+	}{{
+		desc: "Dash",
+		msg:  `"-": 5`,
+		out:  new(message),
+		want: &message{Dash: 5},
+	}, {
+		desc: "DashWithOption",
+		msg:  `"-": 50%`,
+		out:  new(rate),
+		want: &rate{Rate: .5},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if err := Unmarshal([]byte(tc.msg), tc.out); err != nil {
+				t.Fatalf("Unmarshal failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, tc.out); diff != "" {
+				t.Errorf("Unmarshal returned unexpected diff (-want +got):\n%s", diff)
+			}
+			got, err := Marshal(tc.want)
 			if err != nil {
-				if err == errEOF {
-					break
+				t.Fatalf("Marshal failed: %s", err)
+			}
+			if string(got) != tc.msg+"\n" {
+				t.Errorf("Marshal returned %q, want %q", got, tc.msg+"\n")
+			}
+		})
+	}
+}
+
+func TestUnmarshal_Explicit(t *testing.T) {
+	t.Parallel()
+
+	type inner struct {
+		Enabled bool `ccl:"enabled,explicit"`
+	}
+	type message struct {
+		AllowDeletes *bool   `ccl:"allow_deletes,explicit"`
+		Inner        *inner  `ccl:"inner"`
+		Inners       []inner `ccl:"inners"`
+		Other        int     `ccl:"other"`
+	}
+	for _, tc := range []struct {
+		desc    string
+		msg     string
+		want    message
+		wantErr string
+	}{{
+		desc: "False",
+		msg:  `allow_deletes: false`,
+		want: message{AllowDeletes: ptr(false)},
+	}, {
+		desc: "Nested",
+		msg:  `allow_deletes: true  inner { enabled: false }  inners { enabled: true }`,
+		want: message{AllowDeletes: ptr(true), Inner: &inner{}, Inners: []inner{{Enabled: true}}},
+	}, {
+		desc:    "Missing",
+		msg:     `other: 1`,
+		wantErr: `1:9 syntax error: field "allow_deletes" must be set explicitly`,
+	}, {
+		desc:    "MissingNested",
+		msg:     `allow_deletes: true  inner {}`,
+		wantErr: `1:29 syntax error: field "inner.enabled" must be set explicitly`,
+	}, {
+		desc:    "MissingInList",
+		msg:     `allow_deletes: true  inners: [{ enabled: true }, {}]`,
+		wantErr: `1:51 syntax error: field "inners.enabled" must be set explicitly`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var got message
+			err := Unmarshal([]byte(tc.msg), &got)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Errorf("Unmarshal returned error %v, want %q", err, tc.wantErr)
 				}
-				b.Fatal(err)
+				return
 			}
-		}
+			if err != nil {
+				t.Fatalf("Unmarshal failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unmarshal returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
 	}
 }
 
-func BenchmarkParse(b *testing.B) {
-	msg := []byte(`
-		# This is a comment
-		string: 'asdf\n' # comment end of line
-		string2: "asdf\n"
-		int: 10
-		float: 10.5e13
-		bool: true
-		bool2: false
-		message { field: 10 }
-		repeated: [1, 2, 3]
-		repeated: 4
-		repeated: [5, 6]
-	`)
+func TestUnmarshal_ExplicitInvalid(t *testing.T) {
+	t.Parallel()
+
+	out := new(struct {
+		A int `ccl:"a,explicit"`
+	})
+	want := `option "explicit" needs a bool field`
+	if err := Unmarshal([]byte(`a: 1`), out); err == nil || err.Error() != want {
+		t.Errorf("Unmarshal returned error %v, want %q", err, want)
+	}
+}
+
+func TestUnmarshal_Enum(t *testing.T) {
+	t.Parallel()
+
+	type mode string
 	type message struct {
-		String  string  `ccl:"string"`
-		String2 string  `ccl:"string2"`
-		Int     int     `ccl:"int"`
-		Float   float64 `ccl:"float"`
-		Bool    bool    `ccl:"bool"`
-		Bool2   bool    `ccl:"bool2"`
-		Message struct {
-			Field int `ccl:"field"`
-		} `ccl:"message"`
-		Repeated []int `ccl:"repeated"`
+		Mode  string   `ccl:"mode,enum=fast|safe|auto"`
+		Modes []mode   `ccl:"modes,enum=fast|safe"`
+		Level *string  `ccl:"level,enum=debug|info|warn|error"`
+		Other []string `ccl:"other"`
 	}
-	for b.Loop() {
-		var m message
-		if err := Unmarshal(msg, &m); err != nil {
-			b.Fatal(err)
-		}
+	for _, tc := range []struct {
+		desc    string
+		msg     string
+		want    message
+		wantErr string
+	}{{
+		desc: "Valid",
+		msg:  `mode: "safe"  modes: ["fast", "safe"]  level: "warn"  other: "anything"`,
+		want: message{Mode: "safe", Modes: []mode{"fast", "safe"}, Level: ptr("warn"), Other: []string{"anything"}},
+	}, {
+		desc:    "Typo",
+		msg:     `mode: "fsat"`,
+		wantErr: `1:7 syntax error: field "mode": "fsat" is not one of "fast", "safe", "auto"; did you mean "fast"?`,
+	}, {
+		desc:    "Case",
+		msg:     `level: "INFO"`,
+		wantErr: `1:8 syntax error: field "level": "INFO" is not one of "debug", "info", "warn", "error"; did you mean "info"?`,
+	}, {
+		desc:    "NoSuggestion",
+		msg:     `mode: "quick"`,
+		wantErr: `1:7 syntax error: field "mode": "quick" is not one of "fast", "safe", "auto"`,
+	}, {
+		desc:    "List",
+		msg:     `modes: ["fast", "auto"]`,
+		wantErr: `1:17 syntax error: field "modes": "auto" is not one of "fast", "safe"`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var got message
+			err := Unmarshal([]byte(tc.msg), &got)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Errorf("Unmarshal returned error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unmarshal returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
 	}
 }
 
-func FuzzUnmarshal(f *testing.F) {
-	for _, tc := range []string{
-		`
-			# This is a comment
-			string: 'asdf\n' # comment end of line
-			string2: "asdf\n"
-			int: 10
-			float: 10.5e13
-			bool: true
-			bool2: false
-			message { field: 10 }
-			repeated: [1, 2, 3]
-			repeated: 4
-			repeated: [5, 6]
-		`,
-		`string: "strings
-can just span multiple lines"`,
-		`int: 0`,
-		`int: 0xff`,
-		`int: 0XfF`,
-		`int: 0x0f`,
-		`int: -0x0f`,
-		`int: +0x0f`,
-		`float: 1.5e10`,
-		`float: 1.5E10`,
-		`float: -1.5e-10`,
-		`float: +1.5e+10`,
-		`int: 10`,
-		`int: -10`,
-		`int: +10`,
-		`int8:1`,
-		`int16:1`,
-		`int32:1`,
-		`int64:1`,
-		`uint:1`,
-		`uint8:1`,
-		`uint16:1`,
-		`uint32:1`,
-		`uint64:1`,
-		`int:on`,
-		`int:no`,
-		`uint:on`,
-		`uint:no`,
-		`float:-1`,
-		`float:1`,
-		`string: 'asdf'`,
-		`string: "asdf"`,
-		`string: 'ain\'t'`,
-		`string: "won\'t"`,
-		`string: '\"'`,
-		`string: "\""`,
-		`string: "\?"`,
-		`string: '\\'`,
-		`string: '\a'`,
-		`string: '\b'`,
-		`string: '\f'`,
-		`string: '\n'`,
-		`string: '\r'`,
-		`string: '\t'`,
-		`string: '\v'`,
-		`string: '\x0a'`,
-		`string: "\xe4\xb8\x96"`,
-		`string: '\u2014'`,
-		`string: '\U0001f600'`,
-		`string: '\033'`,
-		`message { field: 10 }`,
-		`message {}`,
-		`
-			repeated: 1
-			repeated: 2`,
-		`repeated: [1, 2]`,
-		`repeated: []`,
-		`repeated: 1`,
-		`repeated: [
-			1,
-			2,
-		]`,
-		`repeated_message: [{}]`,
-		`message: /** inline comment **/ {}`,
-		`message: {} // line comment`,
-		`string: 'that'"'"'s cool'`,
-		`string: 'remove newline \
-from string'`,
-		"string: 'remove newline \\\r\nfrom string'",
-		`bytes:"dGVzdA=="`,
-		`bytes_wrapper: [1, 2, 3]`,
-		`time:"2025-10-28T07:41:47Z"`,
-		`time_pointer:"2025-10-28T07:41:47Z"`,
-		`int_pointer: 5`,
-		`repeated_pointer: [1, 2, 3]`,
-		`int: .`,
-		`float:1e+`,
-		`int:0xgg`,
-		`string: '\g'`,
-		`string: "\g"`,
-		"string:'\\\r'",
-		`string:"\x1"`,
-		`string:"\xgg"`,
-		`string:"\u001"`,
-		`string:"\ugggg"`,
-		`string: '`,
-		`string: "`,
-		`10`,
-		`msg {10}`,
-		`repeated []`,
-		`repeated: [1 2]`,
-		`repeated: [asdf]`,
-		`repeated_msg: [{asdf}]`,
-		`int: 0644`,
-		`string: "\777"`,
-		`string: "\x80"`,
-		`string`,
-		`string "abc"`,
-		`int:5 int:6`,
-		`int8:512`,
-		`int8:-512`,
-		`bytes:"dGVzdAo"`,
-		`bytes:[1,2,3]`,
-		`asdfasdfasdf:"asdf"`,
-		`repeated: [[1]]`,
-		`nested_repeated: [[1]]`,
-		`float:1e`,
-		`/*`,
-		`bytes:100000000000000000000`,
-		`float:1e700`,
-		`float:1A000`,
-	} {
+func TestUnmarshal_EnumInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		out  any
+		want string
+	}{{
+		desc: "Int",
+		out: new(struct {
+			A int `ccl:"a,enum=1|2"`
+		}),
+		want: `option "enum=1|2" needs a string field`,
+	}, {
+		desc: "Empty",
+		out: new(struct {
+			A string `ccl:"a,enum="`
+		}),
+		want: `option "enum=" needs at least one value`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if err := Unmarshal(nil, tc.out); err == nil || err.Error() != tc.want {
+				t.Errorf("Unmarshal returned error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_Flags(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Perms uint8  `ccl:"perms,flags=READ:4|WRITE:2|EXEC:1|ALL:7"`
+		Mode  *int64 `ccl:"mode,flags=A:0x1|B:0x100"`
+		Small int8   `ccl:"small,flags=BIG:0x100"`
+	}
+	for _, tc := range []struct {
+		desc    string
+		msg     string
+		want    message
+		wantErr string
+	}{{
+		desc: "List",
+		msg:  `perms: ["READ", "WRITE"]`,
+		want: message{Perms: 6},
+	}, {
+		desc: "Name",
+		msg:  `perms: "EXEC"  mode: 'B'`,
+		want: message{Perms: 1, Mode: ptr[int64](0x100)},
+	}, {
+		desc: "Overlapping",
+		msg:  `perms: ["ALL", "READ",]`,
+		want: message{Perms: 7},
+	}, {
+		desc: "Number",
+		msg:  `perms: 5`,
+		want: message{Perms: 5},
+	}, {
+		desc: "Empty",
+		msg:  `perms: []`,
+		want: message{},
+	}, {
+		desc:    "Unknown",
+		msg:     `perms: ["READ", "WRTIE"]`,
+		wantErr: `1:17 syntax error: field "perms": "WRTIE" is not one of "READ", "WRITE", "EXEC", "ALL"; did you mean "WRITE"?`,
+	}, {
+		desc:    "NotAString",
+		msg:     `perms: [4]`,
+		wantErr: `1:9 syntax error: field "perms": expecting a flag name`,
+	}, {
+		desc:    "OutOfRange",
+		msg:     `small: "BIG"`,
+		wantErr: `1:8 syntax error: flags 0x100 are out of range for int8`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var got message
+			err := Unmarshal([]byte(tc.msg), &got)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Errorf("Unmarshal returned error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unmarshal returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_FlagsInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		out  any
+		want string
+	}{{
+		desc: "String",
+		out: new(struct {
+			A string `ccl:"a,flags=A:1"`
+		}),
+		want: `option "flags=A:1" needs an integer field`,
+	}, {
+		desc: "NoValue",
+		out: new(struct {
+			A int `ccl:"a,flags=A:1|B"`
+		}),
+		want: `option "flags=A:1|B": flag "B" should be written as NAME:value`,
+	}, {
+		desc: "BadValue",
+		out: new(struct {
+			A int `ccl:"a,flags=A:one"`
+		}),
+		want: `option "flags=A:one": flag "A:one" should be written as NAME:value`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if err := Unmarshal(nil, tc.out); err == nil || err.Error() != tc.want {
+				t.Errorf("Unmarshal returned error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_Unit(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Timeout  time.Duration   `ccl:"timeout_ms,unit=ms"`
+		Interval *time.Duration  `ccl:"interval,unit=s"`
+		Backoff  []time.Duration `ccl:"backoff,unit=h"`
+	}
+	for _, tc := range []struct {
+		desc    string
+		msg     string
+		want    message
+		wantErr string
+	}{{
+		desc: "Int",
+		msg:  `timeout_ms: 1500  interval: -2  backoff: [1, 24]`,
+		want: message{Timeout: 1500 * time.Millisecond, Interval: ptr(-2 * time.Second), Backoff: []time.Duration{time.Hour, 24 * time.Hour}},
+	}, {
+		desc: "Float",
+		msg:  `timeout_ms: .5  interval: 1e-3`,
+		want: message{Timeout: 500 * time.Microsecond, Interval: ptr(time.Millisecond)},
+	}, {
+		desc: "String",
+		msg:  `timeout_ms: "1m30s"  backoff: ["90m", 2]`,
+		want: message{Timeout: 90 * time.Second, Backoff: []time.Duration{90 * time.Minute, 2 * time.Hour}},
+	}, {
+		desc:    "BadString",
+		msg:     `timeout_ms: "soon"`,
+		wantErr: `1:13 syntax error: field "timeout_ms": invalid duration "soon", want a number of ms or a number with a unit, such as "1.5s"`,
+	}, {
+		desc:    "OutOfRange",
+		msg:     `backoff: [1e10]`,
+		wantErr: `1:11 syntax error: duration 1e10 is out of range`,
+	}, {
+		desc:    "IntOutOfRange",
+		msg:     `backoff: [10000000]`,
+		wantErr: `1:11 syntax error: duration 10000000 is out of range`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var got message
+			err := Unmarshal([]byte(tc.msg), &got)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Errorf("Unmarshal returned error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unmarshal returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_UnitInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		out  any
+		want string
+	}{{
+		desc: "Float",
+		out: new(struct {
+			A float64 `ccl:"a,unit=s"`
+		}),
+		want: `option "unit=s" needs a time.Duration field`,
+	}, {
+		desc: "Unknown",
+		out: new(struct {
+			A time.Duration `ccl:"a,unit=d"`
+		}),
+		want: `option "unit=d": unknown unit "d", want one of ns, us, ms, s, m, or h`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if err := Unmarshal(nil, tc.out); err == nil || err.Error() != tc.want {
+				t.Errorf("Unmarshal returned error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_SharedType(t *testing.T) {
+	t.Parallel()
+
+	type inner struct {
+		X int   `ccl:"x"`
+		L []int `ccl:"l"`
+	}
+	type message struct {
+		A inner   `ccl:"a,merge=replace"`
+		B inner   `ccl:"b"`
+		C []inner `ccl:"c"`
+	}
+	var got message
+	err := MergeOptions{}.Merge(&got,
+		Layer{Name: "defaults", Data: []byte(`a { x: 1  l: [1] }  b { x: 1  l: [1] }  c { x: 1 }`)},
+		Layer{Name: "config", Data: []byte(`a { l: [2] }  b { l: [2] }  c { l: [2] }`)})
+	if err != nil {
+		t.Fatalf("Merge failed: %s", err)
+	}
+	want := message{
+		A: inner{L: []int{2}},
+		B: inner{X: 1, L: []int{2}},
+		C: []inner{{L: []int{2}}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Merge returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestUnmarshal_NestedTypeError(t *testing.T) {
+	t.Parallel()
+
+	type conflict struct {
+		X int
+		Y int `ccl:"X"`
+	}
+	for _, tc := range []struct {
+		desc string
+		out  any
+		want string
+	}{{
+		desc: "TopLevel",
+		out:  new(conflict),
+		want: `multiple fields with name "X"`,
+	}, {
+		desc: "Nested",
+		out: new(struct {
+			A struct {
+				B conflict `ccl:"b"`
+			} `ccl:"a"`
+		}),
+		want: `field "a.b": multiple fields with name "X"`,
+	}, {
+		desc: "List",
+		out: new(struct {
+			A []*conflict `ccl:"a"`
+		}),
+		want: `field "a": multiple fields with name "X"`,
+	}, {
+		desc: "MapValue",
+		out: new(struct {
+			A map[string]struct {
+				B string `ccl:"b,bad"`
+			} `ccl:"a"`
+		}),
+		want: `field "a": unknown option "bad"`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if err := Unmarshal(nil, tc.out); err == nil || err.Error() != tc.want {
+				t.Errorf("Unmarshal returned error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_Recursive(t *testing.T) {
+	t.Parallel()
+
+	type node struct {
+		Name     string           `ccl:"name"`
+		Children []*node          `ccl:"child"`
+		Next     *node            `ccl:"next"`
+		Named    map[string]*node `ccl:"named"`
+	}
+	msg := `
+		name: "root"
+		child {
+			name: "a"
+			child: [{name: "a1"}, {name: "a2" next { name: "a3" }}]
+		}
+		child { name: "b" }
+		named { x { child { name: "x1" } } }
+	`
+	want := &node{
+		Name: "root",
+		Children: []*node{{
+			Name:     "a",
+			Children: []*node{{Name: "a1"}, {Name: "a2", Next: &node{Name: "a3"}}},
+		}, {
+			Name: "b",
+		}},
+		Named: map[string]*node{"x": {Children: []*node{{Name: "x1"}}}},
+	}
+	got := new(node)
+	if err := Unmarshal([]byte(msg), got); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("Unmarshal returned unexpected diff (-want +got):\n%s", diff)
+	}
+
+	// A linked list as deep as the document.
+	const depth = 10000
+	deep := strings.Repeat("next {", depth) + strings.Repeat("}", depth)
+	list := new(node)
+	if err := Unmarshal([]byte(deep), list); err != nil {
+		t.Fatalf("Unmarshal of a list %d deep failed: %s", depth, err)
+	}
+	n := 0
+	for l := list.Next; l != nil; l = l.Next {
+		n++
+	}
+	if n != depth {
+		t.Errorf("Unmarshal decoded a list %d deep, want %d", n, depth)
+	}
+}
+
+func TestUnmarshal_PointerToPointer(t *testing.T) {
+	t.Parallel()
+
+	type inner struct {
+		X int `ccl:"x"`
+	}
+	type message struct {
+		Int     **int            `ccl:"int"`
+		String  ***string        `ccl:"string"`
+		Enum    **string         `ccl:"enum,enum=a|b"`
+		Message **inner          `ccl:"message"`
+		List    **[]int          `ccl:"list"`
+		Elems   []**int          `ccl:"elems"`
+		Map     map[string]**int `ccl:"map"`
+		Time    **time.Time      `ccl:"time"`
+		Any     **any            `ccl:"any"`
+	}
+	msg := `
+		int: 1
+		string: "s"
+		enum: "b"
+		message { x: 2 }
+		list: [3, 4]
+		list: 5
+		elems: [6, 7]
+		map { a: 8 }
+		time: "2024-01-02T03:04:05Z"
+		any: [true]
+	`
+	pp := func(v int) **int { return ptr(ptr(v)) }
+	want := message{
+		Int:     pp(1),
+		String:  ptr(ptr(ptr("s"))),
+		Enum:    ptr(ptr("b")),
+		Message: ptr(&inner{X: 2}),
+		List:    ptr(&[]int{3, 4, 5}),
+		Elems:   []**int{pp(6), pp(7)},
+		Map:     map[string]**int{"a": pp(8)},
+		Time:    ptr(ptr(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))),
+		Any:     ptr(ptr[any]([]any{true})),
+	}
+	var got message
+	if err := Unmarshal([]byte(msg), &got); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unmarshal returned unexpected diff (-want +got):\n%s", diff)
+	}
+
+	type recursive *recursive
+	for _, tc := range []struct {
+		desc string
+		out  any
+		want string
+	}{{
+		desc: "TooMany",
+		out: new(struct {
+			F *****int `ccl:"f"`
+		}),
+		want: `field "f": type *****int has more than 4 levels of pointers`,
+	}, {
+		desc: "Recursive",
+		out: new(struct {
+			F []recursive `ccl:"f"`
+		}),
+		want: `field "f": type ccl.recursive has more than 4 levels of pointers`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if err := Unmarshal([]byte(`f: 1`), tc.out); err == nil || err.Error() != tc.want {
+				t.Errorf("Unmarshal returned error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_ExistingPointers(t *testing.T) {
+	t.Parallel()
+
+	type server struct {
+		Host    string  `ccl:"host"`
+		Port    int     `ccl:"port"`
+		Backup  *server `ccl:"backup"`
+		Timeout *int    `ccl:"timeout"`
+	}
+	type message struct {
+		Server  *server            `ccl:"server"`
+		Servers map[string]*server `ccl:"servers"`
+	}
+	// Programmatic defaults, which the document partly overrides.
+	backup := &server{Host: "backup.example.com", Port: 80}
+	timeout := 30
+	def := &server{Host: "example.com", Port: 80, Backup: backup, Timeout: &timeout}
+	named := &server{Host: "a.example.com", Port: 80}
+	got := message{Server: def, Servers: map[string]*server{"a": named}}
+	msg := `
+		server {
+			port: 8080
+			backup { port: 8081 }
+			timeout: 10
+		}
+		servers { a { port: 443 } }
+	`
+	if err := Unmarshal([]byte(msg), &got); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	want := message{
+		Server: &server{
+			Host:    "example.com",
+			Port:    8080,
+			Backup:  &server{Host: "backup.example.com", Port: 8081},
+			Timeout: ptr(10),
+		},
+		Servers: map[string]*server{"a": {Host: "a.example.com", Port: 443}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unmarshal returned unexpected diff (-want +got):\n%s", diff)
+	}
+	if got.Server != def || got.Server.Backup != backup || got.Server.Timeout != &timeout || got.Servers["a"] != named {
+		t.Error("Unmarshal replaced a non-nil pointer, want it to decode into the value it points to")
+	}
+}
+
+func TestUnmarshal_Bool(t *testing.T) {
+	t.Parallel()
+
+	type namedBool bool
+	type message struct {
+		Bool         bool              `ccl:"bool"`
+		Pointer      *bool             `ccl:"pointer"`
+		List         []bool            `ccl:"list"`
+		PointerList  []*bool           `ccl:"pointer_list"`
+		ListPointer  *[]bool           `ccl:"list_pointer"`
+		Named        namedBool         `ccl:"named"`
+		NamedList    []namedBool       `ccl:"named_list"`
+		Map          map[string]bool   `ccl:"map"`
+		MapList      map[string][]bool `ccl:"map_list"`
+		MapOfPointer map[string]*bool  `ccl:"map_of_pointer"`
+	}
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want message
+	}{{
+		desc: "Bool",
+		msg:  `bool: true`,
+		want: message{Bool: true},
+	}, {
+		desc: "Pointer",
+		msg:  `pointer: false`,
+		want: message{Pointer: ptr(false)},
+	}, {
+		desc: "List",
+		msg:  `list: [true, false, true]`,
+		want: message{List: []bool{true, false, true}},
+	}, {
+		desc: "EmptyList",
+		msg:  `list: []`,
+		want: message{List: []bool{}},
+	}, {
+		desc: "RepeatedKey",
+		msg:  `list: true list: [false, false] list: true`,
+		want: message{List: []bool{true, false, false, true}},
+	}, {
+		desc: "PointerList",
+		msg:  `pointer_list: [true, false]`,
+		want: message{PointerList: []*bool{ptr(true), ptr(false)}},
+	}, {
+		desc: "ListPointer",
+		msg:  `list_pointer: [false, true] list_pointer: true`,
+		want: message{ListPointer: &[]bool{false, true, true}},
+	}, {
+		desc: "Named",
+		msg:  `named: true named_list: [false, true]`,
+		want: message{Named: true, NamedList: []namedBool{false, true}},
+	}, {
+		desc: "Map",
+		msg:  `map { a: true b: false } map_list { a: [true] a: false } map_of_pointer { a: true }`,
+		want: message{
+			Map:          map[string]bool{"a": true, "b": false},
+			MapList:      map[string][]bool{"a": {true, false}},
+			MapOfPointer: map[string]*bool{"a": ptr(true)},
+		},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var got message
+			if err := Unmarshal([]byte(tc.msg), &got); err != nil {
+				t.Fatalf("Unmarshal(%q) failed: %s", tc.msg, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unmarshal(%q) returned unexpected diff (-want +got):\n%s", tc.msg, diff)
+			}
+			// The same value comes back after a round trip.
+			out, err := Marshal(got)
+			if err != nil {
+				t.Fatalf("Marshal(%+v) failed: %s", got, err)
+			}
+			var roundTrip message
+			if err := Unmarshal(out, &roundTrip); err != nil {
+				t.Fatalf("Unmarshal(%q) failed: %s", out, err)
+			}
+			if diff := cmp.Diff(got, roundTrip); diff != "" {
+				t.Errorf("Unmarshal(Marshal(%+v)) returned unexpected diff (-want +got):\n%s", got, diff)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_BoolInvalid(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Bool     bool     `ccl:"bool"`
+		List     []bool   `ccl:"list"`
+		NotBool  int      `ccl:"not_bool"`
+		NotBools []int    `ccl:"not_bools"`
+		Pointer  *bool    `ccl:"pointer"`
+		Strings  []string `ccl:"strings"`
+	}
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+	}{
+		{desc: "ListIntoBool", msg: `bool: [true]`},
+		{desc: "DuplicateBool", msg: `bool: true bool: false`},
+		{desc: "StringIntoBool", msg: `bool: "true"`},
+		{desc: "NumberIntoBool", msg: `bool: 1`},
+		{desc: "NumberInList", msg: `list: [true, 0]`},
+		{desc: "NestedList", msg: `list: [[true]]`},
+		{desc: "BoolIntoInt", msg: `not_bool: true`},
+		{desc: "BoolsIntoInts", msg: `not_bools: [true]`},
+		{desc: "StringIntoPointer", msg: `pointer: "false"`},
+		{desc: "BoolsIntoStrings", msg: `strings: [false]`},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if err := Unmarshal([]byte(tc.msg), new(message)); err == nil {
+				t.Errorf("Unmarshal(%q) succeeded, want error", tc.msg)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_Percent(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Rate     float64   `ccl:"rate,percent"`
+		Rate32   float32   `ccl:"rate32,percent"`
+		Pointer  *float64  `ccl:"pointer,percent"`
+		Repeated []float64 `ccl:"repeated,percent"`
+		Number   Number    `ccl:"number,percent"`
+	}
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want message
+	}{{
+		desc: "Fraction",
+		msg:  `rate: 2.5%`,
+		want: message{Rate: 0.025},
+	}, {
+		desc: "Integer",
+		msg:  `rate: 50%`,
+		want: message{Rate: 0.5},
+	}, {
+		desc: "Exact",
+		msg:  `rate: .1%`,
+		want: message{Rate: 0.001},
+	}, {
+		desc: "Exponent",
+		msg:  `rate: 1e-3% rate32: 1.5E2%`,
+		want: message{Rate: 1e-5, Rate32: 1.5},
+	}, {
+		desc: "Negative",
+		msg:  `rate: -.5%`,
+		want: message{Rate: -0.005},
+	}, {
+		desc: "PlainNumber",
+		msg:  `rate: .025`,
+		want: message{Rate: 0.025},
+	}, {
+		desc: "Pointer",
+		msg:  `pointer: 100%`,
+		want: message{Pointer: ptr(1.0)},
+	}, {
+		desc: "Repeated",
+		msg:  `repeated: [1%, .5, 99.9%]`,
+		want: message{Repeated: []float64{0.01, 0.5, 0.999}},
+	}, {
+		desc: "Number",
+		msg:  `number: 2.5%`,
+		want: message{Number: "2.5%"},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var got message
+			if err := Unmarshal([]byte(tc.msg), &got); err != nil {
+				t.Fatalf("Unmarshal(%q) failed: %s", tc.msg, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unmarshal(%q) returned unexpected diff (-want +got):\n%s", tc.msg, diff)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_PercentInvalid(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Rate   float64 `ccl:"rate,percent"`
+		Float  float64 `ccl:"float"`
+		Int    int     `ccl:"int,percent"`
+		Number Number  `ccl:"number"`
+	}
+	for _, tc := range []struct {
+		desc string
+		msg  string
+	}{{
+		desc: "NoOption",
+		msg:  `float: 2.5%`,
+	}, {
+		desc: "Int",
+		msg:  `int: 50%`,
+	}, {
+		desc: "Number",
+		msg:  `number: 50%`,
+	}, {
+		desc: "Hex",
+		msg:  `rate: 0x10%`,
+	}, {
+		desc: "Sign",
+		msg:  `rate: -%`,
+	}, {
+		desc: "Twice",
+		msg:  `rate: 5%%`,
+	}, {
+		desc: "Middle",
+		msg:  `rate: 5%0`,
+	}, {
+		desc: "String",
+		msg:  `rate: "5%"`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var got message
+			if err := Unmarshal([]byte(tc.msg), &got); err == nil {
+				t.Errorf("Unmarshal(%q) returned %+v, want error", tc.msg, got)
+			}
+		})
+	}
+}
+
+var errBadText = errors.New("bad text")
+
+type text string
+
+func (t *text) UnmarshalText(b []byte) error {
+	if string(b) == "bad" {
+		return errBadText
+	}
+	*t = text(b)
+	return nil
+}
+
+func TestUnmarshal_TextError(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Server []struct {
+			Values map[string]text `ccl:"values"`
+		} `ccl:"server"`
+	}
+	msg := "server {}\nserver {\n    values { a: 'good' b: 'bad' }\n}"
+	err := Unmarshal([]byte(msg), new(message))
+	if !errors.Is(err, errBadText) {
+		t.Errorf("Unmarshal(%q) returned error %v, want it to wrap %v", msg, err, errBadText)
+	}
+	want := `3:27 syntax error: field "server.values.b": bad text`
+	if err == nil || err.Error() != want {
+		t.Errorf("Unmarshal(%q) returned error %v, want %q", msg, err, want)
+	}
+}
+
+func TestUnmarshal_NumberText(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Text  text     `ccl:"text"`
+		Texts []text   `ccl:"texts"`
+		Big   *big.Int `ccl:"big"`
+	}
+	msg := `text: 2.5% texts: [0x10, -1e3] big: 123456789012345678901234567890`
+	var got message
+	if err := Unmarshal([]byte(msg), &got); err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %s", msg, err)
+	}
+	n, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	want := message{Text: "2.5%", Texts: []text{"0x10", "-1e3"}, Big: n}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(x, y *big.Int) bool { return x.Cmp(y) == 0 })); diff != "" {
+		t.Errorf("Unmarshal(%q) returned unexpected diff (-want +got):\n%s", msg, diff)
+	}
+
+	const bad = `big: 1.5`
+	wantErr := `1:6 syntax error: field "big": math/big: cannot unmarshal "1.5" into a *big.Int`
+	if err := Unmarshal([]byte(bad), new(message)); err == nil || err.Error() != wantErr {
+		t.Errorf("Unmarshal(%q) returned error %v, want %q", bad, err, wantErr)
+	}
+}
+
+// csvText is a slice type that's decoded from a string of comma-separated
+// values.
+type csvText []string
+
+func (c *csvText) UnmarshalText(b []byte) error {
+	*c = strings.Split(string(b), ",")
+	return nil
+}
+
+func (c csvText) MarshalText() ([]byte, error) {
+	return []byte(strings.Join(c, ",")), nil
+}
+
+func TestUnmarshal_RepeatedText(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Times     []time.Time         `ccl:"times"`
+		TimePtrs  []*time.Time        `ccl:"time_ptrs"`
+		PtrTimes  *[]time.Time        `ccl:"ptr_times"`
+		Addrs     []netip.Addr        `ccl:"addrs"`
+		IP        net.IP              `ccl:"ip"`
+		IPPtr     *net.IP             `ccl:"ip_ptr"`
+		IPs       []net.IP            `ccl:"ips"`
+		IPMap     map[string]net.IP   `ccl:"ip_map"`
+		IPListMap map[string][]net.IP `ccl:"ip_list_map"`
+		CSV       csvText             `ccl:"csv"`
+		CSVs      []csvText           `ccl:"csvs"`
+	}
+	msg := `times: ["2024-01-02T00:00:00Z", "2024-01-03T00:00:00Z"]
+time_ptrs: "2024-01-02T00:00:00Z"
+time_ptrs: "2024-01-03T00:00:00Z"
+ptr_times: ["2024-01-02T00:00:00Z"]
+addrs: ["::1", "10.0.0.1"]
+ip: "10.0.0.1"
+ip_ptr: "::1"
+ips: ["10.0.0.1", "::1"]
+ips: "10.0.0.2"
+ip_map { a: "10.0.0.1" }
+ip_list_map { a: ["10.0.0.1"] b: "::1" }
+csv: "a,b"
+csvs: ["a,b", "c"]
+`
+	var got message
+	if err := Unmarshal([]byte(msg), &got); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	day2 := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	day3 := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	want := message{
+		Times:     []time.Time{day2, day3},
+		TimePtrs:  []*time.Time{&day2, &day3},
+		PtrTimes:  &[]time.Time{day2},
+		Addrs:     []netip.Addr{netip.MustParseAddr("::1"), netip.MustParseAddr("10.0.0.1")},
+		IP:        net.ParseIP("10.0.0.1"),
+		IPPtr:     ptr(net.ParseIP("::1")),
+		IPs:       []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("::1"), net.ParseIP("10.0.0.2")},
+		IPMap:     map[string]net.IP{"a": net.ParseIP("10.0.0.1")},
+		IPListMap: map[string][]net.IP{"a": {net.ParseIP("10.0.0.1")}, "b": {net.ParseIP("::1")}},
+		CSV:       csvText{"a", "b"},
+		CSVs:      []csvText{{"a", "b"}, {"c"}},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateComparable(netip.Addr{})); diff != "" {
+		t.Errorf("Unmarshal returned unexpected diff (-want +got):\n%s", diff)
+	}
+
+	b, err := Marshal(got)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	var again message
+	if err := Unmarshal(b, &again); err != nil {
+		t.Fatalf("Unmarshal of the marshaled value failed: %s\n%s", err, b)
+	}
+	if diff := cmp.Diff(got, again, cmpopts.EquateComparable(netip.Addr{})); diff != "" {
+		t.Errorf("Unmarshal of the marshaled value returned unexpected diff (-want +got):\n%s", diff)
+	}
+
+	for _, tc := range []struct {
+		msg  string
+		want string
+	}{{
+		msg:  `ip: ["10.0.0.1"]`,
+		want: "1:5 syntax error: invalid repeated value",
+	}, {
+		msg:  `csv: "a" csv: "b"`,
+		want: `1:10 syntax error: duplicate field "csv" but type is not repeated`,
+	}, {
+		msg:  `times: ["yesterday"]`,
+		want: `1:9 syntax error: field "times": parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`,
+	}} {
+		if err := Unmarshal([]byte(tc.msg), new(message)); err == nil || err.Error() != tc.want {
+			t.Errorf("Unmarshal(%q) returned error %v, want %q", tc.msg, err, tc.want)
+		}
+	}
+}
+
+// listFlag is a flag.Value that splits its value on commas.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = strings.Split(s, ",")
+	return nil
+}
+
+// levelFlag is a flag.Value with a restricted set of values.
+type levelFlag struct {
+	level string
+}
+
+func (l *levelFlag) String() string {
+	return l.level
+}
+
+func (l *levelFlag) Set(s string) error {
+	if s != "debug" && s != "info" {
+		return fmt.Errorf("unknown level %q", s)
+	}
+	l.level = s
+	return nil
+}
+
+func TestUnmarshal_FlagValue(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		List    listFlag   `ccl:"list"`
+		Level   levelFlag  `ccl:"level"`
+		Pointer *levelFlag `ccl:"pointer"`
+	}
+	msg := `list: "a,b" level: "debug" pointer: "info"`
+	var got message
+	if err := Unmarshal([]byte(msg), &got); err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %s", msg, err)
+	}
+	want := message{List: listFlag{"a", "b"}, Level: levelFlag{"debug"}, Pointer: &levelFlag{"info"}}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(levelFlag{})); diff != "" {
+		t.Errorf("Unmarshal(%q) returned unexpected diff (-want +got):\n%s", msg, diff)
+	}
+
+	for _, msg := range []string{
+		`level: "trace"`,
+		`level: 1`,
+		`list: ["a", "b"]`,
+		`list: "a" list: "b"`,
+	} {
+		if err := Unmarshal([]byte(msg), new(message)); err == nil {
+			t.Errorf("Unmarshal(%q) succeeded, want error", msg)
+		}
+	}
+}
+
+func TestUnmarshalTo(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Int int `ccl:"int"`
+	}
+	got, err := UnmarshalTo[message]([]byte(`int: 5`))
+	if err != nil {
+		t.Fatalf("UnmarshalTo failed: %s", err)
+	}
+	if want := (message{Int: 5}); got != want {
+		t.Errorf("UnmarshalTo = %+v, want %+v", got, want)
+	}
+	if got, err := UnmarshalTo[message]([]byte(`int: "5"`)); err == nil {
+		t.Errorf("UnmarshalTo returned %+v, want error", got)
+	}
+	if got, err := UnmarshalTo[int]([]byte(`int: 5`)); err == nil {
+		t.Errorf("UnmarshalTo[int] returned %+v, want error", got)
+	}
+}
+
+func TestMustUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Int int `ccl:"int"`
+	}
+	if got, want := MustUnmarshal[message](`int: 5`), (message{Int: 5}); got != want {
+		t.Errorf("MustUnmarshal = %+v, want %+v", got, want)
+	}
+	defer func() {
+		want := `ccl: 1:6 syntax error: field "int" has type int, got string "5"`
+		if r := recover(); r != want {
+			t.Errorf("MustUnmarshal panicked with %v, want %q", r, want)
+		}
+	}()
+	MustUnmarshal[message](`int: "5"`)
+}
+
+func TestUnmarshalOptions_MaxBytes(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		String   string   `ccl:"string"`
+		Repeated []int64  `ccl:"repeated"`
+		Strings  []string `ccl:"strings"`
+	}
+
+	for _, tc := range []struct {
+		desc    string
+		msg     string
+		max     int
+		wantErr bool
+	}{{
+		desc: "Unlimited",
+		msg:  `string: "abcdefghijklmnopqrstuvwxyz"`,
+	}, {
+		desc: "String",
+		msg:  `string: "abcd"`,
+		max:  4,
+	}, {
+		desc:    "StringTooLong",
+		msg:     `string: "abcde"`,
+		max:     4,
+		wantErr: true,
+	}, {
+		desc: "List",
+		msg:  `repeated: [1, 2]`,
+		max:  16,
+	}, {
+		desc:    "ListTooLong",
+		msg:     `repeated: [1, 2, 3]`,
+		max:     16,
+		wantErr: true,
+	}, {
+		desc:    "RepeatedTooLong",
+		msg:     `repeated: 1 repeated: 2 repeated: 3`,
+		max:     16,
+		wantErr: true,
+	}, {
+		desc:    "ListOfStrings",
+		msg:     `strings: ["aaaaaaaa", "aaaaaaaa"]`,
+		max:     40,
+		wantErr: true,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			err := UnmarshalOptions{MaxBytes: tc.max}.Unmarshal([]byte(tc.msg), new(message))
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Unmarshal(%q) with MaxBytes %d returned error %v, want error: %t", tc.msg, tc.max, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnmarshalOptions_Timeout(t *testing.T) {
+	t.Parallel()
+
+	msg := []byte("repeated: [" + strings.Repeat("1, ", 1000) + "]")
+	var m struct {
+		Repeated []int `ccl:"repeated"`
+	}
+	if err := (UnmarshalOptions{Timeout: time.Hour}).Unmarshal(msg, &m); err != nil {
+		t.Errorf("Unmarshal with a one hour timeout failed: %s", err)
+	}
+	err := UnmarshalOptions{Timeout: time.Nanosecond}.Unmarshal(msg, &m)
+	if _, ok := err.(*syntaxError); !ok {
+		t.Errorf("Unmarshal with a one nanosecond timeout returned %v, want *syntaxError", err)
+	}
+}
+
+func TestUnmarshalOptions_MaxDepth(t *testing.T) {
+	t.Parallel()
+
+	type node struct {
+		Children []*node `ccl:"child"`
+		Any      any     `ccl:"any"`
+	}
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		opts UnmarshalOptions
+		want string
+	}{{
+		desc: "Unlimited",
+		msg:  strings.Repeat("child {", 100) + strings.Repeat("}", 100),
+	}, {
+		desc: "AtLimit",
+		msg:  `child { child: [{ child {} }] }`,
+		opts: UnmarshalOptions{MaxDepth: 4},
+	}, {
+		desc: "Messages",
+		msg:  `child { child { child {} } }`,
+		opts: UnmarshalOptions{MaxDepth: 2},
+		want: "1:23 syntax error: document is nested more than 2 deep",
+	}, {
+		desc: "Lists",
+		msg:  `child { child: [{}] }`,
+		opts: UnmarshalOptions{MaxDepth: 2},
+		want: "1:17 syntax error: document is nested more than 2 deep",
+	}, {
+		desc: "Any",
+		msg:  `any: [{ a: [1] }]`,
+		opts: UnmarshalOptions{MaxDepth: 2},
+		want: "1:12 syntax error: document is nested more than 2 deep",
+	}, {
+		desc: "Unknown",
+		msg:  `unknown { a { b {} } }`,
+		opts: UnmarshalOptions{MaxDepth: 2, DiscardUnknown: true},
+		want: "1:17 syntax error: document is nested more than 2 deep",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.opts.Unmarshal([]byte(tc.msg), new(node))
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("Unmarshal failed: %s", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.want {
+				t.Errorf("Unmarshal returned error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalOptions_Ranges(t *testing.T) {
+	t.Parallel()
+
+	type server struct {
+		Host string `ccl:"host"`
+	}
+	type message struct {
+		Password string            `ccl:"password"`
+		Server   []server          `ccl:"server"`
+		Tags     []string          `ccl:"tags"`
+		Labels   map[string]string `ccl:"labels"`
+		Unknown  any               `ccl:"unknown"`
+	}
+	msg := `password: "hunter"
+    "2" # comment
+server { host: "a" }
+server { host: "b" }
+tags: ["x",
+  "y"]
+labels { env: 'prod' }
+unknown: { a: [1, 2] }
+`
+	ranges := make(map[string]Range)
+	if err := (UnmarshalOptions{Ranges: ranges}).Unmarshal([]byte(msg), new(message)); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	got := make(map[string]string)
+	for path, r := range ranges {
+		got[path] = msg[r.Start:r.End]
+	}
+	want := map[string]string{
+		"password":    "password: \"hunter\"\n    \"2\"",
+		"server":      `server { host: "b" }`,
+		"server.host": `host: "b"`,
+		"tags":        "tags: [\"x\",\n  \"y\"]",
+		"labels":      `labels { env: 'prod' }`,
+		"labels.env":  `env: 'prod'`,
+		"unknown":     `unknown: { a: [1, 2] }`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unmarshal recorded unexpected diff in ranges (-want +got):\n%s", diff)
+	}
+}
+
+func TestUnmarshalOptions_DisableStringConcatenation(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Hosts []string          `ccl:"hosts"`
+		Name  string            `ccl:"name"`
+		Any   any               `ccl:"any"`
+		Map   map[string]string `ccl:"map"`
+	}
+	opts := UnmarshalOptions{DisableStringConcatenation: true}
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want string
+	}{{
+		desc: "Separate",
+		msg:  `hosts: ["a", "b"] name: "n" map { "k": "v" "k2": "v2" }`,
+	}, {
+		desc: "List",
+		msg: `hosts: [
+			"a.example.com"
+			"b.example.com",
+		]`,
+		want: "3:4 syntax error: strings can't be concatenated; if they're separate values, add a comma between them",
+	}, {
+		desc: "Field",
+		msg:  `name: "a" 'b'`,
+		want: "1:11 syntax error: strings can't be concatenated; if they're separate values, add a comma between them",
+	}, {
+		desc: "Any",
+		msg:  `any: ["a" "b"]`,
+		want: "1:11 syntax error: strings can't be concatenated; if they're separate values, add a comma between them",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			err := opts.Unmarshal([]byte(tc.msg), new(message))
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("Unmarshal failed: %s", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.want {
+				t.Errorf("Unmarshal returned error %v, want %q", err, tc.want)
+			}
+			// Without the option, the strings are concatenated.
+			if err := Unmarshal([]byte(tc.msg), new(message)); err != nil {
+				t.Errorf("Unmarshal without the option failed: %s", err)
+			}
+		})
+	}
+
+	n, err := Parse([]byte(`a: "x" "y"  b: "z"`))
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	if a, b := n.Fields[0].Value, n.Fields[1].Value; !a.Concatenated || b.Concatenated {
+		t.Errorf("Parse set Concatenated to %t and %t, want true and false", a.Concatenated, b.Concatenated)
+	}
+}
+
+func TestUnmarshalOptions_StrictEscapes(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		S string `ccl:"s"`
+	}
+	opts := UnmarshalOptions{StrictEscapes: true}
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want string
+	}{{
+		desc: "Common",
+		msg:  `s: "\x41\t\n\u00e9\U0001F600\\\'\"\a\b\f\r\v"`,
+	}, {
+		desc: "QuestionMark",
+		msg:  `s: "why\?"`,
+		want: `1:8 syntax error: escape sequence "\\?" isn't allowed; write "?" instead`,
+	}, {
+		desc: "Octal",
+		msg:  `s: "ab\101c"`,
+		want: `1:7 syntax error: octal escape "\\101" isn't allowed; write "\\x41" instead`,
+	}, {
+		desc: "Zero",
+		msg:  `s: "\0"`,
+		want: `1:5 syntax error: octal escape "\\0" isn't allowed; write "\\x00" instead`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			err := opts.Unmarshal([]byte(tc.msg), new(message))
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("Unmarshal failed: %s", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.want {
+				t.Errorf("Unmarshal returned error %v, want %q", err, tc.want)
+			}
+			// The escapes are allowed by default.
+			if err := Unmarshal([]byte(tc.msg), new(message)); err != nil {
+				t.Errorf("Unmarshal without the option failed: %s", err)
+			}
+		})
+	}
+}
+
+func TestUnmarshalOptions_PreserveCarriageReturns(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		S     string   `ccl:"s"`
+		Lines []string `ccl:"lines"`
+	}
+	for _, tc := range []struct {
+		desc         string
+		msg          string
+		want         message
+		wantPreserve message
+	}{{
+		desc:         "CRLFFile",
+		msg:          "# comment\r\ns: 'first\r\nsecond'\r\nlines: [\r\n  'a',\r\n  \"b\r\nc\",\r\n]\r\n",
+		want:         message{S: "first\nsecond", Lines: []string{"a", "b\nc"}},
+		wantPreserve: message{S: "first\r\nsecond", Lines: []string{"a", "b\r\nc"}},
+	}, {
+		desc:         "Continuation",
+		msg:          "s: 'one \\\r\ntwo'\r\n",
+		want:         message{S: "one two"},
+		wantPreserve: message{S: "one two"},
+	}, {
+		desc:         "Escape",
+		msg:          "s: 'a\\r\\nb'\r\n",
+		want:         message{S: "a\r\nb"},
+		wantPreserve: message{S: "a\r\nb"},
+	}, {
+		desc:         "LFFile",
+		msg:          "s: 'first\nsecond'\n",
+		want:         message{S: "first\nsecond"},
+		wantPreserve: message{S: "first\nsecond"},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var got message
+			if err := Unmarshal([]byte(tc.msg), &got); err != nil {
+				t.Fatalf("Unmarshal failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unmarshal returned unexpected diff (-want +got):\n%s", diff)
+			}
+			var gotPreserve message
+			if err := (UnmarshalOptions{PreserveCarriageReturns: true}).Unmarshal([]byte(tc.msg), &gotPreserve); err != nil {
+				t.Fatalf("Unmarshal with PreserveCarriageReturns failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.wantPreserve, gotPreserve); diff != "" {
+				t.Errorf("Unmarshal with PreserveCarriageReturns returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// A carriage return that isn't part of a line break is still an error.
+	const want = "1:6 syntax error: control character '\\r' must be escaped"
+	err := (UnmarshalOptions{PreserveCarriageReturns: true}).Unmarshal([]byte("s: 'a\rb'"), new(message))
+	if err == nil || err.Error() != want {
+		t.Errorf("Unmarshal returned error %v, want %q", err, want)
+	}
+}
+
+func TestUnmarshalOptions_Warnings(t *testing.T) {
+	t.Parallel()
+
+	type tls struct {
+		Cert string `ccl:"cert"`
+	}
+	type message struct {
+		Port    int               `ccl:"port"`
+		Ratio   float64           `ccl:"ratio"`
+		TLS     tls               `ccl:"tls"`
+		Backup  *tls              `ccl:"backup"`
+		Labels  map[string]string `ccl:"labels"`
+		Hosts   []string          `ccl:"hosts"`
+		Unknown any               `ccl:"unknown"`
+	}
+	msg := `port: +8080
+ratio: -1.5
+tls {}
+backup {}
+labels {}
+hosts: []
+unknown: +1
+`
+	var got []Warning
+	if err := (UnmarshalOptions{Warnings: &got}).Unmarshal([]byte(msg), new(message)); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	want := []Warning{
+		{Line: 1, Col: 7, Message: "number +8080 is written with a leading +"},
+		{Line: 3, Col: 5, Message: `field "tls" is an empty message, which has no effect`},
+		{Line: 5, Col: 8, Message: `field "labels" is an empty message, which has no effect`},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unmarshal returned unexpected diff in warnings (-want +got):\n%s", diff)
+	}
+	if s, want := got[0].String(), "1:7 warning: number +8080 is written with a leading +"; s != want {
+		t.Errorf("Warning.String() = %q, want %q", s, want)
+	}
+}
+
+func TestUnmarshalOptions_Logger(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Name  string `ccl:"name"`
+		Ports []int  `ccl:"ports"`
+	}
+	msg := `name: "a"
+ports: [80]
+extra: 1
+`
+	var buf strings.Builder
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	opts := UnmarshalOptions{Logger: logger, DiscardUnknown: true}
+	if err := opts.Unmarshal([]byte(msg), new(message)); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	want := `level=DEBUG msg="ccl token" pos=1:1 token=name
+level=DEBUG msg="ccl token" pos=1:5 token=:
+level=DEBUG msg="ccl token" pos=1:7 token="\"a\""
+level=DEBUG msg="ccl token" pos=2:1 token=ports
+level=DEBUG msg="ccl field set" pos=1:1 field=name value=a
+level=DEBUG msg="ccl token" pos=2:6 token=:
+level=DEBUG msg="ccl token" pos=2:8 token=[
+level=DEBUG msg="ccl token" pos=2:9 token=80
+level=DEBUG msg="ccl token" pos=2:11 token=]
+level=DEBUG msg="ccl field set" pos=2:1 field=ports value=[80]
+level=DEBUG msg="ccl token" pos=3:1 token=extra
+level=DEBUG msg="ccl unknown field skipped" pos=3:1 field=extra
+level=DEBUG msg="ccl token" pos=3:6 token=:
+level=DEBUG msg="ccl token" pos=3:8 token=1
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Unmarshal logged unexpected diff (-want +got):\n%s", diff)
+	}
+
+	// A logger that isn't enabled for debug logs isn't used.
+	buf.Reset()
+	opts.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+	if err := opts.Unmarshal([]byte(msg), new(message)); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("Unmarshal logged %q at the default level, want nothing", buf.String())
+	}
+}
+
+func TestUnmarshalOptions_Stats(t *testing.T) {
+	t.Parallel()
+
+	msg := []byte(`
+		name: "abc"
+		message {
+			repeated: [1, 2]
+			repeated: 3
+		}
+	`)
+	var m struct {
+		Name    string `ccl:"name"`
+		Message struct {
+			Repeated []int `ccl:"repeated"`
+		} `ccl:"message"`
+	}
+	var got Stats
+	if err := (UnmarshalOptions{Stats: &got}).Unmarshal(msg, &m); err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %s", msg, err)
+	}
+	want := Stats{
+		Tokens:      16,
+		MaxDepth:    2,
+		Fields:      4,
+		Duplicates:  1,
+		StringBytes: 3,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unmarshal(%q) returned unexpected stats (-want +got):\n%s", msg, diff)
+	}
+}
+
+func TestUnmarshalOptions_StatsLenient(t *testing.T) {
+	t.Parallel()
+
+	msg := []byte(`
+		name: "abc"
+		name: "def"
+		debug: "yes"
+		verbose: 0
+		ratio: inf
+		unknown { a: 1  b: 2 }
+		old_name: "x"
+		list: 1
+		list: 2
+	`)
+	var m struct {
+		Name    string  `ccl:"name"`
+		Debug   bool    `ccl:"debug"`
+		Verbose bool    `ccl:"verbose"`
+		Ratio   float64 `ccl:"ratio"`
+		List    []int   `ccl:"list"`
+	}
+	var got Stats
+	opts := Lenient()
+	opts.Stats = &got
+	if err := opts.Unmarshal(msg, &m); err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %s", msg, err)
+	}
+	want := Stats{
+		Duplicates:    1,
+		UnknownFields: 2,
+		Overwritten:   1,
+		LooseBooleans: 2,
+		NonFinite:     1,
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreFields(Stats{}, "Tokens", "MaxDepth", "Fields", "StringBytes")); diff != "" {
+		t.Errorf("Unmarshal(%q) returned unexpected stats (-want +got):\n%s", msg, diff)
+	}
+}
+
+func TestUnmarshalOptions_Presets(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Name    string             `ccl:"name"`
+		Enabled bool               `ccl:"enabled"`
+		Ports   []int              `ccl:"ports"`
+		Ratio   float64            `ccl:"ratio"`
+		Nested  struct{ A, B int } `ccl:"nested"`
+	}
+
+	for _, tc := range []struct {
+		desc    string
+		msg     string
+		opts    UnmarshalOptions
+		want    message
+		wantErr bool
+	}{{
+		desc: "Default",
+		msg:  `name: "a" ports: 1 ports: [2, 3]`,
+		want: message{Name: "a", Ports: []int{1, 2, 3}},
+	}, {
+		desc:    "StrictRepeatedKey",
+		msg:     `ports: 1 ports: [2, 3]`,
+		opts:    Strict(),
+		wantErr: true,
+	}, {
+		desc: "StrictList",
+		msg:  `name: "a" enabled: true ports: [1, 2]`,
+		opts: Strict(),
+		want: message{Name: "a", Enabled: true, Ports: []int{1, 2}},
+	}, {
+		desc:    "StrictLooseBoolean",
+		msg:     `enabled: "yes"`,
+		opts:    Strict(),
+		wantErr: true,
+	}, {
+		desc:    "StrictUnknown",
+		msg:     `unknown: 1`,
+		opts:    Strict(),
+		wantErr: true,
+	}, {
+		desc: "LenientUnknown",
+		msg:  `name: "a" unknown { b: [1, {c: 2}] } other: 'x' ports: 1`,
+		opts: Lenient(),
+		want: message{Name: "a", Ports: []int{1}},
+	}, {
+		desc:    "LenientUnknownSyntaxError",
+		msg:     `unknown: [1 2]`,
+		opts:    Lenient(),
+		wantErr: true,
+	}, {
+		desc: "LenientDuplicates",
+		msg:  `name: "a" name: "b" nested { A: 1 B: 2 } nested { B: 3 }`,
+		opts: Lenient(),
+		want: message{Name: "b", Nested: struct{ A, B int }{1, 3}},
+	}, {
+		desc: "LenientBooleans",
+		msg:  `enabled: "On"`,
+		opts: Lenient(),
+		want: message{Enabled: true},
+	}, {
+		desc: "LenientNumericBoolean",
+		msg:  `enabled: 1 enabled: 0`,
+		opts: Lenient(),
+		want: message{Enabled: false},
+	}, {
+		desc:    "LenientBadBoolean",
+		msg:     `enabled: "maybe"`,
+		opts:    Lenient(),
+		wantErr: true,
+	}, {
+		desc:    "LenientBadNumericBoolean",
+		msg:     `enabled: 2`,
+		opts:    Lenient(),
+		wantErr: true,
+	}, {
+		desc: "LenientNonFinite",
+		msg:  `ratio: inf`,
+		opts: Lenient(),
+		want: message{Ratio: math.Inf(1)},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var got message
+			err := tc.opts.Unmarshal([]byte(tc.msg), &got)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("%+v.Unmarshal(%q) returned error %v, want error: %t", tc.opts, tc.msg, err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%+v.Unmarshal(%q) returned unexpected diff (-want +got):\n%s", tc.opts, tc.msg, diff)
+			}
+		})
+	}
+}
+
+func TestCheckSize(t *testing.T) {
+	t.Parallel()
+
+	for _, n := range []int64{0, MaxSize - 1, MaxSize} {
+		if err := checkSize(n); err != nil {
+			t.Errorf("checkSize(%d) = %v, want nil", n, err)
+		}
+	}
+	for _, n := range []int64{MaxSize + 1, 1 << 32, 1<<63 - 1} {
+		var tooLarge *TooLargeError
+		if err := checkSize(n); !errors.As(err, &tooLarge) || tooLarge.Size != n {
+			t.Errorf("checkSize(%d) = %v, want TooLargeError with size %[1]d", n, err)
+		}
+	}
+}
+
+func TestTooLargeError(t *testing.T) {
+	t.Parallel()
+
+	if strconv.IntSize == 32 {
+		t.Skip("documents can't be larger than MaxSize on 32-bit platforms")
+	}
+	// The memory isn't touched, since the size is checked first.
+	data := make([]byte, MaxSize+1)
+	var v struct{}
+	for _, tc := range []struct {
+		desc string
+		f    func() error
+	}{{
+		desc: "Unmarshal",
+		f:    func() error { return Unmarshal(data, &v) },
+	}, {
+		desc: "Parse",
+		f: func() error {
+			_, err := Parse(data)
+			return err
+		},
+	}, {
+		desc: "ParseAll",
+		f: func() error {
+			_, err := ParseAll(data)
+			return err
+		},
+	}, {
+		desc: "Tokens",
+		f: func() error {
+			_, err := Tokens(data)
+			return err
+		},
+	}, {
+		desc: "Decoder",
+		f: func() error {
+			d, err := NewDecoder[struct{}](UnmarshalOptions{})
+			if err != nil {
+				return err
+			}
+			_, err = d.Decode(data)
+			return err
+		},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var tooLarge *TooLargeError
+			if err := tc.f(); !errors.As(err, &tooLarge) || tooLarge.Size != MaxSize+1 {
+				t.Errorf("%s of %d bytes returned %v, want TooLargeError", tc.desc, len(data), err)
+			}
+		})
+	}
+}
+
+func ExampleUnmarshal() {
+	// Pretend this was loaded from a file
+	msg := []byte(`
+		server {
+		    listen: "0.0.0.0:80"
+		    listen: "[::0]:80"
+		    location {
+		        path: "/"
+		        return: "301 https://$host$request_uri" # redirect to https
+		    }
+		    location {
+		        path: "/.well-known/acme-challenge/"
+		        root: "/var/lib/acme/acme-challenge"
+		        auth_basic: false
+		        auth_request: false
+		    }
+		}
+	`)
+	var serverConfig struct {
+		Server struct {
+			Listen   []string `ccl:"listen"`
+			Location []struct {
+				Path        string `ccl:"path"`
+				Root        string `ccl:"root"`
+				AuthBasic   bool   `ccl:"auth_basic"`
+				AuthRequest bool   `ccl:"auth_request"`
+				Return      string `ccl:"return"`
+			} `ccl:"location"`
+		} `ccl:"server"`
+	}
+	if err := Unmarshal(msg, &serverConfig); err != nil {
+		panic(err)
+	}
+	fmt.Println(serverConfig.Server.Location[0].Return)
+	// Output:
+	// 301 https://$host$request_uri
+}
+
+func BenchmarkLex(b *testing.B) {
+	msg := []byte(`
+		# This is a comment
+		string: 'asdf\n' # comment end of line
+		string2: "asdf\n"
+		int: 10
+		float: 10.5e13
+		bool: true
+		bool2: false
+		message { field: 10 }
+		repeated: [1, 2, 3]
+		repeated: 4
+		repeated: [5, 6]
+	`)
+	for b.Loop() {
+		l := &lexer{data: msg}
+		for {
+			_, _, err := l.next()
+			if err != nil {
+				if err == errEOF {
+					break
+				}
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	msg := []byte(`
+		# This is a comment
+		string: 'asdf\n' # comment end of line
+		string2: "asdf\n"
+		int: 10
+		float: 10.5e13
+		bool: true
+		bool2: false
+		message { field: 10 }
+		repeated: [1, 2, 3]
+		repeated: 4
+		repeated: [5, 6]
+	`)
+	type message struct {
+		String  string  `ccl:"string"`
+		String2 string  `ccl:"string2"`
+		Int     int     `ccl:"int"`
+		Float   float64 `ccl:"float"`
+		Bool    bool    `ccl:"bool"`
+		Bool2   bool    `ccl:"bool2"`
+		Message struct {
+			Field int `ccl:"field"`
+		} `ccl:"message"`
+		Repeated []int `ccl:"repeated"`
+	}
+	for b.Loop() {
+		var m message
+		if err := Unmarshal(msg, &m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// fuzzCorpus holds the seed inputs shared by the fuzz tests, including the
+// documents in cclcorpus.
+var fuzzCorpus = append([]string{
+	`
+		# This is a comment
+		string: 'asdf\n' # comment end of line
+		string2: "asdf\n"
+		int: 10
+		float: 10.5e13
+		bool: true
+		bool2: false
+		message { field: 10 }
+		repeated: [1, 2, 3]
+		repeated: 4
+		repeated: [5, 6]
+	`,
+	`string: "strings
+can just span multiple lines"`,
+	`int: 0`,
+	`int: 0xff`,
+	`int: 0XfF`,
+	`int: 0x0f`,
+	`int: -0x0f`,
+	`int: +0x0f`,
+	`float: 1.5e10`,
+	`float: 1.5E10`,
+	`float: -1.5e-10`,
+	`float: +1.5e+10`,
+	`float: 2.5%`,
+	`float: -1e-3%`,
+	`int: 10`,
+	`int: -10`,
+	`int: +10`,
+	`int8:1`,
+	`int16:1`,
+	`int32:1`,
+	`int64:1`,
+	`uint:1`,
+	`uint8:1`,
+	`uint16:1`,
+	`uint32:1`,
+	`uint64:1`,
+	`int:on`,
+	`int:no`,
+	`uint:on`,
+	`uint:no`,
+	`float:-1`,
+	`float:1`,
+	`string: 'asdf'`,
+	`string: "asdf"`,
+	`string: 'ain\'t'`,
+	`string: "won\'t"`,
+	`string: '\"'`,
+	`string: "\""`,
+	`string: "\?"`,
+	`string: '\\'`,
+	`string: '\a'`,
+	`string: '\b'`,
+	`string: '\f'`,
+	`string: '\n'`,
+	`string: '\r'`,
+	`string: '\t'`,
+	`string: '\v'`,
+	`string: '\x0a'`,
+	`string: "\xe4\xb8\x96"`,
+	`string: '\u2014'`,
+	`string: '\U0001f600'`,
+	`string: '\033'`,
+	`message { field: 10 }`,
+	`message {}`,
+	`
+		repeated: 1
+		repeated: 2`,
+	`repeated: [1, 2]`,
+	`repeated: []`,
+	`repeated: 1`,
+	`repeated: [
+		1,
+		2,
+	]`,
+	`repeated_message: [{}]`,
+	`message: /** inline comment **/ {}`,
+	`message: {} // line comment`,
+	`string: 'that'"'"'s cool'`,
+	`string: 'remove newline \
+from string'`,
+	"string: 'remove newline \\\r\nfrom string'",
+	`bytes:"dGVzdA=="`,
+	`bytes_wrapper: [1, 2, 3]`,
+	`time:"2025-10-28T07:41:47Z"`,
+	`time_pointer:"2025-10-28T07:41:47Z"`,
+	`int_pointer: 5`,
+	`repeated_pointer: [1, 2, 3]`,
+	`int: .`,
+	`float:1e+`,
+	`int:0xgg`,
+	`string: '\g'`,
+	`string: "\g"`,
+	"string:'\\\r'",
+	`string:"\x1"`,
+	`string:"\xgg"`,
+	`string:"\u001"`,
+	`string:"\ugggg"`,
+	`string: '`,
+	`string: "`,
+	`10`,
+	`msg {10}`,
+	`repeated []`,
+	`repeated: [1 2]`,
+	`repeated: [asdf]`,
+	`repeated_msg: [{asdf}]`,
+	`int: 0644`,
+	`string: "\777"`,
+	`string: "\x80"`,
+	`string`,
+	`string "abc"`,
+	`int:5 int:6`,
+	`int8:512`,
+	`int8:-512`,
+	`bytes:"dGVzdAo"`,
+	`bytes:[1,2,3]`,
+	`asdfasdfasdf:"asdf"`,
+	`repeated: [[1]]`,
+	`nested_repeated: [[1]]`,
+	`float:1e`,
+	`/*`,
+	`bytes:100000000000000000000`,
+	`float:1e700`,
+	`float:1A000`,
+}, corpus()...)
+
+// corpus returns the documents in cclcorpus.
+func corpus() []string {
+	var docs []string
+	for _, doc := range cclcorpus.Documents() {
+		docs = append(docs, string(doc.Data))
+	}
+	return docs
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	for _, tc := range fuzzCorpus {
 		f.Add([]byte(tc))
 	}
 	f.Fuzz(func(t *testing.T, input []byte) {
@@ -975,7 +2941,7 @@ from string'`,
 			IntPointer      *int             `ccl:"int_pointer"`
 			RepeatedPointer []*int           `ccl:"repeated_pointer"`
 
-			Ignore     map[int]int `ccl:"-,"` // unlike JSON this also means ignore
+			Ignore     map[int]int `ccl:"-"`
 			unexported int64
 		}
 		Unmarshal(input, &message)
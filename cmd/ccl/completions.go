@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"roseh.moe/pkg/ccl/x/cclschema"
+)
+
+func completions(args []string) error {
+	fs := flag.NewFlagSet("completions", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ccl completions schema")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Completions prints the keys described by a schema as a JSON completion")
+		fmt.Fprintln(fs.Output(), "manifest, for use by editors.")
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	data, err := readFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	s, err := cclschema.Parse(data)
+	if err != nil {
+		return fileError(fs.Arg(0), err)
+	}
+	manifest, err := s.CompletionManifest()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Printf("%s\n", manifest)
+	return err
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/cclschema"
+)
+
+func defaults(args []string) error {
+	fs := flag.NewFlagSet("defaults", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ccl defaults -schema schema file")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Defaults prints file with the defaults from the schema filled in, which is")
+		fmt.Fprintln(fs.Output(), "the effective config seen by a program using the schema.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	schemaFile := fs.String("schema", "", "read defaults from the schema in `file`")
+	fs.Parse(args)
+	if *schemaFile == "" || fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	data, err := readFile(*schemaFile)
+	if err != nil {
+		return err
+	}
+	schema, err := cclschema.Parse(data)
+	if err != nil {
+		return fileError(*schemaFile, err)
+	}
+	data, err = readFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	n, err := ccl.Parse(data)
+	if err != nil {
+		return fileError(fs.Arg(0), err)
+	}
+	_, err = os.Stdout.Write(ccl.FormatNode(schema.ApplyDefaults(n)))
+	return err
+}
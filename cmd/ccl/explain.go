@@ -0,0 +1,231 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/cclschema"
+)
+
+func explain(args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ccl explain [-schema schema] path file...")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Explain prints the effective value of the field at the dot-separated path,")
+		fmt.Fprintln(fs.Output(), "such as server.listen, in the config made by merging the files in order,")
+		fmt.Fprintln(fs.Output(), "so that later files override earlier ones. Messages are merged field by")
+		fmt.Fprintln(fs.Output(), "field, and other values, including lists, are replaced. It also prints")
+		fmt.Fprintln(fs.Output(), "where the value was set, the values it overrides, and the field's")
+		fmt.Fprintln(fs.Output(), "default and documentation from the schema.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	schemaFile := fs.String("schema", "", "read defaults and documentation from the schema in `file`")
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+	names := strings.Split(path, ".")
+
+	var field *cclschema.Field
+	if *schemaFile != "" {
+		data, err := readFile(*schemaFile)
+		if err != nil {
+			return err
+		}
+		schema, err := cclschema.Parse(data)
+		if err != nil {
+			return fileError(*schemaFile, err)
+		}
+		if field = schemaField(schema, names); field == nil {
+			return fmt.Errorf("%s: no field %q in the schema", displayName(*schemaFile), path)
+		}
+	}
+
+	var layers []ccl.Layer
+	var docs []*ccl.Node
+	for _, name := range fs.Args()[1:] {
+		data, err := readConfig(name)
+		if err != nil {
+			return err
+		}
+		n, err := ccl.Parse(data)
+		if err != nil {
+			return fileError(name, err)
+		}
+		layers = append(layers, ccl.Layer{Name: displayName(name), Data: data})
+		docs = append(docs, n)
+	}
+	t := configType(docs)
+	opts := ccl.MergeOptions{Unmarshal: ccl.UnmarshalOptions{DiscardUnknown: true}}
+
+	// Each file is merged on its own to find the ones that write the field,
+	// and then they're all merged for its effective value.
+	var sources []string
+	for _, l := range layers {
+		v, prov, err := merge(t, opts, l)
+		if err != nil {
+			return err
+		}
+		value, err := find(v, names)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			sources = append(sources, source(prov, names).String())
+		}
+	}
+	v, prov, err := merge(t, opts, layers...)
+	if err != nil {
+		return err
+	}
+	value, err := find(v, names)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	switch {
+	case value != nil:
+		b.Write(ccl.FormatNode(&ccl.Node{Kind: ccl.KindMessage, Fields: []*ccl.Field{{Name: path, Value: value}}}))
+		last := len(sources) - 1
+		if value.Kind == ccl.KindMessage {
+			fmt.Fprintf(&b, "merged from: %s\n", strings.Join(sources, ", "))
+		} else {
+			fmt.Fprintf(&b, "set at: %s\n", source(prov, names))
+			if last > 0 {
+				fmt.Fprintf(&b, "overrides: %s\n", strings.Join(sources[:last], ", "))
+			}
+		}
+	case field != nil && field.Default != nil:
+		b.Write(ccl.FormatNode(&ccl.Node{Kind: ccl.KindMessage, Fields: []*ccl.Field{{Name: path, Value: field.Default}}}))
+		fmt.Fprintln(&b, "set at: the schema's default")
+	default:
+		fmt.Fprintf(&b, "%s isn't set\n", path)
+	}
+	if field != nil {
+		if field.Default != nil {
+			def := ccl.FormatNode(&ccl.Node{Kind: ccl.KindMessage, Fields: []*ccl.Field{{Name: "default", Value: field.Default}}})
+			b.Write(def)
+		}
+		if field.Doc != "" {
+			fmt.Fprintf(&b, "doc: %s\n", field.Doc)
+		}
+	}
+	_, err = os.Stdout.WriteString(b.String())
+	return err
+}
+
+// schemaField returns the field of the schema at the given path, or nil.
+func schemaField(s *cclschema.Schema, names []string) *cclschema.Field {
+	f := s.Lookup(names[0])
+	for _, name := range names[1:] {
+		switch {
+		case f == nil:
+			return nil
+		case f.Type == cclschema.Map:
+			f = f.Values
+		default:
+			f = f.Lookup(name)
+		}
+	}
+	return f
+}
+
+// configType returns a struct type that the messages ns can all be
+// unmarshaled into, so that they can be merged by [ccl.MergeOptions]. A
+// field that's a message wherever it's written is a pointer to a struct
+// built the same way, a field that's written more than once in a message is
+// a []any, and any other field is an any.
+func configType(ns []*ccl.Node) reflect.Type {
+	var names []string
+	values := make(map[string][]*ccl.Node)
+	repeated := make(map[string]bool)
+	for _, n := range ns {
+		count := make(map[string]int)
+		for _, f := range n.Fields {
+			if _, ok := values[f.Name]; !ok {
+				names = append(names, f.Name)
+			}
+			values[f.Name] = append(values[f.Name], f.Value)
+			count[f.Name]++
+			repeated[f.Name] = repeated[f.Name] || count[f.Name] > 1
+		}
+	}
+	var fields []reflect.StructField
+	for _, name := range names {
+		if name == "" || strings.Contains(name, ",") {
+			// The name can't be written in a tag, so the field is left
+			// out, and skipped by DiscardUnknown.
+			continue
+		}
+		t := reflect.TypeFor[any]()
+		switch {
+		case repeated[name]:
+			t = reflect.TypeFor[[]any]()
+		case !slices.ContainsFunc(values[name], func(v *ccl.Node) bool { return v.Kind != ccl.KindMessage }):
+			t = reflect.PointerTo(configType(values[name]))
+		}
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("F%d", len(fields)),
+			Type: t,
+			Tag:  reflect.StructTag(fmt.Sprintf("ccl:%q", name+",")),
+		})
+	}
+	return reflect.StructOf(fields)
+}
+
+// merge merges the layers into a new value of type t, and returns it as a
+// pointer along with where its fields were set.
+func merge(t reflect.Type, opts ccl.MergeOptions, layers ...ccl.Layer) (any, ccl.Provenance, error) {
+	v := reflect.New(t).Interface()
+	opts.Provenance = make(ccl.Provenance)
+	if err := opts.Merge(v, layers...); err != nil {
+		return nil, nil, err
+	}
+	return v, opts.Provenance, nil
+}
+
+// find returns the value of the field at the given path in the merged config
+// v, or nil if it's not set.
+func find(v any, names []string) (*ccl.Node, error) {
+	data, err := ccl.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	n, err := ccl.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if n.Kind != ccl.KindMessage {
+			return nil, nil
+		}
+		i := slices.IndexFunc(n.Fields, func(f *ccl.Field) bool { return f.Name == name })
+		if i < 0 {
+			return nil, nil
+		}
+		n = n.Fields[i].Value
+	}
+	return n, nil
+}
+
+// source returns where the field at the given path got its value. A field
+// inside a value that was set as a whole, such as a message that's also
+// written as a string in another file, got it where that value was set.
+func source(prov ccl.Provenance, names []string) ccl.Source {
+	for i := len(names); i > 0; i-- {
+		if s, ok := prov[strings.Join(names[:i], ".")]; ok {
+			return s
+		}
+	}
+	return ccl.Source{}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"roseh.moe/pkg/ccl"
+)
+
+// trailingCommaFlag is a flag that selects a ccl.TrailingComma by name.
+type trailingCommaFlag ccl.TrailingComma
+
+var trailingCommaNames = []string{
+	ccl.TrailingCommaMultiline: "multiline",
+	ccl.TrailingCommaAlways:    "always",
+	ccl.TrailingCommaNever:     "never",
+}
+
+func (f *trailingCommaFlag) String() string {
+	return trailingCommaNames[*f]
+}
+
+func (f *trailingCommaFlag) Set(s string) error {
+	for i, name := range trailingCommaNames {
+		if name == s {
+			*f = trailingCommaFlag(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown policy %q, want multiline, always, or never", s)
+}
+
+func format(args []string) error {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ccl fmt [-l] [-w] [flags] file...")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Fmt reformats ccl documents, keeping their comments. By default the")
+		fmt.Fprintln(fs.Output(), "result is printed to standard output.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	var opts ccl.FormatOptions
+	list := fs.Bool("l", false, "list files whose formatting differs instead of printing them")
+	write := fs.Bool("w", false, "write the result back to each file instead of standard output")
+	fs.StringVar(&opts.Indent, "indent", "", "indent with `string` instead of four spaces")
+	fs.BoolVar(&opts.AlignValues, "align", false, "align the values of neighboring fields")
+	fs.BoolVar(&opts.SortKeys, "sort", false, "sort the fields of every message by name")
+	fs.Var((*stringList)(&opts.PinnedKeys), "pin", "with -sort, write fields named `key` first; can be given more than once")
+	fs.IntVar(&opts.CommentWidth, "comment-width", 0, "wrap comments on their own line to `width` characters")
+	fs.Var((*trailingCommaFlag)(&opts.TrailingComma), "trailing-comma", "when to write a comma after the last list element: multiline, always, or never")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	for _, name := range fs.Args() {
+		data, err := readFile(name)
+		if err != nil {
+			return err
+		}
+		out, err := opts.Format(data)
+		if err != nil {
+			return fileError(name, err)
+		}
+		switch {
+		case *list:
+			if !bytes.Equal(data, out) {
+				_, err = fmt.Println(displayName(name))
+			}
+		case *write && name != "-":
+			err = os.WriteFile(name, out, 0o666)
+		default:
+			_, err = os.Stdout.Write(out)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
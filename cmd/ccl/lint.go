@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/ccllint"
+	"roseh.moe/pkg/ccl/x/cclschema"
+)
+
+func lint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ccl lint [-schema schema] [-watch] file...")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Lint reports legal but suspicious constructs in ccl documents, and exits")
+		fmt.Fprintln(fs.Output(), "with status 1 if there are any. Every syntax error in a document is")
+		fmt.Fprintln(fs.Output(), "reported, not just the first. A finding can be suppressed with a")
+		fmt.Fprintln(fs.Output(), "\"# ccl:ignore rule\" comment on the field. The rules are:")
+		fmt.Fprintln(fs.Output())
+		for _, r := range ccllint.Rules {
+			fmt.Fprintf(fs.Output(), "\t%-14s %s\n", r.Name, r.Doc)
+		}
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "With -watch, lint keeps running while the documents are edited. Each time")
+		fmt.Fprintln(fs.Output(), "a document changes, its findings are printed again, or \"ok\" if it had")
+		fmt.Fprintln(fs.Output(), "findings that are now fixed. A directory can be given, in which case the")
+		fmt.Fprintln(fs.Output(), "documents are the .ccl files in it and its subdirectories.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	schemaFile := fs.String("schema", "", "also validate the documents against the schema in `file`")
+	watch := fs.Bool("watch", false, "keep running, and lint files again when they change")
+	interval := fs.Duration("interval", time.Second, "with -watch, check for changes every `duration`")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var schema *cclschema.Schema
+	if *schemaFile != "" {
+		data, err := readFile(*schemaFile)
+		if err != nil {
+			return err
+		}
+		if schema, err = cclschema.Parse(data); err != nil {
+			return fileError(*schemaFile, err)
+		}
+	}
+	if *watch {
+		return watchLint(fs.Args(), schema, *interval)
+	}
+	found := false
+	for _, name := range fs.Args() {
+		data, err := readFile(name)
+		if err != nil {
+			return err
+		}
+		findings := lintFile(displayName(name), data, schema)
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+		found = found || len(findings) > 0
+	}
+	if found {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// lintFile returns the findings in the document data, which was read from the
+// named file, as lines to print.
+func lintFile(name string, data []byte, schema *cclschema.Schema) []string {
+	var findings []string
+	n, err := ccl.ParseAll(data)
+	if err != nil {
+		// Report every syntax error, and don't lint what's left of the
+		// document.
+		for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+			findings = append(findings, fmt.Sprintf("%s:%s", name, err))
+		}
+		return findings
+	}
+	diags := ccllint.Lint(n)
+	if schema != nil {
+		diags = append(diags, schema.Validate(n)...)
+	}
+	for _, d := range diags {
+		findings = append(findings, fmt.Sprintf("%s: %s", name, d))
+	}
+	return findings
+}
+
+// watchLint lints the files named by args, which may be directories holding
+// .ccl files, and then checks them for changes every interval, linting the
+// files that change. It only returns if it can't read a file or directory.
+func watchLint(args []string, schema *cclschema.Schema, interval time.Duration) error {
+	type state struct {
+		modTime time.Time
+		size    int64
+		failing bool
+	}
+	files := make(map[string]*state)
+	for {
+		seen := make(map[string]bool)
+		for _, arg := range args {
+			err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() || path != arg && filepath.Ext(path) != ".ccl" {
+					return nil
+				}
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				seen[path] = true
+				st := files[path]
+				if st != nil && info.ModTime().Equal(st.modTime) && info.Size() == st.size {
+					return nil
+				}
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				findings := lintFile(path, data, schema)
+				for _, f := range findings {
+					fmt.Println(f)
+				}
+				if st != nil && st.failing && len(findings) == 0 {
+					fmt.Printf("%s: ok\n", path)
+				}
+				files[path] = &state{info.ModTime(), info.Size(), len(findings) > 0}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		for path := range files {
+			if !seen[path] {
+				delete(files, path)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
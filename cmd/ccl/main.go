@@ -0,0 +1,132 @@
+// Command ccl is a tool for working with ccl documents.
+//
+// Usage:
+//
+//	ccl <command> [arguments]
+//
+// The commands are:
+//
+//	completions  print the completion manifest of a schema
+//	defaults     print a document with the defaults from a schema filled in
+//	explain      print the effective value of a field and where it was set
+//	fmt          reformat documents
+//	lint         report suspicious constructs in documents
+//	migrate      upgrade documents to the latest version of a schema
+//	redact       print a document with sensitive values removed
+//	verify       check documents against a schema exported by a program
+//
+// A file name of "-" means standard input, so commands can be used in
+// pipelines. Results that would be written back to a file with -w are written
+// to standard output instead.
+//
+// Run "ccl <command> -h" for help with a command.
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"roseh.moe/pkg/ccl"
+)
+
+type command struct {
+	name  string
+	short string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"completions", "print the completion manifest of a schema", completions},
+	{"defaults", "print a document with the defaults from a schema filled in", defaults},
+	{"explain", "print the effective value of a field and where it was set", explain},
+	{"fmt", "reformat documents", format},
+	{"lint", "report suspicious constructs in documents", lint},
+	{"migrate", "upgrade documents to the latest version of a schema", migrate},
+	{"redact", "print a document with sensitive values removed", redact},
+	{"verify", "check documents against a schema exported by a program", verify},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ccl <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "The commands are:")
+	fmt.Fprintln(os.Stderr)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "\t%-12s %s\n", c.name, c.short)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "A file name of \"-\" means standard input.")
+	os.Exit(2)
+}
+
+// stringList is a flag that can be given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// readFile reads the named file, or standard input if name is "-".
+func readFile(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// readConfig is like readFile, but reads files with [ccl.ReadFile], so that
+// they're decompressed if they're compressed. It's for commands that don't
+// write the file back.
+func readConfig(name string) ([]byte, error) {
+	if name == "-" {
+		return readFile(name)
+	}
+	return ccl.ReadFile(name)
+}
+
+// fileError adds the name of the file that err is about to it. An error
+// that starts with a position is joined to the name, as in
+// "app.ccl:3:9 syntax error: ...".
+func fileError(name string, err error) error {
+	if positionRE.MatchString(err.Error()) {
+		return fmt.Errorf("%s:%w", displayName(name), err)
+	}
+	return fmt.Errorf("%s: %w", displayName(name), err)
+}
+
+var positionRE = regexp.MustCompile(`^[0-9]+:[0-9]+ `)
+
+// displayName returns the name of a file for messages about it.
+func displayName(name string) string {
+	if name == "-" {
+		return "<stdin>"
+	}
+	return name
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ccl: ")
+	if len(os.Args) < 2 {
+		usage()
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "ccl: unknown command %q\n", os.Args[1])
+	usage()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/cclschema"
+)
+
+func migrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ccl migrate -schema schema [-from version] [-w] file...")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Migrate upgrades documents to the latest version of a schema using the")
+		fmt.Fprintln(fs.Output(), "migrations it describes, keeping comments. The version of a document is")
+		fmt.Fprintf(fs.Output(), "read from its top-level %s key unless -from is given.\n", cclschema.VersionKey)
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	schemaFile := fs.String("schema", "", "read migrations from the schema in `file`")
+	from := fs.Int("from", -1, "the schema `version` that the documents were written for")
+	write := fs.Bool("w", false, "write the result back to each file instead of standard output")
+	fs.Parse(args)
+	if *schemaFile == "" || fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	data, err := readFile(*schemaFile)
+	if err != nil {
+		return err
+	}
+	schema, err := cclschema.Parse(data)
+	if err != nil {
+		return fileError(*schemaFile, err)
+	}
+	for _, name := range fs.Args() {
+		data, err := readFile(name)
+		if err != nil {
+			return err
+		}
+		n, err := ccl.Parse(data)
+		if err != nil {
+			return fileError(name, err)
+		}
+		version := *from
+		if version < 0 {
+			v, ok := cclschema.Version(n)
+			if !ok {
+				return fmt.Errorf("%s: no %s key; use -from to give the version", displayName(name), cclschema.VersionKey)
+			}
+			version = v
+		}
+		if _, err := schema.Migrate(n, version); err != nil {
+			return fmt.Errorf("%s: %w", displayName(name), err)
+		}
+		out := ccl.FormatNode(n)
+		if *write && name != "-" {
+			err = os.WriteFile(name, out, 0o666)
+		} else {
+			_, err = os.Stdout.Write(out)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
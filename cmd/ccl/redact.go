@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"roseh.moe/pkg/ccl"
+)
+
+func redact(args []string) error {
+	fs := flag.NewFlagSet("redact", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ccl redact [-path pattern]... [-key pattern]... file")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Redact prints file with the selected values replaced, so it can be")
+		fmt.Fprintln(fs.Output(), "attached to a bug report.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	var rules ccl.RedactRules
+	fs.Var((*stringList)(&rules.Paths), "path", "redact the field at this dot-separated `pattern`, e.g. server.tls.key")
+	fs.Var((*stringList)(&rules.Keys), "key", "redact fields whose name matches `pattern` at any depth, e.g. '*password*'")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	data, err := readFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	n, err := ccl.Parse(data)
+	if err != nil {
+		return fileError(fs.Arg(0), err)
+	}
+	_, err = os.Stdout.Write(ccl.FormatNode(ccl.Redact(n, rules)))
+	return err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/cclschema"
+)
+
+func verify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: ccl verify -against schema file...")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Verify checks that documents are valid configs for a program, and exits")
+		fmt.Fprintln(fs.Output(), "with status 1 if any aren't. Unlike lint, it only reports syntax errors")
+		fmt.Fprintln(fs.Output(), "and violations of the schema, not questions of style.")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "The schema is usually exported by the program itself, from the Go type")
+		fmt.Fprintln(fs.Output(), "of its config, so that changes to configs can be checked in CI without")
+		fmt.Fprintln(fs.Output(), "building the program:")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "\ts, err := cclschema.FromType(reflect.TypeFor[Config]())")
+		fmt.Fprintln(fs.Output(), "\t...")
+		fmt.Fprintln(fs.Output(), "\tos.WriteFile(\"config.schema.ccl\", s.Marshal(), 0o644)")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	schemaFile := fs.String("against", "", "verify the documents against the schema in `file`")
+	fs.Parse(args)
+	if *schemaFile == "" || fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	data, err := readFile(*schemaFile)
+	if err != nil {
+		return err
+	}
+	schema, err := cclschema.Parse(data)
+	if err != nil {
+		return fileError(*schemaFile, err)
+	}
+	found := false
+	for _, name := range fs.Args() {
+		data, err := readFile(name)
+		if err != nil {
+			return err
+		}
+		findings := verifyFile(displayName(name), data, schema)
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+		found = found || len(findings) > 0
+	}
+	if found {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// verifyFile returns the syntax errors in the document data, which was read
+// from the named file, or else the ways it doesn't match the schema, as lines
+// to print.
+func verifyFile(name string, data []byte, schema *cclschema.Schema) []string {
+	var findings []string
+	n, err := ccl.ParseAll(data)
+	if err != nil {
+		for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+			findings = append(findings, fmt.Sprintf("%s:%s", name, err))
+		}
+		return findings
+	}
+	for _, d := range schema.Validate(n) {
+		findings = append(findings, fmt.Sprintf("%s: %s", name, d))
+	}
+	return findings
+}
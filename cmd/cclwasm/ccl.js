@@ -0,0 +1,23 @@
+// A thin wrapper that loads the cclwasm module. wasm_exec.js, which is in
+// $(go env GOROOT)/lib/wasm, must be loaded first; it defines globalThis.Go.
+//
+//	import { load } from "./ccl.js";
+//	const ccl = await load("ccl.wasm");
+//	const { text, error } = ccl.format(source);
+
+let loading;
+
+// load fetches and starts the module at url, and resolves to an object with
+// its parse, format and lint functions. The module is only started once.
+export function load(url) {
+  loading ??= (async () => {
+    const go = new globalThis.Go();
+    const { instance } = await WebAssembly.instantiateStreaming(
+      fetch(url),
+      go.importObject,
+    );
+    go.run(instance);
+    return globalThis.ccl;
+  })();
+  return loading;
+}
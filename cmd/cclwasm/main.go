@@ -0,0 +1,76 @@
+//go:build js && wasm
+
+// Command cclwasm is a WebAssembly module that lets JavaScript programs,
+// such as a config editor in a browser, parse, format and lint ccl
+// documents with the same code as the Go package. Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o ccl.wasm ./cmd/cclwasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// and load it with the wrapper in ccl.js:
+//
+//	import { load } from "./ccl.js";
+//	const ccl = await load("ccl.wasm");
+//
+// The module sets globalThis.ccl to an object with three functions, each of
+// which takes the text of a document:
+//
+//	ccl.parse(text)          // {value: {...}} or {error: "1:5 syntax error: ..."}
+//	ccl.format(text)         // {text: "..."} or {error: "..."}
+//	ccl.lint(text, schema?)  // {diagnostics: [{path, rule, message}, ...]}
+//
+// Parse returns the document as an object, with numbers as JavaScript
+// numbers. Lint reports syntax errors and lint findings, and validates the
+// document against the schema if one is given; if the schema is invalid,
+// its result has an "error" string instead. The diagnostics are the same as
+// those of the libccl shared library.
+package main
+
+import (
+	"syscall/js"
+
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/internal/check"
+)
+
+func main() {
+	js.Global().Set("ccl", js.ValueOf(map[string]any{
+		"parse":  js.FuncOf(parse),
+		"format": js.FuncOf(format),
+		"lint":   js.FuncOf(lint),
+	}))
+	select {}
+}
+
+// text returns the i'th argument as a string, or "" if it's not a string.
+func text(args []js.Value, i int) string {
+	if i >= len(args) || args[i].Type() != js.TypeString {
+		return ""
+	}
+	return args[i].String()
+}
+
+func parse(_ js.Value, args []js.Value) any {
+	v, err := check.Value([]byte(text(args, 0)))
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	return map[string]any{"value": v}
+}
+
+func format(_ js.Value, args []js.Value) any {
+	out, err := ccl.Format([]byte(text(args, 0)))
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	return map[string]any{"text": string(out)}
+}
+
+func lint(_ js.Value, args []js.Value) any {
+	var schema []byte
+	if len(args) > 1 && args[1].Type() == js.TypeString {
+		schema = []byte(args[1].String())
+	}
+	res := check.JSON([]byte(text(args, 0)), schema)
+	return js.Global().Get("JSON").Call("parse", string(res))
+}
@@ -0,0 +1,54 @@
+//go:build cgo
+
+// Command libccl is a shared library that lets programs in other languages
+// validate ccl documents with the same code as the Go package. Build it
+// with
+//
+//	go build -buildmode=c-shared -o libccl.so ./cmd/libccl
+//
+// which also writes libccl.h, declaring:
+//
+//	char *ValidateCCL(char *data, int length, char *schema, int schemaLength);
+//	void FreeCCL(char *p);
+//
+// ValidateCCL checks the document of the given length for syntax errors and
+// lint findings, and validates it against the schema if schema isn't NULL.
+// It returns a JSON object, which must be freed with FreeCCL:
+//
+//	{"diagnostics": [{"path": "server.port", "rule": "type", "message": "..."}]}
+//
+// A document is valid if the list is empty. If the schema is invalid, the
+// object has an "error" string instead. From Python, for example:
+//
+//	lib = ctypes.CDLL("./libccl.so")
+//	lib.ValidateCCL.restype = ctypes.c_void_p
+//	p = lib.ValidateCCL(data, len(data), None, 0)
+//	result = json.loads(ctypes.string_at(p))
+//	lib.FreeCCL(p)
+package main
+
+// #include <stdlib.h>
+import "C"
+
+import (
+	"unsafe"
+
+	"roseh.moe/pkg/ccl/internal/check"
+)
+
+//export ValidateCCL
+func ValidateCCL(data *C.char, length C.int, schema *C.char, schemaLength C.int) *C.char {
+	var s []byte
+	if schema != nil {
+		s = C.GoBytes(unsafe.Pointer(schema), schemaLength)
+	}
+	res := check.JSON(C.GoBytes(unsafe.Pointer(data), length), s)
+	return C.CString(string(res))
+}
+
+//export FreeCCL
+func FreeCCL(p *C.char) {
+	C.free(unsafe.Pointer(p))
+}
+
+func main() {}
@@ -0,0 +1,143 @@
+package ccl
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// A decompressor is a compression format that's recognized by [ReadFile]
+// and [Decoder.DecodeReader].
+type decompressor struct {
+	name  string
+	ext   string
+	magic string
+	// open is nil for a format that's recognized but can't be read until
+	// it's registered.
+	open func(io.Reader) (io.Reader, error)
+}
+
+var (
+	decompressorsMu sync.RWMutex
+	decompressors   = []*decompressor{{
+		name:  "gzip",
+		ext:   ".gz",
+		magic: "\x1f\x8b",
+		open:  func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	}, {
+		name:  "zstd",
+		ext:   ".zst",
+		magic: "\x28\xb5\x2f\xfd",
+	}}
+)
+
+// RegisterDecompressor registers a compression format, so that files with
+// the extension ext, or that start with the bytes magic, are decompressed
+// with open by [ReadFile] and [Decoder.DecodeReader]. gzip is built in.
+// zstd is recognized, but since the standard library doesn't have a zstd
+// decoder, one has to be registered before zstd files can be read:
+//
+//	ccl.RegisterDecompressor("zstd", ".zst", "\x28\xb5\x2f\xfd", func(r io.Reader) (io.Reader, error) {
+//	    return zstd.NewReader(r)
+//	})
+//
+// RegisterDecompressor is meant to be called from init functions. It panics
+// if a decompressor for the format is already registered.
+func RegisterDecompressor(name, ext, magic string, open func(io.Reader) (io.Reader, error)) {
+	decompressorsMu.Lock()
+	defer decompressorsMu.Unlock()
+	for _, d := range decompressors {
+		if d.name != name {
+			continue
+		}
+		if d.open != nil {
+			panic(fmt.Sprintf("ccl: decompressor for %s registered twice", name))
+		}
+		d.ext, d.magic, d.open = ext, magic, open
+		return
+	}
+	decompressors = append(decompressors, &decompressor{name: name, ext: ext, magic: magic, open: open})
+}
+
+// magicLen returns the length of the longest magic number of the formats
+// that are registered.
+func magicLen() int {
+	decompressorsMu.RLock()
+	defer decompressorsMu.RUnlock()
+	n := 0
+	for _, d := range decompressors {
+		n = max(n, len(d.magic))
+	}
+	return n
+}
+
+// findDecompressor returns the format of a file called name that starts
+// with prefix, or nil if it isn't compressed. name can be empty when it
+// isn't known.
+func findDecompressor(name string, prefix []byte) *decompressor {
+	decompressorsMu.RLock()
+	defer decompressorsMu.RUnlock()
+	for _, d := range decompressors {
+		if name != "" && strings.HasSuffix(name, d.ext) || bytes.HasPrefix(prefix, []byte(d.magic)) {
+			// d is copied, since RegisterDecompressor can change it.
+			c := *d
+			return &c
+		}
+	}
+	return nil
+}
+
+// decompress returns a reader for the decompressed contents of r, which is
+// in format d.
+func (d *decompressor) decompress(r io.Reader) (io.Reader, error) {
+	if d.open == nil {
+		return nil, fmt.Errorf("data is compressed with %s, which needs a decompressor registered with RegisterDecompressor", d.name)
+	}
+	zr, err := d.open(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", d.name, err)
+	}
+	return zr, nil
+}
+
+// readAll reads r until EOF, and returns a [TooLargeError] once more than
+// [MaxSize] bytes have been read.
+func readAll(buf *bytes.Buffer, r io.Reader) error {
+	n, err := buf.ReadFrom(io.LimitReader(r, MaxSize+1))
+	if err != nil {
+		return err
+	}
+	return checkSize(n)
+}
+
+// ReadFile reads the named file, like [os.ReadFile], and decompresses it if
+// it's compressed. Compressed files are recognized by their extension, as in
+// config.ccl.gz, or by the magic number they start with. See
+// [RegisterDecompressor] for the formats that are supported. Like a file
+// that isn't compressed, a file that's larger than [MaxSize] bytes once it's
+// decompressed is rejected with a [TooLargeError].
+func ReadFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	prefix, _ := br.Peek(magicLen())
+	var r io.Reader = br
+	if d := findDecompressor(name, prefix); d != nil {
+		if r, err = d.decompress(br); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", name, err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := readAll(&buf, r); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,135 @@
+package ccl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatalf("gzip failed: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("gzip failed: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func init() {
+	// A stand-in compression format that's just its magic number followed
+	// by the data.
+	RegisterDecompressor("test", ".ccltest", "CCL\x00", func(r io.Reader) (io.Reader, error) {
+		magic := make([]byte, 4)
+		if _, err := io.ReadFull(r, magic); err != nil {
+			return nil, err
+		}
+		return r, nil
+	})
+}
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+
+	const doc = "name: \"a\"\n"
+	for _, tc := range []struct {
+		desc string
+		name string
+		data []byte
+	}{{
+		desc: "Plain",
+		name: "config.ccl",
+		data: []byte(doc),
+	}, {
+		desc: "GzipExtension",
+		name: "config.ccl.gz",
+		data: gzipped(t, doc),
+	}, {
+		desc: "GzipMagic",
+		name: "config.ccl",
+		data: gzipped(t, doc),
+	}, {
+		desc: "Registered",
+		name: "config",
+		data: []byte("CCL\x00" + doc),
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), tc.name)
+			if err := os.WriteFile(path, tc.data, 0o666); err != nil {
+				t.Fatalf("WriteFile failed: %s", err)
+			}
+			got, err := ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile failed: %s", err)
+			}
+			if diff := cmp.Diff(doc, string(got)); diff != "" {
+				t.Errorf("ReadFile returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadFile_Error(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		name string
+		data []byte
+		want string
+	}{{
+		desc: "NotGzip",
+		name: "config.ccl.gz",
+		data: []byte("name: \"a\"\n"),
+		want: "reading %s: gzip: gzip: invalid header",
+	}, {
+		desc: "Zstd",
+		name: "config.ccl.zst",
+		data: []byte("\x28\xb5\x2f\xfd"),
+		want: "reading %s: data is compressed with zstd, which needs a decompressor registered with RegisterDecompressor",
+	}, {
+		desc: "TruncatedGzip",
+		name: "config.ccl",
+		data: gzipped(t, "name: \"a\"\n")[:15],
+		want: "reading %s: unexpected EOF",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), tc.name)
+			if err := os.WriteFile(path, tc.data, 0o666); err != nil {
+				t.Fatalf("WriteFile failed: %s", err)
+			}
+			_, err := ReadFile(path)
+			if want := fmt.Sprintf(tc.want, path); err == nil || err.Error() != want {
+				t.Errorf("ReadFile returned error %v, want %q", err, want)
+			}
+		})
+	}
+	if _, err := ReadFile(filepath.Join(t.TempDir(), "missing.ccl")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ReadFile of a missing file returned error %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestRegisterDecompressor_Twice(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("RegisterDecompressor of gzip didn't panic")
+		}
+	}()
+	RegisterDecompressor("gzip", ".gz", "\x1f\x8b", nil)
+}
@@ -0,0 +1,191 @@
+package ccl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// A Decoder decodes ccl documents into values of type T, which must be a
+// struct type. The work of inspecting T is done once by [NewDecoder] rather
+// than on every call, and scratch memory is kept between calls, so a Decoder
+// is faster than [Unmarshal] when decoding many documents of the same type.
+//
+// A Decoder is not safe for concurrent use, but Decoders can be kept in a
+// [sync.Pool] so that their scratch memory is reused. [Decoder.Reset] gives
+// a pooled Decoder a new input to read with [Decoder.Next].
+type Decoder[T any] struct {
+	opts     UnmarshalOptions
+	fields   map[structField]fieldInfo
+	seenFree []map[string]bool
+	buf      bytes.Buffer
+	zbuf     bytes.Buffer // decompressed input of DecodeReader
+	consumed int
+
+	r   io.Reader // input given to Reset that hasn't been read yet
+	in  []byte    // input given to Reset, once it's read
+	off int       // offset in in of the next document
+}
+
+// NewDecoder returns a Decoder for type T that uses the given options.
+func NewDecoder[T any](opts UnmarshalOptions) (*Decoder[T], error) {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("type %s is not a struct", t)
+	}
+	fields := make(map[structField]fieldInfo)
+	if err := fieldMap(fields, make(map[reflect.Type]bool), t); err != nil {
+		return nil, err
+	}
+	return &Decoder[T]{opts: opts, fields: fields}, nil
+}
+
+// Decode decodes a ccl document into a new value of type T. Like
+// [Unmarshal], it decodes all of data.
+func (d *Decoder[T]) Decode(data []byte) (T, error) {
+	return d.decode(data, 0, false)
+}
+
+// DecodeFrame is like Decode, but it also accepts a document that's a single
+// message in braces, such as {name: "a"}. Since the closing brace marks the
+// end of the document, decoding stops there and the rest of data is left
+// alone, which lets a ccl document be embedded in a larger stream.
+// [Decoder.NumBytesConsumed] reports where the document ended.
+func (d *Decoder[T]) DecodeFrame(data []byte) (T, error) {
+	return d.decode(data, 0, true)
+}
+
+// decode decodes the document that starts at offset off of data.
+func (d *Decoder[T]) decode(data []byte, off int, frame bool) (T, error) {
+	var v T
+	d.consumed = 0
+	if err := checkSize(int64(len(data))); err != nil {
+		return v, err
+	}
+	p := newParser(data, d.fields, d.opts)
+	p.lexer.i = off
+	p.seenFree = d.seenFree
+	out := reflect.ValueOf(&v).Elem()
+	var n int
+	var err error
+	if frame {
+		n, err = p.parseFrame(out)
+	} else {
+		n, err = len(data), p.parse(out)
+	}
+	d.seenFree = p.seenFree
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	d.consumed = n - off
+	return v, nil
+}
+
+// NumBytesConsumed returns the number of bytes of input used by the last
+// successful call to Decode, DecodeFrame, DecodeReader, or Next, or 0 if it
+// failed. It's less than the length of the input only when DecodeFrame or
+// Next decoded a message in braces followed by more data.
+func (d *Decoder[T]) NumBytesConsumed() int {
+	return d.consumed
+}
+
+// DecodeReader reads r until EOF and decodes the result into a new value of
+// type T. The buffer used to read r is kept by d for the next call. Reading
+// stops with a [TooLargeError] once more than [MaxSize] bytes have been read.
+//
+// Input that's compressed in one of the formats described in
+// [RegisterDecompressor], recognized by its magic number, is decompressed
+// first.
+func (d *Decoder[T]) DecodeReader(r io.Reader) (T, error) {
+	d.consumed = 0
+	data, err := d.read(r)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return d.Decode(data)
+}
+
+// read reads r until EOF into d.buf, and decompresses it into d.zbuf if
+// it's compressed. It returns the contents of whichever buffer holds the
+// document.
+func (d *Decoder[T]) read(r io.Reader) ([]byte, error) {
+	d.buf.Reset()
+	d.zbuf.Reset()
+	if err := readAll(&d.buf, r); err != nil {
+		return nil, err
+	}
+	data := d.buf.Bytes()
+	if dec := findDecompressor("", data); dec != nil {
+		zr, err := dec.decompress(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if err := readAll(&d.zbuf, zr); err != nil {
+			return nil, err
+		}
+		data = d.zbuf.Bytes()
+	}
+	return data, nil
+}
+
+// Reset makes r the input of d, to be decoded by [Decoder.Next], and drops
+// whatever was left of the input before. It lets a Decoder be reused for
+// one input after another, such as the bodies of requests:
+//
+//	var decoders = sync.Pool{New: func() any {
+//	    d, _ := ccl.NewDecoder[Config](ccl.UnmarshalOptions{})
+//	    return d
+//	}}
+//
+//	d := decoders.Get().(*ccl.Decoder[Config])
+//	defer decoders.Put(d)
+//	d.Reset(req.Body)
+//	cfg, err := d.Next()
+//
+// A []byte can be given as a [bytes.Reader]. The scratch memory of d is
+// kept, unless r is nil, in which case it's released, for example after
+// decoding an unusually large document.
+func (d *Decoder[T]) Reset(r io.Reader) {
+	d.r, d.in, d.off = r, nil, 0
+	d.consumed = 0
+	if r == nil {
+		d.seenFree = nil
+		d.buf = bytes.Buffer{}
+		d.zbuf = bytes.Buffer{}
+	}
+}
+
+// Next decodes the next document of the input given to [Decoder.Reset] into
+// a new value of type T. The first call reads the input until EOF, like
+// [Decoder.DecodeReader]. The input can hold a single document, or a series
+// of messages in braces as accepted by [Decoder.DecodeFrame], such as
+// {name: "a"} {name: "b"}. Positions in errors are relative to the start of
+// the input. Next returns [io.EOF] once there are no more documents, or
+// after it returns any other error.
+func (d *Decoder[T]) Next() (T, error) {
+	var zero T
+	d.consumed = 0
+	if d.r != nil {
+		in, err := d.read(d.r)
+		d.r = nil
+		if err != nil {
+			return zero, err
+		}
+		d.in, d.off = in, 0
+	}
+	l := lexer{data: d.in, i: d.off}
+	if err := l.skipSpace(); err == nil && l.i == len(d.in) {
+		d.in, d.off = nil, 0
+		return zero, io.EOF
+	}
+	v, err := d.decode(d.in, d.off, true)
+	if err != nil {
+		d.in, d.off = nil, 0
+		return zero, err
+	}
+	d.off += d.consumed
+	return v, nil
+}
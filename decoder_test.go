@@ -0,0 +1,293 @@
+package ccl
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecoder(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Name    string `ccl:"name"`
+		Message struct {
+			Repeated []int `ccl:"repeated"`
+		} `ccl:"message"`
+	}
+	d, err := NewDecoder[message](UnmarshalOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %s", err)
+	}
+	for _, tc := range []struct {
+		msg  string
+		want message
+	}{{
+		msg: `name: "a" message { repeated: [1, 2] }`,
+		want: message{Name: "a", Message: struct {
+			Repeated []int `ccl:"repeated"`
+		}{Repeated: []int{1, 2}}},
+	}, {
+		msg:  `name: "b"`,
+		want: message{Name: "b"},
+	}} {
+		got, err := d.Decode([]byte(tc.msg))
+		if err != nil {
+			t.Fatalf("Decode(%q) failed: %s", tc.msg, err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("Decode(%q) returned unexpected diff (-want +got):\n%s", tc.msg, diff)
+		}
+		d.Reset(nil)
+	}
+	if got, err := d.Decode([]byte(`name: "a" name: "b"`)); err == nil {
+		t.Errorf("Decode with duplicate field returned %+v, want error", got)
+	}
+}
+
+func TestDecoder_DecodeReader(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Name string `ccl:"name"`
+	}
+	d, err := NewDecoder[message](UnmarshalOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %s", err)
+	}
+	for _, name := range []string{"first", "second"} {
+		msg := `name: "` + name + `"`
+		got, err := d.DecodeReader(strings.NewReader(msg))
+		if err != nil {
+			t.Fatalf("DecodeReader(%q) failed: %s", msg, err)
+		}
+		if got.Name != name {
+			t.Errorf("DecodeReader(%q) = %+v, want name %q", msg, got, name)
+		}
+	}
+}
+
+func TestDecoder_DecodeReader_Compressed(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Name string `ccl:"name"`
+	}
+	d, err := NewDecoder[message](UnmarshalOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %s", err)
+	}
+	// Plain and compressed inputs take turns, to check that the buffers
+	// kept between calls are reset.
+	for _, name := range []string{"a", "b", "c"} {
+		data := []byte(`name: "` + name + `"`)
+		if name != "b" {
+			data = gzipped(t, string(data))
+		}
+		got, err := d.DecodeReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("DecodeReader failed: %s", err)
+		}
+		if got.Name != name {
+			t.Errorf("DecodeReader = %+v, want name %q", got, name)
+		}
+	}
+}
+
+func TestDecoder_Reset(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Name string `ccl:"name"`
+	}
+	d, err := NewDecoder[message](UnmarshalOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %s", err)
+	}
+	for _, tc := range []struct {
+		desc    string
+		in      string
+		want    []message
+		wantErr string
+	}{{
+		desc: "Document",
+		in:   `name: "a"`,
+		want: []message{{Name: "a"}},
+	}, {
+		desc: "Frames",
+		in:   "{name: \"a\"}\n{name: \"b\"} # last\n",
+		want: []message{{Name: "a"}, {Name: "b"}},
+	}, {
+		desc: "FrameThenDocument",
+		in:   `{name: "a"} name: "b"`,
+		want: []message{{Name: "a"}, {Name: "b"}},
+	}, {
+		desc: "Empty",
+		in:   " # nothing\n",
+	}, {
+		desc:    "ErrorInSecondFrame",
+		in:      "{name: \"a\"}\n{name: 1}",
+		want:    []message{{Name: "a"}},
+		wantErr: `2:8 syntax error: field "name" has type string, got number 1`,
+	}} {
+		d.Reset(strings.NewReader(tc.in))
+		var got []message
+		var gotErr string
+		for {
+			v, err := d.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				gotErr = err.Error()
+				if _, err := d.Next(); err != io.EOF {
+					t.Errorf("%s: Next after error %q returned %v, want io.EOF", tc.desc, gotErr, err)
+				}
+				break
+			}
+			got = append(got, v)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("%s: Next returned unexpected diff (-want +got):\n%s", tc.desc, diff)
+		}
+		if gotErr != tc.wantErr {
+			t.Errorf("%s: Next returned error %q, want %q", tc.desc, gotErr, tc.wantErr)
+		}
+	}
+}
+
+func TestNewDecoder_InvalidType(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewDecoder[int](UnmarshalOptions{}); err == nil {
+		t.Errorf("NewDecoder[int] succeeded, want error")
+	}
+	if _, err := NewDecoder[struct {
+		F string `ccl:",asdf"`
+	}](UnmarshalOptions{}); err == nil {
+		t.Errorf("NewDecoder with an unknown tag option succeeded, want error")
+	}
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	msg := []byte(`
+		# This is a comment
+		string: 'asdf\n' # comment end of line
+		string2: "asdf\n"
+		int: 10
+		float: 10.5e13
+		bool: true
+		bool2: false
+		message { field: 10 }
+		repeated: [1, 2, 3]
+		repeated: 4
+		repeated: [5, 6]
+	`)
+	type message struct {
+		String  string  `ccl:"string"`
+		String2 string  `ccl:"string2"`
+		Int     int     `ccl:"int"`
+		Float   float64 `ccl:"float"`
+		Bool    bool    `ccl:"bool"`
+		Bool2   bool    `ccl:"bool2"`
+		Message struct {
+			Field int `ccl:"field"`
+		} `ccl:"message"`
+		Repeated []int `ccl:"repeated"`
+	}
+	d, err := NewDecoder[message](UnmarshalOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for b.Loop() {
+		if _, err := d.Decode(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecoder_NumBytesConsumed(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Name   string `ccl:"name"`
+		Nested struct {
+			Name string `ccl:"name"`
+		} `ccl:"nested"`
+	}
+	d, err := NewDecoder[message](UnmarshalOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %s", err)
+	}
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want message
+		n    int
+	}{{
+		desc: "Document",
+		msg:  "name: \"a\" # comment\n",
+		want: message{Name: "a"},
+		n:    20,
+	}, {
+		desc: "Braces",
+		msg:  `{name: "a" nested {name: "b"}} trailing data`,
+		want: message{Name: "a", Nested: struct {
+			Name string `ccl:"name"`
+		}{Name: "b"}},
+		n: 30,
+	}, {
+		desc: "BracesThenDocument",
+		msg:  ` {} {name: "a"}`,
+		n:    3,
+	}} {
+		got, err := d.DecodeFrame([]byte(tc.msg))
+		if err != nil {
+			t.Fatalf("%s: DecodeFrame(%q) failed: %s", tc.desc, tc.msg, err)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("%s: DecodeFrame(%q) returned unexpected diff (-want +got):\n%s", tc.desc, tc.msg, diff)
+		}
+		if n := d.NumBytesConsumed(); n != tc.n {
+			t.Errorf("%s: DecodeFrame(%q) consumed %d bytes, want %d", tc.desc, tc.msg, n, tc.n)
+		}
+	}
+	for _, msg := range []string{`{name: "a"`, `{name: 1}`, `name: 1`} {
+		if _, err := d.DecodeFrame([]byte(msg)); err == nil {
+			t.Errorf("DecodeFrame(%q) succeeded, want error", msg)
+		} else if n := d.NumBytesConsumed(); n != 0 {
+			t.Errorf("DecodeFrame(%q) failed but consumed %d bytes, want 0", msg, n)
+		}
+	}
+}
+
+func TestDecoder_Decode_TrailingData(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Name string `ccl:"name"`
+	}
+	d, err := NewDecoder[message](UnmarshalOptions{})
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %s", err)
+	}
+	const msg = `{name: "a"} garbage {{{`
+	if got, err := d.Decode([]byte(msg)); err == nil {
+		t.Errorf("Decode(%q) = %+v, want error", msg, got)
+	} else if n := d.NumBytesConsumed(); n != 0 {
+		t.Errorf("Decode(%q) failed but consumed %d bytes, want 0", msg, n)
+	}
+	got, err := d.DecodeFrame([]byte(msg))
+	if err != nil {
+		t.Fatalf("DecodeFrame(%q) failed: %s", msg, err)
+	}
+	if want := (message{Name: "a"}); got != want {
+		t.Errorf("DecodeFrame(%q) = %+v, want %+v", msg, got, want)
+	}
+	if n := d.NumBytesConsumed(); n != 11 {
+		t.Errorf("DecodeFrame(%q) consumed %d bytes, want 11, leaving %q", msg, n, msg[n:])
+	}
+}
@@ -0,0 +1,244 @@
+package ccl
+
+import (
+	"bytes"
+	"slices"
+)
+
+// FormatEdited prints n, which was parsed from src with [Parse] and then
+// edited, using the default options. See [FormatOptions.FormatEdited].
+func FormatEdited(src []byte, n *Node) []byte {
+	return FormatOptions{}.FormatEdited(src, n)
+}
+
+// FormatEdited prints n, which was parsed from src with [Parse] and then
+// edited, changing as little of src as possible so that automated edits make
+// small diffs. The parts of the document that weren't edited are copied from
+// src byte for byte, with their original formatting, and only the edited
+// fields and values are printed with the options in o.
+//
+// Fields and values are matched up with src by their offsets, so nodes that
+// were added have zero offsets, as they do when they're built by hand. A
+// field or value whose offsets don't match its place in src is treated as
+// new. Fields that were removed are deleted along with their comments. If the
+// fields of a message are reordered, or its end comments are changed, the
+// whole message is printed again. If src doesn't parse, or n didn't come from
+// it, FormatEdited is the same as [FormatOptions.FormatNode].
+func (o FormatOptions) FormatEdited(src []byte, n *Node) []byte {
+	orig, err := Parse(src)
+	if err != nil || n.Kind != KindMessage || n.Start != orig.Start || n.End != orig.End {
+		return o.FormatNode(n)
+	}
+	if o.Indent == "" {
+		o.Indent = "    "
+	}
+	e := &editor{opts: o, src: src}
+	if !e.message(orig, n, 0, true) {
+		return o.FormatNode(n)
+	}
+	var b []byte
+	i := 0
+	for _, ed := range e.edits {
+		b = append(b, src[i:ed.start]...)
+		b = append(b, ed.text...)
+		i = ed.end
+	}
+	return append(b, src[i:]...)
+}
+
+// An edit replaces src[start:end] with text.
+type edit struct {
+	start, end int
+	text       []byte
+}
+
+// An editor compares a parsed document with its edited version and collects
+// the edits that turn one into the other. The edits are collected in order of
+// their offsets.
+type editor struct {
+	opts  FormatOptions
+	src   []byte
+	edits []edit
+}
+
+func (e *editor) replace(start, end int, text []byte) {
+	e.edits = append(e.edits, edit{start, end, text})
+}
+
+// lineEnd returns the offset after the newline that ends the line at offset
+// i, skipping over the trailing comment if there's one. If something else
+// comes first, lineEnd returns i.
+func (e *editor) lineEnd(i int, trailingComment string) int {
+	j := i
+	for j < len(e.src) && (e.src[j] == ' ' || e.src[j] == '\t') {
+		j++
+	}
+	if trailingComment != "" && bytes.HasPrefix(e.src[j:], []byte(trailingComment)) {
+		j += len(trailingComment)
+	}
+	for j < len(e.src) && (e.src[j] == ' ' || e.src[j] == '\t' || e.src[j] == '\r') {
+		j++
+	}
+	if j < len(e.src) && e.src[j] == '\n' {
+		return j + 1
+	}
+	if j == len(e.src) {
+		return j
+	}
+	return i
+}
+
+// isSpace reports whether b separates tokens.
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+// lineStart reports whether offset i is at the start of a line.
+func (e *editor) lineStart(i int) bool {
+	return i == 0 || e.src[i-1] == '\n'
+}
+
+// field replaces src[start:end] with f, printed on lines of its own.
+func (e *editor) field(start, end int, f *Field, depth int, first bool) {
+	p := &printer{opts: e.opts}
+	if !e.lineStart(start) {
+		p.b = append(p.b, '\n')
+	}
+	if f.BlankLine && !first {
+		p.b = append(p.b, '\n')
+	}
+	p.field(f, depth, 0)
+	e.replace(start, end, p.b)
+}
+
+// value replaces src[o.Start:o.End] with n.
+func (e *editor) value(o, n *Node, depth int) {
+	p := &printer{opts: e.opts}
+	p.value(n, depth)
+	e.replace(o.Start, o.End, p.b)
+}
+
+// message collects the edits that turn the message o into n, whose fields
+// are printed at the given depth. It reports false, without collecting any
+// edits, if the message has to be printed again as a whole.
+func (e *editor) message(o, n *Node, depth int, topLevel bool) bool {
+	if !slices.Equal(o.EndComments, n.EndComments) || len(o.Fields) == 0 && len(n.Fields) > 0 && !topLevel {
+		return false
+	}
+	// match[i] is the index in o.Fields of n.Fields[i], or -1 if it's new.
+	match := make([]int, len(n.Fields))
+	last := -1
+	for i, f := range n.Fields {
+		match[i] = slices.IndexFunc(o.Fields, func(of *Field) bool { return of.Start == f.Start && of.End == f.End })
+		if match[i] < 0 {
+			continue
+		}
+		if match[i] <= last {
+			return false
+		}
+		last = match[i]
+	}
+
+	// regionEnd returns the end of the text of o.Fields[j], including its
+	// trailing comment and newline. Its leading comments start where the
+	// field before it ends.
+	regionEnd := func(j int) int {
+		if j < 0 {
+			if topLevel {
+				return 0
+			}
+			return e.lineEnd(o.Start+1, "")
+		}
+		return e.lineEnd(o.Fields[j].End, o.Fields[j].TrailingComment)
+	}
+	// remove deletes o.Fields[j].
+	remove := func(j int) {
+		start, end := regionEnd(j-1), regionEnd(j)
+		if !e.lineStart(start) && e.lineStart(end) && end > start {
+			end-- // keep the newline that ends the line before
+		}
+		var sep []byte
+		if start > 0 && end < len(e.src) && !isSpace(e.src[start-1]) && !isSpace(e.src[end]) {
+			// The fields on either side would run together, as in
+			// `a: 1 b: "x"c: 3` without b.
+			sep = []byte(" ")
+		}
+		e.replace(start, end, sep)
+	}
+	next := 0 // the index of the next field of o
+	for i, f := range n.Fields {
+		j := match[i]
+		if j < 0 {
+			pos := regionEnd(next - 1)
+			e.field(pos, pos, f, depth, i == 0)
+			continue
+		}
+		for ; next < j; next++ {
+			remove(next)
+		}
+		next++
+		of := o.Fields[j]
+		switch {
+		case identicalField(of, f):
+		case of.Name != f.Name || !slices.Equal(of.Comments, f.Comments) || of.BlankLine != f.BlankLine && i > 0 ||
+			of.TrailingComment != f.TrailingComment || (of.Value.Kind == KindMessage) != (f.Value.Kind == KindMessage):
+			e.field(regionEnd(j-1), regionEnd(j), f, depth, i == 0)
+		default:
+			e.node(of.Value, f.Value, depth)
+		}
+	}
+	for ; next < len(o.Fields); next++ {
+		remove(next)
+	}
+	return true
+}
+
+// node collects the edits that turn the value o into n.
+func (e *editor) node(o, n *Node, depth int) {
+	if n.Start != o.Start || n.End != o.End || n.Kind != o.Kind {
+		e.value(o, n, depth)
+		return
+	}
+	if identical(o, n) {
+		return
+	}
+	switch n.Kind {
+	case KindMessage:
+		before := len(e.edits)
+		if !e.message(o, n, depth+1, false) {
+			e.edits = e.edits[:before]
+			e.value(o, n, depth)
+		}
+	case KindList:
+		same := len(o.List) == len(n.List) && slices.Equal(o.EndComments, n.EndComments)
+		for i := 0; same && i < len(o.List); i++ {
+			oe, ne := o.List[i], n.List[i]
+			same = oe.Start == ne.Start && oe.End == ne.End &&
+				slices.Equal(oe.Comments, ne.Comments) && oe.TrailingComment == ne.TrailingComment
+		}
+		if !same {
+			e.value(o, n, depth)
+			return
+		}
+		for i := range o.List {
+			e.node(o.List[i], n.List[i], depth+1)
+		}
+	default:
+		e.value(o, n, depth)
+	}
+}
+
+// identical reports whether a and b would be printed the same way, including
+// their comments. Unlike [Node.Equal], the order of fields matters.
+func identical(a, b *Node) bool {
+	return a.Kind == b.Kind && a.Bool == b.Bool && a.Number == b.Number && a.String == b.String &&
+		slices.EqualFunc(a.List, b.List, identical) &&
+		slices.EqualFunc(a.Fields, b.Fields, identicalField) &&
+		slices.Equal(a.EndComments, b.EndComments) &&
+		slices.Equal(a.Comments, b.Comments) && a.TrailingComment == b.TrailingComment
+}
+
+func identicalField(a, b *Field) bool {
+	return a.Name == b.Name && a.BlankLine == b.BlankLine && a.TrailingComment == b.TrailingComment &&
+		slices.Equal(a.Comments, b.Comments) && identical(a.Value, b.Value)
+}
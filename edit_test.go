@@ -0,0 +1,292 @@
+package ccl
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFormatEdited(t *testing.T) {
+	t.Parallel()
+
+	const src = `# Server config.
+name:   'web'   # aligned by hand
+port:   8080
+
+tls {
+  cert: "a.pem"
+  key:  "a.key"
+}
+hosts: ["a", "b"] // trailing
+`
+	for _, tc := range []struct {
+		desc string
+		edit func(n *Node)
+		want string
+	}{{
+		desc: "Unchanged",
+		edit: func(n *Node) {},
+		want: src,
+	}, {
+		desc: "ChangeScalar",
+		edit: func(n *Node) {
+			n.Fields[1].Value.Number = "9090"
+		},
+		want: `# Server config.
+name:   'web'   # aligned by hand
+port:   9090
+
+tls {
+  cert: "a.pem"
+  key:  "a.key"
+}
+hosts: ["a", "b"] // trailing
+`,
+	}, {
+		desc: "ChangeNested",
+		edit: func(n *Node) {
+			n.Fields[2].Value.Fields[1].Value.String = "b.key"
+		},
+		want: `# Server config.
+name:   'web'   # aligned by hand
+port:   8080
+
+tls {
+  cert: "a.pem"
+  key:  "b.key"
+}
+hosts: ["a", "b"] // trailing
+`,
+	}, {
+		desc: "ChangeListElement",
+		edit: func(n *Node) {
+			n.Fields[3].Value.List[1].String = "c"
+		},
+		want: `# Server config.
+name:   'web'   # aligned by hand
+port:   8080
+
+tls {
+  cert: "a.pem"
+  key:  "a.key"
+}
+hosts: ["a", "c"] // trailing
+`,
+	}, {
+		desc: "AppendToList",
+		edit: func(n *Node) {
+			l := n.Fields[3].Value
+			l.List = append(l.List, &Node{Kind: KindString, String: "c"})
+		},
+		want: `# Server config.
+name:   'web'   # aligned by hand
+port:   8080
+
+tls {
+  cert: "a.pem"
+  key:  "a.key"
+}
+hosts: ["a", "b", "c"] // trailing
+`,
+	}, {
+		desc: "RemoveField",
+		edit: func(n *Node) {
+			n.Fields = append(n.Fields[:2], n.Fields[3:]...)
+		},
+		want: `# Server config.
+name:   'web'   # aligned by hand
+port:   8080
+hosts: ["a", "b"] // trailing
+`,
+	}, {
+		desc: "RemoveFirstField",
+		edit: func(n *Node) {
+			n.Fields = n.Fields[1:]
+		},
+		want: `port:   8080
+
+tls {
+  cert: "a.pem"
+  key:  "a.key"
+}
+hosts: ["a", "b"] // trailing
+`,
+	}, {
+		desc: "AddFields",
+		edit: func(n *Node) {
+			tls := n.Fields[2].Value
+			tls.Fields = append(tls.Fields, &Field{Name: "ca", Value: &Node{Kind: KindString, String: "ca.pem"}})
+			n.Fields = append(n.Fields, &Field{
+				Name:      "debug",
+				Value:     &Node{Kind: KindBool, Bool: true},
+				Comments:  []string{"# Added."},
+				BlankLine: true,
+			})
+		},
+		want: `# Server config.
+name:   'web'   # aligned by hand
+port:   8080
+
+tls {
+  cert: "a.pem"
+  key:  "a.key"
+    ca: "ca.pem"
+}
+hosts: ["a", "b"] // trailing
+
+# Added.
+debug: true
+`,
+	}, {
+		desc: "RenameField",
+		edit: func(n *Node) {
+			n.Fields[1].Name = "listen_port"
+		},
+		want: `# Server config.
+name:   'web'   # aligned by hand
+listen_port: 8080
+
+tls {
+  cert: "a.pem"
+  key:  "a.key"
+}
+hosts: ["a", "b"] // trailing
+`,
+	}, {
+		desc: "ReplaceValue",
+		edit: func(n *Node) {
+			n.Fields[2].Value = &Node{Kind: KindMessage, Fields: []*Field{
+				{Name: "acme", Value: &Node{Kind: KindBool, Bool: true}},
+			}}
+		},
+		want: `# Server config.
+name:   'web'   # aligned by hand
+port:   8080
+
+tls {
+    acme: true
+}
+hosts: ["a", "b"] // trailing
+`,
+	}, {
+		desc: "ChangeKind",
+		edit: func(n *Node) {
+			n.Fields[2].Value = &Node{Kind: KindBool}
+		},
+		want: `# Server config.
+name:   'web'   # aligned by hand
+port:   8080
+
+tls: false
+hosts: ["a", "b"] // trailing
+`,
+	}, {
+		desc: "Reorder",
+		edit: func(n *Node) {
+			n.Fields[0], n.Fields[1] = n.Fields[1], n.Fields[0]
+		},
+		want: `port: 8080
+# Server config.
+name: "web" # aligned by hand
+
+tls {
+    cert: "a.pem"
+    key: "a.key"
+}
+hosts: ["a", "b"] // trailing
+`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			n, err := Parse([]byte(src))
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %s", src, err)
+			}
+			tc.edit(n)
+			got := FormatEdited([]byte(src), n)
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("FormatEdited returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFormatEdited_RemoveBetweenTokens(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		src  string
+		want string
+	}{{
+		desc: "String",
+		src:  `a: 1 b: "x"c: 3`,
+		want: `a: 1 c: 3`,
+	}, {
+		desc: "Message",
+		src:  `a: true b{}c: 3`,
+		want: `a: true c: 3`,
+	}, {
+		desc: "Spaced",
+		src:  `a: 1 b: 2 c: 3`,
+		want: `a: 1 c: 3`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			n, err := Parse([]byte(tc.src))
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %s", tc.src, err)
+			}
+			n.Fields = slices.Delete(n.Fields, 1, 2)
+			got := FormatEdited([]byte(tc.src), n)
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("FormatEdited(%q) returned unexpected diff (-want +got):\n%s", tc.src, diff)
+			}
+		})
+	}
+}
+
+// FuzzFormatEdited checks that FormatEdited doesn't change a document that
+// wasn't edited, and that its output has the edited value.
+func FuzzFormatEdited(f *testing.F) {
+	for _, tc := range fuzzCorpus {
+		f.Add([]byte(tc))
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		n, err := Parse(input)
+		if err != nil {
+			return
+		}
+		if got := FormatEdited(input, n); string(got) != string(input) {
+			t.Fatalf("FormatEdited(%q) with no edits = %q", input, got)
+		}
+		// Drop every other field, recursively, and add one at the end.
+		var edit func(n *Node)
+		edit = func(n *Node) {
+			for _, v := range n.List {
+				edit(v)
+			}
+			var fields []*Field
+			for i, f := range n.Fields {
+				if i%2 == 1 {
+					edit(f.Value)
+					fields = append(fields, f)
+				}
+			}
+			n.Fields = fields
+		}
+		edit(n)
+		n.Fields = append(n.Fields, &Field{Name: "added", Value: &Node{Kind: KindNumber, Number: "1"}})
+		out := FormatEdited(input, n)
+		n2, err := Parse(out)
+		if err != nil {
+			t.Fatalf("FormatEdited(%q) = %q, which doesn't parse: %s", input, out, err)
+		}
+		if !n.Equal(n2) {
+			t.Fatalf("FormatEdited(%q) = %q, which doesn't parse to the edited value", input, out)
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package ccl
+
+// A Handler receives the parts of a document from [ParseEvents] as they're
+// parsed. Each callback may be nil, in which case those events are skipped.
+// If a callback returns an error, parsing stops and ParseEvents returns it.
+//
+// The events of a document follow its structure. The document is a message,
+// so it starts with OnMessageStart and ends with OnMessageEnd. Each field of
+// a message is an OnFieldStart with its key, followed by the events of its
+// value: an OnScalar, or a nested message or list. A list is an OnListStart,
+// the events of its elements, and an OnListEnd. For example,
+//
+//	name: "web"
+//	port { number: 80 }
+//	tags: ["a", "b"]
+//
+// gives
+//
+//	OnMessageStart
+//	OnFieldStart name, OnScalar "web"
+//	OnFieldStart port, OnMessageStart
+//	    OnFieldStart number, OnScalar 80
+//	OnMessageEnd
+//	OnFieldStart tags, OnListStart, OnScalar "a", OnScalar "b", OnListEnd
+//	OnMessageEnd
+//
+// Byte slices passed to the callbacks may point into the document or into
+// memory that's reused by the parser, so they're only valid during the call.
+type Handler struct {
+	// OnFieldStart is called with the key of a field, and the offset in
+	// the document where it starts.
+	OnFieldStart func(name []byte, start int) error
+	// OnScalar is called with a bool, number, or string value.
+	OnScalar func(s Scalar) error
+	// OnMessageStart and OnMessageEnd are called at the braces around a
+	// message, with their offsets; for the document, they're called with
+	// its start and end.
+	OnMessageStart func(start int) error
+	OnMessageEnd   func(end int) error
+	// OnListStart and OnListEnd are called at the brackets around a list,
+	// with their offsets.
+	OnListStart func(start int) error
+	OnListEnd   func(end int) error
+}
+
+// A Scalar is a bool, number, or string value passed to
+// [Handler.OnScalar].
+type Scalar struct {
+	// Kind is KindBool, KindNumber, or KindString.
+	Kind Kind
+	Bool bool
+	// Number is the literal of a number, as it's written.
+	Number []byte
+	// String is the value of a string, with its escapes replaced.
+	String string
+	// Concatenated reports whether a string was written as adjacent
+	// strings, as in Node.
+	Concatenated bool
+	// Start and End are the offsets of the value in the document.
+	Start, End int
+}
+
+// ParseEvents parses a ccl document and calls h's callbacks for its parts in
+// order, without building a tree of Nodes or decoding into a Go value. It's
+// meant for programs that build their own representation of a document, or
+// only need a few values from a large one, and can't afford the memory of
+// [Parse] or [Unmarshal].
+//
+// ParseEvents stops at the first syntax error, after the callbacks for the
+// part of the document before it have been called. Comments are skipped. As
+// with Parse, a key written more than once isn't an error.
+func ParseEvents(data []byte, h Handler) error {
+	if err := checkSize(int64(len(data))); err != nil {
+		return err
+	}
+	p := &parser{lexer: lexer{data: data}, data: data}
+	if err := call(h.OnMessageStart, 0); err != nil {
+		return err
+	}
+	if err := p.eventMessage(&h, true); err != nil {
+		return err
+	}
+	return call(h.OnMessageEnd, len(data))
+}
+
+// call calls f with the offset i, if f isn't nil.
+func call(f func(int) error, i int) error {
+	if f == nil {
+		return nil
+	}
+	return f(i)
+}
+
+// eventMessage parses the fields of a message, up to and including its
+// closing brace, or the end of the document if it's the top level.
+func (p *parser) eventMessage(h *Handler, topLevel bool) error {
+	for {
+		var tok []byte
+		var err error
+		if topLevel {
+			tok, err = p.nextEOF()
+			if err == errEOF {
+				return nil
+			}
+		} else {
+			tok, err = p.next()
+		}
+		if err != nil {
+			return err
+		}
+		if !topLevel && tok[0] == '}' {
+			return nil
+		}
+		start := p.i
+		name, err := p.parseKey(tok)
+		if err != nil {
+			return err
+		}
+		if h.OnFieldStart != nil {
+			if err := h.OnFieldStart(name, start); err != nil {
+				return err
+			}
+		}
+		if tok, err = p.next(); err != nil {
+			return err
+		}
+		switch tok[0] {
+		case '{':
+		case ':':
+			if tok, err = p.next(); err != nil {
+				return err
+			}
+		default:
+			return p.error("expecting colon")
+		}
+		if err := p.eventValue(h, tok); err != nil {
+			return err
+		}
+	}
+}
+
+// eventList parses the elements of a list, up to and including its closing
+// bracket.
+func (p *parser) eventList(h *Handler) error {
+	for n := 0; ; n++ {
+		tok, err := p.next()
+		if err != nil {
+			return err
+		}
+		if tok[0] == ']' {
+			return nil
+		}
+		if n > 0 {
+			if tok[0] != ',' {
+				return p.error("expecting comma")
+			}
+			if tok, err = p.next(); err != nil {
+				return err
+			}
+			if tok[0] == ']' {
+				return nil
+			}
+		}
+		if tok[0] == '[' {
+			return p.error("invalid repeated value")
+		}
+		if err := p.eventValue(h, tok); err != nil {
+			return err
+		}
+	}
+}
+
+// eventValue parses the value starting with tok, which has just been read.
+func (p *parser) eventValue(h *Handler, tok []byte) error {
+	start := p.i
+	switch tok[0] {
+	case '[':
+		if err := p.enter(); err != nil {
+			return err
+		}
+		defer p.leave()
+		if err := call(h.OnListStart, start); err != nil {
+			return err
+		}
+		if err := p.eventList(h); err != nil {
+			return err
+		}
+		return call(h.OnListEnd, p.prevEnd)
+	case '{':
+		if err := p.enter(); err != nil {
+			return err
+		}
+		defer p.leave()
+		if err := call(h.OnMessageStart, start); err != nil {
+			return err
+		}
+		if err := p.eventMessage(h, false); err != nil {
+			return err
+		}
+		return call(h.OnMessageEnd, p.prevEnd)
+	}
+	s := Scalar{Start: start}
+	switch {
+	case tok[0] == '\'' || tok[0] == '"':
+		var err error
+		s.Kind = KindString
+		if s.String, s.Concatenated, err = p.parseStrings(tok); err != nil {
+			return err
+		}
+	case string(tok) == "true" || string(tok) == "false":
+		s.Kind, s.Bool = KindBool, tok[0] == 't'
+	case !numFirstByte(tok[0]):
+		return p.error("expecting value")
+	default:
+		var err error
+		if isPercent(tok) {
+			_, err = p.parsePercent(tok)
+		} else if isFloat(tok) {
+			_, err = p.parseFloat(tok)
+		} else {
+			_, err = p.parseInt(tok)
+		}
+		if err != nil {
+			return err
+		}
+		s.Kind, s.Number = KindNumber, tok
+	}
+	s.End = p.prevEnd
+	if h.OnScalar == nil {
+		return nil
+	}
+	return h.OnScalar(s)
+}
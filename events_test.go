@@ -0,0 +1,176 @@
+package ccl
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// eventLog returns a Handler that appends a line for each event to log.
+func eventLog(log *[]string) Handler {
+	add := func(format string, args ...any) {
+		*log = append(*log, fmt.Sprintf(format, args...))
+	}
+	return Handler{
+		OnFieldStart: func(name []byte, start int) error {
+			add("field %s @%d", name, start)
+			return nil
+		},
+		OnScalar: func(s Scalar) error {
+			switch s.Kind {
+			case KindBool:
+				add("bool %t @%d-%d", s.Bool, s.Start, s.End)
+			case KindNumber:
+				add("number %s @%d-%d", s.Number, s.Start, s.End)
+			default:
+				add("string %q concatenated=%t @%d-%d", s.String, s.Concatenated, s.Start, s.End)
+			}
+			return nil
+		},
+		OnMessageStart: func(start int) error { add("message @%d", start); return nil },
+		OnMessageEnd:   func(end int) error { add("end message @%d", end); return nil },
+		OnListStart:    func(start int) error { add("list @%d", start); return nil },
+		OnListEnd:      func(end int) error { add("end list @%d", end); return nil },
+	}
+}
+
+func TestParseEvents(t *testing.T) {
+	t.Parallel()
+
+	const doc = `# comment
+name: "web"
+port { number: 80 }
+tags: ['a' "b", true,]
+`
+	var got []string
+	if err := ParseEvents([]byte(doc), eventLog(&got)); err != nil {
+		t.Fatalf("ParseEvents failed: %s", err)
+	}
+	want := []string{
+		"message @0",
+		"field name @10",
+		`string "web" concatenated=false @16-21`,
+		"field port @22",
+		"message @27",
+		"field number @29",
+		"number 80 @37-39",
+		"end message @41",
+		"field tags @42",
+		"list @48",
+		`string "ab" concatenated=true @49-56`,
+		"bool true @58-62",
+		"end list @64",
+		"end message @65",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseEvents returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseEvents_Error(t *testing.T) {
+	t.Parallel()
+
+	stop := errors.New("stop")
+	var fields []string
+	h := Handler{OnFieldStart: func(name []byte, start int) error {
+		fields = append(fields, string(name))
+		if string(name) == "b" {
+			return stop
+		}
+		return nil
+	}}
+	if err := ParseEvents([]byte("a: 1\nb: 2\nc: 3\n"), h); err != stop {
+		t.Errorf("ParseEvents returned error %v, want %v", err, stop)
+	}
+	if diff := cmp.Diff([]string{"a", "b"}, fields); diff != "" {
+		t.Errorf("ParseEvents called OnFieldStart with unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+// nodeBuilder builds a tree of Nodes from the events of a document, without
+// comments or offsets.
+type nodeBuilder struct {
+	stack []*Node
+	names [][]byte // the key of the field being parsed in each message
+	root  *Node
+}
+
+func (b *nodeBuilder) handler() Handler {
+	return Handler{
+		OnFieldStart: func(name []byte, start int) error {
+			b.names[len(b.names)-1] = append([]byte(nil), name...)
+			return nil
+		},
+		OnScalar: func(s Scalar) error {
+			n := &Node{Kind: s.Kind, Bool: s.Bool, Number: string(s.Number), String: s.String, Concatenated: s.Concatenated}
+			b.add(n)
+			return nil
+		},
+		OnMessageStart: func(int) error {
+			b.push(&Node{Kind: KindMessage, Fields: []*Field{}})
+			b.names = append(b.names, nil)
+			return nil
+		},
+		OnMessageEnd: func(int) error {
+			b.names = b.names[:len(b.names)-1]
+			b.pop()
+			return nil
+		},
+		OnListStart: func(int) error {
+			b.push(&Node{Kind: KindList, List: []*Node{}})
+			return nil
+		},
+		OnListEnd: func(int) error {
+			b.pop()
+			return nil
+		},
+	}
+}
+
+func (b *nodeBuilder) add(n *Node) {
+	if len(b.stack) == 0 {
+		b.root = n
+		return
+	}
+	switch top := b.stack[len(b.stack)-1]; top.Kind {
+	case KindList:
+		top.List = append(top.List, n)
+	default:
+		top.Fields = append(top.Fields, &Field{Name: string(b.names[len(b.names)-1]), Value: n})
+	}
+}
+
+func (b *nodeBuilder) push(n *Node) {
+	b.add(n)
+	b.stack = append(b.stack, n)
+}
+
+func (b *nodeBuilder) pop() {
+	b.stack = b.stack[:len(b.stack)-1]
+}
+
+// FuzzParseEvents checks that ParseEvents agrees with Parse.
+func FuzzParseEvents(f *testing.F) {
+	for _, tc := range fuzzCorpus {
+		f.Add([]byte(tc))
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		want, wantErr := Parse(input)
+		var b nodeBuilder
+		err := ParseEvents(input, b.handler())
+		if wantErr != nil {
+			if err == nil || err.Error() != wantErr.Error() {
+				t.Fatalf("ParseEvents returned error %v, want %q", err, wantErr)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("ParseEvents failed: %s", err)
+		}
+		if !want.Equal(b.root) {
+			t.Errorf("ParseEvents built %s, want %s", FormatNode(b.root), FormatNode(want))
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package ccl
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	factories     sync.Map // map[reflect.Type]func(*Node) (any, error)
+	haveFactories atomic.Bool
+)
+
+// RegisterFactory registers f to build values of type T when they're
+// unmarshaled. Instead of being decoded field by field, the value written in
+// the document for a T, which can have any kind, is parsed into a [Node] and
+// passed to f. This lets a struct hold values that are constructed from
+// their config rather than decoded from it, such as a ready-to-use logger
+// built from a logging config block:
+//
+//	ccl.RegisterFactory(func(n *ccl.Node) (*slog.Logger, error) {
+//	    ...
+//	})
+//
+// A factory for T is also used for fields of type *T, and for the elements
+// of a []T, one at a time. Errors returned by f are reported with the
+// position and path of the value, like errors from UnmarshalText.
+//
+// RegisterFactory is meant to be called from init functions. It panics if a
+// factory for T is already registered.
+func RegisterFactory[T any](f func(n *Node) (T, error)) {
+	t := reflect.TypeFor[T]()
+	_, loaded := factories.LoadOrStore(t, func(n *Node) (any, error) { return f(n) })
+	if loaded {
+		panic(fmt.Sprintf("ccl: factory for %s registered twice", t))
+	}
+	haveFactories.Store(true)
+}
+
+// factory returns the registered factory for values of type t.
+func factory(t reflect.Type) func(*Node) (any, error) {
+	if !haveFactories.Load() {
+		return nil
+	}
+	f, ok := factories.Load(t)
+	if !ok {
+		return nil
+	}
+	return f.(func(*Node) (any, error))
+}
+
+// parseFactory builds the value starting with tok with the factory for the
+// type of out, or for its element type if it's a pointer. It reports false
+// if there's no factory.
+func (p *parser) parseFactory(out reflect.Value, tok []byte) (bool, error) {
+	f := factory(out.Type())
+	if f == nil && out.Kind() == reflect.Pointer {
+		if f = factory(out.Type().Elem()); f != nil {
+			out = setPtr(out)
+		}
+	}
+	if f == nil {
+		return false, nil
+	}
+	n, err := p.parseNode(tok)
+	if err != nil {
+		return true, err
+	}
+	v, err := f(n)
+	if err != nil {
+		return true, p.textError(n.Start, err)
+	}
+	if v == nil {
+		out.SetZero()
+	} else {
+		out.Set(reflect.ValueOf(v))
+	}
+	return true, nil
+}
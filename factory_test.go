@@ -0,0 +1,78 @@
+package ccl
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// A greeter is built from a message by a factory.
+type greeter struct {
+	greeting string
+}
+
+func init() {
+	RegisterFactory(func(n *Node) (*greeter, error) {
+		if n.Kind != KindMessage {
+			return nil, errors.New("greeter should be a message")
+		}
+		g := &greeter{greeting: "hello"}
+		for _, f := range n.Fields {
+			switch {
+			case f.Name == "greeting" && f.Value.Kind == KindString:
+				g.greeting = f.Value.String
+			case f.Name == "shout" && f.Value.Kind == KindBool:
+				if f.Value.Bool {
+					g.greeting = strings.ToUpper(g.greeting)
+				}
+			default:
+				return nil, errors.New("bad greeter field " + f.Name)
+			}
+		}
+		return g, nil
+	})
+}
+
+func TestRegisterFactory(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Greeter  *greeter   `ccl:"greeter"`
+		Greeters []*greeter `ccl:"greeters"`
+	}
+	msg := `
+		greeter { greeting: "hi" shout: true }
+		greeters: [{}, {greeting: "hey"}]
+	`
+	var got message
+	if err := Unmarshal([]byte(msg), &got); err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %s", msg, err)
+	}
+	want := message{
+		Greeter:  &greeter{"HI"},
+		Greeters: []*greeter{{"hello"}, {"hey"}},
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(greeter{})); diff != "" {
+		t.Errorf("Unmarshal(%q) returned unexpected diff (-want +got):\n%s", msg, diff)
+	}
+
+	msg = `greeter { bogus: 1 }`
+	err := Unmarshal([]byte(msg), new(message))
+	wantErr := `1:9 syntax error: field "greeter": bad greeter field bogus`
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("Unmarshal(%q) returned error %v, want %s", msg, err, wantErr)
+	}
+}
+
+func TestRegisterFactory_Twice(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("RegisterFactory for *greeter didn't panic the second time")
+		}
+	}()
+	RegisterFactory(func(n *Node) (*greeter, error) { return nil, nil })
+}
@@ -0,0 +1,432 @@
+package ccl
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FormatOptions controls how ccl text is printed. The zero value is ready to
+// use.
+type FormatOptions struct {
+	// Indent is written once for each level of nesting. If empty, four spaces
+	// are used.
+	Indent string
+	// MultilineStrings writes newlines inside strings as literal line
+	// breaks instead of \n escapes. The lines after the first aren't
+	// indented, since the indentation would become part of the string.
+	MultilineStrings bool
+	// TrailingComma selects when a comma is written after the last element
+	// of a list.
+	TrailingComma TrailingComma
+	// AlignValues pads field names so that the values of neighboring fields
+	// start in the same column. Alignment is broken up by blank lines and by
+	// values that span multiple lines.
+	AlignValues bool
+	// SortKeys writes the fields of every message sorted by name. Fields
+	// with the same name keep their relative order, and each field keeps
+	// its comments.
+	SortKeys bool
+	// PinnedKeys are written before all other fields, in this order, when
+	// SortKeys is set. For example, PinnedKeys of []string{"name", "type"}
+	// puts those fields at the top of every message.
+	PinnedKeys []string
+	// CommentWidth, if positive, is the width in characters that line
+	// comments on their own line are wrapped to, including indentation.
+	// Long comments are only split at spaces; words are never broken and
+	// lines are never joined. Comments whose marker isn't followed by a
+	// space, such as "#!" or "//go:", and directives such as
+	// "# ccl:ignore" are left alone.
+	CommentWidth int
+}
+
+// TrailingComma is a policy for writing a comma after the last element of a
+// list. The language allows the comma in every list.
+type TrailingComma uint8
+
+const (
+	// TrailingCommaMultiline writes a trailing comma in lists that are
+	// printed on multiple lines, so that adding an element only changes one
+	// line. It's the default.
+	TrailingCommaMultiline TrailingComma = iota
+	// TrailingCommaAlways writes a trailing comma in every non-empty list.
+	TrailingCommaAlways
+	// TrailingCommaNever never writes a trailing comma.
+	TrailingCommaNever
+)
+
+// Format reformats a ccl document using the default options. Comments are
+// kept as described in [Parse].
+func Format(data []byte) ([]byte, error) {
+	return FormatOptions{}.Format(data)
+}
+
+// Format reformats a ccl document. Comments are kept as described in
+// [Parse], and numbers are written exactly as they appear in data, so a hex
+// or exponent literal keeps its form.
+//
+// Formatting is idempotent: formatting the output again with the same options
+// returns it unchanged, so the output of Format can be checked in CI.
+func (o FormatOptions) Format(data []byte) ([]byte, error) {
+	n, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return o.FormatNode(n), nil
+}
+
+// FormatNode prints n, which must have kind KindMessage, as a ccl document
+// using the default options.
+func FormatNode(n *Node) []byte {
+	return FormatOptions{}.FormatNode(n)
+}
+
+// FormatNode prints n, which must have kind KindMessage, as a ccl document.
+func (o FormatOptions) FormatNode(n *Node) []byte {
+	return o.appendNode(nil, n)
+}
+
+func (o FormatOptions) appendNode(b []byte, n *Node) []byte {
+	if o.Indent == "" {
+		o.Indent = "    "
+	}
+	p := &printer{opts: o, b: b}
+	p.message(n, 0)
+	return p.b
+}
+
+type printer struct {
+	opts FormatOptions
+	b    []byte
+}
+
+func (p *printer) indent(depth int) {
+	for range depth {
+		p.b = append(p.b, p.opts.Indent...)
+	}
+}
+
+// comments writes comments on their own lines. An empty comment is written
+// as a blank line.
+func (p *printer) comments(comments []string, depth int) {
+	for _, c := range comments {
+		if c == "" {
+			p.b = append(p.b, '\n')
+			continue
+		}
+		lines := []string{c}
+		if p.opts.CommentWidth > 0 {
+			lines = wrapComment(c, p.opts.CommentWidth-depth*utf8.RuneCountInString(p.opts.Indent))
+		}
+		for _, line := range lines {
+			p.indent(depth)
+			p.b = append(p.b, line...)
+			p.b = append(p.b, '\n')
+		}
+	}
+}
+
+// wrapComment splits a line comment into lines of at most width characters.
+// The comment marker and the spaces after it are repeated on every line.
+func wrapComment(c string, width int) []string {
+	var prefix string
+	switch {
+	case strings.HasPrefix(c, "#"):
+		prefix = "#"
+	case strings.HasPrefix(c, "//"):
+		prefix = "//"
+	default:
+		return []string{c}
+	}
+	rest := c[len(prefix):]
+	trimmed := strings.TrimLeft(rest, " ")
+	if !strings.HasPrefix(rest, " ") || strings.HasPrefix(trimmed, "ccl:") || utf8.RuneCountInString(c) <= width {
+		return []string{c}
+	}
+	prefix += rest[:len(rest)-len(trimmed)]
+	rest = strings.TrimRight(trimmed, " \t")
+	var lines []string
+	for utf8.RuneCountInString(prefix)+utf8.RuneCountInString(rest) > width {
+		// limit is the byte offset of the first character that doesn't fit.
+		limit, n := len(rest), width-utf8.RuneCountInString(prefix)
+		for i := range rest {
+			if n <= 0 {
+				limit = i
+				break
+			}
+			n--
+		}
+		i := strings.LastIndexByte(rest[:min(limit+1, len(rest))], ' ')
+		if i <= 0 {
+			// The first word is too long, so it gets a line of its own.
+			if i = strings.IndexByte(rest, ' '); i < 0 {
+				break
+			}
+		}
+		lines = append(lines, prefix+strings.TrimRight(rest[:i], " "))
+		rest = strings.TrimLeft(rest[i:], " ")
+	}
+	return append(lines, prefix+rest)
+}
+
+func (p *printer) message(n *Node, depth int) {
+	fields := n.Fields
+	if p.opts.SortKeys {
+		fields = p.sorted(fields)
+	}
+	var widths []int
+	if p.opts.AlignValues {
+		widths = p.alignment(fields)
+	}
+	for i, f := range fields {
+		if f.BlankLine && i > 0 {
+			p.b = append(p.b, '\n')
+		}
+		width := 0
+		if widths != nil {
+			width = widths[i]
+		}
+		p.field(f, depth, width)
+	}
+	p.comments(n.EndComments, depth)
+}
+
+// field writes f with its comments, padding its name and colon to width.
+func (p *printer) field(f *Field, depth, width int) {
+	p.comments(f.Comments, depth)
+	p.indent(depth)
+	start := len(p.b)
+	p.b = appendFieldName(p.b, f.Name)
+	if f.Value.Kind == KindMessage {
+		p.b = append(p.b, ' ')
+	} else {
+		p.b = append(p.b, ':')
+		for len(p.b)-start < width {
+			p.b = append(p.b, ' ')
+		}
+		p.b = append(p.b, ' ')
+	}
+	p.value(f.Value, depth)
+	if f.TrailingComment != "" {
+		p.b = append(p.b, ' ')
+		p.b = append(p.b, f.TrailingComment...)
+	}
+	p.b = append(p.b, '\n')
+}
+
+// sorted returns a copy of fields sorted for SortKeys.
+func (p *printer) sorted(fields []*Field) []*Field {
+	rank := func(name string) int {
+		if i := slices.Index(p.opts.PinnedKeys, name); i >= 0 {
+			return i
+		}
+		return len(p.opts.PinnedKeys)
+	}
+	fields = slices.Clone(fields)
+	slices.SortStableFunc(fields, func(a, b *Field) int {
+		return cmp.Or(cmp.Compare(rank(a.Name), rank(b.Name)), strings.Compare(a.Name, b.Name))
+	})
+	return fields
+}
+
+// alignment returns the width that each field's name and colon are padded to
+// for AlignValues. Fields are aligned in runs of neighboring fields whose
+// values fit on one line.
+func (p *printer) alignment(fields []*Field) []int {
+	widths := make([]int, len(fields))
+	start := 0
+	align := func(end int) {
+		w := 0
+		for _, f := range fields[start:end] {
+			w = max(w, len(appendFieldName(nil, f.Name))+1)
+		}
+		for i := start; i < end; i++ {
+			widths[i] = w
+		}
+		start = end
+	}
+	for i, f := range fields {
+		if f.BlankLine {
+			align(i)
+		}
+		if !p.oneLine(f.Value) {
+			align(i)
+			start = i + 1
+		}
+	}
+	align(len(fields))
+	return widths
+}
+
+// oneLine reports whether n is printed on a single line after a colon.
+func (p *printer) oneLine(n *Node) bool {
+	switch n.Kind {
+	case KindMessage:
+		return false
+	case KindList:
+		return singleLine(n)
+	case KindString:
+		return !p.opts.MultilineStrings || !strings.Contains(n.String, "\n")
+	default:
+		return true
+	}
+}
+
+// appendFieldName appends name as a field name, quoting it if necessary.
+func appendFieldName(b []byte, name string) []byte {
+	if validFieldName(name) {
+		return append(b, name...)
+	}
+	return appendQuoted(b, name, false)
+}
+
+// trailingComma reports whether a comma is written after the last element of
+// a non-empty list.
+func (p *printer) trailingComma(multiline bool) bool {
+	switch p.opts.TrailingComma {
+	case TrailingCommaAlways:
+		return true
+	case TrailingCommaNever:
+		return false
+	default:
+		return multiline
+	}
+}
+
+// validFieldName reports whether name can be written as a field name.
+func validFieldName(name string) bool {
+	if name == "" || !fieldFirstByte(name[0]) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !fieldTailByte(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// singleLine reports whether a list is short enough to be printed on one
+// line, which is the case for lists that only hold scalars and don't have
+// comments.
+func singleLine(list *Node) bool {
+	if len(list.EndComments) > 0 {
+		return false
+	}
+	for _, n := range list.List {
+		if n.Kind == KindList || n.Kind == KindMessage || len(n.Comments) > 0 || n.TrailingComment != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *printer) value(n *Node, depth int) {
+	switch n.Kind {
+	case KindBool:
+		p.b = strconv.AppendBool(p.b, n.Bool)
+	case KindNumber:
+		p.b = append(p.b, n.Number...)
+	case KindString:
+		p.b = appendQuoted(p.b, n.String, p.opts.MultilineStrings)
+	case KindList:
+		if singleLine(n) {
+			p.b = append(p.b, '[')
+			for i, elem := range n.List {
+				if i > 0 {
+					p.b = append(p.b, ", "...)
+				}
+				p.value(elem, depth)
+			}
+			if len(n.List) > 0 && p.trailingComma(false) {
+				p.b = append(p.b, ',')
+			}
+			p.b = append(p.b, ']')
+			return
+		}
+		p.b = append(p.b, "[\n"...)
+		for i, elem := range n.List {
+			comments := elem.Comments
+			if i == 0 && len(comments) > 0 && comments[0] == "" {
+				comments = comments[1:]
+			}
+			p.comments(comments, depth+1)
+			p.indent(depth + 1)
+			p.value(elem, depth+1)
+			if i < len(n.List)-1 || p.trailingComma(true) {
+				p.b = append(p.b, ',')
+			}
+			if elem.TrailingComment != "" {
+				p.b = append(p.b, ' ')
+				p.b = append(p.b, elem.TrailingComment...)
+			}
+			p.b = append(p.b, '\n')
+		}
+		p.comments(n.EndComments, depth+1)
+		p.indent(depth)
+		p.b = append(p.b, ']')
+	case KindMessage:
+		if len(n.Fields) == 0 && len(n.EndComments) == 0 {
+			p.b = append(p.b, "{}"...)
+			return
+		}
+		p.b = append(p.b, "{\n"...)
+		p.message(n, depth+1)
+		p.indent(depth)
+		p.b = append(p.b, '}')
+	default:
+		panic(fmt.Sprintf("ccl: cannot format node of kind %v", n.Kind))
+	}
+}
+
+// appendQuoted appends s as a ccl string literal. The quote character is
+// chosen to avoid escape sequences where possible, and only characters that
+// can't appear in a string literal are escaped. If multiline is true,
+// newlines are written as is.
+func appendQuoted(b []byte, s string, multiline bool) []byte {
+	q := byte('"')
+	if strings.Count(s, `"`) > strings.Count(s, "'") {
+		q = '\''
+	}
+	b = append(b, q)
+	for _, r := range s {
+		switch r {
+		case rune(q):
+			b = append(b, '\\', q)
+		case '\\':
+			b = append(b, `\\`...)
+		case '\t':
+			b = append(b, '\t')
+		case '\a':
+			b = append(b, `\a`...)
+		case '\b':
+			b = append(b, `\b`...)
+		case '\f':
+			b = append(b, `\f`...)
+		case '\n':
+			if multiline {
+				b = append(b, '\n')
+			} else {
+				b = append(b, `\n`...)
+			}
+		case '\r':
+			b = append(b, `\r`...)
+		case '\v':
+			b = append(b, `\v`...)
+		default:
+			switch {
+			case r < utf8.RuneSelf && unicode.IsControl(r):
+				b = fmt.Appendf(b, `\x%02x`, r)
+			case unicode.IsControl(r):
+				b = fmt.Appendf(b, `\u%04x`, r)
+			default:
+				b = utf8.AppendRune(b, r)
+			}
+		}
+	}
+	return append(b, q)
+}
@@ -0,0 +1,496 @@
+package ccl
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"roseh.moe/pkg/ccl/x/cclcorpus"
+)
+
+func TestFormatNode(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want string
+	}{{
+		desc: "Empty",
+		msg:  ``,
+		want: ``,
+	}, {
+		desc: "Scalars",
+		msg:  `b:true n:0xff s:'a "quoted"\n\x01string'`,
+		want: `b: true
+n: 0xff
+s: 'a "quoted"\n\x01string'
+`,
+	}, {
+		desc: "Message",
+		msg:  `m{a:1 e:{} n{b:2}}`,
+		want: `m {
+    a: 1
+    e {}
+    n {
+        b: 2
+    }
+}
+`,
+	}, {
+		desc: "List",
+		msg:  `l:[1,2,] e:[] m:[{a:1},{}]`,
+		want: `l: [1, 2]
+e: []
+m: [
+    {
+        a: 1
+    },
+    {},
+]
+`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			n, err := Parse([]byte(tc.msg))
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %s", tc.msg, err)
+			}
+			got := FormatNode(n)
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("FormatNode(%q) returned unexpected diff (-want +got):\n%s", tc.msg, diff)
+			}
+			n2, err := Parse(got)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %s", got, err)
+			}
+			if !n.Equal(n2) {
+				t.Errorf("FormatNode(%q) = %q, which doesn't parse to the same value", tc.msg, got)
+			}
+		})
+	}
+}
+
+func TestAppendQuoted(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{``, `""`},
+		{`plain`, `"plain"`},
+		{`say "hi"`, `'say "hi"'`},
+		{`that's`, `"that's"`},
+		{`it's "quoted"`, `'it\'s "quoted"'`},
+		{`"it's" 'both'`, `"\"it's\" 'both'"`},
+		{`back\slash`, `"back\\slash"`},
+		{"tab\there", "\"tab\there\""},
+		{"line\nbreak\r\n", `"line\nbreak\r\n"`},
+		{"\x00\x7f\u0085", `"\x00\x7f\u0085"`},
+		{"世界 😀", `"世界 😀"`},
+	} {
+		got := string(appendQuoted(nil, tc.in, false))
+		if got != tc.want {
+			t.Errorf("appendQuoted(%q) = %s, want %s", tc.in, got, tc.want)
+		}
+		n, err := Parse([]byte("s: " + got))
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %s", "s: "+got, err)
+			continue
+		}
+		if s := n.Fields[0].Value.String; s != tc.in {
+			t.Errorf("appendQuoted(%q) = %s, which parses as %q", tc.in, got, s)
+		}
+	}
+}
+
+func TestFormatOptions_MultilineStrings(t *testing.T) {
+	t.Parallel()
+
+	msg := `m { s: "first line\nsecond line\r\n" }`
+	n, err := Parse([]byte(msg))
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %s", msg, err)
+	}
+	got := FormatOptions{MultilineStrings: true}.FormatNode(n)
+	want := `m {
+    s: "first line
+second line\r
+"
+}
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("FormatNode(%q) returned unexpected diff (-want +got):\n%s", msg, diff)
+	}
+	n2, err := Parse(got)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %s", got, err)
+	}
+	if !n.Equal(n2) {
+		t.Errorf("FormatNode(%q) = %q, which doesn't parse to the same value", msg, got)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want string
+	}{{
+		desc: "Comments",
+		msg: `# header
+
+# about a
+a: 1 # one
+/* b */ b {
+  c: 2
+
+
+  // d
+  d: [1, 2]
+  # end of b
+}
+
+# end of file
+`,
+		want: `# header
+
+# about a
+a: 1 # one
+/* b */
+b {
+    c: 2
+
+    // d
+    d: [1, 2]
+    # end of b
+}
+
+# end of file
+`,
+	}, {
+		desc: "NumberLiterals",
+		msg:  `hex: 0XfF exp: 1E10 signed: +.5e-3 list: [0x10, -1e+2, 7]`,
+		want: `hex: 0XfF
+exp: 1E10
+signed: +.5e-3
+list: [0x10, -1e+2, 7]
+`,
+	}, {
+		desc: "CommentInList",
+		msg: `l: [
+  1, # one
+  2,
+]
+m: 3`,
+		want: `l: [
+    1, # one
+    2,
+]
+m: 3
+`,
+	}, {
+		desc: "CommentsInList",
+		msg: `l: [ # first
+  1,
+  /* two */ 2 # last
+
+  // end
+] # list`,
+		want: `l: [
+    # first
+    1,
+    /* two */
+    2, # last
+
+    // end
+] # list
+`,
+	}, {
+		desc: "CommentBetweenKeyAndValue",
+		msg: `a: # one
+  1`,
+		want: `a: 1
+# one
+`,
+	}, {
+		desc: "EmptyMessageWithComment",
+		msg: `m { # nothing here
+}`,
+		want: `m {
+    # nothing here
+}
+`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Format([]byte(tc.msg))
+			if err != nil {
+				t.Fatalf("Format(%q) failed: %s", tc.msg, err)
+			}
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("Format(%q) returned unexpected diff (-want +got):\n%s", tc.msg, diff)
+			}
+		})
+	}
+}
+
+func TestFormat_Corpus(t *testing.T) {
+	t.Parallel()
+
+	for _, doc := range cclcorpus.Documents() {
+		t.Run(doc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			n, err := Parse(doc.Data)
+			if err != nil {
+				t.Fatalf("Parse failed: %s", err)
+			}
+			once, err := Format(doc.Data)
+			if err != nil {
+				t.Fatalf("Format failed: %s", err)
+			}
+			n2, err := Parse(once)
+			if err != nil {
+				t.Fatalf("Format returned a document that doesn't parse: %s\n%s", err, once)
+			}
+			if !n.Equal(n2) {
+				t.Errorf("Format returned a document that doesn't parse to the same value:\n%s", once)
+			}
+			twice, err := Format(once)
+			if err != nil {
+				t.Fatalf("Format failed: %s", err)
+			}
+			if diff := cmp.Diff(string(once), string(twice)); diff != "" {
+				t.Errorf("Format isn't idempotent (-once +twice):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFormatOptions_TrailingComma(t *testing.T) {
+	t.Parallel()
+
+	const msg = `l: [1, 2] e: [] m: [{}, {}]`
+	for _, tc := range []struct {
+		desc  string
+		comma TrailingComma
+		want  string
+	}{{
+		desc:  "Multiline",
+		comma: TrailingCommaMultiline,
+		want: `l: [1, 2]
+e: []
+m: [
+    {},
+    {},
+]
+`,
+	}, {
+		desc:  "Always",
+		comma: TrailingCommaAlways,
+		want: `l: [1, 2,]
+e: []
+m: [
+    {},
+    {},
+]
+`,
+	}, {
+		desc:  "Never",
+		comma: TrailingCommaNever,
+		want: `l: [1, 2]
+e: []
+m: [
+    {},
+    {}
+]
+`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := FormatOptions{TrailingComma: tc.comma}.Format([]byte(msg))
+			if err != nil {
+				t.Fatalf("Format(%q) failed: %s", msg, err)
+			}
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("Format(%q) returned unexpected diff (-want +got):\n%s", msg, diff)
+			}
+		})
+	}
+}
+
+func TestFormatOptions_AlignValues(t *testing.T) {
+	t.Parallel()
+
+	const msg = `
+name: "web"
+replicas: 3
+"user-agent": "ccl"
+
+timeout: "5s"
+m {
+  a: 1
+  bb: 2
+}
+ports: [80, 443]
+tags: [{}]
+x: 1
+`
+	const want = `name:         "web"
+replicas:     3
+"user-agent": "ccl"
+
+timeout: "5s"
+m {
+    a:  1
+    bb: 2
+}
+ports: [80, 443]
+tags: [
+    {},
+]
+x: 1
+`
+	got, err := FormatOptions{AlignValues: true}.Format([]byte(msg))
+	if err != nil {
+		t.Fatalf("Format(%q) failed: %s", msg, err)
+	}
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Format(%q) returned unexpected diff (-want +got):\n%s", msg, diff)
+	}
+}
+
+// FuzzFormat checks that formatting preserves the value of a document and
+// that formatting is idempotent: formatting the output again doesn't change
+// it.
+func FuzzFormat(f *testing.F) {
+	for _, tc := range fuzzCorpus {
+		f.Add([]byte(tc))
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		n, err := Parse(input)
+		if err != nil {
+			return
+		}
+		for _, opts := range []FormatOptions{
+			{},
+			{Indent: "\t", AlignValues: true, TrailingComma: TrailingCommaNever},
+			{MultilineStrings: true, TrailingComma: TrailingCommaAlways},
+			{SortKeys: true, PinnedKeys: []string{"string", "message"}, CommentWidth: 20},
+		} {
+			once, err := opts.Format(input)
+			if err != nil {
+				t.Fatalf("%+v.Format(%q) failed: %s", opts, input, err)
+			}
+			n2, err := Parse(once)
+			if err != nil {
+				t.Fatalf("%+v.Format(%q) = %q, which doesn't parse: %s", opts, input, once, err)
+			}
+			if !n.Equal(n2) {
+				t.Fatalf("%+v.Format(%q) = %q, which doesn't parse to the same value", opts, input, once)
+			}
+			twice, err := opts.Format(once)
+			if err != nil {
+				t.Fatalf("%+v.Format(%q) failed: %s", opts, once, err)
+			}
+			if diff := cmp.Diff(string(once), string(twice)); diff != "" {
+				t.Fatalf("%+v.Format isn't idempotent on %q (-once +twice):\n%s", opts, input, diff)
+			}
+		}
+	})
+}
+
+func TestFormatOptions_SortKeys(t *testing.T) {
+	t.Parallel()
+
+	const msg = `
+zone: "a"
+# the service type
+type: "web"
+b { z: 1 name: "inner" a: 2 }
+a: 1
+a: 2
+name: "svc"
+`
+	const want = `name: "svc"
+# the service type
+type: "web"
+a: 1
+a: 2
+b {
+    name: "inner"
+    a: 2
+    z: 1
+}
+zone: "a"
+`
+	got, err := FormatOptions{SortKeys: true, PinnedKeys: []string{"name", "type"}}.Format([]byte(msg))
+	if err != nil {
+		t.Fatalf("Format(%q) failed: %s", msg, err)
+	}
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Format(%q) returned unexpected diff (-want +got):\n%s", msg, diff)
+	}
+}
+
+func TestWrapComment(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		in    string
+		width int
+		want  []string
+	}{
+		{"# short", 20, []string{"# short"}},
+		{"# one two three four", 10, []string{"# one two", "# three", "# four"}},
+		{"// one two three", 9, []string{"// one", "// two", "// three"}},
+		{"#   indented text here", 16, []string{"#   indented", "#   text here"}},
+		{"# averyveryverylongword and more", 10, []string{"# averyveryverylongword", "# and more"}},
+		{"# averyveryverylongword", 10, []string{"# averyveryverylongword"}},
+		{"# ünïcödé wörds hérè", 16, []string{"# ünïcödé wörds", "# hérè"}},
+		{"# trailing spaces here   ", 12, []string{"# trailing", "# spaces", "# here"}},
+		{"#!/usr/bin/env some long command", 10, []string{"#!/usr/bin/env some long command"}},
+		{"# ccl:ignore key-style number-case", 10, []string{"# ccl:ignore key-style number-case"}},
+		{"/* block comment that is long */", 10, []string{"/* block comment that is long */"}},
+	} {
+		if got := wrapComment(tc.in, tc.width); !slices.Equal(got, tc.want) {
+			t.Errorf("wrapComment(%q, %d) = %q, want %q", tc.in, tc.width, got, tc.want)
+		}
+	}
+}
+
+func TestFormatOptions_CommentWidth(t *testing.T) {
+	t.Parallel()
+
+	const msg = `
+# The address that the server listens on.
+m {
+  # The number of worker threads.
+  workers: 4 # a trailing comment is never wrapped
+}
+`
+	const want = `# The address that
+# the server listens
+# on.
+m {
+    # The number of
+    # worker
+    # threads.
+    workers: 4 # a trailing comment is never wrapped
+}
+`
+	got, err := FormatOptions{CommentWidth: 20}.Format([]byte(msg))
+	if err != nil {
+		t.Fatalf("Format(%q) failed: %s", msg, err)
+	}
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Format(%q) returned unexpected diff (-want +got):\n%s", msg, diff)
+	}
+}
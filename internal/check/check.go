@@ -0,0 +1,142 @@
+// Package check validates ccl documents for the bindings that let other
+// languages use this implementation, and reports the findings as JSON.
+package check
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/ccllint"
+	"roseh.moe/pkg/ccl/x/cclschema"
+)
+
+// A Diagnostic is a finding in a document, as it's written in JSON.
+type Diagnostic struct {
+	// Path is the dot-separated path of the field the finding is about.
+	// It's empty for syntax errors, whose messages start with their
+	// position instead.
+	Path    string `json:"path,omitempty"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// A Result is what's reported for a document.
+type Result struct {
+	// Diagnostics holds every finding in the document. A document with no
+	// findings is valid.
+	Diagnostics []Diagnostic `json:"diagnostics"`
+	// Error is set if the document couldn't be checked at all, such as
+	// when the schema is invalid.
+	Error string `json:"error,omitempty"`
+}
+
+// Document checks the document data for syntax errors and lint findings,
+// and validates it against the schema if one is given. As with ccl lint,
+// every syntax error is reported, and a document with syntax errors isn't
+// linted.
+func Document(data, schema []byte) Result {
+	res := Result{Diagnostics: []Diagnostic{}}
+	var s *cclschema.Schema
+	if schema != nil {
+		var err error
+		if s, err = cclschema.Parse(schema); err != nil {
+			res.Error = fmt.Sprintf("schema:%s", err)
+			return res
+		}
+	}
+	n, err := ccl.ParseAll(data)
+	if err != nil {
+		for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+			res.Diagnostics = append(res.Diagnostics, Diagnostic{Rule: "syntax", Message: err.Error()})
+		}
+		return res
+	}
+	diags := ccllint.Lint(n)
+	if s != nil {
+		diags = append(diags, s.Validate(n)...)
+	}
+	for _, d := range diags {
+		res.Diagnostics = append(res.Diagnostics, Diagnostic{Path: d.Path, Rule: d.Rule, Message: d.Message})
+	}
+	return res
+}
+
+// JSON returns the result of [Document] as JSON.
+func JSON(data, schema []byte) []byte {
+	b, err := json.Marshal(Document(data, schema))
+	if err != nil {
+		// A Result only holds strings.
+		panic(err)
+	}
+	return b
+}
+
+// Value parses the document data and returns it as a value that can be
+// written as JSON or passed to JavaScript: a message is a map[string]any,
+// a list is a []any, and a number is a float64, which may be rounded. As
+// when a message is decoded into a field of type any, a key written more
+// than once has the values of all of them, in a list.
+func Value(data []byte) (map[string]any, error) {
+	n, err := ccl.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	v, err := value(n)
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]any), nil
+}
+
+// value returns n as a value of the types Value uses.
+func value(n *ccl.Node) (any, error) {
+	switch n.Kind {
+	case ccl.KindBool:
+		return n.Bool, nil
+	case ccl.KindNumber:
+		return ccl.Number(n.Number).Float64()
+	case ccl.KindString:
+		return n.String, nil
+	case ccl.KindList:
+		list := make([]any, len(n.List))
+		for i, elem := range n.List {
+			v, err := value(elem)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v
+		}
+		return list, nil
+	}
+	// Group the values of keys written more than once, in order.
+	var names []string
+	groups := make(map[string][]*ccl.Node)
+	for _, f := range n.Fields {
+		if groups[f.Name] == nil {
+			names = append(names, f.Name)
+		}
+		groups[f.Name] = append(groups[f.Name], f.Value)
+	}
+	m := make(map[string]any, len(names))
+	for _, name := range names {
+		vals := groups[name]
+		if len(vals) > 1 {
+			list := &ccl.Node{Kind: ccl.KindList}
+			for _, v := range vals {
+				if v.Kind == ccl.KindList {
+					list.List = append(list.List, v.List...)
+				} else {
+					list.List = append(list.List, v)
+				}
+			}
+			vals = []*ccl.Node{list}
+		}
+		v, err := value(vals[0])
+		if err != nil {
+			return nil, err
+		}
+		m[name] = v
+	}
+	return m, nil
+}
@@ -0,0 +1,89 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+
+	schema := `field { name: "port" type: "int" }`
+	for _, tc := range []struct {
+		desc   string
+		data   string
+		schema string
+		want   string
+	}{{
+		desc: "Valid",
+		data: `port: 80`,
+		want: `{"diagnostics":[]}`,
+	}, {
+		desc: "Syntax",
+		data: "port: [1,\nname: }",
+		want: `{"diagnostics":[{"rule":"syntax","message":"2:1 syntax error: expecting value"}]}`,
+	}, {
+		desc: "Lint",
+		data: `Port: 0XFF`,
+		want: `{"diagnostics":[{"path":"Port","rule":"key-style","message":"key \"Port\" is not lower_snake_case"},{"path":"Port","rule":"number-case","message":"number written with an upper case X or E"}]}`,
+	}, {
+		desc:   "Schema",
+		data:   `port: "80"`,
+		schema: schema,
+		want:   `{"diagnostics":[{"path":"port","rule":"type","message":"expecting int, got string"}]}`,
+	}, {
+		desc:   "BadSchema",
+		data:   `port: 80`,
+		schema: `field {`,
+		want:   `{"diagnostics":[],"error":"schema:1:8 syntax error: premature EOF"}`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var s []byte
+			if tc.schema != "" {
+				s = []byte(tc.schema)
+			}
+			got := JSON([]byte(tc.data), s)
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("JSON returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestValue(t *testing.T) {
+	t.Parallel()
+
+	got, err := Value([]byte(`
+name: "web"
+port: 8080
+debug: true
+tags: ["a", "b"]
+server { host: "x" }
+server { host: "y" }
+ratio: .5
+`))
+	if err != nil {
+		t.Fatalf("Value failed: %s", err)
+	}
+	want := map[string]any{
+		"name":  "web",
+		"port":  float64(8080),
+		"debug": true,
+		"tags":  []any{"a", "b"},
+		"server": []any{
+			map[string]any{"host": "x"},
+			map[string]any{"host": "y"},
+		},
+		"ratio": .5,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Value returned unexpected diff (-want +got):\n%s", diff)
+	}
+
+	if _, err := Value([]byte(`x: `)); err == nil {
+		t.Error("Value succeeded on a bad document, want error")
+	}
+}
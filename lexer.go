@@ -9,6 +9,16 @@ import (
 type lexer struct {
 	data []byte
 	i    int
+
+	// If keepComments is set, the position of every comment that's skipped
+	// is appended to comments.
+	keepComments bool
+	comments     []span
+}
+
+// A span is a range of bytes in the input.
+type span struct {
+	start, end int
 }
 
 func (l *lexer) error(reason string, args ...any) error {
@@ -25,14 +35,18 @@ func (l *lexer) skipSpace() error {
 Space:
 	for l.i < len(l.data) {
 		if bytes.HasPrefix(l.data[l.i:], []byte("#")) || bytes.HasPrefix(l.data[l.i:], []byte("//")) {
+			start := l.i
 			for ; l.i < len(l.data) && l.data[l.i] != '\n'; l.i++ {
 			}
+			l.comment(start)
 			continue
 		}
 		if bytes.HasPrefix(l.data[l.i:], []byte("/*")) {
 			for i := l.i; i < len(l.data); i++ {
 				if bytes.HasPrefix(l.data[i:], []byte("*/")) {
+					start := l.i
 					l.i = i + 2
+					l.comment(start)
 					continue Space
 				}
 			}
@@ -47,6 +61,33 @@ Space:
 	return nil
 }
 
+// skipBad skips past the input that caused an error, so that lexing can
+// continue after it. An unterminated string is skipped to the end of the
+// line, and an unterminated comment to the end of the input.
+func (l *lexer) skipBad() {
+	switch {
+	case l.i == len(l.data):
+	case bytes.HasPrefix(l.data[l.i:], []byte("/*")):
+		l.i = len(l.data)
+	case l.data[l.i] == '\'' || l.data[l.i] == '"':
+		if n := bytes.IndexByte(l.data[l.i:], '\n'); n >= 0 {
+			l.i += n
+		} else {
+			l.i = len(l.data)
+		}
+	default:
+		_, n := utf8.DecodeRune(l.data[l.i:])
+		l.i += n
+	}
+}
+
+// comment records a comment that ends at the current position.
+func (l *lexer) comment(start int) {
+	if l.keepComments {
+		l.comments = append(l.comments, span{start, l.i})
+	}
+}
+
 func numFirstByte(b byte) bool {
 	return b == '-' ||
 		b == '+' ||
@@ -56,6 +97,7 @@ func numFirstByte(b byte) bool {
 
 func numTailByte(b byte) bool {
 	return numFirstByte(b) ||
+		b == '%' ||
 		'a' <= b && b <= 'z' ||
 		'A' <= b && b <= 'Z'
 }
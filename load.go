@@ -0,0 +1,163 @@
+package ccl
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// MustLoadFS unmarshals the file name in fsys into v, and panics if it can't
+// be read or unmarshaled. It's meant for default configs that are embedded
+// in the program with go:embed, so that a mistake in them is caught as soon
+// as the program starts:
+//
+//	//go:embed default.ccl
+//	var defaults embed.FS
+//
+//	var cfg = func() (cfg Config) {
+//	    ccl.MustLoadFS(defaults, "default.ccl", &cfg)
+//	    return cfg
+//	}()
+//
+// The panic message starts with the file name and the position of the
+// error, as in "default.ccl:3:9 syntax error: ...".
+func MustLoadFS(fsys fs.FS, name string, v any) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		panic("ccl: " + err.Error())
+	}
+	if err := Unmarshal(data, v); err != nil {
+		panic("ccl: " + inFile(name, err).Error())
+	}
+}
+
+// MergeOptions configures how [LoadWithDefaults] and [MergeOptions.Merge]
+// combine the layers of a config.
+type MergeOptions struct {
+	// Unmarshal holds the options used to unmarshal each layer.
+	Unmarshal UnmarshalOptions
+	// AppendLists appends the values of a repeated field in a layer to its
+	// values from the earlier layers. By default they replace them.
+	AppendLists bool
+	// AllowMissing makes a config file that doesn't exist the same as an
+	// empty one, so that the defaults are used as they are. It's only used
+	// by LoadWithDefaults.
+	AllowMissing bool
+	// If Provenance is non-nil, it's filled in with the position where
+	// each field got its final value.
+	Provenance Provenance
+}
+
+// A Layer is one of the documents that make up a config.
+type Layer struct {
+	// Name identifies the layer in errors and in a [Provenance], and is
+	// usually its file name.
+	Name string
+	Data []byte
+}
+
+// Provenance records where the fields of a config that was merged from
+// several layers got their values. Its keys are the dotted paths of fields,
+// as in "server.listen". A message's own entry is where it was last written
+// to. For a list that's appended to, it's where the last values were added.
+type Provenance map[string]Source
+
+// remove deletes the entries for path and the fields inside it.
+func (p Provenance) remove(path string) {
+	for k := range p {
+		if k == path || strings.HasPrefix(k, path+".") {
+			delete(p, k)
+		}
+	}
+}
+
+// A Source is the position in a layer where a field was written.
+type Source struct {
+	Layer     string
+	Line, Col int
+}
+
+// String returns the source in the form "name:line:col".
+func (s Source) String() string {
+	return fmt.Sprintf("%s:%d:%d", s.Layer, s.Line, s.Col)
+}
+
+// LoadWithDefaults unmarshals defaults into v, followed by the config file
+// at path, whose fields override the defaults. It's the same as calling
+// [MergeOptions.Merge] with a layer called "defaults" followed by the file.
+// The file is read with [ReadFile], so it can be compressed.
+func LoadWithDefaults(defaults []byte, path string, v any, opts MergeOptions) error {
+	layers := []Layer{{"defaults", defaults}}
+	data, err := ReadFile(path)
+	if err == nil {
+		layers = append(layers, Layer{path, data})
+	} else if !opts.AllowMissing || !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return opts.Merge(v, layers...)
+}
+
+// Merge unmarshals each of the layers into v in turn, so that the fields of
+// each layer override the ones before it:
+//
+//   - A field that's only in an earlier layer keeps its value.
+//   - A field that's written in a later layer replaces its earlier value.
+//   - Messages are merged field by field, following these rules, and so
+//     are maps, key by key.
+//   - A repeated field replaces all of its earlier values, unless
+//     o.AppendLists is set.
+//
+// A struct field can choose how it's merged with the merge option in its
+// tag, whatever o says:
+//
+//	type Config struct {
+//	    Middleware []string   `ccl:"middleware,merge=append"`
+//	    Hosts      []string   `ccl:"hosts,merge=replace"`
+//	    TLS        *TLSConfig `ccl:"tls,merge=replace"`
+//	}
+//
+// With merge=append, a repeated field's values are appended to its earlier
+// values. With merge=replace, a field's value replaces its earlier value as
+// a whole, even if it's a message or map. merge=deep, which is the default
+// for messages and maps, merges them field by field.
+//
+// A field with the explicit option only has to be written in one of the
+// layers.
+//
+// An error in a layer is prefixed with its name, as in
+// "app.ccl:3:9 syntax error: ...".
+func (o MergeOptions) Merge(v any, layers ...Layer) error {
+	explicit := make(map[string]bool)
+	for i, l := range layers {
+		err := o.Unmarshal.unmarshal(l.Data, v, func(p *parser) {
+			p.overlay = i > 0
+			p.appendLists = o.AppendLists
+			p.provenance = o.Provenance
+			p.layer = l.Name
+			p.explicit = explicit
+		})
+		if err != nil {
+			return inFile(l.Name, err)
+		}
+	}
+	for _, path := range slices.Sorted(maps.Keys(explicit)) {
+		if !explicit[path] {
+			return fmt.Errorf("field %q must be set explicitly", path)
+		}
+	}
+	return nil
+}
+
+// inFile adds the name of the file that err is about to it. A syntax error
+// starts with its position, which the name is joined to, as in
+// "app.ccl:3:9 syntax error: ...".
+func inFile(name string, err error) error {
+	var syntaxErr *syntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Errorf("%s:%w", name, err)
+	}
+	return fmt.Errorf("%s: %w", name, err)
+}
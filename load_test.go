@@ -0,0 +1,453 @@
+package ccl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestMustLoadFS(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Name string `ccl:"name"`
+		Port int    `ccl:"port"`
+	}
+	fsys := fstest.MapFS{
+		"default.ccl": {Data: []byte("name: \"web\"\nport: 8080\n")},
+		"bad.ccl":     {Data: []byte("name: \"web\"\nport: \"8080\"\n")},
+	}
+	var got message
+	MustLoadFS(fsys, "default.ccl", &got)
+	if want := (message{Name: "web", Port: 8080}); got != want {
+		t.Errorf("MustLoadFS = %+v, want %+v", got, want)
+	}
+
+	for _, tc := range []struct {
+		desc string
+		name string
+		want string
+	}{{
+		desc: "Invalid",
+		name: "bad.ccl",
+		want: `ccl: bad.ccl:2:7 syntax error: field "port" has type int, got string "8080"`,
+	}, {
+		desc: "Missing",
+		name: "missing.ccl",
+		want: "ccl: open missing.ccl: file does not exist",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			defer func() {
+				if r := recover(); r != tc.want {
+					t.Errorf("MustLoadFS(%q) panicked with %v, want %q", tc.name, r, tc.want)
+				}
+			}()
+			MustLoadFS(fsys, tc.name, new(message))
+		})
+	}
+}
+
+func TestLoadWithDefaults(t *testing.T) {
+	t.Parallel()
+
+	type server struct {
+		Listen []string `ccl:"listen"`
+		Port   int      `ccl:"port"`
+		Debug  *bool    `ccl:"debug"`
+	}
+	type message struct {
+		Name   string            `ccl:"name"`
+		Server server            `ccl:"server"`
+		Limits *server           `ccl:"limits"`
+		Labels map[string]string `ccl:"labels"`
+		Hosts  []string          `ccl:"hosts"`
+	}
+	defaults := []byte(`
+name: "web"
+server {
+    listen: ["a", "b"]
+    port: 80
+}
+labels { app: "web"  tier: "frontend" }
+hosts: "example.com"
+`)
+	for _, tc := range []struct {
+		desc string
+		user string
+		opts MergeOptions
+		want message
+	}{{
+		desc: "Empty",
+		user: ``,
+		want: message{
+			Name:   "web",
+			Server: server{Listen: []string{"a", "b"}, Port: 80},
+			Labels: map[string]string{"app": "web", "tier": "frontend"},
+			Hosts:  []string{"example.com"},
+		},
+	}, {
+		desc: "Override",
+		user: `
+name: "api"
+server { port: 8080 }
+labels { tier: "backend" }
+hosts: "api.example.com"
+hosts: "api2.example.com"
+limits { port: 10 }`,
+		want: message{
+			Name:   "api",
+			Server: server{Listen: []string{"a", "b"}, Port: 8080},
+			Limits: &server{Port: 10},
+			Labels: map[string]string{"app": "web", "tier": "backend"},
+			Hosts:  []string{"api.example.com", "api2.example.com"},
+		},
+	}, {
+		desc: "ReplaceNestedList",
+		user: `server { listen: "c" }`,
+		want: message{
+			Name:   "web",
+			Server: server{Listen: []string{"c"}, Port: 80},
+			Labels: map[string]string{"app": "web", "tier": "frontend"},
+			Hosts:  []string{"example.com"},
+		},
+	}, {
+		desc: "EmptyListClears",
+		user: `hosts: []`,
+		want: message{
+			Name:   "web",
+			Server: server{Listen: []string{"a", "b"}, Port: 80},
+			Labels: map[string]string{"app": "web", "tier": "frontend"},
+		},
+	}, {
+		desc: "AppendLists",
+		user: `hosts: "api.example.com"  server { listen: "c" }`,
+		opts: MergeOptions{AppendLists: true},
+		want: message{
+			Name:   "web",
+			Server: server{Listen: []string{"a", "b", "c"}, Port: 80},
+			Labels: map[string]string{"app": "web", "tier": "frontend"},
+			Hosts:  []string{"example.com", "api.example.com"},
+		},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "user.ccl")
+			if err := os.WriteFile(path, []byte(tc.user), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var got message
+			if err := LoadWithDefaults(defaults, path, &got, tc.opts); err != nil {
+				t.Fatalf("LoadWithDefaults failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("LoadWithDefaults returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoadWithDefaults_MergeTags(t *testing.T) {
+	t.Parallel()
+
+	type server struct {
+		Listen string `ccl:"listen"`
+		Port   int    `ccl:"port"`
+	}
+	type message struct {
+		Middleware []string          `ccl:"middleware,merge=append"`
+		Hosts      []string          `ccl:"hosts,merge=replace"`
+		Server     server            `ccl:"server,merge=replace"`
+		Backend    *server           `ccl:"backend,merge=deep"`
+		Labels     map[string]string `ccl:"labels,merge=replace"`
+		Tags       map[string]string `ccl:"tags"`
+	}
+	defaults := []byte(`
+middleware: ["log", "auth"]
+hosts: ["a", "b"]
+server { listen: "localhost"  port: 80 }
+backend { listen: "backend"  port: 8080 }
+labels { app: "web" }
+tags { env: "prod" }
+`)
+	user := `
+middleware: "gzip"
+hosts: "c"
+server { port: 8080 }
+backend { port: 9090 }
+labels { tier: "frontend" }
+tags { owner: "me" }
+`
+	want := message{
+		Middleware: []string{"log", "auth", "gzip"},
+		Hosts:      []string{"c"},
+		Server:     server{Port: 8080},
+		Backend:    &server{Listen: "backend", Port: 9090},
+		Labels:     map[string]string{"tier": "frontend"},
+		Tags:       map[string]string{"env": "prod", "owner": "me"},
+	}
+	path := filepath.Join(t.TempDir(), "user.ccl")
+	if err := os.WriteFile(path, []byte(user), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The tags win over AppendLists.
+	for _, opts := range []MergeOptions{{}, {AppendLists: true}} {
+		var got message
+		if err := LoadWithDefaults(defaults, path, &got, opts); err != nil {
+			t.Fatalf("LoadWithDefaults(%+v) failed: %s", opts, err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("LoadWithDefaults(%+v) returned unexpected diff (-want +got):\n%s", opts, diff)
+		}
+	}
+}
+
+func TestMergeOptions_Provenance(t *testing.T) {
+	t.Parallel()
+
+	type server struct {
+		Listen string `ccl:"listen"`
+		Port   int    `ccl:"port"`
+	}
+	type message struct {
+		Name    string            `ccl:"name"`
+		Server  server            `ccl:"server"`
+		Backend server            `ccl:"backend,merge=replace"`
+		Labels  map[string]string `ccl:"labels"`
+		Hosts   []string          `ccl:"hosts"`
+	}
+	layers := []Layer{{
+		Name: "defaults",
+		Data: []byte(`name: "web"
+server { listen: "localhost"  port: 80 }
+backend {
+    listen: "backend"
+    port: 8080
+}
+labels { app: "web" }
+hosts: "a"
+`),
+	}, {
+		Name: "site.ccl",
+		Data: []byte(`server {
+    port: 8080
+}
+labels { tier: "frontend" }
+`),
+	}, {
+		Name: "host.ccl",
+		Data: []byte(`backend { port: 9090 }
+hosts: ["b", "c"]
+`),
+	}}
+	got := Provenance{}
+	if err := (MergeOptions{Provenance: got}).Merge(new(message), layers...); err != nil {
+		t.Fatalf("Merge failed: %s", err)
+	}
+	want := Provenance{
+		"name":          {"defaults", 1, 1},
+		"server":        {"site.ccl", 1, 1},
+		"server.listen": {"defaults", 2, 10},
+		"server.port":   {"site.ccl", 2, 5},
+		"backend":       {"host.ccl", 1, 1},
+		"backend.port":  {"host.ccl", 1, 11},
+		"labels":        {"site.ccl", 4, 1},
+		"labels.app":    {"defaults", 7, 10},
+		"labels.tier":   {"site.ccl", 4, 10},
+		"hosts":         {"host.ccl", 2, 1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Merge recorded unexpected provenance diff (-want +got):\n%s", diff)
+	}
+	if got, want := got["server.port"].String(), "site.ccl:2:5"; got != want {
+		t.Errorf("Source.String() = %q, want %q", got, want)
+	}
+}
+
+func TestMergeOptions_Warnings(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Hosts  []string `ccl:"hosts"`
+		Ports  []int    `ccl:"ports,merge=append"`
+		Labels []string `ccl:"labels"`
+	}
+	layers := []Layer{
+		{Name: "defaults", Data: []byte("hosts: [\"a\", \"b\"]\nports: 80\n")},
+		{Name: "site.ccl", Data: []byte("hosts: []\nports: []\nlabels: []\n")},
+	}
+	var got []Warning
+	if err := (MergeOptions{Unmarshal: UnmarshalOptions{Warnings: &got}}).Merge(new(message), layers...); err != nil {
+		t.Fatalf("Merge failed: %s", err)
+	}
+	want := []Warning{
+		{Layer: "site.ccl", Line: 1, Col: 1, Message: `empty list replaces the 2 values of field "hosts" from earlier layers`},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Merge returned unexpected diff in warnings (-want +got):\n%s", diff)
+	}
+	if s, want := got[0].String(), `site.ccl:1:1 warning: empty list replaces the 2 values of field "hosts" from earlier layers`; s != want {
+		t.Errorf("Warning.String() = %q, want %q", s, want)
+	}
+}
+
+func TestMergeOptions_Explicit(t *testing.T) {
+	t.Parallel()
+
+	type server struct {
+		TLS bool `ccl:"tls,explicit"`
+	}
+	type message struct {
+		DryRun bool    `ccl:"dry_run,explicit"`
+		Server *server `ccl:"server"`
+	}
+	for _, tc := range []struct {
+		desc    string
+		layers  []string
+		want    message
+		wantErr string
+	}{{
+		desc:   "EarlierLayer",
+		layers: []string{`dry_run: true  server { tls: true }`, `server {}`},
+		want:   message{DryRun: true, Server: &server{TLS: true}},
+	}, {
+		desc:   "LaterLayer",
+		layers: []string{`server {}`, `dry_run: false  server { tls: true }`},
+		want:   message{Server: &server{TLS: true}},
+	}, {
+		desc:    "Missing",
+		layers:  []string{`server { tls: true }`, ``},
+		wantErr: `field "dry_run" must be set explicitly`,
+	}, {
+		desc:    "MissingNested",
+		layers:  []string{`dry_run: true`, `server {}`},
+		wantErr: `field "server.tls" must be set explicitly`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var layers []Layer
+			for i, data := range tc.layers {
+				layers = append(layers, Layer{Name: fmt.Sprint("layer", i), Data: []byte(data)})
+			}
+			var got message
+			err := MergeOptions{}.Merge(&got, layers...)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Errorf("Merge returned error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Merge failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Merge returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMergeTag_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		v    any
+		want string
+	}{{
+		desc: "AppendScalar",
+		v: &struct {
+			A int `ccl:"a,merge=append"`
+		}{},
+		want: `option "merge=append" needs a slice field`,
+	}, {
+		desc: "AppendBytes",
+		v: &struct {
+			A []byte `ccl:"a,merge=append"`
+		}{},
+		want: `option "merge=append" needs a slice field`,
+	}, {
+		desc: "DeepList",
+		v: &struct {
+			A []int `ccl:"a,merge=deep"`
+		}{},
+		want: `option "merge=deep" needs a struct or map field`,
+	}, {
+		desc: "Unknown",
+		v: &struct {
+			A []int `ccl:"a,merge=shallow"`
+		}{},
+		want: `unknown option "merge=shallow"`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if err := Unmarshal(nil, tc.v); err == nil || err.Error() != tc.want {
+				t.Errorf("Unmarshal returned error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadWithDefaults_Missing(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Name string `ccl:"name"`
+	}
+	path := filepath.Join(t.TempDir(), "missing.ccl")
+	var got message
+	if err := LoadWithDefaults([]byte(`name: "web"`), path, &got, MergeOptions{}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadWithDefaults(%q) returned error %v, want %v", path, err, os.ErrNotExist)
+	}
+	if err := LoadWithDefaults([]byte(`name: "web"`), path, &got, MergeOptions{AllowMissing: true}); err != nil {
+		t.Fatalf("LoadWithDefaults(%q) with AllowMissing failed: %s", path, err)
+	}
+	if got.Name != "web" {
+		t.Errorf("LoadWithDefaults(%q) with AllowMissing set Name = %q, want %q", path, got.Name, "web")
+	}
+}
+
+func TestLoadWithDefaults_Error(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Port int `ccl:"port"`
+	}
+	path := filepath.Join(t.TempDir(), "user.ccl")
+	if err := os.WriteFile(path, []byte("\nport: \"80\""), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		desc     string
+		defaults string
+		want     string
+	}{{
+		desc:     "Defaults",
+		defaults: `port: true`,
+		want:     `defaults:1:7 syntax error: field "port" has type int, got bool true`,
+	}, {
+		desc:     "User",
+		defaults: `port: 80`,
+		want:     path + `:2:7 syntax error: field "port" has type int, got string "80"`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			err := LoadWithDefaults([]byte(tc.defaults), path, new(message), MergeOptions{})
+			if err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+				t.Errorf("LoadWithDefaults returned error %v, want one starting with %q", err, tc.want)
+			}
+		})
+	}
+}
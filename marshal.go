@@ -0,0 +1,608 @@
+package ccl
+
+import (
+	"encoding"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Marshal returns the ccl encoding of v, which must be a struct or a non-nil
+// pointer to a struct. The encoding follows the same rules as [Unmarshal], so
+// unmarshaling the result gives back the original value:
+//
+//   - A field with the zero value is omitted, as is a nil pointer, except
+//     that a field with the explicit option is always written. A non-nil
+//     pointer is encoded as the value it points to.
+//   - Numbers are written in base 10, and bools are written as true or false.
+//   - A string is written as a string, as is a []byte using base64.
+//   - A slice is written as a list, except that an empty slice is written as
+//     [] to distinguish it from a nil slice.
+//   - A struct is written as a message, as is a map. The map's key type must
+//     be a string type or implement [encoding.TextMarshaler], and keys are
+//     sorted unless [MarshalOptions.MapKeyOrder] says otherwise. Keys that
+//     aren't valid field names are written as strings.
+//   - A [Number] is written as a number literal, exactly as it is.
+//   - A type that implements [FieldExporter] is written as a message with
+//     the fields it lists.
+//   - A type that implements [encoding.TextMarshaler] is written as a string
+//     using MarshalText. Otherwise, a type that implements [flag.Value] is
+//     written as a string using its String method.
+//
+// Field names can be changed with the "ccl" struct tag, as described in
+// [Unmarshal]. Marshaling a type that can't be unmarshaled is an error.
+//
+// Infinity and NaN are an [UnsupportedValueError] unless they're enabled with
+// [MarshalOptions.AllowNonFinite]. So is a cycle of pointers, which would
+// otherwise be written forever.
+func Marshal(v any) ([]byte, error) {
+	return MarshalOptions{}.Append(nil, v)
+}
+
+// Append is like [Marshal], but appends the ccl encoding of v to dst and
+// returns the extended buffer. If there's an error, dst is returned
+// unchanged.
+func Append(dst []byte, v any) ([]byte, error) {
+	return MarshalOptions{}.Append(dst, v)
+}
+
+// MarshalOptions configures how values are marshaled. The zero value gives
+// the same behavior as [Marshal].
+type MarshalOptions struct {
+	FormatOptions
+
+	// MapKeyOrder sets the order that map keys are written in, by comparing
+	// two keys like [strings.Compare]. If nil, keys are sorted with
+	// strings.Compare so that the output is deterministic.
+	MapKeyOrder func(a, b string) int
+	// Header is called with the name of each top-level field, so that
+	// generated configs can be laid out like hand-written ones. If blankLine
+	// is true, the field is separated from the one before it by a blank
+	// line. If comment is non-empty, each of its lines is written as a #
+	// comment above the field.
+	Header func(name string) (comment string, blankLine bool)
+	// AllowNonFinite writes infinite and NaN floats as inf, -inf, and nan,
+	// which can be decoded with [UnmarshalOptions.AllowNonFinite].
+	AllowNonFinite bool
+	// Warn, if non-nil, is called with a message about each value whose
+	// encoding is probably not what was intended. At the moment, that's a
+	// number or bool whose type has a String method but doesn't implement
+	// [encoding.TextMarshaler], such as a time.Duration, since it's written
+	// as its underlying value rather than as text. The message starts with
+	// the path of the field.
+	Warn func(msg string)
+
+	// ptrSeen holds the pointers followed to reach the value being
+	// marshaled, so that a cycle is an error rather than a stack overflow.
+	ptrSeen map[pointer]struct{}
+}
+
+// A pointer identifies the value that a pointer points to. It needs the
+// type as well as the address, since a struct and its first field have the
+// same address.
+type pointer struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+// Marshal is like [Marshal] but uses the given options.
+func (o MarshalOptions) Marshal(v any) ([]byte, error) {
+	return o.Append(nil, v)
+}
+
+// Append is like [Append] but uses the given options.
+func (o MarshalOptions) Append(dst []byte, v any) ([]byte, error) {
+	n, err := o.marshalNode(v)
+	if err != nil {
+		return dst, err
+	}
+	return o.FormatOptions.appendNode(dst, n), nil
+}
+
+// EstimateSize returns the size in bytes of the ccl encoding of v, so that a
+// buffer can be allocated for it up front:
+//
+//	size, err := ccl.EstimateSize(cfg)
+//	...
+//	buf, err := ccl.Append(make([]byte, 0, size), cfg)
+//
+// The size is measured by formatting v with the same printer as [Marshal],
+// so it's exact, but it costs as much as Marshal. It returns the same
+// errors as Marshal.
+func EstimateSize(v any) (int, error) {
+	return MarshalOptions{}.EstimateSize(v)
+}
+
+// EstimateSize is like [EstimateSize] but uses the given options.
+func (o MarshalOptions) EstimateSize(v any) (int, error) {
+	b, err := o.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// An UnsupportedValueError is returned when marshaling a value that can't be
+// written in ccl.
+type UnsupportedValueError struct {
+	Value reflect.Value
+	Str   string
+}
+
+func (e *UnsupportedValueError) Error() string {
+	return "unsupported value: " + e.Str
+}
+
+// An Encoder writes ccl documents to an output stream.
+//
+// An Encoder keeps its output buffer between calls to Encode. Encoders can be
+// kept in a [sync.Pool] and reused with [Encoder.Reset] to avoid allocating a
+// new buffer for each document.
+type Encoder struct {
+	w    io.Writer
+	buf  []byte
+	opts MarshalOptions
+}
+
+// NewEncoder returns a new Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the ccl encoding of v to the stream, as described in
+// [Marshal]. Note that encoding more than one value to the same stream gives
+// a single document containing the fields of every value.
+func (e *Encoder) Encode(v any) error {
+	var err error
+	e.buf, err = e.opts.Append(e.buf[:0], v)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(e.buf)
+	return err
+}
+
+// SetOptions sets the options used by future calls to Encode.
+func (e *Encoder) SetOptions(opts MarshalOptions) {
+	e.opts = opts
+}
+
+// Reset makes e write to w, keeping its output buffer and options.
+func (e *Encoder) Reset(w io.Writer) {
+	e.w = w
+}
+
+func (o MarshalOptions) marshalNode(v any) (*Node, error) {
+	val := reflect.ValueOf(v)
+	if val.Kind() == reflect.Pointer && !val.IsNil() {
+		o.ptrSeen = map[pointer]struct{}{{val.Pointer(), val.Type()}: {}}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("value must be a struct or a non-nil pointer to a struct")
+	}
+	var n *Node
+	var err error
+	if fe, ok := asFieldExporter(addressable(val)); ok {
+		n, err = o.marshalExported(fe)
+	} else {
+		n, err = o.marshalMessage(addressable(val))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if o.Header != nil {
+		for _, f := range n.Fields {
+			var comment string
+			comment, f.BlankLine = o.Header(f.Name)
+			if comment != "" {
+				for line := range strings.Lines(comment) {
+					f.Comments = append(f.Comments, strings.TrimRight("# "+strings.TrimSuffix(line, "\n"), " "))
+				}
+			}
+		}
+	}
+	return n, nil
+}
+
+// addressable returns an addressable copy of v if v isn't addressable, so
+// that methods with pointer receivers can be called.
+func addressable(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v
+	}
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	return ptr.Elem()
+}
+
+func (o MarshalOptions) marshalMessage(v reflect.Value) (*Node, error) {
+	n := &Node{Kind: KindMessage, Fields: []*Field{}}
+	for i := range v.NumField() {
+		name, tag, err := parseTag(v.Type().Field(i))
+		if err != nil {
+			return nil, err
+		}
+		fieldVal := v.Field(i)
+		if name == "" {
+			continue
+		}
+		if fieldVal.IsZero() {
+			if tag.explicit {
+				// The field has to be written for the output to
+				// unmarshal, so a nil *bool is written as false too.
+				n.Fields = append(n.Fields, &Field{Name: name, Value: &Node{Kind: KindBool}})
+			}
+			continue
+		}
+		var val *Node
+		if tag.unit != 0 {
+			val = inUnit(fieldVal, tag.unit)
+		} else if val, err = o.field(name).marshalValue(fieldVal); err != nil {
+			return nil, fmt.Errorf("field %q: %w", name, err)
+		}
+		if val == nil {
+			continue
+		}
+		if tag.percent && isFloatType(fieldVal.Type()) {
+			percentage(val)
+		}
+		if len(tag.flags) > 0 {
+			val = flagNames(fieldVal, tag.flags, val)
+		}
+		n.Fields = append(n.Fields, &Field{Name: name, Value: val})
+	}
+	return n, nil
+}
+
+// A FieldExporter is a type that lists its own fields for [Marshal], instead
+// of having its exported struct fields written. It lets a type that keeps
+// its config in unexported fields, behind getters, be marshaled, such as a
+// wrapper around a type from another package:
+//
+//	type Limiter struct {
+//	    rate  float64
+//	    burst int
+//	}
+//
+//	func (l *Limiter) ExportFields() iter.Seq2[string, any] {
+//	    return func(yield func(string, any) bool) {
+//	        _ = yield("rate", l.rate) && yield("burst", l.burst)
+//	    }
+//	}
+//
+// Each value is marshaled as if it were the value of a struct field with
+// that name, and like a struct field, it's omitted if it's nil or the zero
+// value. Fields are written in the order they're yielded.
+//
+// ExportFields is only used for writing. A FieldExporter that's unmarshaled
+// is decoded like any other type, so types that don't have exported fields
+// to decode into usually need a factory registered with [RegisterFactory]
+// as well.
+type FieldExporter interface {
+	ExportFields() iter.Seq2[string, any]
+}
+
+var fieldExporterType = reflect.TypeFor[FieldExporter]()
+
+// asFieldExporter returns v, or a pointer to it, as a FieldExporter if it
+// implements the interface.
+func asFieldExporter(v reflect.Value) (FieldExporter, bool) {
+	if v.Type().Implements(fieldExporterType) {
+		return v.Interface().(FieldExporter), true
+	}
+	if v.Kind() != reflect.Pointer && v.CanAddr() && v.Addr().Type().Implements(fieldExporterType) {
+		return v.Addr().Interface().(FieldExporter), true
+	}
+	return nil, false
+}
+
+func (o MarshalOptions) marshalExported(fe FieldExporter) (*Node, error) {
+	n := &Node{Kind: KindMessage, Fields: []*Field{}}
+	for name, val := range fe.ExportFields() {
+		if val == nil {
+			continue
+		}
+		fieldVal := addressable(reflect.ValueOf(val))
+		if fieldVal.IsZero() {
+			continue
+		}
+		node, err := o.field(name).marshalValue(fieldVal)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", name, err)
+		}
+		if node == nil {
+			continue
+		}
+		n.Fields = append(n.Fields, &Field{Name: name, Value: node})
+	}
+	return n, nil
+}
+
+func (o MarshalOptions) marshalMap(v reflect.Value) (*Node, error) {
+	keyType := v.Type().Key()
+	if keyType.Kind() != reflect.String && !keyType.Implements(textMarshalerType) {
+		return nil, fmt.Errorf("unsupported map key type %s", keyType)
+	}
+	type entry struct {
+		key string
+		val reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	for key, val := range v.Seq2() {
+		if keyType.Implements(textMarshalerType) {
+			text, err := key.Interface().(encoding.TextMarshaler).MarshalText()
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry{string(text), val})
+		} else {
+			entries = append(entries, entry{key.String(), val})
+		}
+	}
+	keyOrder := o.MapKeyOrder
+	if keyOrder == nil {
+		keyOrder = strings.Compare
+	}
+	slices.SortFunc(entries, func(a, b entry) int { return keyOrder(a.key, b.key) })
+	n := &Node{Kind: KindMessage, Fields: make([]*Field, 0, len(entries))}
+	for _, e := range entries {
+		val, err := o.field(e.key).marshalValue(e.val)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", e.key, err)
+		}
+		if val == nil {
+			continue
+		}
+		n.Fields = append(n.Fields, &Field{Name: e.key, Value: val})
+	}
+	return n, nil
+}
+
+// field returns the options for marshaling the value of the named field,
+// whose warnings are prefixed with the field name like errors are.
+func (o MarshalOptions) field(name string) MarshalOptions {
+	if warn := o.Warn; warn != nil {
+		o.Warn = func(msg string) { warn(fmt.Sprintf("field %q: %s", name, msg)) }
+	}
+	return o
+}
+
+var (
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	stringerType      = reflect.TypeFor[fmt.Stringer]()
+)
+
+// warnStringer warns about v if its type has a String method that isn't
+// used, because v is written as a number or bool.
+func (o MarshalOptions) warnStringer(v reflect.Value) {
+	if o.Warn == nil || !v.Type().Implements(stringerType) && !(v.CanAddr() && reflect.PointerTo(v.Type()).Implements(stringerType)) {
+		return
+	}
+	what := "number"
+	if v.Kind() == reflect.Bool {
+		what = "bool"
+	}
+	o.Warn(fmt.Sprintf("type %s has a String method but doesn't implement encoding.TextMarshaler, so it's written as a %s; add a MarshalText method to write it as text", v.Type(), what))
+}
+
+// marshalValue returns the Node for v, or nil if v is a nil pointer or
+// interface.
+func (o MarshalOptions) marshalValue(v reflect.Value) (*Node, error) {
+	if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil, nil
+	}
+	// Pointers are followed first, so that a cycle through a FieldExporter
+	// is caught.
+	if v.Kind() != reflect.Pointer && v.Kind() != reflect.Interface {
+		if fe, ok := asFieldExporter(v); ok {
+			return o.marshalExported(fe)
+		}
+	}
+	if v.Type().Implements(textMarshalerType) || v.CanAddr() && reflect.PointerTo(v.Type()).Implements(textMarshalerType) {
+		if v.Kind() != reflect.Pointer && v.CanAddr() {
+			v = v.Addr()
+		}
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return &Node{Kind: KindString, String: string(text)}, nil
+	}
+	if v.Type().Implements(flagValueType) || v.CanAddr() && reflect.PointerTo(v.Type()).Implements(flagValueType) {
+		if v.Kind() != reflect.Pointer && v.CanAddr() {
+			v = v.Addr()
+		}
+		return &Node{Kind: KindString, String: v.Interface().(flag.Value).String()}, nil
+	}
+	if v.Type() == reflect.TypeFor[Number]() {
+		if _, err := Number(v.String()).Float64(); err != nil {
+			return nil, err
+		}
+		return &Node{Kind: KindNumber, Number: v.String()}, nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		ptr := pointer{v.Pointer(), v.Type()}
+		if _, ok := o.ptrSeen[ptr]; ok {
+			return nil, &UnsupportedValueError{v, fmt.Sprintf("encountered a cycle via %s", v.Type())}
+		}
+		if o.ptrSeen == nil {
+			o.ptrSeen = make(map[pointer]struct{})
+		}
+		o.ptrSeen[ptr] = struct{}{}
+		defer delete(o.ptrSeen, ptr)
+		return o.marshalValue(addressable(v.Elem()))
+	case reflect.Interface:
+		return o.marshalValue(addressable(v.Elem()))
+	case reflect.Bool:
+		o.warnStringer(v)
+		return &Node{Kind: KindBool, Bool: v.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		o.warnStringer(v)
+		return &Node{Kind: KindNumber, Number: strconv.FormatInt(v.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		o.warnStringer(v)
+		return &Node{Kind: KindNumber, Number: strconv.FormatUint(v.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		o.warnStringer(v)
+		f := v.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			if !o.AllowNonFinite {
+				return nil, &UnsupportedValueError{v, strconv.FormatFloat(f, 'g', -1, 64)}
+			}
+			switch {
+			case math.IsInf(f, 1):
+				return &Node{Kind: KindNumber, Number: "inf"}, nil
+			case math.IsInf(f, -1):
+				return &Node{Kind: KindNumber, Number: "-inf"}, nil
+			default:
+				return &Node{Kind: KindNumber, Number: "nan"}, nil
+			}
+		}
+		return &Node{Kind: KindNumber, Number: formatFloat(f, v.Type().Bits())}, nil
+	case reflect.String:
+		return &Node{Kind: KindString, String: v.String()}, nil
+	case reflect.Struct:
+		return o.marshalMessage(v)
+	case reflect.Map:
+		return o.marshalMap(v)
+	case reflect.Slice:
+		if v.Type() == reflect.TypeFor[[]byte]() {
+			return &Node{Kind: KindString, String: base64.StdEncoding.EncodeToString(v.Bytes())}, nil
+		}
+		list := &Node{Kind: KindList, List: make([]*Node, v.Len())}
+		for i := range v.Len() {
+			if i == 1 && v.Type().Elem().Kind() != reflect.Interface {
+				o.Warn = nil // the other elements have the same type
+			}
+			elem, err := o.marshalValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			if elem == nil {
+				return nil, fmt.Errorf("list element %d is nil", i)
+			}
+			if elem.Kind == KindList {
+				return nil, fmt.Errorf("list element %d is a list", i)
+			}
+			list.List[i] = elem
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// isFloatType reports whether t is a float type, or a pointer to or slice of
+// one.
+func isFloatType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+}
+
+// inUnit returns the duration v, or the list of durations if it's a slice,
+// as numbers of the given unit, for fields with the unit option. A duration
+// that isn't a whole number of units is written as a string with its own
+// units, such as "1.5s", so that it's decoded exactly.
+func inUnit(v reflect.Value, unit time.Duration) *Node {
+	v = reflect.Indirect(v)
+	if v.Kind() == reflect.Slice {
+		list := &Node{Kind: KindList, List: make([]*Node, v.Len())}
+		for i := range v.Len() {
+			list.List[i] = inUnit(v.Index(i), unit)
+		}
+		return list
+	}
+	d := time.Duration(v.Int())
+	if d%unit != 0 {
+		return &Node{Kind: KindString, String: d.String()}
+	}
+	return &Node{Kind: KindNumber, Number: strconv.FormatInt(int64(d/unit), 10)}
+}
+
+// flagNames returns the list of flag names that make up the integer v, for
+// fields with the flags option, or n, which is v as a number, if some of
+// its bits don't have names.
+func flagNames(v reflect.Value, flags []bitFlag, n *Node) *Node {
+	v = reflect.Indirect(v)
+	var bits uint64
+	if v.CanInt() {
+		bits = uint64(v.Int())
+	} else {
+		bits = v.Uint()
+	}
+	list := &Node{Kind: KindList, List: []*Node{}}
+	rest := bits
+	for _, f := range flags {
+		if f.value != 0 && bits&f.value == f.value && rest&f.value != 0 {
+			list.List = append(list.List, &Node{Kind: KindString, String: f.name})
+			rest &^= f.value
+		}
+	}
+	if rest != 0 {
+		return n
+	}
+	return list
+}
+
+// percentage rewrites the numbers in n as percentages, for fields with the
+// percent option. A number is left alone if the percentage wouldn't be
+// decoded as exactly the same value.
+func percentage(n *Node) {
+	if n.Kind == KindList {
+		for _, elem := range n.List {
+			percentage(elem)
+		}
+		return
+	}
+	if n.Kind != KindNumber {
+		return
+	}
+	var p parser
+	f, err := p.parseFloat([]byte(n.Number))
+	if err != nil {
+		return
+	}
+	// Multiplying by 100 adds rounding errors, so move the decimal point
+	// instead.
+	mant, exp, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+	e, _ := strconv.Atoi(exp)
+	pct, err := strconv.ParseFloat(mant+"e"+strconv.Itoa(e+2), 64)
+	if err != nil {
+		return
+	}
+	lit := formatFloat(pct, 64) + "%"
+	if g, err := p.parsePercent([]byte(lit)); err == nil && g == f {
+		n.Number = lit
+	}
+}
+
+// formatFloat formats f as a ccl number. strconv's formatting has to be
+// adjusted because ccl doesn't allow leading zeros, even in exponents.
+func formatFloat(f float64, bitSize int) string {
+	s := strconv.FormatFloat(f, 'g', -1, bitSize)
+	mant, exp, hasExp := strings.Cut(s, "e")
+	if rest, ok := strings.CutPrefix(mant, "0."); ok {
+		mant = "." + rest
+	} else if rest, ok := strings.CutPrefix(mant, "-0."); ok {
+		mant = "-." + rest
+	}
+	if !hasExp {
+		return mant
+	}
+	sign := ""
+	if exp[0] == '-' {
+		sign = "-"
+	}
+	return mant + "e" + sign + strings.TrimLeft(exp[1:], "0")
+}
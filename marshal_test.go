@@ -0,0 +1,898 @@
+package ccl
+
+import (
+	"bytes"
+	"errors"
+	"iter"
+	"math"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestMarshal(t *testing.T) {
+	t.Parallel()
+
+	type nestedMessage struct {
+		Field int64 `ccl:"field"`
+	}
+	type message struct {
+		String          string                   `ccl:"string"`
+		Int             int                      `ccl:"int"`
+		Int8            int8                     `ccl:"int8"`
+		Uint64          uint64                   `ccl:"uint64"`
+		Float           float64                  `ccl:"float"`
+		Float32         float32                  `ccl:"float32"`
+		Bool            bool                     `ccl:"bool"`
+		Message         *nestedMessage           `ccl:"message"`
+		Value           nestedMessage            `ccl:"value"`
+		Repeated        []int64                  `ccl:"repeated"`
+		RepeatedMessage []*nestedMessage         `ccl:"repeated_message"`
+		Bytes           []byte                   `ccl:"bytes"`
+		Time            time.Time                `ccl:"time"`
+		TimePointer     *time.Time               `ccl:"time_pointer"`
+		IntPointer      *int                     `ccl:"int_pointer"`
+		Map             map[string]int           `ccl:"map"`
+		MapMessage      map[string]nestedMessage `ccl:"map_message"`
+		MapAddr         map[netip.Addr]string    `ccl:"map_addr"`
+		Untagged        string
+
+		Ignore     map[int]int `ccl:"-"`
+		unexported int64
+	}
+
+	for _, tc := range []struct {
+		desc string
+		in   message
+		want string
+	}{{
+		desc: "Empty",
+		in:   message{},
+		want: ``,
+	}, {
+		desc: "Scalars",
+		in: message{
+			String:   "asdf\n",
+			Int:      -10,
+			Int8:     math.MaxInt8,
+			Uint64:   math.MaxUint64,
+			Bool:     true,
+			Untagged: "untagged",
+		},
+		want: `string: "asdf\n"
+int: -10
+int8: 127
+uint64: 18446744073709551615
+bool: true
+Untagged: "untagged"
+`,
+	}, {
+		desc: "Float",
+		in:   message{Float: 0.5},
+		want: "float: .5\n",
+	}, {
+		desc: "FloatNegative",
+		in:   message{Float: -0.5},
+		want: "float: -.5\n",
+	}, {
+		desc: "FloatExponent",
+		in:   message{Float: 1.5e100},
+		want: "float: 1.5e100\n",
+	}, {
+		desc: "FloatNegativeExponent",
+		in:   message{Float: 1e-7},
+		want: "float: 1e-7\n",
+	}, {
+		desc: "FloatIntegral",
+		in:   message{Float: 3},
+		want: "float: 3\n",
+	}, {
+		desc: "Float32",
+		in:   message{Float32: 0.1},
+		want: "float32: .1\n",
+	}, {
+		desc: "Message",
+		in: message{
+			Message: &nestedMessage{Field: 10},
+			Value:   nestedMessage{Field: 11},
+		},
+		want: `message {
+    field: 10
+}
+value {
+    field: 11
+}
+`,
+	}, {
+		desc: "EmptyMessage",
+		in:   message{Message: &nestedMessage{}},
+		want: "message {}\n",
+	}, {
+		desc: "Repeated",
+		in: message{
+			Repeated:        []int64{1, 2, 3},
+			RepeatedMessage: []*nestedMessage{{Field: 1}, {}},
+		},
+		want: `repeated: [1, 2, 3]
+repeated_message: [
+    {
+        field: 1
+    },
+    {},
+]
+`,
+	}, {
+		desc: "EmptyList",
+		in:   message{Repeated: []int64{}},
+		want: "repeated: []\n",
+	}, {
+		desc: "Bytes",
+		in:   message{Bytes: []byte("test")},
+		want: "bytes: \"dGVzdA==\"\n",
+	}, {
+		desc: "TextMarshaler",
+		in: message{
+			Time:        time.Date(2025, time.October, 28, 7, 41, 47, 0, time.UTC),
+			TimePointer: ptr(time.Date(2025, time.October, 28, 7, 41, 47, 0, time.UTC)),
+		},
+		want: `time: "2025-10-28T07:41:47Z"
+time_pointer: "2025-10-28T07:41:47Z"
+`,
+	}, {
+		desc: "Map",
+		in: message{
+			Map:        map[string]int{"b": 2, "a": 1, "c": 0},
+			MapMessage: map[string]nestedMessage{"x": {Field: 1}},
+		},
+		want: `map {
+    a: 1
+    b: 2
+    c: 0
+}
+map_message {
+    x {
+        field: 1
+    }
+}
+`,
+	}, {
+		desc: "MapQuotedKey",
+		in:   message{Map: map[string]int{"example.com": 1, "": 2}},
+		want: `map {
+    "": 2
+    "example.com": 1
+}
+`,
+	}, {
+		desc: "MapTextMarshalerKey",
+		in: message{MapAddr: map[netip.Addr]string{
+			netip.MustParseAddr("::1"):      "localhost",
+			netip.MustParseAddr("10.0.0.1"): "router",
+		}},
+		want: `map_addr {
+    "10.0.0.1": "router"
+    "::1": "localhost"
+}
+`,
+	}, {
+		desc: "EmptyMap",
+		in:   message{Map: map[string]int{}},
+		want: "map {}\n",
+	}, {
+		desc: "Pointer",
+		in:   message{IntPointer: ptr(0)},
+		want: "int_pointer: 0\n",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Marshal(tc.in)
+			if err != nil {
+				t.Fatalf("Marshal(%+v) failed: %s", tc.in, err)
+			}
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("Marshal(%+v) returned unexpected diff (-want +got):\n%s", tc.in, diff)
+			}
+			var roundTrip message
+			if err := Unmarshal(got, &roundTrip); err != nil {
+				t.Fatalf("Unmarshal(%q) failed: %s", got, err)
+			}
+			if diff := cmp.Diff(tc.in, roundTrip, cmp.AllowUnexported(message{})); diff != "" {
+				t.Errorf("Unmarshal(Marshal(%+v)) returned unexpected diff (-want +got):\n%s", tc.in, diff)
+			}
+		})
+	}
+}
+
+func TestMarshal_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		in   any
+	}{{
+		desc: "NotStruct",
+		in:   5,
+	}, {
+		desc: "NilPointer",
+		in:   (*struct{})(nil),
+	}, {
+		desc: "Chan",
+		in:   struct{ F chan int }{make(chan int)},
+	}, {
+		desc: "NestedList",
+		in:   struct{ F [][]int }{[][]int{{1}}},
+	}, {
+		desc: "NilElement",
+		in:   struct{ F []*int }{[]*int{nil}},
+	}, {
+		desc: "NaN",
+		in:   struct{ F float64 }{math.NaN()},
+	}, {
+		desc: "Inf",
+		in:   struct{ F float64 }{math.Inf(1)},
+	}, {
+		desc: "MapIntKeys",
+		in:   struct{ F map[int]int }{map[int]int{1: 1}},
+	}, {
+		desc: "BadOption",
+		in: struct {
+			F int `ccl:",asdf"`
+		}{},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if got, err := Marshal(tc.in); err == nil {
+				t.Errorf("Marshal(%+v) returned %q, want error", tc.in, got)
+			}
+		})
+	}
+}
+
+func TestMarshalOptions_AllowNonFinite(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Inf    float64  `ccl:"inf"`
+		NegInf float32  `ccl:"neg_inf"`
+		NaN    *float64 `ccl:"nan"`
+	}
+	in := message{Inf: math.Inf(1), NegInf: float32(math.Inf(-1)), NaN: ptr(math.NaN())}
+
+	_, err := Marshal(in)
+	var unsupported *UnsupportedValueError
+	if !errors.As(err, &unsupported) {
+		t.Errorf("Marshal(%+v) returned error %v, want *UnsupportedValueError", in, err)
+	}
+
+	got, err := MarshalOptions{AllowNonFinite: true}.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal(%+v) failed: %s", in, err)
+	}
+	want := "inf: inf\nneg_inf: -inf\nnan: nan\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshal(%+v) returned unexpected diff (-want +got):\n%s", in, diff)
+	}
+	if err := Unmarshal(got, new(message)); err == nil {
+		t.Errorf("Unmarshal(%q) succeeded without AllowNonFinite", got)
+	}
+	var roundTrip message
+	if err := (UnmarshalOptions{AllowNonFinite: true}).Unmarshal(got, &roundTrip); err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %s", got, err)
+	}
+	if diff := cmp.Diff(in, roundTrip, cmpopts.EquateNaNs()); diff != "" {
+		t.Errorf("Unmarshal(%q) returned unexpected diff (-want +got):\n%s", got, diff)
+	}
+}
+
+func TestMarshal_Percent(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Rate     float64   `ccl:"rate,percent"`
+		Rate32   float32   `ccl:"rate32,percent"`
+		Repeated []float64 `ccl:"repeated,percent"`
+		Int      int       `ccl:"int,percent"`
+	}
+	in := message{Rate: 0.025, Rate32: 0.07, Repeated: []float64{1, 1e-9}, Int: 5}
+	got, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal(%+v) failed: %s", in, err)
+	}
+	want := "rate: 2.5%\nrate32: 7%\nrepeated: [100%, 1e-7%]\nint: 5\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshal(%+v) returned unexpected diff (-want +got):\n%s", in, diff)
+	}
+	var roundTrip message
+	if err := Unmarshal(got, &roundTrip); err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %s", got, err)
+	}
+	if diff := cmp.Diff(in, roundTrip); diff != "" {
+		t.Errorf("Unmarshal(%q) returned unexpected diff (-want +got):\n%s", got, diff)
+	}
+}
+
+func TestMarshal_Flags(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Perms   uint32 `ccl:"perms,flags=READ:4|WRITE:2|EXEC:1"`
+		All     *int   `ccl:"all,flags=ALL:7|READ:4|WRITE:2|EXEC:1"`
+		Unnamed int    `ccl:"unnamed,flags=READ:4"`
+	}
+	in := message{Perms: 6, All: ptr(7), Unnamed: 5}
+	got, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal(%+v) failed: %s", in, err)
+	}
+	want := "perms: [\"READ\", \"WRITE\"]\nall: [\"ALL\"]\nunnamed: 5\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshal(%+v) returned unexpected diff (-want +got):\n%s", in, diff)
+	}
+	var roundTrip message
+	if err := Unmarshal(got, &roundTrip); err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %s", got, err)
+	}
+	if diff := cmp.Diff(in, roundTrip); diff != "" {
+		t.Errorf("Unmarshal(%q) returned unexpected diff (-want +got):\n%s", got, diff)
+	}
+}
+
+func TestMarshal_Unit(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Timeout  time.Duration   `ccl:"timeout_ms,unit=ms"`
+		Interval *time.Duration  `ccl:"interval,unit=s"`
+		Backoff  []time.Duration `ccl:"backoff,unit=m"`
+	}
+	in := message{Timeout: 1500 * time.Millisecond, Interval: ptr(1500 * time.Millisecond), Backoff: []time.Duration{time.Minute, time.Hour}}
+	got, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal(%+v) failed: %s", in, err)
+	}
+	want := "timeout_ms: 1500\ninterval: \"1.5s\"\nbackoff: [1, 60]\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshal(%+v) returned unexpected diff (-want +got):\n%s", in, diff)
+	}
+	var roundTrip message
+	if err := Unmarshal(got, &roundTrip); err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %s", got, err)
+	}
+	if diff := cmp.Diff(in, roundTrip); diff != "" {
+		t.Errorf("Unmarshal(%q) returned unexpected diff (-want +got):\n%s", got, diff)
+	}
+}
+
+func TestMarshal_Explicit(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Name         string `ccl:"name"`
+		AllowDeletes bool   `ccl:"allow_deletes,explicit"`
+		DryRun       *bool  `ccl:"dry_run,explicit"`
+	}
+	in := message{Name: "x"}
+	got, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal(%+v) failed: %s", in, err)
+	}
+	want := "name: \"x\"\nallow_deletes: false\ndry_run: false\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshal(%+v) returned unexpected diff (-want +got):\n%s", in, diff)
+	}
+	var out message
+	if err := Unmarshal(got, &out); err != nil {
+		t.Fatalf("Unmarshal of the output of Marshal failed: %s", err)
+	}
+	if out.Name != in.Name || out.AllowDeletes || out.DryRun == nil || *out.DryRun {
+		t.Errorf("Unmarshal(Marshal(%+v)) = %+v", in, out)
+	}
+}
+
+func TestMarshal_Recursive(t *testing.T) {
+	t.Parallel()
+
+	type node struct {
+		Name     string  `ccl:"name"`
+		Children []*node `ccl:"child"`
+		Next     *node   `ccl:"next"`
+	}
+	in := &node{
+		Name:     "root",
+		Children: []*node{{Name: "a", Next: &node{Name: "b"}}, {Name: "c"}},
+	}
+	got, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal(%+v) failed: %s", in, err)
+	}
+	want := `name: "root"
+child: [
+    {
+        name: "a"
+        next {
+            name: "b"
+        }
+    },
+    {
+        name: "c"
+    },
+]
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshal(%+v) returned unexpected diff (-want +got):\n%s", in, diff)
+	}
+
+	cycle := &node{Name: "a", Next: &node{Name: "b"}}
+	cycle.Next.Next = cycle
+	wantErr := `field "next": field "next": unsupported value: encountered a cycle via *ccl.node`
+	if _, err := Marshal(cycle); err == nil || err.Error() != wantErr {
+		t.Errorf("Marshal of a cycle returned error %v, want %q", err, wantErr)
+	}
+}
+
+func TestMarshal_FlagValue(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		List    listFlag   `ccl:"list"`
+		Pointer *levelFlag `ccl:"pointer"`
+	}
+	in := message{List: listFlag{"a", "b"}, Pointer: &levelFlag{"info"}}
+	got, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal(%+v) failed: %s", in, err)
+	}
+	want := "list: \"a,b\"\npointer: \"info\"\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshal(%+v) returned unexpected diff (-want +got):\n%s", in, diff)
+	}
+}
+
+type limiter struct {
+	rate  float64
+	burst int
+	next  *limiter
+}
+
+func (l *limiter) ExportFields() iter.Seq2[string, any] {
+	return func(yield func(string, any) bool) {
+		_ = yield("rate", l.rate) && yield("burst", l.burst) && yield("next", l.next)
+	}
+}
+
+func TestMarshal_FieldExporter(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Limiter  limiter   `ccl:"limiter"`
+		Pointer  *limiter  `ccl:"pointer"`
+		Limiters []limiter `ccl:"limiters"`
+	}
+	in := message{
+		Limiter:  limiter{rate: 1.5, burst: 10, next: &limiter{rate: 2}},
+		Pointer:  &limiter{burst: 1},
+		Limiters: []limiter{{rate: 3}},
+	}
+	got, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal(%+v) failed: %s", in, err)
+	}
+	want := `limiter {
+    rate: 1.5
+    burst: 10
+    next {
+        rate: 2
+    }
+}
+pointer {
+    burst: 1
+}
+limiters: [
+    {
+        rate: 3
+    },
+]
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshal(%+v) returned unexpected diff (-want +got):\n%s", in, diff)
+	}
+
+	got, err = Marshal(&limiter{rate: 1, burst: 2})
+	if err != nil {
+		t.Fatalf("Marshal of a top-level FieldExporter failed: %s", err)
+	}
+	if want := "rate: 1\nburst: 2\n"; string(got) != want {
+		t.Errorf("Marshal of a top-level FieldExporter = %q, want %q", got, want)
+	}
+
+	cycle := &limiter{rate: 1}
+	cycle.next = cycle
+	wantErr := `field "next": unsupported value: encountered a cycle via *ccl.limiter`
+	if _, err := Marshal(cycle); err == nil || err.Error() != wantErr {
+		t.Errorf("Marshal of a cycle returned error %v, want %q", err, wantErr)
+	}
+}
+
+type color int
+
+func (c color) String() string {
+	return [...]string{"red", "green"}[c]
+}
+
+func TestMarshalOptions_Warn(t *testing.T) {
+	t.Parallel()
+
+	type nested struct {
+		Timeout time.Duration `ccl:"timeout"`
+	}
+	in := struct {
+		Color  color            `ccl:"color"`
+		Colors []color          `ccl:"colors"`
+		Nested nested           `ccl:"nested"`
+		Map    map[string]color `ccl:"map"`
+		Text   netip.Addr       `ccl:"text"`
+		Plain  int              `ccl:"plain"`
+	}{
+		Color:  1,
+		Colors: []color{0, 1, 0},
+		Nested: nested{Timeout: time.Second},
+		Map:    map[string]color{"a": 1},
+		Text:   netip.MustParseAddr("::1"),
+		Plain:  1,
+	}
+	var got []string
+	if _, err := (MarshalOptions{Warn: func(msg string) { got = append(got, msg) }}).Marshal(in); err != nil {
+		t.Fatalf("Marshal(%+v) failed: %s", in, err)
+	}
+	const colorWarning = "type ccl.color has a String method but doesn't implement encoding.TextMarshaler, so it's written as a number; add a MarshalText method to write it as text"
+	want := []string{
+		`field "color": ` + colorWarning,
+		`field "colors": ` + colorWarning,
+		`field "nested": field "timeout": type time.Duration has a String method but doesn't implement encoding.TextMarshaler, so it's written as a number; add a MarshalText method to write it as text`,
+		`field "map": field "a": ` + colorWarning,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Marshal(%+v) returned unexpected warnings (-want +got):\n%s", in, diff)
+	}
+}
+
+func TestMarshalOptions_MapKeyOrder(t *testing.T) {
+	t.Parallel()
+
+	in := struct {
+		M map[string]int `ccl:"m"`
+	}{map[string]int{"a": 1, "b": 2, "c": 3}}
+	got, err := MarshalOptions{
+		MapKeyOrder: func(a, b string) int { return strings.Compare(b, a) },
+	}.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal(%+v) failed: %s", in, err)
+	}
+	want := "m {\n    c: 3\n    b: 2\n    a: 1\n}\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshal(%+v) returned unexpected diff (-want +got):\n%s", in, diff)
+	}
+}
+
+func TestMarshalOptions_MultilineStrings(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Script string `ccl:"script"`
+	}
+	in := message{Script: "set -e\nmake\n"}
+	got, err := MarshalOptions{FormatOptions: FormatOptions{MultilineStrings: true}}.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal(%+v) failed: %s", in, err)
+	}
+	want := "script: \"set -e\nmake\n\"\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshal(%+v) returned unexpected diff (-want +got):\n%s", in, diff)
+	}
+	var roundTrip message
+	if err := Unmarshal(got, &roundTrip); err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %s", got, err)
+	}
+	if roundTrip != in {
+		t.Errorf("Unmarshal(%q) = %+v, want %+v", got, roundTrip, in)
+	}
+}
+
+func TestMarshalOptions_Header(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Name   string `ccl:"name"`
+		Server struct {
+			Listen string `ccl:"listen"`
+		} `ccl:"server"`
+		Database struct {
+			Host string `ccl:"host"`
+		} `ccl:"database"`
+	}
+	in := message{Name: "app"}
+	in.Server.Listen = ":80"
+	in.Database.Host = "db"
+	got, err := MarshalOptions{
+		Header: func(name string) (string, bool) {
+			switch name {
+			case "server":
+				return "Frontend\n\nDon't touch", true
+			case "database":
+				return "", true
+			}
+			return "Generated file", false
+		},
+	}.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal(%+v) failed: %s", in, err)
+	}
+	want := `# Generated file
+name: "app"
+
+# Frontend
+#
+# Don't touch
+server {
+    listen: ":80"
+}
+
+database {
+    host: "db"
+}
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshal(%+v) returned unexpected diff (-want +got):\n%s", in, diff)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Int int `ccl:"int"`
+	}
+	buf := make([]byte, 0, 64)
+	buf = append(buf, "# header\n"...)
+	got, err := Append(buf, message{Int: 1})
+	if err != nil {
+		t.Fatalf("Append failed: %s", err)
+	}
+	if want := "# header\nint: 1\n"; string(got) != want {
+		t.Errorf("Append = %q, want %q", got, want)
+	}
+	if &got[0] != &buf[:1][0] {
+		t.Errorf("Append reallocated a buffer with enough capacity")
+	}
+	got, err = Append(buf, 5)
+	if err == nil {
+		t.Errorf("Append(5) succeeded, want error")
+	}
+	if string(got) != string(buf) {
+		t.Errorf("Append(%q, 5) = %q, want dst unchanged", buf, got)
+	}
+}
+
+func TestEstimateSize(t *testing.T) {
+	t.Parallel()
+
+	type nested struct {
+		Name  string `ccl:"name"`
+		Ports []int  `ccl:"ports"`
+	}
+	type message struct {
+		String   string            `ccl:"string"`
+		Multi    string            `ccl:"multi"`
+		Float    float64           `ccl:"float"`
+		Bool     bool              `ccl:"bool"`
+		Nested   nested            `ccl:"nested"`
+		Repeated []nested          `ccl:"repeated"`
+		Empty    []string          `ccl:"empty"`
+		Map      map[string]string `ccl:"map"`
+	}
+	v := message{
+		String:   "it's \"quoted\"\x00\u0085\tü",
+		Multi:    "line one\nline two\r\n",
+		Float:    1.5,
+		Bool:     true,
+		Nested:   nested{Name: "a", Ports: []int{80, 443}},
+		Repeated: []nested{{Name: "b"}, {}},
+		Empty:    []string{},
+		Map:      map[string]string{"key": "v", "not a field name": "w"},
+	}
+	for _, opts := range []MarshalOptions{
+		{},
+		{FormatOptions: FormatOptions{Indent: "\t", AlignValues: true, MultilineStrings: true, TrailingComma: TrailingCommaAlways}},
+		{
+			FormatOptions: FormatOptions{CommentWidth: 20},
+			Header: func(name string) (string, bool) {
+				return "# The " + name + " field, with a comment that's long enough to wrap.", true
+			},
+		},
+	} {
+		size, err := opts.EstimateSize(v)
+		if err != nil {
+			t.Fatalf("EstimateSize failed: %s", err)
+		}
+		got, err := opts.Append(make([]byte, 0, size), v)
+		if err != nil {
+			t.Fatalf("Append failed: %s", err)
+		}
+		if size != len(got) {
+			t.Errorf("EstimateSize = %d, want %d for:\n%s", size, len(got), got)
+		}
+	}
+	if _, err := EstimateSize(5); err == nil {
+		t.Errorf("EstimateSize(5) succeeded, want error")
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Int int `ccl:"int"`
+	}
+	var buf1, buf2 bytes.Buffer
+	e := NewEncoder(&buf1)
+	if err := e.Encode(message{Int: 1}); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	e.Reset(&buf2)
+	if err := e.Encode(&message{Int: 2}); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	if got, want := buf1.String(), "int: 1\n"; got != want {
+		t.Errorf("Encode wrote %q, want %q", got, want)
+	}
+	if got, want := buf2.String(), "int: 2\n"; got != want {
+		t.Errorf("Encode after Reset wrote %q, want %q", got, want)
+	}
+}
+
+// fuzzValue fills in v with values taken from data, and returns what's left
+// of data. Floats are always finite, since inf and nan can't be marshaled by
+// default, and strings are valid UTF-8, since invalid bytes are marshaled as
+// the replacement character. depth limits the nesting of pointers, slices, and maps.
+func fuzzValue(v reflect.Value, data []byte, depth int) []byte {
+	take := func(n int) uint64 {
+		var x uint64
+		for i := 0; i < n && len(data) > 0; i++ {
+			x = x<<8 | uint64(data[0])
+			data = data[1:]
+		}
+		return x
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(take(1)&1 == 1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(take(int(v.Type().Size()))))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(take(int(v.Type().Size())))
+	case reflect.Float32:
+		f := math.Float32frombits(uint32(take(4)))
+		if math.IsInf(float64(f), 0) || math.IsNaN(float64(f)) {
+			f = 0
+		}
+		v.SetFloat(float64(f))
+	case reflect.Float64:
+		f := math.Float64frombits(take(8))
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			f = 0
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		n := min(int(take(1)), len(data))
+		v.SetString(strings.ToValidUTF8(string(data[:n]), "\uFFFD"))
+		data = data[n:]
+	case reflect.Pointer:
+		if depth > 0 && take(1)&1 == 1 {
+			v.Set(reflect.New(v.Type().Elem()))
+			data = fuzzValue(v.Elem(), data, depth-1)
+		}
+	case reflect.Slice:
+		if depth == 0 {
+			break
+		}
+		n := int(take(1) % 4)
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+		for i := range n {
+			data = fuzzValue(v.Index(i), data, depth-1)
+		}
+	case reflect.Map:
+		if depth == 0 {
+			break
+		}
+		n := int(take(1) % 4)
+		v.Set(reflect.MakeMap(v.Type()))
+		for range n {
+			key := reflect.New(v.Type().Key()).Elem()
+			elem := reflect.New(v.Type().Elem()).Elem()
+			data = fuzzValue(key, data, depth-1)
+			data = fuzzValue(elem, data, depth-1)
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				data = fuzzValue(v.Field(i), data, depth)
+			}
+		}
+	}
+	return data
+}
+
+func FuzzMarshal(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte("\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\x0d\x0e\x0f"))
+	f.Add(bytes.Repeat([]byte{0xff}, 100))
+	f.Add([]byte("\x05hello\x01\x03\x02\x80\x00\x00\x00\x00\x00\x00\x00\x04\"\\\n\t"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		type nestedMessage struct {
+			Field    int64             `ccl:"field"`
+			Name     string            `ccl:"name"`
+			Repeated []string          `ccl:"repeated"`
+			Map      map[string]uint16 `ccl:"map"`
+		}
+		type message struct {
+			String          string                   `ccl:"string"`
+			Int             int                      `ccl:"int"`
+			Int8            int8                     `ccl:"int8"`
+			Int16           int16                    `ccl:"int16"`
+			Int32           int32                    `ccl:"int32"`
+			Uint            uint                     `ccl:"uint"`
+			Uint8           uint8                    `ccl:"uint8"`
+			Uint64          uint64                   `ccl:"uint64"`
+			Float           float64                  `ccl:"float"`
+			Float32         float32                  `ccl:"float32"`
+			Rate            float64                  `ccl:"rate,percent"`
+			Bool            bool                     `ccl:"bool"`
+			Bytes           []byte                   `ccl:"bytes"`
+			Message         *nestedMessage           `ccl:"message"`
+			Value           nestedMessage            `ccl:"value"`
+			Repeated        []int64                  `ccl:"repeated"`
+			RepeatedFloat   []float32                `ccl:"repeated_float"`
+			RepeatedMessage []nestedMessage          `ccl:"repeated_message"`
+			IntPointer      *int                     `ccl:"int_pointer"`
+			Map             map[string]string        `ccl:"map"`
+			MapMessage      map[string]nestedMessage `ccl:"map_message"`
+		}
+		var in message
+		fuzzValue(reflect.ValueOf(&in).Elem(), data, 3)
+		b, err := Marshal(in)
+		if err != nil {
+			t.Fatalf("Marshal(%+v) failed: %s", in, err)
+		}
+		if size, err := EstimateSize(in); err != nil || size < len(b) {
+			t.Fatalf("EstimateSize(%+v) = %d, %v, want at least %d\n%s", in, size, err, len(b), b)
+		}
+		// Nil and empty lists and maps are written the same way.
+		opts := cmp.Options{cmpopts.EquateEmpty()}
+		var out message
+		if err := Unmarshal(b, &out); err != nil {
+			t.Fatalf("Unmarshal(Marshal(%+v)) failed: %s\n%s", in, err, b)
+		}
+		if diff := cmp.Diff(in, out, opts); diff != "" {
+			t.Fatalf("Unmarshal(Marshal(v)) returned unexpected diff (-v +got):\n%s\n%s", diff, b)
+		}
+		formatted, err := Format(b)
+		if err != nil {
+			t.Fatalf("Format(Marshal(%+v)) failed: %s\n%s", in, err, b)
+		}
+		out = message{}
+		if err := Unmarshal(formatted, &out); err != nil {
+			t.Fatalf("Unmarshal(Format(Marshal(%+v))) failed: %s\n%s", in, err, formatted)
+		}
+		if diff := cmp.Diff(in, out, opts); diff != "" {
+			t.Fatalf("Unmarshal(Format(Marshal(v))) returned unexpected diff (-v +got):\n%s\n%s", diff, formatted)
+		}
+	})
+}
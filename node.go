@@ -0,0 +1,630 @@
+package ccl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// A Kind is the type of value held by a [Node].
+type Kind uint8
+
+const (
+	KindBool Kind = iota + 1
+	KindNumber
+	KindString
+	KindList
+	KindMessage
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindBool:
+		return "bool"
+	case KindNumber:
+		return "number"
+	case KindString:
+		return "string"
+	case KindList:
+		return "list"
+	case KindMessage:
+		return "message"
+	default:
+		return fmt.Sprintf("Kind(%d)", k)
+	}
+}
+
+// A Node is a ccl value that hasn't been decoded into a Go type. Only the
+// field corresponding to Kind is meaningful.
+type Node struct {
+	Kind Kind
+
+	Bool bool
+	// Number holds the number as it was written in the document, e.g. "0xff",
+	// "1.5e10", or "2.5%".
+	Number string
+	// String holds the string value with escape sequences expanded and
+	// adjacent string literals concatenated.
+	String string
+	// Concatenated is set if String was written as adjacent string
+	// literals. Like the offsets, it's ignored by [Node.Equal].
+	Concatenated bool
+	List         []*Node
+	// Fields holds the fields of a message in the order they were written.
+	// A key that is written more than once has one entry per occurrence.
+	Fields []*Field
+	// EndComments holds the comments in a message or list after its last
+	// field or element, in the same form as Field.Comments. A blank line
+	// before them is recorded as a leading empty string.
+	EndComments []string
+
+	// Comments and TrailingComment are the comments of a list element, like
+	// those of a Field. A blank line before the element is recorded as a
+	// leading empty string in Comments. They're empty for other Nodes, whose
+	// comments belong to their Field.
+	Comments        []string
+	TrailingComment string
+
+	// Start and End are the byte offsets of the value in the document that
+	// it was parsed from, so that data[Start:End] is the text of the value,
+	// including the brackets of a list or message. The top-level message
+	// spans the whole document. Use [Position] to convert an offset to a
+	// line and column. Nodes that weren't parsed have zero offsets, and the
+	// offsets are ignored by [Node.Equal].
+	Start, End int
+}
+
+// A Field is a key-value pair inside a message.
+type Field struct {
+	Name  string
+	Value *Node
+
+	// Comments are written on the lines before the field, including the
+	// comment markers, e.g. "# comment" or "/* comment */". An empty string
+	// stands for a blank line.
+	Comments []string
+	// BlankLine is set if the field is separated from the one before it by
+	// a blank line.
+	BlankLine bool
+	// TrailingComment is written at the end of the field's last line.
+	TrailingComment string
+
+	// Start and End are the byte offsets of the field, from the start of
+	// its key to the end of its value, and NameEnd is the end of its key.
+	// Comments aren't included.
+	Start, NameEnd, End int
+}
+
+// Position returns the line and column of the byte at offset in data. Both
+// start at 1, and the column counts bytes rather than characters, as in
+// syntax error messages.
+func Position(data []byte, offset int) (line, col int) {
+	line, col = 1, 1
+	for _, b := range data[:offset] {
+		if b == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
+// A Token is a lexical token of a ccl document: punctuation such as a brace
+// or colon, a key, a number, a single string literal, or a comment.
+type Token struct {
+	// Start and End are the byte offsets of the token.
+	Start, End int
+	Comment    bool
+}
+
+// Tokens splits data into tokens in the order they're written, for tools
+// such as syntax highlighters that work below the level of [Parse]. Only
+// lexical errors, such as an unterminated string, are reported; the tokens
+// don't have to form a valid document.
+func Tokens(data []byte) ([]Token, error) {
+	if err := checkSize(int64(len(data))); err != nil {
+		return nil, err
+	}
+	l := lexer{data: data, keepComments: true}
+	var toks []Token
+	flush := func() {
+		for _, c := range l.comments {
+			toks = append(toks, Token{Start: c.start, End: c.end, Comment: true})
+		}
+		l.comments = l.comments[:0]
+	}
+	for {
+		i, tok, err := l.next()
+		flush()
+		if err == errEOF {
+			return toks, nil
+		}
+		if err != nil {
+			return toks, err
+		}
+		toks = append(toks, Token{Start: i, End: i + len(tok)})
+	}
+}
+
+// Parse parses a ccl document into a tree of Nodes. The returned Node has
+// kind KindMessage and holds the top-level fields of the document.
+//
+// Unlike [Unmarshal], Parse has no type information, so a key written more
+// than once is never an error.
+//
+// Comments and blank lines are attached to the tree, so that it can be
+// printed again with [FormatNode] without losing them and so that moving a
+// field or list element moves its comments along with it. The rules are:
+//
+//   - Comments on their own lines before a field or list element are its
+//     leading comments, in Field.Comments or Node.Comments.
+//   - A comment after the end of a field or list element on the same line is
+//     its trailing comment. The comma after a list element is part of it.
+//   - Comments after the last field or element of a message or list are the
+//     EndComments of that message or list. The comments at the end of the
+//     document belong to the top-level message.
+//   - Comments anywhere else, such as between a key and its value, are
+//     moved to the leading comments of the next field or element, or to the
+//     end comments if there isn't one.
+func Parse(data []byte) (*Node, error) {
+	if err := checkSize(int64(len(data))); err != nil {
+		return nil, err
+	}
+	p := &parser{lexer: lexer{data: data, keepComments: true}, data: data}
+	n, err := p.parseNodeMessage(true)
+	if err != nil {
+		return nil, err
+	}
+	n.End = len(data)
+	return n, nil
+}
+
+// MustParse is like [Parse], but takes the document as a string and panics
+// if it can't be parsed. It's meant for documents written into the program,
+// such as fixtures in tests.
+func MustParse(data string) *Node {
+	n, err := Parse([]byte(data))
+	if err != nil {
+		panic("ccl: " + err.Error())
+	}
+	return n
+}
+
+// ParseAll is like [Parse], but it doesn't stop at the first syntax error.
+// After an error it skips ahead to the next field or the end of the message
+// and carries on, so that every error in the document can be reported at
+// once, as an editor or linter would want. The returned error joins all of
+// the errors with [errors.Join].
+//
+// The returned Node is never nil. It holds the fields that were parsed
+// without errors; the rest are left out.
+func ParseAll(data []byte) (*Node, error) {
+	if err := checkSize(int64(len(data))); err != nil {
+		return &Node{Kind: KindMessage, Fields: []*Field{}}, err
+	}
+	p := &parser{lexer: lexer{data: data, keepComments: true}, data: data, recovering: true}
+	// At the top level, every error is recorded in p.errs.
+	n, _ := p.parseNodeMessage(true)
+	n.End = len(data)
+	return n, errors.Join(p.errs...)
+}
+
+func (p *parser) parseNodeMessage(topLevel bool) (*Node, error) {
+	n := &Node{Kind: KindMessage, Fields: []*Field{}}
+	for {
+		start := len(p.data)
+		if _, err := p.peek(); err == nil {
+			start = p.i
+		}
+		comments, blank := p.takeComments(start)
+		if len(n.Fields) == 0 {
+			blank = false
+		}
+		var tok []byte
+		var err error
+		if topLevel {
+			tok, err = p.nextEOF()
+			if err == errEOF {
+				n.EndComments = endComments(comments, blank)
+				return n, nil
+			}
+		} else {
+			tok, err = p.next()
+		}
+		var field *Field
+		if err == nil {
+			if !topLevel && tok[0] == '}' {
+				n.EndComments = endComments(comments, blank)
+				return n, nil
+			}
+			field, err = p.parseNodeField(tok)
+		}
+		if err != nil {
+			// A premature EOF is only recorded once, at the top level.
+			if !p.recovering || !topLevel && p.err == errEOF {
+				return nil, err
+			}
+			p.errs = append(p.errs, err)
+			p.resync(topLevel)
+			continue
+		}
+		field.Comments = comments
+		field.BlankLine = blank
+		field.TrailingComment = p.trailingComment()
+		n.Fields = append(n.Fields, field)
+	}
+}
+
+func (p *parser) parseNodeField(tok []byte) (*Field, error) {
+	start := p.i
+	name, err := p.parseKey(tok)
+	if err != nil {
+		return nil, err
+	}
+	nameEnd := p.prevEnd
+	tok, err = p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch tok[0] {
+	case '{':
+	case ':':
+		tok, err = p.next()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.error("expecting colon")
+	}
+	val, err := p.parseNode(tok)
+	if err != nil {
+		return nil, err
+	}
+	return &Field{Name: string(name), Value: val, Start: start, NameEnd: nameEnd, End: val.End}, nil
+}
+
+// resync skips the input after a syntax error up to the start of the next
+// field, or the closing brace of the current message, so that parsing can
+// carry on from there. Lexer errors found along the way are recorded.
+func (p *parser) resync(topLevel bool) {
+	depth := 0
+	for {
+		if p.err != nil {
+			if p.err == errEOF {
+				return
+			}
+			p.err = nil
+			p.lexer.skipBad()
+		}
+		tok, err := p.peek()
+		if err != nil {
+			if err != errEOF {
+				p.errs = append(p.errs, err)
+			}
+			continue
+		}
+		switch {
+		case tok[0] == '{' || tok[0] == '[':
+			depth++
+		case tok[0] == '}' || tok[0] == ']':
+			if depth == 0 && tok[0] == '}' && !topLevel {
+				return
+			}
+			depth = max(depth-1, 0)
+		case depth == 0 && (fieldFirstByte(tok[0]) || tok[0] == '\'' || tok[0] == '"') && p.quotedKey():
+			return
+		}
+		p.nextEOF()
+	}
+}
+
+// takeComments returns the comments before offset i that haven't been
+// attached to a Node yet, and whether they're preceded by a blank line.
+func (p *parser) takeComments(i int) (comments []string, blank bool) {
+	prev := p.prevEnd
+	for ; p.nextComment < len(p.lexer.comments); p.nextComment++ {
+		c := p.lexer.comments[p.nextComment]
+		if c.start >= i {
+			break
+		}
+		if len(comments) == 0 {
+			blank = p.blankBetween(prev, c.start)
+		} else if p.blankBetween(prev, c.start) {
+			comments = append(comments, "")
+		}
+		comments = append(comments, string(p.data[c.start:c.end]))
+		prev = max(prev, c.end)
+	}
+	if len(comments) == 0 {
+		blank = p.blankBetween(prev, i)
+	} else if p.blankBetween(prev, i) {
+		comments = append(comments, "")
+	}
+	return comments, blank
+}
+
+// trailingComment returns the comment after the last token on the same
+// line, if there is one.
+func (p *parser) trailingComment() string {
+	p.peek() // lex the comments before the next token
+	if p.nextComment == len(p.lexer.comments) {
+		return ""
+	}
+	c := p.lexer.comments[p.nextComment]
+	if c.start < p.prevEnd || bytes.IndexByte(p.data[p.prevEnd:c.start], '\n') >= 0 {
+		return ""
+	}
+	p.nextComment++
+	p.prevEnd = c.end
+	return string(p.data[c.start:c.end])
+}
+
+// blankBetween reports whether there's a blank line between offsets i and j.
+func (p *parser) blankBetween(i, j int) bool {
+	return i < j && bytes.Count(p.data[i:j], []byte("\n")) >= 2
+}
+
+// endComments returns the comments at the end of a message.
+func endComments(comments []string, blank bool) []string {
+	if blank && len(comments) > 0 {
+		return append([]string{""}, comments...)
+	}
+	return comments
+}
+
+func (p *parser) parseNodeList() (*Node, error) {
+	n := &Node{Kind: KindList, List: []*Node{}}
+	comma := false
+	for {
+		start := len(p.data)
+		if _, err := p.peek(); err == nil {
+			start = p.i
+		}
+		comments, blank := p.takeComments(start)
+		if len(n.List) == 0 {
+			blank = false
+		}
+		tok, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		if tok[0] == ']' {
+			n.EndComments = endComments(comments, blank)
+			return n, nil
+		}
+		if len(n.List) > 0 && !comma {
+			return nil, p.error("expecting comma")
+		}
+		if tok[0] == '[' {
+			return nil, p.error("invalid repeated value")
+		}
+		val, err := p.parseNode(tok)
+		if err != nil {
+			return nil, err
+		}
+		comma = false
+		if tok, err := p.peek(); err == nil && tok[0] == ',' {
+			p.next()
+			comma = true
+		}
+		val.Comments = endComments(comments, blank)
+		val.TrailingComment = p.trailingComment()
+		n.List = append(n.List, val)
+	}
+}
+
+// parseNode parses the value starting with tok, which has just been read,
+// and records its offsets.
+func (p *parser) parseNode(tok []byte) (*Node, error) {
+	start := p.i
+	n, err := p.parseNodeValue(tok)
+	if err != nil {
+		return nil, err
+	}
+	n.Start, n.End = start, p.prevEnd
+	return n, nil
+}
+
+func (p *parser) parseNodeValue(tok []byte) (*Node, error) {
+	switch tok[0] {
+	case '[':
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		return p.parseNodeList()
+	case '{':
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		return p.parseNodeMessage(false)
+	case '\'', '"':
+		s, concatenated, err := p.parseStrings(tok)
+		if err != nil {
+			return nil, err
+		}
+		return &Node{Kind: KindString, String: s, Concatenated: concatenated}, nil
+	}
+	switch string(tok) {
+	case "true":
+		return &Node{Kind: KindBool, Bool: true}, nil
+	case "false":
+		return &Node{Kind: KindBool, Bool: false}, nil
+	}
+	if !numFirstByte(tok[0]) {
+		return nil, p.error("expecting value")
+	}
+	if isPercent(tok) {
+		if _, err := p.parsePercent(tok); err != nil {
+			return nil, err
+		}
+	} else if isFloat(tok) {
+		if _, err := p.parseFloat(tok); err != nil {
+			return nil, err
+		}
+	} else if _, err := p.parseInt(tok); err != nil {
+		return nil, err
+	}
+	return &Node{Kind: KindNumber, Number: string(tok)}, nil
+}
+
+// canonicalNumber returns a representation of a number literal that is the
+// same for all literals with the same value. Integers and floats are never
+// equal, since they can't be decoded into the same types. A percentage is a
+// float, so 50% is equal to .5.
+func canonicalNumber(lit string) string {
+	var p parser
+	if isPercent([]byte(lit)) || isFloat([]byte(lit)) {
+		parse := p.parseFloat
+		if isPercent([]byte(lit)) {
+			parse = p.parsePercent
+		}
+		f, err := parse([]byte(lit))
+		if err != nil {
+			return "?" + lit
+		}
+		if f == 0 {
+			f = 0 // -0
+		}
+		return "f" + strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	n, err := p.parseInt([]byte(lit))
+	if err != nil {
+		return "?" + lit
+	}
+	if n.sgn < 0 && n.n != 0 {
+		return "i-" + strconv.FormatUint(n.n, 10)
+	}
+	return "i" + strconv.FormatUint(n.n, 10)
+}
+
+// merged returns the fields of a message, where keys written more than once
+// have been combined into a single list as described in the package
+// documentation.
+func (n *Node) merged() map[string]*Node {
+	groups := make(map[string][]*Node)
+	for _, f := range n.Fields {
+		groups[f.Name] = append(groups[f.Name], f.Value)
+	}
+	m := make(map[string]*Node, len(groups))
+	for name, vals := range groups {
+		if len(vals) == 1 {
+			m[name] = vals[0]
+			continue
+		}
+		list := &Node{Kind: KindList}
+		for _, v := range vals {
+			if v.Kind == KindList {
+				list.List = append(list.List, v.List...)
+			} else {
+				list.List = append(list.List, v)
+			}
+		}
+		m[name] = list
+	}
+	return m
+}
+
+// Equal reports whether n and other hold the same value. Comparison is
+// semantic: numbers are compared by value (so 0xff equals 255), the order of
+// message keys doesn't matter, and a key written more than once is equal to
+// the same key written once with a list.
+func (n *Node) Equal(other *Node) bool {
+	if n == nil || other == nil {
+		return n == other
+	}
+	if n.Kind != other.Kind {
+		return false
+	}
+	switch n.Kind {
+	case KindBool:
+		return n.Bool == other.Bool
+	case KindNumber:
+		return canonicalNumber(n.Number) == canonicalNumber(other.Number)
+	case KindString:
+		return n.String == other.String
+	case KindList:
+		return slices.EqualFunc(n.List, other.List, (*Node).Equal)
+	case KindMessage:
+		a, b := n.merged(), other.merged()
+		if len(a) != len(b) {
+			return false
+		}
+		for name, v := range a {
+			if !v.Equal(b[name]) {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
+
+// Hash returns a SHA-256 hash of the value held by n. Nodes that are
+// [Node.Equal] have the same hash, so comments, formatting, and key order
+// don't affect the result. The hash is stable across processes and versions
+// of this package, making it suitable for detecting config changes.
+func (n *Node) Hash() [sha256.Size]byte {
+	return sha256.Sum256(n.appendCanonical(nil))
+}
+
+func appendCanonicalString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func (n *Node) appendCanonical(b []byte) []byte {
+	if n == nil {
+		return append(b, 0)
+	}
+	b = append(b, byte(n.Kind))
+	switch n.Kind {
+	case KindBool:
+		if n.Bool {
+			return append(b, 1)
+		}
+		return append(b, 0)
+	case KindNumber:
+		return appendCanonicalString(b, canonicalNumber(n.Number))
+	case KindString:
+		return appendCanonicalString(b, n.String)
+	case KindList:
+		b = binary.AppendUvarint(b, uint64(len(n.List)))
+		for _, v := range n.List {
+			b = v.appendCanonical(b)
+		}
+		return b
+	case KindMessage:
+		m := n.merged()
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		b = binary.AppendUvarint(b, uint64(len(names)))
+		for _, name := range names {
+			b = appendCanonicalString(b, name)
+			b = m[name].appendCanonical(b)
+		}
+		return b
+	}
+	return b
+}
+
+// Checksum parses a ccl document and returns the [Node.Hash] of its
+// contents. Two documents have the same checksum if they hold the same
+// values, regardless of comments, whitespace, or key order.
+func Checksum(data []byte) ([sha256.Size]byte, error) {
+	n, err := Parse(data)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return n.Hash(), nil
+}
@@ -0,0 +1,474 @@
+package ccl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"roseh.moe/pkg/ccl/x/cclcorpus"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want *Node
+	}{{
+		desc: "Empty",
+		msg:  ``,
+		want: &Node{Kind: KindMessage, Fields: []*Field{}},
+	}, {
+		desc: "Scalars",
+		msg: `
+			bool: true
+			number: 0xff
+			percent: 2.5%
+			string: 'that'"'"'s cool'
+		`,
+		want: &Node{Kind: KindMessage, Fields: []*Field{
+			{Name: "bool", Value: &Node{Kind: KindBool, Bool: true}},
+			{Name: "number", Value: &Node{Kind: KindNumber, Number: "0xff"}},
+			{Name: "percent", Value: &Node{Kind: KindNumber, Number: "2.5%"}},
+			{Name: "string", Value: &Node{Kind: KindString, String: "that's cool"}},
+		}},
+	}, {
+		desc: "Nested",
+		msg:  `msg { list: [1, {}, ] } msg: {}`,
+		want: &Node{Kind: KindMessage, Fields: []*Field{
+			{Name: "msg", Value: &Node{Kind: KindMessage, Fields: []*Field{
+				{Name: "list", Value: &Node{Kind: KindList, List: []*Node{
+					{Kind: KindNumber, Number: "1"},
+					{Kind: KindMessage, Fields: []*Field{}},
+				}}},
+			}}},
+			{Name: "msg", Value: &Node{Kind: KindMessage, Fields: []*Field{}}},
+		}},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Parse([]byte(tc.msg))
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %s", tc.msg, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Parse(%q) returned unexpected diff (-want +got):\n%s", tc.msg, diff)
+			}
+		})
+	}
+}
+
+func TestParse_Corpus(t *testing.T) {
+	t.Parallel()
+
+	for _, doc := range cclcorpus.Documents() {
+		t.Run(doc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			want, err := Parse(doc.Data)
+			if err != nil {
+				t.Fatalf("Parse failed: %s", err)
+			}
+			got, err := ParseAll(doc.Data)
+			if err != nil {
+				t.Fatalf("ParseAll failed: %s", err)
+			}
+			if !want.Equal(got) {
+				t.Error("ParseAll doesn't match Parse")
+			}
+		})
+	}
+}
+
+func TestParse_Offsets(t *testing.T) {
+	t.Parallel()
+
+	msg := `# comment
+a: 1 # trailing
+"b c" {
+	d: ['x' "y", {}]
+}
+e: 50%
+`
+	n, err := Parse([]byte(msg))
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %s", msg, err)
+	}
+	// text returns the source text of every field and value in n, in
+	// order.
+	var text func(n *Node) []string
+	text = func(n *Node) []string {
+		got := []string{msg[n.Start:n.End]}
+		for _, v := range n.List {
+			got = append(got, text(v)...)
+		}
+		for _, f := range n.Fields {
+			got = append(got, msg[f.Start:f.NameEnd], msg[f.Start:f.End])
+			got = append(got, text(f.Value)...)
+		}
+		return got
+	}
+	want := []string{
+		msg,
+		`a`, `a: 1`, `1`,
+		`"b c"`, "\"b c\" {\n\td: ['x' \"y\", {}]\n}", "{\n\td: ['x' \"y\", {}]\n}",
+		`d`, `d: ['x' "y", {}]`, `['x' "y", {}]`, `'x' "y"`, `{}`,
+		`e`, `e: 50%`, `50%`,
+	}
+	if diff := cmp.Diff(want, text(n)); diff != "" {
+		t.Errorf("Parse(%q) returned unexpected offsets (-want +got):\n%s", msg, diff)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	t.Parallel()
+
+	msg := "a: [1, 'x'] // c\n/* d */ b {}"
+	toks, err := Tokens([]byte(msg))
+	if err != nil {
+		t.Fatalf("Tokens(%q) failed: %s", msg, err)
+	}
+	var got []string
+	for _, tok := range toks {
+		s := msg[tok.Start:tok.End]
+		if tok.Comment {
+			s = "comment " + s
+		}
+		got = append(got, s)
+	}
+	want := []string{"a", ":", "[", "1", ",", "'x'", "]", "comment // c", "comment /* d */", "b", "{", "}"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Tokens(%q) returned unexpected diff (-want +got):\n%s", msg, diff)
+	}
+
+	if _, err := Tokens([]byte(`a: "unterminated`)); err == nil {
+		t.Errorf("Tokens succeeded on an unterminated string, want error")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want *syntaxError
+	}{{
+		desc: "NoFieldName",
+		msg:  `10`,
+		want: &syntaxError{line: 1, col: 1},
+	}, {
+		desc: "MissingColon",
+		msg:  `a "b"`,
+		want: &syntaxError{line: 1, col: 3},
+	}, {
+		desc: "BadValue",
+		msg:  `a: b`,
+		want: &syntaxError{line: 1, col: 4},
+	}, {
+		desc: "BadNumber",
+		msg:  `a: 0644`,
+		want: &syntaxError{line: 1, col: 4},
+	}, {
+		desc: "BadPercent",
+		msg:  `a: 0x5%`,
+		want: &syntaxError{line: 1, col: 4},
+	}, {
+		desc: "NestedList",
+		msg:  `a: [[]]`,
+		want: &syntaxError{line: 1, col: 5},
+	}, {
+		desc: "UnterminatedMessage",
+		msg:  `a {`,
+		want: &syntaxError{line: 1, col: 4},
+	}, {
+		desc: "EscapeOnLaterLine",
+		msg:  "a: \"line 1\nline 2\n  \\z\"",
+		want: &syntaxError{line: 3, col: 3},
+	}, {
+		desc: "EscapeAfterMultibyte",
+		msg:  `a: "é\z"`,
+		want: &syntaxError{line: 1, col: 7},
+	}, {
+		desc: "EscapeAfterEscapes",
+		msg:  "a: \"x\n\\x41\\u00e9\\101\\z\"",
+		want: &syntaxError{line: 2, col: 15},
+	}, {
+		desc: "EscapeAfterCRLF",
+		msg:  "a: 'x\r\n\\z'",
+		want: &syntaxError{line: 2, col: 1},
+	}, {
+		desc: "ControlCharacter",
+		msg:  "a: 'x' 'y\nz\x01'",
+		want: &syntaxError{line: 2, col: 2},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse([]byte(tc.msg))
+			got, ok := err.(*syntaxError)
+			if !ok {
+				t.Fatalf("Parse(%q): expected *syntaxError, got error %T %[2]v", tc.msg, err)
+			}
+			if got.line != tc.want.line || got.col != tc.want.col {
+				t.Errorf("Parse(%q) returned error at %d:%d, want %d:%d", tc.msg, got.line, got.col, tc.want.line, tc.want.col)
+			}
+		})
+	}
+}
+
+func TestMustParse(t *testing.T) {
+	t.Parallel()
+
+	want := &Node{Kind: KindMessage, Fields: []*Field{{Name: "a", Value: &Node{Kind: KindNumber, Number: "1"}}}}
+	if diff := cmp.Diff(want, MustParse(`a: 1`)); diff != "" {
+		t.Errorf("MustParse returned unexpected diff (-want +got):\n%s", diff)
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("MustParse(%q) didn't panic", `a: b`)
+		}
+	}()
+	MustParse(`a: b`)
+}
+
+func TestParseAll(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc       string
+		msg        string
+		wantErrs   []string // positions of the errors, as line:col
+		wantFields []string
+	}{{
+		desc:       "NoErrors",
+		msg:        `a: 1 b { c: 2 }`,
+		wantFields: []string{"a", "b"},
+	}, {
+		desc: "SkipsBadFields",
+		msg: `a: 1
+b: oops
+c: 2
+d "missing colon"
+e: 3`,
+		wantErrs:   []string{"2:4", "4:3"},
+		wantFields: []string{"a", "c", "e"},
+	}, {
+		desc: "Nested",
+		msg: `a {
+	b: 0644
+	c: 1
+}
+d: [1, 2,, 3]
+e: true`,
+		wantErrs:   []string{"2:5", "5:10"},
+		wantFields: []string{"a", "e"},
+	}, {
+		desc: "SkipsBalancedBrackets",
+		msg: `a: { b c: { d: 1 } }
+e: 2`,
+		wantErrs:   []string{"1:8"},
+		wantFields: []string{"a", "e"},
+	}, {
+		desc:       "StrayBrace",
+		msg:        `a: 1 } b: 2`,
+		wantErrs:   []string{"1:6"},
+		wantFields: []string{"a", "b"},
+	}, {
+		desc: "LexerErrors",
+		msg: `a: 1
+b: ~
+c: 'unterminated
+d: 2`,
+		wantErrs:   []string{"2:4", "3:4"},
+		wantFields: []string{"a", "d"},
+	}, {
+		desc:       "PrematureEOF",
+		msg:        `a: 1 b { c { d: `,
+		wantErrs:   []string{"1:17"},
+		wantFields: []string{"a"},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			n, err := ParseAll([]byte(tc.msg))
+			var gotErrs []string
+			if err != nil {
+				for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+					e, ok := err.(*syntaxError)
+					if !ok {
+						t.Fatalf("ParseAll(%q): expected *syntaxError, got error %T %[2]v", tc.msg, err)
+					}
+					gotErrs = append(gotErrs, fmt.Sprintf("%d:%d", e.line, e.col))
+				}
+			}
+			if diff := cmp.Diff(tc.wantErrs, gotErrs); diff != "" {
+				t.Errorf("ParseAll(%q) returned unexpected errors (-want +got):\n%s\nerror: %v", tc.msg, diff, err)
+			}
+			var gotFields []string
+			for _, f := range n.Fields {
+				gotFields = append(gotFields, f.Name)
+			}
+			if diff := cmp.Diff(tc.wantFields, gotFields); diff != "" {
+				t.Errorf("ParseAll(%q) returned unexpected fields (-want +got):\n%s", tc.msg, diff)
+			}
+		})
+	}
+}
+
+func TestNodeEqual(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		a, b string
+		want bool
+	}{{
+		desc: "Same",
+		a:    `a: 1 b: "x"`,
+		b:    `a: 1 b: "x"`,
+		want: true,
+	}, {
+		desc: "Formatting",
+		a:    `a: 1 # comment`,
+		b:    "/* comment */\na:\n  1\n",
+		want: true,
+	}, {
+		desc: "KeyOrder",
+		a:    `a: 1 b: 2`,
+		b:    `b: 2 a: 1`,
+		want: true,
+	}, {
+		desc: "HexNumber",
+		a:    `a: 0xff`,
+		b:    `a: 255`,
+		want: true,
+	}, {
+		desc: "NegativeZero",
+		a:    `a: -0 b: -.0`,
+		b:    `a: 0 b: .0`,
+		want: true,
+	}, {
+		desc: "IntNotFloat",
+		a:    `a: 1`,
+		b:    `a: 1.0`,
+		want: false,
+	}, {
+		desc: "RepeatedKey",
+		a:    `a: [1, 2] a: 3 a: [4]`,
+		b:    `a: [1, 2, 3, 4]`,
+		want: true,
+	}, {
+		desc: "Percent",
+		a:    `a: 2.5% b: 50%`,
+		b:    `a: .025 b: .5`,
+		want: true,
+	}, {
+		desc: "PercentNotInt",
+		a:    `a: 100%`,
+		b:    `a: 1`,
+		want: false,
+	}, {
+		desc: "SingleList",
+		a:    `a: 1`,
+		b:    `a: [1]`,
+		want: false,
+	}, {
+		desc: "ListOrder",
+		a:    `a: [1, 2]`,
+		b:    `a: [2, 1]`,
+		want: false,
+	}, {
+		desc: "ConcatString",
+		a:    `a: "a" 'b'`,
+		b:    `a: "ab"`,
+		want: true,
+	}, {
+		desc: "DifferentKind",
+		a:    `a: "1"`,
+		b:    `a: 1`,
+		want: false,
+	}, {
+		desc: "MissingKey",
+		a:    `a {b: 1}`,
+		b:    `a {}`,
+		want: false,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			a, err := Parse([]byte(tc.a))
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %s", tc.a, err)
+			}
+			b, err := Parse([]byte(tc.b))
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %s", tc.b, err)
+			}
+			if got := a.Equal(b); got != tc.want {
+				t.Errorf("Equal(%q, %q) = %t, want %t", tc.a, tc.b, got, tc.want)
+			}
+			if got := b.Equal(a); got != tc.want {
+				t.Errorf("Equal(%q, %q) = %t, want %t", tc.b, tc.a, got, tc.want)
+			}
+			if got := a.Hash() == b.Hash(); got != tc.want {
+				t.Errorf("Hash(%q) == Hash(%q) is %t, want %t", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	t.Parallel()
+
+	a, err := Checksum([]byte("# host a\nlisten: ':80'\nworkers: 4\n"))
+	if err != nil {
+		t.Fatalf("Checksum failed: %s", err)
+	}
+	b, err := Checksum([]byte(`workers: 0x4 listen: ":80"`))
+	if err != nil {
+		t.Fatalf("Checksum failed: %s", err)
+	}
+	c, err := Checksum([]byte(`workers: 5 listen: ":80"`))
+	if err != nil {
+		t.Fatalf("Checksum failed: %s", err)
+	}
+	if a != b {
+		t.Errorf("Checksum of equivalent documents differ: %x != %x", a, b)
+	}
+	if a == c {
+		t.Errorf("Checksum of different documents are both %x", a)
+	}
+	if _, err := Checksum([]byte(`workers:`)); err == nil {
+		t.Errorf("Checksum(%q) succeeded, want error", `workers:`)
+	}
+}
+
+// FuzzParseAll checks that ParseAll always finishes, and that it agrees with
+// Parse up to the first error.
+func FuzzParseAll(f *testing.F) {
+	for _, tc := range fuzzCorpus {
+		f.Add([]byte(tc))
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		want, wantErr := Parse(input)
+		got, err := ParseAll(input)
+		if wantErr == nil {
+			if err != nil {
+				t.Fatalf("ParseAll(%q) failed: %s", input, err)
+			}
+			if !want.Equal(got) {
+				t.Fatalf("ParseAll(%q) doesn't match Parse", input)
+			}
+			return
+		}
+		if err == nil {
+			t.Fatalf("ParseAll(%q) succeeded, but Parse failed: %s", input, wantErr)
+		}
+		if first := err.(interface{ Unwrap() []error }).Unwrap()[0]; first.Error() != wantErr.Error() {
+			t.Fatalf("ParseAll(%q) returned first error %q, want %q", input, first, wantErr)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package ccl
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Normalize returns the semantic canonical form of n, a copy in which:
+//
+//   - keys written more than once are merged into a single key with a list
+//     of their values, as they are when unmarshaled;
+//   - message keys are sorted;
+//   - numbers are written in a canonical form, so 0xff becomes 255 and 50%
+//     becomes .5;
+//   - strings written as adjacent strings are a single string;
+//   - comments, blank lines, and offsets are dropped.
+//
+// The result is [Node.Equal] to n, and two Nodes that are Equal have
+// normalized forms that print the same with [FormatNode], so the printed
+// form can be hashed, diffed, or compared as text.
+func (n *Node) Normalize() *Node {
+	switch n.Kind {
+	case KindBool:
+		return &Node{Kind: KindBool, Bool: n.Bool}
+	case KindNumber:
+		return &Node{Kind: KindNumber, Number: normalNumber(n.Number)}
+	case KindString:
+		return &Node{Kind: KindString, String: n.String}
+	case KindList:
+		out := &Node{Kind: KindList, List: make([]*Node, len(n.List))}
+		for i, v := range n.List {
+			out.List[i] = v.Normalize()
+		}
+		return out
+	case KindMessage:
+		m := n.merged()
+		out := &Node{Kind: KindMessage, Fields: make([]*Field, 0, len(m))}
+		for _, name := range slices.Sorted(maps.Keys(m)) {
+			out.Fields = append(out.Fields, &Field{Name: name, Value: m[name].Normalize()})
+		}
+		return out
+	}
+	return &Node{}
+}
+
+// normalNumber returns the canonical literal of a number, the one written by
+// Normalize.
+func normalNumber(lit string) string {
+	c := canonicalNumber(lit)
+	switch c[0] {
+	case 'i':
+		return c[1:]
+	case 'f':
+		f, _ := strconv.ParseFloat(c[1:], 64)
+		switch s := formatFloat(f, 64); {
+		case s == "0":
+			return ".0"
+		case !strings.ContainsAny(s, ".e"):
+			// Integers and floats aren't equal, so the number has to
+			// stay a float.
+			return s + ".0"
+		default:
+			return s
+		}
+	}
+	// The number is out of range, so it's left as it is.
+	return lit
+}
+
+// NormalizeDocument parses a ccl document and prints the [Node.Normalize]
+// form of it. Documents that hold the same values, however they're written,
+// have the same normalized form.
+func NormalizeDocument(data []byte) ([]byte, error) {
+	n, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return FormatNode(n.Normalize()), nil
+}
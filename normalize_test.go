@@ -0,0 +1,91 @@
+package ccl
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNormalizeDocument(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		data string
+		want string
+	}{{
+		desc: "Empty",
+		data: "# nothing here\n",
+		want: "",
+	}, {
+		desc: "SortKeys",
+		data: "b: 1\na: 2\n",
+		want: "a: 2\nb: 1\n",
+	}, {
+		desc: "DuplicateKeys",
+		data: "host: 'a'\nport: 80\nhost: ['b', 'c']\n",
+		want: "host: [\"a\", \"b\", \"c\"]\nport: 80\n",
+	}, {
+		desc: "Numbers",
+		data: "a: 0xff\nb: -0\nc: 50%\nd: 1e3\ne: -.0\nf: 1.50\ng: +7\nh: 1.5e-7\n",
+		want: "a: 255\nb: 0\nc: .5\nd: 1000.0\ne: .0\nf: 1.5\ng: 7\nh: 1.5e-7\n",
+	}, {
+		desc: "ConcatenatedStrings",
+		data: "s: 'a' \"b\"\n",
+		want: "s: \"ab\"\n",
+	}, {
+		desc: "Comments",
+		data: "# leading\na: 1 # trailing\n\n# end\n",
+		want: "a: 1\n",
+	}, {
+		desc: "Nested",
+		data: "server { port: 80 host: 'x' }\nserver { host: 'y' }\n",
+		want: `server: [
+    {
+        host: "x"
+        port: 80
+    },
+    {
+        host: "y"
+    },
+]
+`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := NormalizeDocument([]byte(tc.data))
+			if err != nil {
+				t.Fatalf("NormalizeDocument failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("NormalizeDocument returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// FuzzNormalize checks that the normalized form of a document holds the same
+// values, and doesn't change when it's normalized again.
+func FuzzNormalize(f *testing.F) {
+	for _, tc := range fuzzCorpus {
+		f.Add([]byte(tc))
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		n, err := Parse(input)
+		if err != nil {
+			return
+		}
+		norm := FormatNode(n.Normalize())
+		got, err := Parse(norm)
+		if err != nil {
+			t.Fatalf("Parse of the normalized form failed: %s\n%s", err, norm)
+		}
+		if !n.Equal(got) {
+			t.Errorf("normalized form %s isn't equal to %s", norm, FormatNode(n))
+		}
+		if again := FormatNode(got.Normalize()); string(again) != string(norm) {
+			t.Errorf("normalizing again gave %s, want %s", again, norm)
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package ccl
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// A Number is a number decoded into an interface value, such as a field of
+// type any. It holds the number exactly as it was written, e.g. "0xff" or
+// "2.5%", so that large integers such as 64-bit IDs don't lose precision by
+// being converted to float64. [UnmarshalOptions.Numbers] can be used to get
+// int64 and float64 values instead.
+type Number string
+
+func (n Number) String() string {
+	return string(n)
+}
+
+// Int64 returns the number as an int64. It's an error if the number isn't an
+// integer or doesn't fit in an int64.
+func (n Number) Int64() (int64, error) {
+	lit := []byte(n)
+	if len(lit) == 0 || isPercent(lit) || isFloat(lit) {
+		return 0, fmt.Errorf("%q isn't an integer", n)
+	}
+	var p parser
+	i, err := p.parseInt(lit)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", n)
+	}
+	if i.sgn < 0 && i.n > 1<<63 || i.sgn > 0 && i.n > math.MaxInt64 {
+		return 0, fmt.Errorf("%s is out of range for int64", n)
+	}
+	return int64(i.sgn) * int64(i.n), nil
+}
+
+// Float64 returns the number as a float64, which may be rounded. A
+// percentage is divided by 100, so 50% is .5.
+func (n Number) Float64() (float64, error) {
+	lit := []byte(n)
+	if len(lit) == 0 {
+		return 0, fmt.Errorf("invalid number %q", n)
+	}
+	var p parser
+	if isPercent(lit) || isFloat(lit) {
+		parse := p.parseFloat
+		if isPercent(lit) {
+			parse = p.parsePercent
+		}
+		f, err := parse(lit)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", n)
+		}
+		return f, nil
+	}
+	i, err := p.parseInt(lit)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", n)
+	}
+	return float64(i.sgn) * float64(i.n), nil
+}
+
+// NumberMode selects the type of numbers decoded into interface values.
+type NumberMode uint8
+
+const (
+	// NumberLiteral decodes numbers as [Number]. It's the default.
+	NumberLiteral NumberMode = iota
+	// NumberInt64 decodes integers as int64, and numbers with a fraction,
+	// exponent, or percent sign as float64. An integer that doesn't fit in
+	// an int64 is an error.
+	NumberInt64
+	// NumberFloat64 decodes every number as float64, like encoding/json.
+	NumberFloat64
+)
+
+// parseAny decodes the value starting with tok into out, which is an empty
+// interface.
+func (p *parser) parseAny(out reflect.Value, tok []byte) error {
+	n, err := p.parseNode(tok)
+	if err != nil {
+		return err
+	}
+	v, err := p.anyValue(n)
+	if err != nil {
+		return err
+	}
+	out.Set(reflect.ValueOf(v))
+	return nil
+}
+
+// anyValue converts n to the value that's stored in an interface: a bool,
+// a number as chosen by UnmarshalOptions.Numbers, a string, []any, or
+// map[string]any.
+func (p *parser) anyValue(n *Node) (any, error) {
+	switch n.Kind {
+	case KindBool:
+		return n.Bool, nil
+	case KindNumber:
+		num := Number(n.Number)
+		switch p.opts.Numbers {
+		case NumberInt64:
+			if !isPercent([]byte(num)) && !isFloat([]byte(num)) {
+				i, err := num.Int64()
+				if err != nil {
+					return nil, p.errorAt(n.Start, "%s", err)
+				}
+				return i, nil
+			}
+			fallthrough
+		case NumberFloat64:
+			f, err := num.Float64()
+			if err != nil {
+				return nil, p.errorAt(n.Start, "%s", err)
+			}
+			return f, nil
+		}
+		return num, nil
+	case KindString:
+		if err := p.alloc(len(n.String)); err != nil {
+			return nil, err
+		}
+		p.stats.StringBytes += len(n.String)
+		return n.String, nil
+	case KindList:
+		if err := p.alloc(len(n.List) * int(reflect.TypeFor[any]().Size())); err != nil {
+			return nil, err
+		}
+		list := make([]any, len(n.List))
+		for i, elem := range n.List {
+			v, err := p.anyValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v
+		}
+		return list, nil
+	default:
+		merged := n.merged()
+		m := make(map[string]any, len(merged))
+		for _, f := range n.Fields {
+			if _, ok := m[f.Name]; ok {
+				continue
+			}
+			v, err := p.anyValue(merged[f.Name])
+			if err != nil {
+				return nil, err
+			}
+			m[f.Name] = v
+		}
+		return m, nil
+	}
+}
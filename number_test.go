@@ -0,0 +1,176 @@
+package ccl
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNumber(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		n          Number
+		wantInt    int64
+		wantIntErr bool
+		wantFloat  float64
+	}{
+		{n: "0", wantInt: 0, wantFloat: 0},
+		{n: "-17", wantInt: -17, wantFloat: -17},
+		{n: "0xff", wantInt: 255, wantFloat: 255},
+		{n: "9223372036854775807", wantInt: 9223372036854775807, wantFloat: 9223372036854775807},
+		{n: "-9223372036854775808", wantInt: -9223372036854775808, wantFloat: -9223372036854775808},
+		{n: "9223372036854775808", wantIntErr: true, wantFloat: 9223372036854775808},
+		{n: "1.5", wantIntErr: true, wantFloat: 1.5},
+		{n: "1e3", wantIntErr: true, wantFloat: 1000},
+		{n: "50%", wantIntErr: true, wantFloat: .5},
+	} {
+		gotInt, err := tc.n.Int64()
+		if gotErr := err != nil; gotErr != tc.wantIntErr {
+			t.Errorf("Number(%q).Int64() returned error %v, want error: %t", tc.n, err, tc.wantIntErr)
+		} else if err == nil && gotInt != tc.wantInt {
+			t.Errorf("Number(%q).Int64() = %d, want %d", tc.n, gotInt, tc.wantInt)
+		}
+		gotFloat, err := tc.n.Float64()
+		if err != nil {
+			t.Errorf("Number(%q).Float64() failed: %s", tc.n, err)
+		} else if gotFloat != tc.wantFloat {
+			t.Errorf("Number(%q).Float64() = %g, want %g", tc.n, gotFloat, tc.wantFloat)
+		}
+	}
+
+	for _, n := range []Number{"", "abc", "0644", "1.2.3"} {
+		if _, err := n.Int64(); err == nil {
+			t.Errorf("Number(%q).Int64() succeeded, want error", n)
+		}
+		if _, err := n.Float64(); err == nil {
+			t.Errorf("Number(%q).Float64() succeeded, want error", n)
+		}
+	}
+}
+
+func TestUnmarshal_Any(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Any  any            `ccl:"any"`
+		List []any          `ccl:"list"`
+		Map  map[string]any `ccl:"map"`
+	}
+
+	for _, tc := range []struct {
+		desc    string
+		msg     string
+		numbers NumberMode
+		want    message
+	}{{
+		desc: "Scalars",
+		msg:  `any: true list: ["a", 1] map { a: 'b' }`,
+		want: message{Any: true, List: []any{"a", Number("1")}, Map: map[string]any{"a": "b"}},
+	}, {
+		desc: "BigInteger",
+		msg:  `any: 18446744073709551615`,
+		want: message{Any: Number("18446744073709551615")},
+	}, {
+		desc: "List",
+		msg:  `any: [1, 0x10, {a: 2}]`,
+		want: message{Any: []any{Number("1"), Number("0x10"), map[string]any{"a": Number("2")}}},
+	}, {
+		desc: "Message",
+		msg: `any {
+			a: 1
+			b { c: "d" }
+			e: 1 e: [2, 3]
+		}`,
+		want: message{Any: map[string]any{
+			"a": Number("1"),
+			"b": map[string]any{"c": "d"},
+			"e": []any{Number("1"), Number("2"), Number("3")},
+		}},
+	}, {
+		desc:    "Int64",
+		msg:     `any: [9007199254740993, 1.5, 50%]`,
+		numbers: NumberInt64,
+		want:    message{Any: []any{int64(9007199254740993), 1.5, .5}},
+	}, {
+		desc:    "Float64",
+		msg:     `any: [3, 1.5]`,
+		numbers: NumberFloat64,
+		want:    message{Any: []any{3.0, 1.5}},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var got message
+			if err := (UnmarshalOptions{Numbers: tc.numbers}).Unmarshal([]byte(tc.msg), &got); err != nil {
+				t.Fatalf("Unmarshal(%q) failed: %s", tc.msg, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unmarshal(%q) returned unexpected diff (-want +got):\n%s", tc.msg, diff)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_AnyInvalid(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Any  any   `ccl:"any"`
+		List []any `ccl:"list"`
+	}
+
+	for _, tc := range []struct {
+		desc    string
+		msg     string
+		numbers NumberMode
+	}{
+		{desc: "NestedList", msg: `list: [[1]]`},
+		{desc: "NestedListInAny", msg: `any: [[1]]`},
+		{desc: "BadNumber", msg: `any: 0644`},
+		{desc: "Duplicate", msg: `any: 1 any: 2`},
+		{desc: "Int64OutOfRange", msg: `any: 9223372036854775808`, numbers: NumberInt64},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if err := (UnmarshalOptions{Numbers: tc.numbers}).Unmarshal([]byte(tc.msg), new(message)); err == nil {
+				t.Errorf("Unmarshal(%q) succeeded, want error", tc.msg)
+			}
+		})
+	}
+}
+
+func TestMarshal_Number(t *testing.T) {
+	t.Parallel()
+
+	in := struct {
+		ID  Number         `ccl:"id"`
+		Any map[string]any `ccl:"any"`
+	}{ID: "18446744073709551615", Any: map[string]any{"n": Number("0x10"), "s": "x"}}
+	got, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal(%+v) failed: %s", in, err)
+	}
+	want := "id: 18446744073709551615\nany {\n    n: 0x10\n    s: \"x\"\n}\n"
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshal(%+v) returned unexpected diff (-want +got):\n%s", in, diff)
+	}
+
+	var roundTrip struct {
+		ID Number `ccl:"id"`
+	}
+	if err := (UnmarshalOptions{DiscardUnknown: true}).Unmarshal(got, &roundTrip); err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %s", got, err)
+	}
+	if roundTrip.ID != in.ID {
+		t.Errorf("Unmarshal(%q) decoded id %q, want %q", got, roundTrip.ID, in.ID)
+	}
+
+	bad := struct {
+		ID Number `ccl:"id"`
+	}{ID: "abc"}
+	if got, err := Marshal(bad); err == nil {
+		t.Errorf("Marshal(%+v) = %q, want error", bad, got)
+	}
+}
@@ -0,0 +1,83 @@
+package ccl
+
+import (
+	"path"
+	"strings"
+)
+
+// Redacted is the value that [Redact] substitutes for sensitive values.
+const Redacted = "REDACTED"
+
+// RedactRules selects the fields whose values are removed by [Redact].
+// Patterns use the syntax of [path.Match].
+type RedactRules struct {
+	// Paths are dot-separated field paths starting at the top level of the
+	// document, for example "server.tls.key". Each element of a path may be
+	// a pattern, so "*.password" matches a password field in any top-level
+	// message. Lists of messages are transparent, so a path doesn't mention
+	// list indices.
+	Paths []string
+	// Keys are matched against field names at any depth, for example
+	// "*secret*".
+	Keys []string
+}
+
+func (r RedactRules) match(fieldPath []string) bool {
+	name := fieldPath[len(fieldPath)-1]
+	for _, pattern := range r.Keys {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+Paths:
+	for _, p := range r.Paths {
+		elems := strings.Split(p, ".")
+		if len(elems) != len(fieldPath) {
+			continue
+		}
+		for i, elem := range elems {
+			if ok, _ := path.Match(elem, fieldPath[i]); !ok {
+				continue Paths
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Redact returns a copy of n where the value of every field selected by rules
+// has been replaced with the string [Redacted]. It's intended for producing
+// a copy of a config that's safe to attach to a bug report. Comments aren't
+// copied, since they may describe the redacted values. n is not modified.
+func Redact(n *Node, rules RedactRules) *Node {
+	return rules.redact(n, nil)
+}
+
+func (r RedactRules) redact(n *Node, fieldPath []string) *Node {
+	switch n.Kind {
+	case KindList:
+		out := &Node{Kind: KindList, List: make([]*Node, len(n.List))}
+		for i, elem := range n.List {
+			out.List[i] = r.redact(elem, fieldPath)
+		}
+		return out
+	case KindMessage:
+		out := &Node{Kind: KindMessage, Fields: make([]*Field, len(n.Fields))}
+		for i, f := range n.Fields {
+			fieldPath := append(fieldPath[:len(fieldPath):len(fieldPath)], f.Name)
+			if r.match(fieldPath) {
+				out.Fields[i] = &Field{Name: f.Name, Value: &Node{Kind: KindString, String: Redacted}}
+			} else {
+				out.Fields[i] = &Field{Name: f.Name, Value: r.redact(f.Value, fieldPath)}
+			}
+		}
+		return out
+	default:
+		clone := *n
+		// A list element's comments may describe it, and its offsets are
+		// into a document that isn't copied.
+		clone.Comments, clone.TrailingComment, clone.EndComments = nil, "", nil
+		clone.Start, clone.End = 0, 0
+		return &clone
+	}
+}
@@ -0,0 +1,77 @@
+package ccl
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRedact(t *testing.T) {
+	t.Parallel()
+
+	msg := `
+		server {
+			listen: ":80"
+			tls { key: "secret" cert: "cert" }
+		}
+		db_password: "hunter2"
+		users: [{name: "a" token: "x"}]
+	`
+	n, err := Parse([]byte(msg))
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %s", msg, err)
+	}
+	got := FormatNode(Redact(n, RedactRules{
+		Paths: []string{"*.tls.key"},
+		Keys:  []string{"*password", "token"},
+	}))
+	want := `server {
+    listen: ":80"
+    tls {
+        key: "REDACTED"
+        cert: "cert"
+    }
+}
+db_password: "REDACTED"
+users: [
+    {
+        name: "a"
+        token: "REDACTED"
+    },
+]
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Redact returned unexpected diff (-want +got):\n%s", diff)
+	}
+	if got := n.Fields[1].Value.String; got != "hunter2" {
+		t.Errorf("Redact modified its input: db_password = %q", got)
+	}
+}
+
+func TestRedact_ListComments(t *testing.T) {
+	t.Parallel()
+
+	msg := `
+		db {
+			password: "hunter2"
+			hosts: [
+				# password is hunter2
+				"a",
+				"b", // same as staging
+			]
+		}
+	`
+	n, err := Parse([]byte(msg))
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %s", msg, err)
+	}
+	got := FormatNode(Redact(n, RedactRules{Keys: []string{"password"}}))
+	want := `db {
+    password: "REDACTED"
+    hosts: ["a", "b"]
+}
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Redact returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
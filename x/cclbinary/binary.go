@@ -0,0 +1,112 @@
+// Package cclbinary converts ccl documents to and from the binary formats
+// CBOR (RFC 8949) and MessagePack, so that configs can be cached or sent
+// compactly while they're kept as ccl, which people can edit, at rest:
+//
+//	n, err := ccl.Parse(data)
+//	...
+//	b, err := cclbinary.EncodeCBOR(n)
+//	...
+//	n, err = cclbinary.DecodeCBOR(b)
+//	data = ccl.FormatNode(n)
+//
+// A message is encoded as a map with string keys, a list as an array, and
+// bools and strings as themselves. Integers are encoded as integers, and
+// other numbers, including percentages, as floats, so that decoding gives
+// back a Node that's [ccl.Node.Equal] to the original. Messages are encoded
+// in their [ccl.Node.Normalize] form, so keys written more than once are
+// merged into a list and the keys are sorted, and comments aren't kept.
+//
+// Decoding accepts any document of the same shape. Other values, such as
+// null or byte strings, can't be represented in ccl and are an error, as
+// are arrays nested directly in arrays, and floats that are infinite or NaN.
+package cclbinary
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"roseh.moe/pkg/ccl"
+)
+
+// A number is a ccl number as it's encoded: an integer of up to 64 bits with
+// a sign, or a float.
+type number struct {
+	isInt bool
+	neg   bool // the integer is negative, and u is its absolute value
+	u     uint64
+	f     float64
+}
+
+// parseNumber returns the value of a number literal in a Node.
+func parseNumber(lit string) (number, error) {
+	if !strings.ContainsAny(lit, ".eE%") || strings.Contains(lit, "0x") || strings.Contains(lit, "0X") {
+		digits := strings.TrimLeft(lit, "+-")
+		base := 10
+		if rest, ok := strings.CutPrefix(strings.ToLower(digits), "0x"); ok {
+			digits, base = rest, 16
+		}
+		u, err := strconv.ParseUint(digits, base, 64)
+		if err != nil {
+			return number{}, fmt.Errorf("invalid number %q", lit)
+		}
+		return number{isInt: true, neg: lit[0] == '-' && u != 0, u: u}, nil
+	}
+	f, err := ccl.Number(lit).Float64()
+	if err != nil {
+		return number{}, err
+	}
+	return number{f: f}, nil
+}
+
+// intNode returns a Node for an integer with the given sign and absolute
+// value.
+func intNode(neg bool, u uint64) *ccl.Node {
+	lit := strconv.FormatUint(u, 10)
+	if neg {
+		lit = "-" + lit
+	}
+	return &ccl.Node{Kind: ccl.KindNumber, Number: lit}
+}
+
+// floatNode returns a Node for a float, which is written so that it's still
+// a float and not an integer when it's parsed.
+func floatNode(f float64) (*ccl.Node, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("float %v can't be represented in ccl", f)
+	}
+	// ccl doesn't allow leading zeros, even in exponents.
+	mant, exp, hasExp := strings.Cut(strconv.FormatFloat(f, 'g', -1, 64), "e")
+	if rest, ok := strings.CutPrefix(mant, "0."); ok {
+		mant = "." + rest
+	} else if rest, ok := strings.CutPrefix(mant, "-0."); ok {
+		mant = "-." + rest
+	}
+	switch {
+	case hasExp:
+		sign := ""
+		if exp[0] == '-' {
+			sign = "-"
+		}
+		mant += "e" + sign + strings.TrimLeft(exp[1:], "0")
+	case mant == "0" || mant == "-0":
+		mant = ".0"
+	case !strings.Contains(mant, "."):
+		mant += ".0"
+	}
+	return &ccl.Node{Kind: ccl.KindNumber, Number: mant}, nil
+}
+
+// messageNode returns a message Node with the given keys and values, where a
+// list value is a list of the values of a repeated field.
+func messageNode(keys []string, values []*ccl.Node) *ccl.Node {
+	n := &ccl.Node{Kind: ccl.KindMessage, Fields: make([]*ccl.Field, len(keys))}
+	for i, k := range keys {
+		n.Fields[i] = &ccl.Field{Name: k, Value: values[i]}
+	}
+	return n
+}
+
+var errTruncated = errors.New("unexpected end of data")
@@ -0,0 +1,252 @@
+package cclbinary
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"roseh.moe/pkg/ccl"
+)
+
+// The major types of CBOR data items.
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// EncodeCBOR encodes n, which is usually a whole document, as CBOR. Floats
+// are encoded as single-precision when that doesn't lose any precision, and
+// lengths in the shortest form, so equal Nodes have the same encoding.
+func EncodeCBOR(n *ccl.Node) ([]byte, error) {
+	return appendCBOR(nil, n.Normalize())
+}
+
+func appendCBORHead(b []byte, major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return append(b, major<<5|byte(arg))
+	case arg <= math.MaxUint8:
+		return append(b, major<<5|24, byte(arg))
+	case arg <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major<<5|25), uint16(arg))
+	case arg <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major<<5|26), uint32(arg))
+	}
+	return binary.BigEndian.AppendUint64(append(b, major<<5|27), arg)
+}
+
+func appendCBOR(b []byte, n *ccl.Node) ([]byte, error) {
+	switch n.Kind {
+	case ccl.KindBool:
+		if n.Bool {
+			return append(b, cborSimple<<5|21), nil
+		}
+		return append(b, cborSimple<<5|20), nil
+	case ccl.KindNumber:
+		num, err := parseNumber(n.Number)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case num.isInt && num.neg:
+			return appendCBORHead(b, cborNegInt, num.u-1), nil
+		case num.isInt:
+			return appendCBORHead(b, cborUint, num.u), nil
+		case float64(float32(num.f)) == num.f:
+			return binary.BigEndian.AppendUint32(append(b, cborSimple<<5|26), math.Float32bits(float32(num.f))), nil
+		}
+		return binary.BigEndian.AppendUint64(append(b, cborSimple<<5|27), math.Float64bits(num.f)), nil
+	case ccl.KindString:
+		b = appendCBORHead(b, cborText, uint64(len(n.String)))
+		return append(b, n.String...), nil
+	case ccl.KindList:
+		b = appendCBORHead(b, cborArray, uint64(len(n.List)))
+		for _, v := range n.List {
+			var err error
+			if b, err = appendCBOR(b, v); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case ccl.KindMessage:
+		b = appendCBORHead(b, cborMap, uint64(len(n.Fields)))
+		for _, f := range n.Fields {
+			b = appendCBORHead(b, cborText, uint64(len(f.Name)))
+			b = append(b, f.Name...)
+			var err error
+			if b, err = appendCBOR(b, f.Value); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("invalid node kind %v", n.Kind)
+}
+
+// DecodeCBOR decodes a CBOR data item into a Node. Indefinite-length items
+// and tags aren't supported.
+func DecodeCBOR(data []byte) (*ccl.Node, error) {
+	d := &cborDecoder{data: data}
+	n, err := d.value(false)
+	if err == nil && d.i < len(data) {
+		err = fmt.Errorf("extra data after the value")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cbor: at byte %d: %w", d.i, err)
+	}
+	return n, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	i    int
+}
+
+// head reads the initial byte of a data item and its argument.
+func (d *cborDecoder) head() (major, info byte, arg uint64, err error) {
+	if d.i >= len(d.data) {
+		return 0, 0, 0, errTruncated
+	}
+	major, info = d.data[d.i]>>5, d.data[d.i]&0x1f
+	size := 0
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		size = 1 << (info - 24)
+	default:
+		return 0, 0, 0, fmt.Errorf("indefinite-length and reserved items aren't supported")
+	}
+	if len(d.data)-d.i-1 < size {
+		return 0, 0, 0, errTruncated
+	}
+	for _, c := range d.data[d.i+1 : d.i+1+size] {
+		arg = arg<<8 | uint64(c)
+	}
+	d.i += 1 + size
+	return major, info, arg, nil
+}
+
+// value decodes a data item. inList is set for the elements of an array,
+// which can't be arrays themselves.
+func (d *cborDecoder) value(inList bool) (*ccl.Node, error) {
+	start := d.i
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUint:
+		return intNode(false, arg), nil
+	case cborNegInt:
+		if arg == math.MaxUint64 {
+			return nil, fmt.Errorf("integer -18446744073709551616 is out of range")
+		}
+		return intNode(true, arg+1), nil
+	case cborText:
+		s, err := d.text(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &ccl.Node{Kind: ccl.KindString, String: s}, nil
+	case cborArray:
+		if inList {
+			d.i = start
+			return nil, fmt.Errorf("arrays can't be nested directly in arrays")
+		}
+		if arg > uint64(len(d.data)-d.i) {
+			return nil, errTruncated
+		}
+		n := &ccl.Node{Kind: ccl.KindList, List: make([]*ccl.Node, arg)}
+		for i := range n.List {
+			if n.List[i], err = d.value(true); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	case cborMap:
+		if arg > uint64(len(d.data)-d.i)/2 {
+			return nil, errTruncated
+		}
+		keys := make([]string, arg)
+		values := make([]*ccl.Node, arg)
+		for i := range keys {
+			keyStart := d.i
+			major, _, arg, err := d.head()
+			if err != nil {
+				return nil, err
+			}
+			if major != cborText {
+				d.i = keyStart
+				return nil, fmt.Errorf("map keys should be text strings")
+			}
+			if keys[i], err = d.text(arg); err != nil {
+				return nil, err
+			}
+			if values[i], err = d.value(false); err != nil {
+				return nil, err
+			}
+		}
+		return messageNode(keys, values), nil
+	case cborSimple:
+		switch info {
+		case 20, 21:
+			return &ccl.Node{Kind: ccl.KindBool, Bool: info == 21}, nil
+		case 25:
+			return floatNode(halfToFloat(uint16(arg)))
+		case 26:
+			return floatNode(float64(math.Float32frombits(uint32(arg))))
+		case 27:
+			return floatNode(math.Float64frombits(arg))
+		}
+	}
+	d.i = start
+	switch major {
+	case cborBytes:
+		return nil, fmt.Errorf("byte strings can't be represented in ccl")
+	case cborTag:
+		return nil, fmt.Errorf("tags aren't supported")
+	}
+	return nil, fmt.Errorf("simple value %d can't be represented in ccl", arg)
+}
+
+// text reads the contents of a text string of the given length.
+func (d *cborDecoder) text(n uint64) (string, error) {
+	if n > uint64(len(d.data)-d.i) {
+		return "", errTruncated
+	}
+	s := d.data[d.i : d.i+int(n)]
+	if !utf8.Valid(s) {
+		return "", fmt.Errorf("text string isn't valid UTF-8")
+	}
+	d.i += int(n)
+	return string(s), nil
+}
+
+// halfToFloat converts an IEEE 754 half-precision float to a float64.
+func halfToFloat(h uint16) float64 {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		f = math.Inf(1)
+		if mant != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
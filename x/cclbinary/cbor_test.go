@@ -0,0 +1,234 @@
+package cclbinary
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/cclcorpus"
+)
+
+const testDoc = `# A comment that isn't kept.
+name: "web"
+port: 8080
+offset: -3
+big: 18446744073709551615
+small: -18446744073709551615
+ratio: 1.5
+precise: .1
+share: 50%
+debug: true
+hosts: ["a", "b"]
+hosts: "c"
+server { listen: ":443" }
+empty {}
+none: []
+servers: [{ a: 1 }, {}]
+`
+
+func TestCBOR_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	docs := []cclcorpus.Document{{Name: "test", Data: []byte(testDoc)}}
+	for _, doc := range append(docs, cclcorpus.Documents()...) {
+		t.Run(doc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			want := ccl.MustParse(string(doc.Data))
+			b, err := EncodeCBOR(want)
+			if err != nil {
+				t.Fatalf("EncodeCBOR failed: %s", err)
+			}
+			got, err := DecodeCBOR(b)
+			if err != nil {
+				t.Fatalf("DecodeCBOR failed: %s", err)
+			}
+			if !want.Equal(got) {
+				t.Errorf("DecodeCBOR(EncodeCBOR(n)) = %s, want %s", ccl.FormatNode(got), ccl.FormatNode(want))
+			}
+		})
+	}
+}
+
+func TestEncodeCBOR(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		doc  string
+		want string
+	}{{
+		desc: "Empty",
+		doc:  "",
+		want: "a0",
+	}, {
+		desc: "Scalars",
+		doc:  "b: true\na: 'x'\nc: -1\nd: 1000\n",
+		want: "a4" + "6161" + "6178" + "6162" + "f5" + "6163" + "20" + "6164" + "1903e8",
+	}, {
+		desc: "Floats",
+		doc:  "a: 1.5\nb: .1\nc: 2.0\n",
+		want: "a3" + "6161" + "fa3fc00000" + "6162" + "fb3fb999999999999a" + "6163" + "fa40000000",
+	}, {
+		desc: "Lists",
+		doc:  "a: 1\na: [2, 3]\nm { }\n",
+		want: "a2" + "6161" + "83010203" + "616d" + "a0",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			b, err := EncodeCBOR(ccl.MustParse(tc.doc))
+			if err != nil {
+				t.Fatalf("EncodeCBOR failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, hex.EncodeToString(b)); diff != "" {
+				t.Errorf("EncodeCBOR returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		data string
+		want string
+	}{{
+		desc: "Half",
+		data: "a16161f93e00",
+		want: "a: 1.5\n",
+	}, {
+		desc: "WholeFloat",
+		data: "a16161fb4000000000000000",
+		want: "a: 2.0\n",
+	}, {
+		desc: "Zero",
+		data: "a16161f90000",
+		want: "a: .0\n",
+	}, {
+		desc: "Exponent",
+		data: "a16161fb3e7ad7f29abcaf48",
+		want: "a: 1e-7\n",
+	}, {
+		desc: "QuotedKey",
+		data: "a163612062f4",
+		want: "\"a b\": false\n",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			data, _ := hex.DecodeString(tc.data)
+			n, err := DecodeCBOR(data)
+			if err != nil {
+				t.Fatalf("DecodeCBOR failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, string(ccl.FormatNode(n))); diff != "" {
+				t.Errorf("DecodeCBOR returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecodeCBOR_Error(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		data string
+		want string
+	}{{
+		desc: "Empty",
+		data: "",
+		want: "cbor: at byte 0: unexpected end of data",
+	}, {
+		desc: "ExtraData",
+		data: "a1616101a0",
+		want: "cbor: at byte 4: extra data after the value",
+	}, {
+		desc: "TruncatedMap",
+		data: "a2616101",
+		want: "cbor: at byte 1: unexpected end of data",
+	}, {
+		desc: "TruncatedString",
+		data: "a1616163",
+		want: "cbor: at byte 4: unexpected end of data",
+	}, {
+		desc: "Null",
+		data: "a16161f6",
+		want: "cbor: at byte 3: simple value 22 can't be represented in ccl",
+	}, {
+		desc: "Bytes",
+		data: "a1616141ff",
+		want: "cbor: at byte 3: byte strings can't be represented in ccl",
+	}, {
+		desc: "NestedArrays",
+		data: "a161618181",
+		want: "cbor: at byte 4: arrays can't be nested directly in arrays",
+	}, {
+		desc: "IntegerKey",
+		data: "a10101",
+		want: "cbor: at byte 1: map keys should be text strings",
+	}, {
+		desc: "Infinity",
+		data: "a16161f97c00",
+		want: "cbor: at byte 6: float +Inf can't be represented in ccl",
+	}, {
+		desc: "Indefinite",
+		data: "bf",
+		want: "cbor: at byte 0: indefinite-length and reserved items aren't supported",
+	}, {
+		desc: "InvalidUTF8",
+		data: "a16161" + "61ff",
+		want: "cbor: at byte 4: text string isn't valid UTF-8",
+	}, {
+		desc: "HugeLength",
+		data: "9bffffffffffffffff",
+		want: "cbor: at byte 9: unexpected end of data",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			data, _ := hex.DecodeString(tc.data)
+			if _, err := DecodeCBOR(data); err == nil || err.Error() != tc.want {
+				t.Errorf("DecodeCBOR returned error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// FuzzDecodeCBOR checks that whatever DecodeCBOR accepts is valid ccl and
+// can be encoded again.
+func FuzzDecodeCBOR(f *testing.F) {
+	for _, doc := range append(cclcorpus.Documents(), cclcorpus.Document{Data: []byte(testDoc)}) {
+		b, err := EncodeCBOR(ccl.MustParse(string(doc.Data)))
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		n, err := DecodeCBOR(data)
+		if err != nil {
+			return
+		}
+		b, err := EncodeCBOR(n)
+		if err != nil {
+			t.Fatalf("EncodeCBOR failed: %s", err)
+		}
+		got, err := DecodeCBOR(b)
+		if err != nil {
+			t.Fatalf("DecodeCBOR of the encoding failed: %s", err)
+		}
+		if !n.Equal(got) {
+			t.Errorf("DecodeCBOR(EncodeCBOR(n)) = %s, want %s", ccl.FormatNode(got), ccl.FormatNode(n))
+		}
+		if n.Kind == ccl.KindMessage {
+			if _, err := ccl.Parse(ccl.FormatNode(n)); err != nil {
+				t.Errorf("Parse of the decoded document failed: %s", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,306 @@
+package cclbinary
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"roseh.moe/pkg/ccl"
+)
+
+// EncodeMsgPack encodes n, which is usually a whole document, as
+// MessagePack. Like [EncodeCBOR], it uses the shortest forms, so equal Nodes
+// have the same encoding. MessagePack's integers are only 64 bits with their
+// sign, so an integer below math.MinInt64 is an error.
+func EncodeMsgPack(n *ccl.Node) ([]byte, error) {
+	return appendMsgPack(nil, n.Normalize())
+}
+
+// appendMsgPackLen appends the header of a string, array, or map of length
+// l. fix is the format of the short form, which holds up to max items, and
+// long is the format for 8 bits of length, if there is one, followed by the
+// formats for 16 and 32 bits.
+func appendMsgPackLen(b []byte, l int, fix byte, max int, long ...byte) ([]byte, error) {
+	switch {
+	case l <= max:
+		return append(b, fix|byte(l)), nil
+	case len(long) == 3 && l <= math.MaxUint8:
+		return append(b, long[0], byte(l)), nil
+	case l <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, long[len(long)-2]), uint16(l)), nil
+	case l <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, long[len(long)-1]), uint32(l)), nil
+	}
+	return nil, fmt.Errorf("length %d is too long for MessagePack", l)
+}
+
+func appendMsgPackString(b []byte, s string) ([]byte, error) {
+	b, err := appendMsgPackLen(b, len(s), 0xa0, 31, 0xd9, 0xda, 0xdb)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, s...), nil
+}
+
+func appendMsgPack(b []byte, n *ccl.Node) ([]byte, error) {
+	var err error
+	switch n.Kind {
+	case ccl.KindBool:
+		if n.Bool {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case ccl.KindNumber:
+		num, err := parseNumber(n.Number)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case num.isInt && !num.neg:
+			switch u := num.u; {
+			case u <= 0x7f:
+				return append(b, byte(u)), nil
+			case u <= math.MaxUint8:
+				return append(b, 0xcc, byte(u)), nil
+			case u <= math.MaxUint16:
+				return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(u)), nil
+			case u <= math.MaxUint32:
+				return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(u)), nil
+			}
+			return binary.BigEndian.AppendUint64(append(b, 0xcf), num.u), nil
+		case num.isInt:
+			if num.u > 1<<63 {
+				return nil, fmt.Errorf("integer %s is out of range for MessagePack", n.Number)
+			}
+			switch i := -int64(num.u); {
+			case i >= -32:
+				return append(b, byte(i)), nil
+			case i >= math.MinInt8:
+				return append(b, 0xd0, byte(i)), nil
+			case i >= math.MinInt16:
+				return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i)), nil
+			case i >= math.MinInt32:
+				return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i)), nil
+			default:
+				return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i)), nil
+			}
+		case float64(float32(num.f)) == num.f:
+			return binary.BigEndian.AppendUint32(append(b, 0xca), math.Float32bits(float32(num.f))), nil
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(num.f)), nil
+	case ccl.KindString:
+		return appendMsgPackString(b, n.String)
+	case ccl.KindList:
+		if b, err = appendMsgPackLen(b, len(n.List), 0x90, 15, 0xdc, 0xdd); err != nil {
+			return nil, err
+		}
+		for _, v := range n.List {
+			if b, err = appendMsgPack(b, v); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case ccl.KindMessage:
+		if b, err = appendMsgPackLen(b, len(n.Fields), 0x80, 15, 0xde, 0xdf); err != nil {
+			return nil, err
+		}
+		for _, f := range n.Fields {
+			if b, err = appendMsgPackString(b, f.Name); err != nil {
+				return nil, err
+			}
+			if b, err = appendMsgPack(b, f.Value); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("invalid node kind %v", n.Kind)
+}
+
+// DecodeMsgPack decodes a MessagePack object into a Node. Extension types
+// aren't supported.
+func DecodeMsgPack(data []byte) (*ccl.Node, error) {
+	d := &msgPackDecoder{data: data}
+	n, err := d.value(false)
+	if err == nil && d.i < len(data) {
+		err = fmt.Errorf("extra data after the value")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("msgpack: at byte %d: %w", d.i, err)
+	}
+	return n, nil
+}
+
+type msgPackDecoder struct {
+	data []byte
+	i    int
+}
+
+// uint reads a big-endian unsigned integer of size bytes.
+func (d *msgPackDecoder) uint(size int) (uint64, error) {
+	if len(d.data)-d.i < size {
+		return 0, errTruncated
+	}
+	var u uint64
+	for _, c := range d.data[d.i : d.i+size] {
+		u = u<<8 | uint64(c)
+	}
+	d.i += size
+	return u, nil
+}
+
+// value decodes an object. inList is set for the elements of an array,
+// which can't be arrays themselves.
+func (d *msgPackDecoder) value(inList bool) (*ccl.Node, error) {
+	if d.i >= len(d.data) {
+		return nil, errTruncated
+	}
+	start := d.i
+	c := d.data[d.i]
+	d.i++
+	var err error
+	switch {
+	case c <= 0x7f:
+		return intNode(false, uint64(c)), nil
+	case c >= 0xe0:
+		return intNode(true, uint64(-int8(c))), nil
+	case c == 0xc2 || c == 0xc3:
+		return &ccl.Node{Kind: ccl.KindBool, Bool: c == 0xc3}, nil
+	case 0xcc <= c && c <= 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return intNode(false, u), nil
+	case 0xd0 <= c && c <= 0xd3:
+		size := 1 << (c - 0xd0)
+		u, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend the integer to 64 bits.
+		i := int64(u<<(64-8*size)) >> (64 - 8*size)
+		if i < 0 {
+			return intNode(true, uint64(-i)), nil
+		}
+		return intNode(false, uint64(i)), nil
+	case c == 0xca:
+		u, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return floatNode(float64(math.Float32frombits(uint32(u))))
+	case c == 0xcb:
+		u, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return floatNode(math.Float64frombits(u))
+	}
+
+	kind, l, err := d.length(c)
+	if err != nil {
+		d.i = start
+		return nil, err
+	}
+	switch kind {
+	case ccl.KindString:
+		s, err := d.text(l)
+		if err != nil {
+			return nil, err
+		}
+		return &ccl.Node{Kind: ccl.KindString, String: s}, nil
+	case ccl.KindList:
+		if inList {
+			d.i = start
+			return nil, fmt.Errorf("arrays can't be nested directly in arrays")
+		}
+		if l > len(d.data)-d.i {
+			return nil, errTruncated
+		}
+		n := &ccl.Node{Kind: ccl.KindList, List: make([]*ccl.Node, l)}
+		for i := range n.List {
+			if n.List[i], err = d.value(true); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	}
+	if l > (len(d.data)-d.i)/2 {
+		return nil, errTruncated
+	}
+	keys := make([]string, l)
+	values := make([]*ccl.Node, l)
+	for i := range keys {
+		keyStart := d.i
+		if d.i >= len(d.data) {
+			return nil, errTruncated
+		}
+		c := d.data[d.i]
+		if c&0xe0 != 0xa0 && (c < 0xd9 || c > 0xdb) {
+			return nil, fmt.Errorf("map keys should be strings")
+		}
+		d.i++
+		_, l, err := d.length(c)
+		if err != nil {
+			d.i = keyStart
+			return nil, err
+		}
+		if keys[i], err = d.text(l); err != nil {
+			return nil, err
+		}
+		if values[i], err = d.value(false); err != nil {
+			return nil, err
+		}
+	}
+	return messageNode(keys, values), nil
+}
+
+// length reads the length of the string, array, or map that starts with the
+// format byte c, and returns which one it is.
+func (d *msgPackDecoder) length(c byte) (ccl.Kind, int, error) {
+	var kind ccl.Kind
+	size := 0 // the size of the length in bytes, or 0 if it's in c
+	switch {
+	case c&0xe0 == 0xa0:
+		return ccl.KindString, int(c & 0x1f), nil
+	case c&0xf0 == 0x90:
+		return ccl.KindList, int(c & 0x0f), nil
+	case c&0xf0 == 0x80:
+		return ccl.KindMessage, int(c & 0x0f), nil
+	case 0xd9 <= c && c <= 0xdb:
+		kind, size = ccl.KindString, 1<<(c-0xd9)
+	case c == 0xdc || c == 0xdd:
+		kind, size = ccl.KindList, 2<<(c-0xdc)
+	case c == 0xde || c == 0xdf:
+		kind, size = ccl.KindMessage, 2<<(c-0xde)
+	case c == 0xc0:
+		return 0, 0, fmt.Errorf("nil can't be represented in ccl")
+	case 0xc4 <= c && c <= 0xc6:
+		return 0, 0, fmt.Errorf("binary data can't be represented in ccl")
+	default:
+		return 0, 0, fmt.Errorf("format 0x%02x isn't supported", c)
+	}
+	l, err := d.uint(size)
+	if err != nil {
+		return 0, 0, err
+	}
+	if l > uint64(len(d.data)-d.i) {
+		return 0, 0, errTruncated
+	}
+	return kind, int(l), nil
+}
+
+// text reads the contents of a string of length l.
+func (d *msgPackDecoder) text(l int) (string, error) {
+	if l > len(d.data)-d.i {
+		return "", errTruncated
+	}
+	s := d.data[d.i : d.i+l]
+	if !utf8.Valid(s) {
+		return "", fmt.Errorf("string isn't valid UTF-8")
+	}
+	d.i += l
+	return string(s), nil
+}
@@ -0,0 +1,213 @@
+package cclbinary
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/cclcorpus"
+)
+
+func TestMsgPack_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	// MessagePack can't hold the integer on the "small" line of testDoc.
+	doc := strings.Replace(testDoc, "small: -18446744073709551615\n", "small: -9223372036854775808\n", 1)
+	docs := []cclcorpus.Document{{Name: "test", Data: []byte(doc)}}
+	for _, doc := range append(docs, cclcorpus.Documents()...) {
+		t.Run(doc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			want := ccl.MustParse(string(doc.Data))
+			b, err := EncodeMsgPack(want)
+			if err != nil {
+				t.Fatalf("EncodeMsgPack failed: %s", err)
+			}
+			got, err := DecodeMsgPack(b)
+			if err != nil {
+				t.Fatalf("DecodeMsgPack failed: %s", err)
+			}
+			if !want.Equal(got) {
+				t.Errorf("DecodeMsgPack(EncodeMsgPack(n)) = %s, want %s", ccl.FormatNode(got), ccl.FormatNode(want))
+			}
+		})
+	}
+}
+
+func TestEncodeMsgPack(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		doc  string
+		want string
+	}{{
+		desc: "Empty",
+		doc:  "",
+		want: "80",
+	}, {
+		desc: "Scalars",
+		doc:  "b: true\na: 'x'\nc: -1\nd: 1000\ne: -200\n",
+		want: "85" + "a161" + "a178" + "a162" + "c3" + "a163" + "ff" + "a164" + "cd03e8" + "a165" + "d1ff38",
+	}, {
+		desc: "Floats",
+		doc:  "a: 1.5\nb: .1\n",
+		want: "82" + "a161" + "ca3fc00000" + "a162" + "cb3fb999999999999a",
+	}, {
+		desc: "Lists",
+		doc:  "a: 1\na: [2, 3]\nm { }\n",
+		want: "82" + "a161" + "93010203" + "a16d" + "80",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			b, err := EncodeMsgPack(ccl.MustParse(tc.doc))
+			if err != nil {
+				t.Fatalf("EncodeMsgPack failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, hex.EncodeToString(b)); diff != "" {
+				t.Errorf("EncodeMsgPack returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEncodeMsgPack_Error(t *testing.T) {
+	t.Parallel()
+
+	_, err := EncodeMsgPack(ccl.MustParse("a: -18446744073709551615\n"))
+	if want := "integer -18446744073709551615 is out of range for MessagePack"; err == nil || err.Error() != want {
+		t.Errorf("EncodeMsgPack returned error %v, want %q", err, want)
+	}
+}
+
+func TestDecodeMsgPack(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		data string
+		want string
+	}{{
+		desc: "SignedInts",
+		data: "83" + "a161d0ff" + "a162d3ffffffffffffff38" + "a163d07f",
+		want: "a: -1\nb: -200\nc: 127\n",
+	}, {
+		desc: "LongForms",
+		data: "de0001" + "d90161" + "dc0002" + "cc01" + "cf0000000000000002",
+		want: "a: [1, 2]\n",
+	}, {
+		desc: "WholeFloat",
+		data: "81a161cb4000000000000000",
+		want: "a: 2.0\n",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			data, _ := hex.DecodeString(tc.data)
+			n, err := DecodeMsgPack(data)
+			if err != nil {
+				t.Fatalf("DecodeMsgPack failed: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, string(ccl.FormatNode(n))); diff != "" {
+				t.Errorf("DecodeMsgPack returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecodeMsgPack_Error(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		data string
+		want string
+	}{{
+		desc: "Empty",
+		data: "",
+		want: "msgpack: at byte 0: unexpected end of data",
+	}, {
+		desc: "ExtraData",
+		data: "8080",
+		want: "msgpack: at byte 1: extra data after the value",
+	}, {
+		desc: "TruncatedMap",
+		data: "82a16101",
+		want: "msgpack: at byte 1: unexpected end of data",
+	}, {
+		desc: "TruncatedInt",
+		data: "81a161cd01",
+		want: "msgpack: at byte 4: unexpected end of data",
+	}, {
+		desc: "Nil",
+		data: "81a161c0",
+		want: "msgpack: at byte 3: nil can't be represented in ccl",
+	}, {
+		desc: "Binary",
+		data: "81a161c401ff",
+		want: "msgpack: at byte 3: binary data can't be represented in ccl",
+	}, {
+		desc: "Extension",
+		data: "81a161d40100",
+		want: "msgpack: at byte 3: format 0xd4 isn't supported",
+	}, {
+		desc: "NestedArrays",
+		data: "81a1619190",
+		want: "msgpack: at byte 4: arrays can't be nested directly in arrays",
+	}, {
+		desc: "IntegerKey",
+		data: "810101",
+		want: "msgpack: at byte 1: map keys should be strings",
+	}, {
+		desc: "NaN",
+		data: "81a161cb7ff8000000000001",
+		want: "msgpack: at byte 12: float NaN can't be represented in ccl",
+	}, {
+		desc: "InvalidUTF8",
+		data: "81a161a1ff",
+		want: "msgpack: at byte 4: string isn't valid UTF-8",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			data, _ := hex.DecodeString(tc.data)
+			if _, err := DecodeMsgPack(data); err == nil || err.Error() != tc.want {
+				t.Errorf("DecodeMsgPack returned error %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// FuzzDecodeMsgPack checks that whatever DecodeMsgPack accepts can be
+// encoded again.
+func FuzzDecodeMsgPack(f *testing.F) {
+	for _, doc := range append(cclcorpus.Documents(), cclcorpus.Document{Data: []byte(testDoc)}) {
+		n := ccl.MustParse(string(doc.Data))
+		b, err := EncodeMsgPack(n)
+		if err != nil {
+			// testDoc has an integer that MessagePack can't hold.
+			continue
+		}
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		n, err := DecodeMsgPack(data)
+		if err != nil {
+			return
+		}
+		b, err := EncodeMsgPack(n)
+		if err != nil {
+			t.Fatalf("EncodeMsgPack failed: %s", err)
+		}
+		got, err := DecodeMsgPack(b)
+		if err != nil {
+			t.Fatalf("DecodeMsgPack of the encoding failed: %s", err)
+		}
+		if !n.Equal(got) {
+			t.Errorf("DecodeMsgPack(EncodeMsgPack(n)) = %s, want %s", ccl.FormatNode(got), ccl.FormatNode(n))
+		}
+	})
+}
@@ -0,0 +1,43 @@
+// Package cclcorpus holds a corpus of ccl documents written in the style of
+// real-world configs: a web server config in the style of nginx, Kubernetes
+// manifests, and a CI pipeline. The ccl packages test and benchmark
+// themselves against it, and it can be used to test other tools that read or
+// write ccl, such as editors and linters, against realistic documents.
+//
+// Every document in the corpus is valid, has no lint findings, and is left
+// unchanged in meaning by formatting.
+package cclcorpus
+
+import (
+	"embed"
+	"io/fs"
+	"strings"
+)
+
+//go:embed *.ccl
+var files embed.FS
+
+// A Document is a document in the corpus.
+type Document struct {
+	// Name is the document's name, such as "nginx".
+	Name string
+	Data []byte
+}
+
+// Documents returns the documents in the corpus, sorted by name. The
+// caller may modify the returned data.
+func Documents() []Document {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		panic("cclcorpus: " + err.Error())
+	}
+	docs := make([]Document, 0, len(entries))
+	for _, e := range entries {
+		data, err := fs.ReadFile(files, e.Name())
+		if err != nil {
+			panic("cclcorpus: " + err.Error())
+		}
+		docs = append(docs, Document{Name: strings.TrimSuffix(e.Name(), ".ccl"), Data: data})
+	}
+	return docs
+}
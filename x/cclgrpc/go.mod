@@ -0,0 +1,19 @@
+module roseh.moe/pkg/ccl/x/cclgrpc
+
+go 1.24
+
+require (
+	github.com/google/go-cmp v0.7.0
+	google.golang.org/grpc v1.75.1
+	roseh.moe/pkg/ccl v0.0.0
+)
+
+require (
+	golang.org/x/net v0.41.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.26.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250707201910-8d1bb00bc6a7 // indirect
+	google.golang.org/protobuf v1.36.6 // indirect
+)
+
+replace roseh.moe/pkg/ccl => ../../
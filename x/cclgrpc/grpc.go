@@ -0,0 +1,275 @@
+// Package cclgrpc reads the options of gRPC servers and clients from ccl
+// configs. A server config looks like this:
+//
+//	listen: ":8443"
+//	tls {
+//	    cert_file: "/etc/certs/server.pem"
+//	    key_file: "/etc/certs/server.key"
+//	    ca_file: "/etc/certs/ca.pem"
+//	    require_client_cert: true
+//	}
+//	keepalive {
+//	    time: "2h"
+//	    timeout: "20s"
+//	    max_connection_age: "30m"
+//	    min_time: "1m"
+//	}
+//	limits {
+//	    max_recv_msg_size: "16MiB"
+//	    max_concurrent_streams: 100
+//	}
+//
+// and is decoded into a [ServerConfig], whose ServerOptions method returns
+// the options for [grpc.NewServer]:
+//
+//	var cfg cclgrpc.ServerConfig
+//	if err := ccl.Unmarshal(data, &cfg); err != nil {
+//	    return err
+//	}
+//	opts, err := cfg.ServerOptions()
+//	if err != nil {
+//	    return err
+//	}
+//	srv := grpc.NewServer(opts...)
+//	lis, err := net.Listen("tcp", cfg.Listen.String())
+//
+// A [ClientConfig] similarly gives the options for [grpc.NewClient]. Fields
+// that aren't set leave gRPC's defaults alone.
+//
+// The config types can also be embedded in a larger config, as in
+//
+//	type Config struct {
+//	    GRPC    cclgrpc.ServerConfig `ccl:"grpc"`
+//	    Backend cclgrpc.ClientConfig `ccl:"backend"`
+//	}
+package cclgrpc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"roseh.moe/pkg/ccl/x/cclwkt"
+)
+
+// A ServerConfig configures a gRPC server.
+type ServerConfig struct {
+	// Listen is the address to listen on. It isn't used by ServerOptions.
+	Listen cclwkt.HostPort `ccl:"listen"`
+	// TLS makes the server use TLS. Without it, the server accepts
+	// plaintext connections.
+	TLS *cclwkt.TLSConfig `ccl:"tls"`
+	// Keepalive configures pings and the lifetime of connections.
+	Keepalive ServerKeepalive `ccl:"keepalive"`
+	// Limits limits the size of messages and the number of streams.
+	Limits Limits `ccl:"limits"`
+	// ConnectionTimeout is the time allowed for new connections to finish
+	// their handshakes.
+	ConnectionTimeout cclwkt.Duration `ccl:"connection_timeout"`
+}
+
+// ServerKeepalive configures the keepalive parameters and enforcement policy
+// of a server. See [keepalive.ServerParameters] and
+// [keepalive.EnforcementPolicy] for the meaning and defaults of each field.
+type ServerKeepalive struct {
+	MaxConnectionIdle     cclwkt.Duration `ccl:"max_connection_idle"`
+	MaxConnectionAge      cclwkt.Duration `ccl:"max_connection_age"`
+	MaxConnectionAgeGrace cclwkt.Duration `ccl:"max_connection_age_grace"`
+	Time                  cclwkt.Duration `ccl:"time"`
+	Timeout               cclwkt.Duration `ccl:"timeout"`
+
+	// MinTime is the shortest time between pings that clients are allowed
+	// to send. Clients that ping more often are disconnected.
+	MinTime cclwkt.Duration `ccl:"min_time"`
+	// PermitWithoutStream allows clients to ping when there are no active
+	// streams.
+	PermitWithoutStream bool `ccl:"permit_without_stream"`
+}
+
+// ClientKeepalive configures the keepalive parameters of a client. See
+// [keepalive.ClientParameters].
+type ClientKeepalive struct {
+	Time                cclwkt.Duration `ccl:"time"`
+	Timeout             cclwkt.Duration `ccl:"timeout"`
+	PermitWithoutStream bool            `ccl:"permit_without_stream"`
+}
+
+// Limits limits the resources used by a connection. For a client,
+// MaxRecvMsgSize and MaxSendMsgSize are the defaults for every call, and
+// MaxConcurrentStreams can't be set.
+type Limits struct {
+	MaxRecvMsgSize       cclwkt.ByteSize `ccl:"max_recv_msg_size"`
+	MaxSendMsgSize       cclwkt.ByteSize `ccl:"max_send_msg_size"`
+	MaxHeaderListSize    cclwkt.ByteSize `ccl:"max_header_list_size"`
+	MaxConcurrentStreams uint32          `ccl:"max_concurrent_streams"`
+}
+
+// A ClientConfig configures a gRPC client.
+type ClientConfig struct {
+	// Target is the server to connect to, in the form accepted by
+	// grpc.NewClient, such as "dns:///api.example.com:443". It isn't used
+	// by DialOptions.
+	Target string `ccl:"target"`
+	// TLS makes the client use TLS. Either TLS or Insecure must be set.
+	TLS *cclwkt.TLSConfig `ccl:"tls"`
+	// Insecure makes the client connect without TLS.
+	Insecure bool `ccl:"insecure"`
+	// Authority overrides the :authority header sent to the server.
+	Authority string `ccl:"authority"`
+	// UserAgent is added to the start of the user agent sent to the server.
+	UserAgent string          `ccl:"user_agent"`
+	Keepalive ClientKeepalive `ccl:"keepalive"`
+	Limits    Limits          `ccl:"limits"`
+}
+
+// ServerOptions returns the options for a server with the config c.
+func (c *ServerConfig) ServerOptions() ([]grpc.ServerOption, error) {
+	var opts []grpc.ServerOption
+	if c.TLS != nil {
+		if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+			return nil, errors.New("tls: a server needs cert_file and key_file")
+		}
+		if c.TLS.ServerName != "" {
+			return nil, errors.New("tls: server_name can only be set for clients")
+		}
+		config, err := c.TLS.Build()
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(config)))
+	}
+
+	k := c.Keepalive
+	if k.MaxConnectionIdle != 0 || k.MaxConnectionAge != 0 || k.MaxConnectionAgeGrace != 0 || k.Time != 0 || k.Timeout != 0 {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     k.MaxConnectionIdle.Std(),
+			MaxConnectionAge:      k.MaxConnectionAge.Std(),
+			MaxConnectionAgeGrace: k.MaxConnectionAgeGrace.Std(),
+			Time:                  k.Time.Std(),
+			Timeout:               k.Timeout.Std(),
+		}))
+	}
+	if k.MinTime != 0 || k.PermitWithoutStream {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             k.MinTime.Std(),
+			PermitWithoutStream: k.PermitWithoutStream,
+		}))
+	}
+
+	l := c.Limits
+	if l.MaxRecvMsgSize != 0 {
+		n, err := intSize("max_recv_msg_size", l.MaxRecvMsgSize, math.MaxInt)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.MaxRecvMsgSize(n))
+	}
+	if l.MaxSendMsgSize != 0 {
+		n, err := intSize("max_send_msg_size", l.MaxSendMsgSize, math.MaxInt)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.MaxSendMsgSize(n))
+	}
+	if l.MaxHeaderListSize != 0 {
+		n, err := intSize("max_header_list_size", l.MaxHeaderListSize, math.MaxUint32)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.MaxHeaderListSize(uint32(n)))
+	}
+	if l.MaxConcurrentStreams != 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(l.MaxConcurrentStreams))
+	}
+	if c.ConnectionTimeout != 0 {
+		if c.ConnectionTimeout < 0 {
+			return nil, fmt.Errorf("connection_timeout %s is negative", c.ConnectionTimeout)
+		}
+		opts = append(opts, grpc.ConnectionTimeout(c.ConnectionTimeout.Std()))
+	}
+	return opts, nil
+}
+
+// DialOptions returns the options for a client with the config c.
+func (c *ClientConfig) DialOptions() ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+	switch {
+	case c.TLS != nil && c.Insecure:
+		return nil, errors.New("tls and insecure can't both be set")
+	case c.TLS != nil:
+		if c.TLS.RequireClientCert {
+			return nil, errors.New("tls: require_client_cert can only be set for servers")
+		}
+		config, err := c.TLS.Build()
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	case c.Insecure:
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	default:
+		return nil, errors.New("no tls config; set insecure: true to connect without TLS")
+	}
+	if c.Authority != "" {
+		opts = append(opts, grpc.WithAuthority(c.Authority))
+	}
+	if c.UserAgent != "" {
+		opts = append(opts, grpc.WithUserAgent(c.UserAgent))
+	}
+
+	k := c.Keepalive
+	if k.Time != 0 || k.Timeout != 0 || k.PermitWithoutStream {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                k.Time.Std(),
+			Timeout:             k.Timeout.Std(),
+			PermitWithoutStream: k.PermitWithoutStream,
+		}))
+	}
+
+	l := c.Limits
+	var callOpts []grpc.CallOption
+	if l.MaxRecvMsgSize != 0 {
+		n, err := intSize("max_recv_msg_size", l.MaxRecvMsgSize, math.MaxInt)
+		if err != nil {
+			return nil, err
+		}
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(n))
+	}
+	if l.MaxSendMsgSize != 0 {
+		n, err := intSize("max_send_msg_size", l.MaxSendMsgSize, math.MaxInt)
+		if err != nil {
+			return nil, err
+		}
+		callOpts = append(callOpts, grpc.MaxCallSendMsgSize(n))
+	}
+	if callOpts != nil {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+	if l.MaxHeaderListSize != 0 {
+		n, err := intSize("max_header_list_size", l.MaxHeaderListSize, math.MaxUint32)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithMaxHeaderListSize(uint32(n)))
+	}
+	if l.MaxConcurrentStreams != 0 {
+		return nil, errors.New("limits: max_concurrent_streams can only be set for servers")
+	}
+	return opts, nil
+}
+
+// intSize checks that the size given for the named field is positive and no
+// larger than max.
+func intSize(name string, size cclwkt.ByteSize, max uint64) (int, error) {
+	if size < 0 {
+		return 0, fmt.Errorf("limits: %s %s is negative", name, size)
+	}
+	if uint64(size) > max {
+		return 0, fmt.Errorf("limits: %s %s is too large", name, size)
+	}
+	return int(size), nil
+}
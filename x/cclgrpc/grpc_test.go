@@ -0,0 +1,354 @@
+package cclgrpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/cclwkt"
+)
+
+func TestUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	type config struct {
+		Server ServerConfig `ccl:"server"`
+		Client ClientConfig `ccl:"client"`
+	}
+	msg := `
+server {
+    listen: ":8443"
+    tls {
+        cert_file: "server.pem"
+        key_file: "server.key"
+        ca_file: "ca.pem"
+    }
+    keepalive {
+        time: "2h"
+        max_connection_age: "30m"
+        min_time: "1m"
+        permit_without_stream: true
+    }
+    limits {
+        max_recv_msg_size: "16MiB"
+        max_concurrent_streams: 100
+    }
+    connection_timeout: "5s"
+}
+client {
+    target: "dns:///api.example.com:443"
+    tls { server_name: "api.internal" }
+    user_agent: "backup/1.0"
+    keepalive { time: "30s" }
+    limits { max_send_msg_size: "1MB" }
+}`
+	want := config{
+		Server: ServerConfig{
+			Listen: cclwkt.HostPort{Port: 8443},
+			TLS:    &cclwkt.TLSConfig{CertFile: "server.pem", KeyFile: "server.key", CAFile: "ca.pem"},
+			Keepalive: ServerKeepalive{
+				Time:                cclwkt.Duration(2 * time.Hour),
+				MaxConnectionAge:    cclwkt.Duration(30 * time.Minute),
+				MinTime:             cclwkt.Duration(time.Minute),
+				PermitWithoutStream: true,
+			},
+			Limits:            Limits{MaxRecvMsgSize: 16 << 20, MaxConcurrentStreams: 100},
+			ConnectionTimeout: cclwkt.Duration(5 * time.Second),
+		},
+		Client: ClientConfig{
+			Target:    "dns:///api.example.com:443",
+			TLS:       &cclwkt.TLSConfig{ServerName: "api.internal"},
+			UserAgent: "backup/1.0",
+			Keepalive: ClientKeepalive{Time: cclwkt.Duration(30 * time.Second)},
+			Limits:    Limits{MaxSendMsgSize: 1e6},
+		},
+	}
+	var got config
+	if err := ccl.Unmarshal([]byte(msg), &got); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unmarshal returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestOptions_Count(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want int
+	}{{
+		desc: "Empty",
+		msg:  ``,
+		want: 0,
+	}, {
+		desc: "Keepalive",
+		msg:  `keepalive { time: "1h" }`,
+		want: 1,
+	}, {
+		desc: "KeepaliveAndPolicy",
+		msg:  `keepalive { time: "1h"  min_time: "1m" }`,
+		want: 2,
+	}, {
+		desc: "Limits",
+		msg:  `limits { max_recv_msg_size: "1MiB"  max_send_msg_size: "1MiB"  max_header_list_size: "8KiB"  max_concurrent_streams: 10 }`,
+		want: 4,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var c ServerConfig
+			if err := ccl.Unmarshal([]byte(tc.msg), &c); err != nil {
+				t.Fatalf("Unmarshal failed: %s", err)
+			}
+			opts, err := c.ServerOptions()
+			if err != nil {
+				t.Fatalf("ServerOptions failed: %s", err)
+			}
+			if len(opts) != tc.want {
+				t.Errorf("ServerOptions returned %d options, want %d", len(opts), tc.want)
+			}
+		})
+	}
+}
+
+func TestServerOptions_Error(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want string
+	}{{
+		desc: "NoCert",
+		msg:  `tls { ca_file: "ca.pem" }`,
+		want: "cert_file and key_file",
+	}, {
+		desc: "ServerName",
+		msg:  `tls { cert_file: "a"  key_file: "b"  server_name: "example.com" }`,
+		want: "server_name can only be set for clients",
+	}, {
+		desc: "MissingFile",
+		msg:  `tls { cert_file: "/nonexistent/cert.pem"  key_file: "/nonexistent/key.pem" }`,
+		want: "no such file",
+	}, {
+		desc: "HeaderListTooLarge",
+		msg:  `limits { max_header_list_size: "8GiB" }`,
+		want: "max_header_list_size 8GiB is too large",
+	}, {
+		desc: "NegativeTimeout",
+		msg:  `connection_timeout: "-1s"`,
+		want: "connection_timeout -1s is negative",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var c ServerConfig
+			if err := ccl.Unmarshal([]byte(tc.msg), &c); err != nil {
+				t.Fatalf("Unmarshal failed: %s", err)
+			}
+			if _, err := c.ServerOptions(); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("ServerOptions returned error %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestDialOptions_Error(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want string
+	}{{
+		desc: "NoTransport",
+		msg:  `target: "localhost:443"`,
+		want: "set insecure: true",
+	}, {
+		desc: "TLSAndInsecure",
+		msg:  `tls {}  insecure: true`,
+		want: "can't both be set",
+	}, {
+		desc: "CertWithoutKey",
+		msg:  `tls { cert_file: "client.pem" }`,
+		want: "cert_file and key_file must be set together",
+	}, {
+		desc: "RequireClientCert",
+		msg:  `tls { require_client_cert: true }`,
+		want: "require_client_cert can only be set for servers",
+	}, {
+		desc: "ConcurrentStreams",
+		msg:  `insecure: true  limits { max_concurrent_streams: 10 }`,
+		want: "max_concurrent_streams can only be set for servers",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var c ClientConfig
+			if err := ccl.Unmarshal([]byte(tc.msg), &c); err != nil {
+				t.Fatalf("Unmarshal failed: %s", err)
+			}
+			if _, err := c.DialOptions(); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("DialOptions returned error %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// writeCerts writes a CA and a certificate for localhost signed by it to
+// dir, as ca.pem, cert.pem, and key.pem.
+func writeCerts(t *testing.T, dir string) {
+	t.Helper()
+
+	write := func(name, typ string, der []byte) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("ca.pem", "CERTIFICATE", caDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, cert, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("cert.pem", "CERTIFICATE", certDER)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func TestConnect(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeCerts(t, dir)
+	for _, tc := range []struct {
+		desc   string
+		server string
+		client string
+	}{{
+		desc:   "Insecure",
+		server: `keepalive { time: "1h" }  limits { max_concurrent_streams: 10 }`,
+		client: `insecure: true  keepalive { time: "1h" }  limits { max_recv_msg_size: "1MiB" }`,
+	}, {
+		desc: "TLS",
+		server: `tls {
+            cert_file: "` + dir + `/cert.pem"
+            key_file: "` + dir + `/key.pem"
+        }`,
+		client: `tls {
+            ca_file: "` + dir + `/ca.pem"
+            server_name: "localhost"
+        }`,
+	}, {
+		desc: "MutualTLS",
+		server: `tls {
+            cert_file: "` + dir + `/cert.pem"
+            key_file: "` + dir + `/key.pem"
+            ca_file: "` + dir + `/ca.pem"
+            require_client_cert: true
+        }`,
+		client: `tls {
+            cert_file: "` + dir + `/cert.pem"
+            key_file: "` + dir + `/key.pem"
+            ca_file: "` + dir + `/ca.pem"
+            server_name: "localhost"
+        }`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var sc ServerConfig
+			if err := ccl.Unmarshal([]byte(tc.server), &sc); err != nil {
+				t.Fatalf("Unmarshal(server) failed: %s", err)
+			}
+			serverOpts, err := sc.ServerOptions()
+			if err != nil {
+				t.Fatalf("ServerOptions failed: %s", err)
+			}
+			srv := grpc.NewServer(serverOpts...)
+			healthpb.RegisterHealthServer(srv, health.NewServer())
+			lis, err := net.Listen("tcp", "localhost:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go srv.Serve(lis)
+			t.Cleanup(srv.Stop)
+
+			var cc ClientConfig
+			if err := ccl.Unmarshal([]byte(tc.client), &cc); err != nil {
+				t.Fatalf("Unmarshal(client) failed: %s", err)
+			}
+			dialOpts, err := cc.DialOptions()
+			if err != nil {
+				t.Fatalf("DialOptions failed: %s", err)
+			}
+			conn, err := grpc.NewClient(lis.Addr().String(), dialOpts...)
+			if err != nil {
+				t.Fatalf("NewClient failed: %s", err)
+			}
+			defer conn.Close()
+			ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+			defer cancel()
+			resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+			if err != nil {
+				t.Fatalf("Check failed: %s", err)
+			}
+			if got, want := resp.GetStatus(), healthpb.HealthCheckResponse_SERVING; got != want {
+				t.Errorf("Check returned status %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+// Package ccllint checks ccl documents for constructs that are legal but
+// likely to be mistakes or to hurt readability.
+//
+// A finding can be suppressed with a directive comment on the field it's
+// reported for, written either on the line before the field or at the end of
+// the field's line:
+//
+//	# ccl:ignore key-style -- the key is used by a third-party tool
+//	"Content-Type": "text/plain"
+//
+// A directive names one or more rules separated by spaces, and applies to the
+// field and to everything nested inside it. Text after "--" is a reason for
+// human readers. A directive that names an unknown rule is itself reported.
+package ccllint
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"roseh.moe/pkg/ccl"
+)
+
+// A Diagnostic is a single finding.
+type Diagnostic struct {
+	// Path is the dot-separated path of the field that the finding is
+	// about, e.g. "server.listen". Lists are transparent, as in
+	// [ccl.RedactRules].
+	Path    string
+	Rule    string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Path == "" {
+		return fmt.Sprintf("%s (%s)", d.Message, d.Rule)
+	}
+	return fmt.Sprintf("%s: %s (%s)", d.Path, d.Message, d.Rule)
+}
+
+// A Rule is a check that's run on every message in a document.
+type Rule struct {
+	Name string
+	Doc  string
+
+	// check is nil for rules added with Register, which are checked by
+	// other packages.
+	check func(fields []*ccl.Field, report func(f *ccl.Field, format string, args ...any))
+}
+
+// Register adds a rule that's checked outside of this package, such as by
+// the cclschema validator, so that ccl:ignore directives naming it aren't
+// reported as unknown. It should be called from an init function.
+func Register(name, doc string) {
+	Rules = append(Rules, &Rule{Name: name, Doc: doc})
+}
+
+// directiveRule is the name used for problems with ccl:ignore directives.
+// It can't be suppressed.
+const directiveRule = "directive"
+
+// Rules holds every rule that [Lint] runs.
+var Rules = []*Rule{{
+	Name: "key-style",
+	Doc:  "keys should be lower_snake_case",
+	check: func(fields []*ccl.Field, report func(*ccl.Field, string, ...any)) {
+		for _, f := range fields {
+			if !snakeCase(f.Name) {
+				report(f, "key %q is not lower_snake_case", f.Name)
+			}
+		}
+	},
+}, {
+	Name: "leading-plus",
+	Doc:  "numbers shouldn't be written with a + sign",
+	check: func(fields []*ccl.Field, report func(*ccl.Field, string, ...any)) {
+		for _, f := range fields {
+			if slices.ContainsFunc(values(f), func(n *ccl.Node) bool {
+				return n.Kind == ccl.KindNumber && strings.HasPrefix(n.Number, "+")
+			}) {
+				report(f, "number written with a leading +")
+			}
+		}
+	},
+}, {
+	Name: "number-case",
+	Doc:  "hex prefixes and exponents should be lower case, e.g. 0xff and 1e10",
+	check: func(fields []*ccl.Field, report func(*ccl.Field, string, ...any)) {
+		for _, f := range fields {
+			if slices.ContainsFunc(values(f), func(n *ccl.Node) bool {
+				return n.Kind == ccl.KindNumber && upperCaseNumber(n.Number)
+			}) {
+				report(f, "number written with an upper case X or E")
+			}
+		}
+	},
+}, {
+	Name: "mixed-list",
+	Doc:  "a repeated key should use either lists or single values, not both",
+	check: func(fields []*ccl.Field, report func(*ccl.Field, string, ...any)) {
+		lists := make(map[string]int)
+		scalars := make(map[string]int)
+		for _, f := range fields {
+			if f.Value.Kind == ccl.KindList {
+				lists[f.Name]++
+			} else {
+				scalars[f.Name]++
+			}
+		}
+		reported := make(map[string]bool)
+		for _, f := range fields {
+			if lists[f.Name] > 0 && scalars[f.Name] > 0 && !reported[f.Name] {
+				reported[f.Name] = true
+				report(f, "key %q is set both with a list and with single values", f.Name)
+			}
+		}
+	},
+}, {
+	Name: "string-concatenation",
+	Doc:  "adjacent strings shouldn't be concatenated, since that can hide a missing comma in a list",
+	check: func(fields []*ccl.Field, report func(*ccl.Field, string, ...any)) {
+		for _, f := range fields {
+			if slices.ContainsFunc(values(f), func(n *ccl.Node) bool {
+				return n.Kind == ccl.KindString && n.Concatenated
+			}) {
+				report(f, "string written as adjacent strings, which are concatenated")
+			}
+		}
+	},
+}}
+
+// values returns the values of a field, looking inside lists.
+func values(f *ccl.Field) []*ccl.Node {
+	if f.Value.Kind == ccl.KindList {
+		return f.Value.List
+	}
+	return []*ccl.Node{f.Value}
+}
+
+// upperCaseNumber reports whether a number literal has an upper case hex
+// prefix or exponent.
+func upperCaseNumber(lit string) bool {
+	lit = strings.TrimLeft(lit, "+-")
+	if strings.HasPrefix(lit, "0X") {
+		return true
+	}
+	return !strings.HasPrefix(lit, "0x") && strings.Contains(lit, "E")
+}
+
+func snakeCase(name string) bool {
+	if name == "" || !('a' <= name[0] && name[0] <= 'z') {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if c := name[i]; !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Lint runs every rule in [Rules] that belongs to this package on n, which should be a document returned
+// by [ccl.Parse], and returns the findings that aren't suppressed.
+func Lint(n *ccl.Node) []Diagnostic {
+	l := &linter{}
+	l.message(n, nil, nil)
+	return l.diags
+}
+
+type linter struct {
+	diags []Diagnostic
+}
+
+func (l *linter) message(n *ccl.Node, path []string, ignored []string) {
+	fieldIgnored := make(map[*ccl.Field][]string, len(n.Fields))
+	for _, f := range n.Fields {
+		fieldPath := strings.Join(append(path[:len(path):len(path)], f.Name), ".")
+		names, ok := Directives(f)
+		if ok && len(names) == 0 {
+			l.diags = append(l.diags, Diagnostic{fieldPath, directiveRule, "ccl:ignore should name at least one rule"})
+		}
+		for _, name := range names {
+			if !slices.ContainsFunc(Rules, func(r *Rule) bool { return r.Name == name }) {
+				l.diags = append(l.diags, Diagnostic{fieldPath, directiveRule, fmt.Sprintf("ccl:ignore names unknown rule %q", name)})
+			}
+		}
+		fieldIgnored[f] = append(ignored[:len(ignored):len(ignored)], names...)
+	}
+	for _, r := range Rules {
+		if r.check == nil {
+			continue
+		}
+		r.check(n.Fields, func(f *ccl.Field, format string, args ...any) {
+			if slices.Contains(fieldIgnored[f], r.Name) {
+				return
+			}
+			l.diags = append(l.diags, Diagnostic{
+				Path:    strings.Join(append(path[:len(path):len(path)], f.Name), "."),
+				Rule:    r.Name,
+				Message: fmt.Sprintf(format, args...),
+			})
+		})
+	}
+	for _, f := range n.Fields {
+		fieldPath := append(path[:len(path):len(path)], f.Name)
+		for _, v := range values(f) {
+			if v.Kind == ccl.KindMessage {
+				l.message(v, fieldPath, fieldIgnored[f])
+			}
+		}
+	}
+}
+
+// Directives returns the rule names listed in the ccl:ignore directives among
+// the comments of f. ok reports whether f has any directive, since a
+// directive might not name any rules.
+func Directives(f *ccl.Field) (names []string, ok bool) {
+	for _, c := range append(f.Comments[:len(f.Comments):len(f.Comments)], f.TrailingComment) {
+		switch {
+		case strings.HasPrefix(c, "#"):
+			c = c[1:]
+		case strings.HasPrefix(c, "//"):
+			c = c[2:]
+		case strings.HasPrefix(c, "/*"):
+			c = strings.TrimSuffix(c[2:], "*/")
+		default:
+			continue
+		}
+		rest, found := strings.CutPrefix(strings.TrimSpace(c), "ccl:ignore")
+		if !found || rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+			continue
+		}
+		ok = true
+		rest, _, _ = strings.Cut(rest, "--")
+		names = append(names, strings.Fields(rest)...)
+	}
+	return names, ok
+}
@@ -0,0 +1,117 @@
+package ccllint
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/cclcorpus"
+)
+
+func TestLint(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want []Diagnostic
+	}{{
+		desc: "Clean",
+		msg: `
+			listen: ":80"
+			listen: ":443"
+			hex: 0xEF
+			exp: 1e10
+			m { ports: [1, 2] }
+		`,
+	}, {
+		desc: "Findings",
+		msg: `
+			"Content-Type": "text/plain"
+			n: [+1, 2]
+			hex: 0XFF
+			exp: 1E10
+			m { a: [1] a: 2 }
+			hosts: ["a", "b" "c"]
+		`,
+		want: []Diagnostic{
+			{Path: "Content-Type", Rule: "key-style", Message: `key "Content-Type" is not lower_snake_case`},
+			{Path: "n", Rule: "leading-plus", Message: "number written with a leading +"},
+			{Path: "hex", Rule: "number-case", Message: "number written with an upper case X or E"},
+			{Path: "exp", Rule: "number-case", Message: "number written with an upper case X or E"},
+			{Path: "hosts", Rule: "string-concatenation", Message: "string written as adjacent strings, which are concatenated"},
+			{Path: "m.a", Rule: "mixed-list", Message: `key "a" is set both with a list and with single values`},
+		},
+	}, {
+		desc: "Ignored",
+		msg: `
+			# ccl:ignore key-style -- used by a third-party tool
+			"Content-Type": "text/plain"
+			n: +1 // ccl:ignore leading-plus
+			/* ccl:ignore key-style number-case */
+			Nested { Inner: 0XFF list: [{ Deeper: 1 }] }
+		`,
+	}, {
+		desc: "IgnoreOtherRule",
+		msg: `
+			# ccl:ignore leading-plus
+			Key: 1
+		`,
+		want: []Diagnostic{
+			{Path: "Key", Rule: "key-style", Message: `key "Key" is not lower_snake_case`},
+		},
+	}, {
+		desc: "NotADirective",
+		msg: `
+			# ccl:ignored key-style
+			Key: 1
+			# see ccl:ignore key-style
+			Key2: 1
+		`,
+		want: []Diagnostic{
+			{Path: "Key", Rule: "key-style", Message: `key "Key" is not lower_snake_case`},
+			{Path: "Key2", Rule: "key-style", Message: `key "Key2" is not lower_snake_case`},
+		},
+	}, {
+		desc: "BadDirective",
+		msg: `
+			# ccl:ignore
+			a: 1
+			b: 2 # ccl:ignore key_style
+		`,
+		want: []Diagnostic{
+			{Path: "a", Rule: "directive", Message: "ccl:ignore should name at least one rule"},
+			{Path: "b", Rule: "directive", Message: `ccl:ignore names unknown rule "key_style"`},
+		},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			n, err := ccl.Parse([]byte(tc.msg))
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %s", tc.msg, err)
+			}
+			if diff := cmp.Diff(tc.want, Lint(n)); diff != "" {
+				t.Errorf("Lint(%q) returned unexpected diff (-want +got):\n%s", tc.msg, diff)
+			}
+		})
+	}
+}
+
+func TestLint_Corpus(t *testing.T) {
+	t.Parallel()
+
+	for _, doc := range cclcorpus.Documents() {
+		t.Run(doc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			n, err := ccl.Parse(doc.Data)
+			if err != nil {
+				t.Fatalf("Parse failed: %s", err)
+			}
+			if got := Lint(n); len(got) > 0 {
+				t.Errorf("Lint returned findings %v, want none", got)
+			}
+		})
+	}
+}
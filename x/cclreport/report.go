@@ -0,0 +1,184 @@
+// Package cclreport records configs that fail to decode as reports that can
+// be attached to a bug report and replayed in a test. A report is a ccl
+// document holding the input, the options it was decoded with, the schema
+// of the type it was decoded into, and the error:
+//
+//	r := &cclreport.Recorder{
+//	    Redact: &ccl.RedactRules{Keys: []string{"*password*", "*secret*"}},
+//	    Save: func(report []byte) {
+//	        os.WriteFile("config-error.ccl", report, 0o600)
+//	    },
+//	}
+//	if err := r.Unmarshal(data, &cfg); err != nil {
+//	    log.Fatalf("%s (details saved to config-error.ccl)", err)
+//	}
+//
+// The report can be replayed by a maintainer with [Parse] and
+// [Report.Replay], using a type built from the schema in the report if the
+// program's own type isn't available:
+//
+//	func TestIssue123(t *testing.T) {
+//	    r, err := cclreport.Parse(report)
+//	    if err != nil {
+//	        t.Fatal(err)
+//	    }
+//	    if err := r.Replay(new(Config)); err != nil {
+//	        t.Errorf("Replay failed: %s (reported as %q)", err, r.Error)
+//	    }
+//	}
+package cclreport
+
+import (
+	"reflect"
+	"time"
+	"unicode/utf8"
+
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/cclschema"
+)
+
+// A Report is a failure to decode a config, as recorded by a [Recorder].
+type Report struct {
+	// Type is the Go type that the input was decoded into.
+	Type string `ccl:"type"`
+	// Error is the error that decoding returned.
+	Error   string  `ccl:"error"`
+	Options Options `ccl:"options"`
+	// Redacted is set if the input was redacted before it was recorded.
+	// Redacting reformats the input, so positions in Error may not match
+	// it.
+	Redacted bool `ccl:"redacted"`
+	// Input is the document that was decoded. If it isn't valid UTF-8,
+	// it's recorded in InputBytes instead.
+	Input      string `ccl:"input"`
+	InputBytes []byte `ccl:"input_bytes"`
+	// Schema is the schema of Type, as written by [cclschema.Schema.Marshal],
+	// or empty if the type doesn't have one, such as a recursive type.
+	Schema string `ccl:"schema"`
+}
+
+// Options are the [ccl.UnmarshalOptions] that a report was decoded with.
+// Options that collect results, such as Stats, and Logger aren't recorded.
+type Options struct {
+	MaxBytes                   int            `ccl:"max_bytes"`
+	Timeout                    time.Duration  `ccl:"timeout_ms,unit=ms"`
+	AllowNonFinite             bool           `ccl:"allow_non_finite"`
+	DiscardUnknown             bool           `ccl:"discard_unknown"`
+	AllowDuplicates            bool           `ccl:"allow_duplicates"`
+	DisallowRepeatedKeys       bool           `ccl:"disallow_repeated_keys"`
+	Numbers                    ccl.NumberMode `ccl:"numbers"`
+	LooseBooleans              bool           `ccl:"loose_booleans"`
+	DisableStringConcatenation bool           `ccl:"disable_string_concatenation"`
+	StrictEscapes              bool           `ccl:"strict_escapes"`
+	MaxDepth                   int            `ccl:"max_depth"`
+	PreserveCarriageReturns    bool           `ccl:"preserve_carriage_returns"`
+}
+
+func optionsOf(o ccl.UnmarshalOptions) Options {
+	return Options{
+		MaxBytes:                   o.MaxBytes,
+		Timeout:                    o.Timeout,
+		AllowNonFinite:             o.AllowNonFinite,
+		DiscardUnknown:             o.DiscardUnknown,
+		AllowDuplicates:            o.AllowDuplicates,
+		DisallowRepeatedKeys:       o.DisallowRepeatedKeys,
+		Numbers:                    o.Numbers,
+		LooseBooleans:              o.LooseBooleans,
+		DisableStringConcatenation: o.DisableStringConcatenation,
+		StrictEscapes:              o.StrictEscapes,
+		MaxDepth:                   o.MaxDepth,
+		PreserveCarriageReturns:    o.PreserveCarriageReturns,
+	}
+}
+
+// UnmarshalOptions returns the options as [ccl.UnmarshalOptions].
+func (o Options) UnmarshalOptions() ccl.UnmarshalOptions {
+	return ccl.UnmarshalOptions{
+		MaxBytes:                   o.MaxBytes,
+		Timeout:                    o.Timeout,
+		AllowNonFinite:             o.AllowNonFinite,
+		DiscardUnknown:             o.DiscardUnknown,
+		AllowDuplicates:            o.AllowDuplicates,
+		DisallowRepeatedKeys:       o.DisallowRepeatedKeys,
+		Numbers:                    o.Numbers,
+		LooseBooleans:              o.LooseBooleans,
+		DisableStringConcatenation: o.DisableStringConcatenation,
+		StrictEscapes:              o.StrictEscapes,
+		MaxDepth:                   o.MaxDepth,
+		PreserveCarriageReturns:    o.PreserveCarriageReturns,
+	}
+}
+
+// A Recorder decodes configs, and saves a report whenever decoding fails.
+type Recorder struct {
+	// Options are the options used to decode configs.
+	Options ccl.UnmarshalOptions
+	// If Redact is non-nil, the fields it selects are redacted from the
+	// input before it's recorded, with [ccl.Redact]. If the input can't
+	// be parsed, it can't be redacted, so it's left out of the report.
+	Redact *ccl.RedactRules
+	// Save is called with each report.
+	Save func(report []byte)
+}
+
+// Unmarshal decodes data into v like [ccl.UnmarshalOptions.Unmarshal]. If
+// that fails, a report of the failure is passed to r.Save before the error
+// is returned.
+func (r *Recorder) Unmarshal(data []byte, v any) error {
+	err := r.Options.Unmarshal(data, v)
+	if err != nil && r.Save != nil {
+		r.Save(r.Report(data, v, err))
+	}
+	return err
+}
+
+// Report returns a report of err, which was returned when data was decoded
+// into v. It's for recording the failures of other ways of decoding, such
+// as [ccl.MergeOptions.Merge].
+func (r *Recorder) Report(data []byte, v any, err error) []byte {
+	report := &Report{
+		Type:    reflect.TypeOf(v).String(),
+		Error:   err.Error(),
+		Options: optionsOf(r.Options),
+	}
+	if r.Redact != nil {
+		report.Redacted = true
+		if n, err := ccl.Parse(data); err == nil {
+			data = ccl.FormatNode(ccl.Redact(n, *r.Redact))
+		} else {
+			data = nil
+		}
+	}
+	if utf8.Valid(data) {
+		report.Input = string(data)
+	} else {
+		report.InputBytes = data
+	}
+	if s, err := cclschema.FromType(reflect.TypeOf(v)); err == nil {
+		report.Schema = string(s.Marshal())
+	}
+	b, err := ccl.MarshalOptions{FormatOptions: ccl.FormatOptions{MultilineStrings: true}}.Marshal(report)
+	if err != nil {
+		panic("ccl: " + err.Error())
+	}
+	return b
+}
+
+// Parse reads a report written by a [Recorder].
+func Parse(data []byte) (*Report, error) {
+	r := new(Report)
+	if err := (ccl.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Replay decodes the input of the report into v with the options it was
+// recorded with, and returns the result.
+func (r *Report) Replay(v any) error {
+	data := []byte(r.Input)
+	if r.InputBytes != nil {
+		data = r.InputBytes
+	}
+	return r.Options.UnmarshalOptions().Unmarshal(data, v)
+}
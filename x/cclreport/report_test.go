@@ -0,0 +1,138 @@
+package cclreport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"roseh.moe/pkg/ccl"
+)
+
+type config struct {
+	Name     string `ccl:"name" doc:"The name of the server."`
+	Port     int    `ccl:"port"`
+	Password string `ccl:"password"`
+}
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+
+	var got []byte
+	r := &Recorder{
+		Options: ccl.UnmarshalOptions{DiscardUnknown: true, Timeout: 2 * time.Second},
+		Save:    func(report []byte) { got = report },
+	}
+	input := "name: \"web\"\npassword: 'hunter2'\nport: \"80\"\n"
+	err := r.Unmarshal([]byte(input), new(config))
+	if err == nil {
+		t.Fatalf("Unmarshal succeeded, want error")
+	}
+	want := `type: "*cclreport.config"
+error: '3:7 syntax error: field "port" has type int, got string "80"'
+options {
+    timeout_ms: 2000
+    discard_unknown: true
+}
+input: 'name: "web"
+password: \'hunter2\'
+port: "80"
+'
+schema: 'field {
+    name: "name"
+    type: "string"
+    doc: "The name of the server."
+}
+field {
+    name: "port"
+    type: "int"
+}
+field {
+    name: "password"
+    type: "string"
+}
+'
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Unmarshal saved unexpected diff (-want +got):\n%s", diff)
+	}
+
+	report, err2 := Parse(got)
+	if err2 != nil {
+		t.Fatalf("Parse failed: %s", err2)
+	}
+	if report.Input != input {
+		t.Errorf("Parse gave input %q, want %q", report.Input, input)
+	}
+	if err2 := report.Replay(new(config)); err2 == nil || err2.Error() != err.Error() {
+		t.Errorf("Replay returned error %v, want %q", err2, err)
+	}
+}
+
+func TestRecorder_Success(t *testing.T) {
+	t.Parallel()
+
+	r := &Recorder{Save: func([]byte) { t.Errorf("Save called for a config that decodes") }}
+	if err := r.Unmarshal([]byte(`port: 80`), new(config)); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+}
+
+func TestRecorder_Redact(t *testing.T) {
+	t.Parallel()
+
+	r := &Recorder{Redact: &ccl.RedactRules{Keys: []string{"password"}}}
+	for _, tc := range []struct {
+		desc  string
+		input string
+		want  string
+	}{{
+		desc:  "Redacted",
+		input: "password: 'hunter2'\nport: 'x'\n",
+		want:  "password: \"REDACTED\"\nport: \"x\"\n",
+	}, {
+		desc:  "SyntaxError",
+		input: "password: 'hunter2'\nport: \n",
+		want:  "",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			err := r.Options.Unmarshal([]byte(tc.input), new(config))
+			if err == nil {
+				t.Fatalf("Unmarshal succeeded, want error")
+			}
+			report, err := Parse(r.Report([]byte(tc.input), new(config), err))
+			if err != nil {
+				t.Fatalf("Parse failed: %s", err)
+			}
+			if !report.Redacted {
+				t.Errorf("Report isn't marked as redacted")
+			}
+			if diff := cmp.Diff(tc.want, report.Input); diff != "" {
+				t.Errorf("Report has unexpected diff in input (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRecorder_InvalidUTF8(t *testing.T) {
+	t.Parallel()
+
+	input := []byte("name: \"\xff\"\n")
+	var saved []byte
+	r := &Recorder{Save: func(report []byte) { saved = report }}
+	want := r.Unmarshal(input, new(config))
+	if want == nil {
+		t.Fatalf("Unmarshal succeeded, want error")
+	}
+	report, err := Parse(saved)
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	if string(report.InputBytes) != string(input) {
+		t.Errorf("Report has input bytes %q, want %q", report.InputBytes, input)
+	}
+	if err := report.Replay(new(config)); err == nil || err.Error() != want.Error() {
+		t.Errorf("Replay returned error %v, want %q", err, want)
+	}
+}
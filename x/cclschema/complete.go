@@ -0,0 +1,67 @@
+package cclschema
+
+import "encoding/json"
+
+// A Completion describes a key that can appear in a document, for editors
+// that suggest keys as they're typed.
+type Completion struct {
+	// Path is the dot-separated path of the key. The keys of a map are
+	// written as "*", e.g. "labels.*".
+	Path     string   `json:"path"`
+	Type     Type     `json:"type"`
+	Repeated bool     `json:"repeated,omitempty"`
+	Doc      string   `json:"doc,omitempty"`
+	Enum     []string `json:"enum,omitempty"`
+}
+
+// Completions returns a Completion for every key described by s, in the
+// order the fields appear in the schema.
+func (s *Schema) Completions() []Completion {
+	var cs []Completion
+	for _, f := range s.Fields {
+		cs = f.appendCompletions(cs, "")
+	}
+	return cs
+}
+
+func (f *Field) appendCompletions(cs []Completion, path string) []Completion {
+	path = join(path, f.Name)
+	cs = append(cs, Completion{
+		Path:     path,
+		Type:     f.Type,
+		Repeated: f.Repeated,
+		Doc:      f.Doc,
+		Enum:     f.Enum,
+	})
+	for _, sub := range f.Fields {
+		cs = sub.appendCompletions(cs, path)
+	}
+	if f.Values != nil {
+		values := *f.Values
+		values.Name = "*"
+		cs = values.appendCompletions(cs, path)
+	}
+	return cs
+}
+
+// manifestVersion is incremented when the format of the completion manifest
+// changes incompatibly.
+const manifestVersion = 1
+
+// CompletionManifest returns the completions of s as a JSON object of the
+// form
+//
+//	{"version": 1, "keys": [{"path": "log.level", "type": "string", ...}]}
+//
+// where each key is a [Completion]. It's intended to be consumed by language
+// servers and web-based config editors.
+func (s *Schema) CompletionManifest() ([]byte, error) {
+	keys := s.Completions()
+	if keys == nil {
+		keys = []Completion{}
+	}
+	return json.MarshalIndent(struct {
+		Version int          `json:"version"`
+		Keys    []Completion `json:"keys"`
+	}{manifestVersion, keys}, "", "  ")
+}
@@ -0,0 +1,58 @@
+package cclschema
+
+import "roseh.moe/pkg/ccl"
+
+// ApplyDefaults returns a copy of the document n with the default of every
+// field that isn't present filled in, computing the effective config that a
+// program using the schema sees. Defaults are added after the fields of
+// each message, in schema order. Every message in the document gets the
+// defaults of its fields, including messages inside lists and maps, but a
+// message field that's absent is only added if it has a default of its own.
+// n is not modified.
+func (s *Schema) ApplyDefaults(n *ccl.Node) *ccl.Node {
+	return applyDefaults(s.Fields, n)
+}
+
+func applyDefaults(fields []*Field, n *ccl.Node) *ccl.Node {
+	out := &ccl.Node{Kind: ccl.KindMessage, Fields: make([]*ccl.Field, 0, len(n.Fields)), EndComments: n.EndComments}
+	set := make(map[string]bool)
+	for _, kv := range n.Fields {
+		set[kv.Name] = true
+		clone := *kv
+		if f := lookup(fields, kv.Name); f != nil {
+			clone.Value = f.applyDefaults(kv.Value)
+		}
+		out.Fields = append(out.Fields, &clone)
+	}
+	for _, f := range fields {
+		if !set[f.Name] && f.Default != nil {
+			out.Fields = append(out.Fields, &ccl.Field{Name: f.Name, Value: f.applyDefaults(f.Default)})
+		}
+	}
+	return out
+}
+
+// applyDefaults fills in the defaults inside a value of f.
+func (f *Field) applyDefaults(v *ccl.Node) *ccl.Node {
+	switch {
+	case v.Kind == ccl.KindList:
+		list := &ccl.Node{Kind: ccl.KindList, List: make([]*ccl.Node, len(v.List))}
+		for i, elem := range v.List {
+			list.List[i] = f.applyDefaults(elem)
+		}
+		return list
+	case v.Kind != ccl.KindMessage:
+		return v
+	case f.Type == Message:
+		return applyDefaults(f.Fields, v)
+	case f.Type == Map:
+		out := &ccl.Node{Kind: ccl.KindMessage, Fields: make([]*ccl.Field, len(v.Fields)), EndComments: v.EndComments}
+		for i, kv := range v.Fields {
+			clone := *kv
+			clone.Value = f.Values.applyDefaults(kv.Value)
+			out.Fields[i] = &clone
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,85 @@
+package cclschema
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"roseh.moe/pkg/ccl"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	t.Parallel()
+
+	s, err := Parse([]byte(`
+field { name: "port" type: "int" default: 8080 }
+field { name: "hosts" type: "string" repeated: true default: ["localhost"] }
+field {
+    name: "backend"
+    type: "message"
+    repeated: true
+    field { name: "weight" type: "int" default: 1 }
+    field { name: "addr" type: "string" }
+}
+field {
+    name: "log"
+    type: "message"
+    field { name: "level" type: "string" default: "info" }
+}
+field {
+    name: "tls"
+    type: "message"
+    default {}
+    field { name: "min_version" type: "string" default: "1.2" }
+}
+field {
+    name: "pools"
+    type: "map"
+    values {
+        type: "message"
+        field { name: "size" type: "int" default: 4 }
+    }
+}
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	const msg = `
+# the port
+port: 80
+backend { addr: "a" }
+backend { addr: "b" weight: 3 }
+pools { main {} }
+`
+	n, err := ccl.Parse([]byte(msg))
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %s", msg, err)
+	}
+	before := string(ccl.FormatNode(n))
+	got := string(ccl.FormatNode(s.ApplyDefaults(n)))
+	want := `# the port
+port: 80
+backend {
+    addr: "a"
+    weight: 1
+}
+backend {
+    addr: "b"
+    weight: 3
+}
+pools {
+    main {
+        size: 4
+    }
+}
+hosts: ["localhost"]
+tls {
+    min_version: "1.2"
+}
+`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ApplyDefaults(%q) returned unexpected diff (-want +got):\n%s", msg, diff)
+	}
+	if after := string(ccl.FormatNode(n)); after != before {
+		t.Errorf("ApplyDefaults modified its input:\n%s", after)
+	}
+}
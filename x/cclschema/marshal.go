@@ -0,0 +1,123 @@
+package cclschema
+
+import (
+	"strconv"
+
+	"roseh.moe/pkg/ccl"
+)
+
+// Marshal writes s as a ccl document that can be read back with [Parse].
+// Together with [FromType], it lets a program export the schema of its
+// config, so that configs can be checked against it by tools that can't
+// import the program's types, such as "ccl verify".
+func (s *Schema) Marshal() []byte {
+	n := &ccl.Node{Kind: ccl.KindMessage}
+	n.Fields = appendFields(n.Fields, s.Fields, s.Rules)
+	for _, m := range s.Migrations {
+		n.Fields = append(n.Fields, keyValue("migration", migrationNode(m)))
+	}
+	return ccl.FormatNode(n)
+}
+
+func keyValue(name string, v *ccl.Node) *ccl.Field {
+	return &ccl.Field{Name: name, Value: v}
+}
+
+func stringNode(s string) *ccl.Node {
+	return &ccl.Node{Kind: ccl.KindString, String: s}
+}
+
+func stringsNode(ss []string) *ccl.Node {
+	n := &ccl.Node{Kind: ccl.KindList}
+	for _, s := range ss {
+		n.List = append(n.List, stringNode(s))
+	}
+	return n
+}
+
+// appendFields appends a field message for each field and a rule message for
+// each rule to kvs.
+func appendFields(kvs []*ccl.Field, fields []*Field, rules []*Rule) []*ccl.Field {
+	for _, f := range fields {
+		kvs = append(kvs, keyValue("field", fieldNode(f)))
+	}
+	for _, r := range rules {
+		kvs = append(kvs, keyValue("rule", ruleNode(r)))
+	}
+	return kvs
+}
+
+func fieldNode(f *Field) *ccl.Node {
+	n := &ccl.Node{Kind: ccl.KindMessage}
+	add := func(name string, v *ccl.Node) {
+		n.Fields = append(n.Fields, keyValue(name, v))
+	}
+	if f.Name != "" {
+		add("name", stringNode(f.Name))
+	}
+	add("type", stringNode(string(f.Type)))
+	if f.Repeated {
+		add("repeated", &ccl.Node{Kind: ccl.KindBool, Bool: true})
+	}
+	if f.Doc != "" {
+		add("doc", stringNode(f.Doc))
+	}
+	if len(f.Enum) > 0 {
+		add("enum", stringsNode(f.Enum))
+	}
+	if f.Required {
+		add("required", &ccl.Node{Kind: ccl.KindBool, Bool: true})
+	}
+	if f.Default != nil {
+		add("default", f.Default)
+	}
+	if f.Values != nil {
+		add("values", fieldNode(f.Values))
+	}
+	n.Fields = appendFields(n.Fields, f.Fields, f.Rules)
+	return n
+}
+
+func ruleNode(r *Rule) *ccl.Node {
+	n := &ccl.Node{Kind: ccl.KindMessage}
+	add := func(name string, v *ccl.Node) {
+		n.Fields = append(n.Fields, keyValue(name, v))
+	}
+	switch {
+	case r.Compare != "":
+		add("compare", stringNode(r.Compare))
+	case r.ExactlyOneOf != nil:
+		add("exactly_one_of", stringsNode(r.ExactlyOneOf))
+	case r.AtMostOneOf != nil:
+		add("at_most_one_of", stringsNode(r.AtMostOneOf))
+	case r.AtLeastOneOf != nil:
+		add("at_least_one_of", stringsNode(r.AtLeastOneOf))
+	}
+	if r.Message != "" {
+		add("message", stringNode(r.Message))
+	}
+	return n
+}
+
+func migrationNode(m *Migration) *ccl.Node {
+	n := &ccl.Node{Kind: ccl.KindMessage}
+	n.Fields = append(n.Fields, keyValue("version", &ccl.Node{Kind: ccl.KindNumber, Number: strconv.Itoa(m.Version)}))
+	for _, s := range m.Steps {
+		step := &ccl.Node{Kind: ccl.KindMessage}
+		add := func(name string, v *ccl.Node) {
+			step.Fields = append(step.Fields, keyValue(name, v))
+		}
+		add("path", stringNode(s.Path))
+		switch s.Kind {
+		case Rename:
+			add("to", stringNode(s.To))
+		case MapValue:
+			add("from", s.From)
+			add("to", s.Value)
+		case Scale:
+			add("factor", &ccl.Node{Kind: ccl.KindNumber, Number: strconv.FormatInt(s.Factor, 10)})
+		}
+		n.Fields = append(n.Fields, keyValue(string(s.Kind), step))
+	}
+	return n
+}
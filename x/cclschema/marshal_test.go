@@ -0,0 +1,107 @@
+package cclschema
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMarshal(t *testing.T) {
+	t.Parallel()
+
+	const want = `field {
+    name: "listen"
+    type: "string"
+    repeated: true
+    doc: "Addresses to listen on."
+    required: true
+}
+field {
+    name: "pool"
+    type: "message"
+    field {
+        name: "min"
+        type: "int"
+        default: 1
+    }
+    field {
+        name: "max"
+        type: "int"
+    }
+    rule {
+        compare: "max >= min"
+        message: "max should be at least min"
+    }
+}
+field {
+    name: "labels"
+    type: "map"
+    values {
+        type: "string"
+        enum: ["a", "b"]
+    }
+}
+field {
+    name: "tls_cert"
+    type: "string"
+}
+field {
+    name: "acme"
+    type: "bool"
+}
+rule {
+    exactly_one_of: ["tls_cert", "acme"]
+}
+migration {
+    version: 2
+    rename {
+        path: "addr"
+        to: "listen"
+    }
+    delete {
+        path: "legacy"
+    }
+    map_value {
+        path: "labels"
+        from: "x"
+        to: "a"
+    }
+    scale {
+        path: "timeout"
+        factor: 1000
+    }
+}
+`
+	s, err := Parse([]byte(want))
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	if diff := cmp.Diff(want, string(s.Marshal())); diff != "" {
+		t.Errorf("Marshal returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestMarshal_FromType(t *testing.T) {
+	t.Parallel()
+
+	type config struct {
+		Listen []string `ccl:"listen" doc:"Addresses to listen on."`
+		Log    struct {
+			Level string `ccl:"level,enum=debug|info"`
+		} `ccl:"log"`
+		Labels map[string]int `ccl:"labels"`
+		Debug  bool           `ccl:"debug,explicit"`
+	}
+	want, err := FromType(reflect.TypeFor[config]())
+	if err != nil {
+		t.Fatalf("FromType failed: %s", err)
+	}
+	got, err := Parse(want.Marshal())
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Parse(Marshal(s)) returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,277 @@
+package cclschema
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"roseh.moe/pkg/ccl"
+)
+
+// VersionKey is the top-level key that holds the schema version of a
+// document, if it has one.
+const VersionKey = "schema_version"
+
+// A Migration upgrades a document from the version before Version to
+// Version. In a schema, migrations are written as migration messages holding
+// a version and a list of steps, which are applied in order:
+//
+//	migration {
+//	    version: 2
+//	    rename { path: "server.addr" to: "listen" }
+//	    delete { path: "server.legacy_mode" }
+//	    map_value { path: "log.level" from: "warning" to: "warn" }
+//	    scale { path: "timeout" factor: 1000 }
+//	}
+//
+// Paths are dot-separated keys starting at the top level of the document.
+// Lists of messages are transparent, and a path element matches every key
+// with that name, so a step applies to every field that the path selects.
+type Migration struct {
+	Version int
+	Steps   []*Step
+}
+
+// A StepKind is the kind of change made by a [Step].
+type StepKind string
+
+const (
+	// Rename changes the name of a field to To, keeping its value and
+	// comments.
+	Rename StepKind = "rename"
+	// Delete removes a field.
+	Delete StepKind = "delete"
+	// MapValue replaces every value of a field equal to From with To. Lists
+	// are replaced element by element.
+	MapValue StepKind = "map_value"
+	// Scale multiplies every integer value of a field by Factor.
+	Scale StepKind = "scale"
+)
+
+// A Step is a single change to a document.
+type Step struct {
+	Kind StepKind
+	Path string
+	// To is the new name of the field for Rename.
+	To string
+	// From and Value are the old and new values for MapValue.
+	From, Value *ccl.Node
+	Factor      int64
+}
+
+func parseMigration(n *ccl.Node) (*Migration, error) {
+	if n.Kind != ccl.KindMessage {
+		return nil, fmt.Errorf("migration should be a message")
+	}
+	m := new(Migration)
+	for _, kv := range n.Fields {
+		if kv.Name != "version" {
+			continue
+		}
+		v, err := strconv.Atoi(kv.Value.Number)
+		if kv.Value.Kind != ccl.KindNumber || err != nil || v <= 0 {
+			return nil, fmt.Errorf("migration version should be a positive integer")
+		}
+		m.Version = v
+	}
+	if m.Version == 0 {
+		return nil, fmt.Errorf("migration has no version")
+	}
+	for _, kv := range n.Fields {
+		if kv.Name == "version" {
+			continue
+		}
+		for _, v := range values(kv.Value) {
+			step, err := parseStep(StepKind(kv.Name), v)
+			if err != nil {
+				return nil, fmt.Errorf("migration %d: %w", m.Version, err)
+			}
+			m.Steps = append(m.Steps, step)
+		}
+	}
+	return m, nil
+}
+
+func parseStep(kind StepKind, n *ccl.Node) (*Step, error) {
+	switch kind {
+	case Rename, Delete, MapValue, Scale:
+	default:
+		return nil, fmt.Errorf("unknown step %q", kind)
+	}
+	if n.Kind != ccl.KindMessage {
+		return nil, fmt.Errorf("%s should be a message", kind)
+	}
+	s := &Step{Kind: kind}
+	var err error
+	for _, kv := range n.Fields {
+		switch {
+		case kv.Name == "path" && kv.Value.Kind == ccl.KindString:
+			s.Path = kv.Value.String
+		case kind == Rename && kv.Name == "to" && kv.Value.Kind == ccl.KindString:
+			s.To = kv.Value.String
+		case kind == MapValue && kv.Name == "from":
+			s.From = kv.Value
+		case kind == MapValue && kv.Name == "to":
+			s.Value = kv.Value
+		case kind == Scale && kv.Name == "factor" && kv.Value.Kind == ccl.KindNumber:
+			if s.Factor, err = strconv.ParseInt(kv.Value.Number, 0, 64); err != nil {
+				return nil, fmt.Errorf("%s: factor should be an integer", kind)
+			}
+		default:
+			return nil, fmt.Errorf("%s: unexpected key %q", kind, kv.Name)
+		}
+	}
+	switch {
+	case s.Path == "":
+		return nil, fmt.Errorf("%s has no path", kind)
+	case kind == Rename && s.To == "":
+		return nil, fmt.Errorf("rename %s has no new name", s.Path)
+	case kind == MapValue && (s.From == nil || s.Value == nil):
+		return nil, fmt.Errorf("map_value %s needs from and to", s.Path)
+	case kind == MapValue && (s.From.Kind == ccl.KindList || s.From.Kind == ccl.KindMessage):
+		return nil, fmt.Errorf("map_value %s: from should be a single scalar", s.Path)
+	case kind == Scale && s.Factor == 0:
+		return nil, fmt.Errorf("scale %s has no factor", s.Path)
+	}
+	return s, nil
+}
+
+// Version returns the value of the top-level [VersionKey] of the document n.
+func Version(n *ccl.Node) (int, bool) {
+	for _, f := range n.Fields {
+		if f.Name == VersionKey && f.Value.Kind == ccl.KindNumber {
+			v, err := strconv.Atoi(f.Value.Number)
+			return v, err == nil
+		}
+	}
+	return 0, false
+}
+
+// Migrate upgrades the document n, which was written for version from of the
+// schema, by applying every migration with a later version. n is modified in
+// place, and comments move along with the fields they belong to. If n has a
+// top-level [VersionKey], it's set to the new version. Migrate returns the
+// new version of the document.
+func (s *Schema) Migrate(n *ccl.Node, from int) (int, error) {
+	version := from
+	for _, m := range s.Migrations {
+		if m.Version <= from {
+			continue
+		}
+		for _, step := range m.Steps {
+			if err := step.apply(n); err != nil {
+				return version, fmt.Errorf("migration %d: %w", m.Version, err)
+			}
+		}
+		version = m.Version
+	}
+	for _, f := range n.Fields {
+		if f.Name == VersionKey {
+			f.Value = &ccl.Node{Kind: ccl.KindNumber, Number: strconv.Itoa(version)}
+		}
+	}
+	return version, nil
+}
+
+// parents returns the messages that hold the last element of path.
+func parents(n *ccl.Node, path []string) []*ccl.Node {
+	if len(path) == 1 {
+		return []*ccl.Node{n}
+	}
+	var out []*ccl.Node
+	for _, f := range n.Fields {
+		if f.Name != path[0] {
+			continue
+		}
+		for _, v := range values(f.Value) {
+			if v.Kind == ccl.KindMessage {
+				out = append(out, parents(v, path[1:])...)
+			}
+		}
+	}
+	return out
+}
+
+func (s *Step) apply(n *ccl.Node) error {
+	path := strings.Split(s.Path, ".")
+	name := path[len(path)-1]
+	for _, msg := range parents(n, path) {
+		switch s.Kind {
+		case Delete:
+			msg.Fields = deleteFields(msg.Fields, name)
+			continue
+		case Rename:
+			for _, f := range msg.Fields {
+				if f.Name == s.To {
+					return fmt.Errorf("rename %s: %s is already set", s.Path, s.To)
+				}
+			}
+		}
+		for _, f := range msg.Fields {
+			if f.Name != name {
+				continue
+			}
+			switch s.Kind {
+			case Rename:
+				f.Name = s.To
+			case MapValue:
+				f.Value = s.mapValue(f.Value)
+			case Scale:
+				var err error
+				if f.Value, err = s.scale(f.Value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func deleteFields(fields []*ccl.Field, name string) []*ccl.Field {
+	out := fields[:0]
+	for _, f := range fields {
+		if f.Name != name {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func (s *Step) mapValue(v *ccl.Node) *ccl.Node {
+	if v.Kind == ccl.KindList {
+		list := &ccl.Node{Kind: ccl.KindList, List: make([]*ccl.Node, len(v.List))}
+		for i, elem := range v.List {
+			list.List[i] = s.mapValue(elem)
+		}
+		return list
+	}
+	if v.Equal(s.From) {
+		return s.Value
+	}
+	return v
+}
+
+func (s *Step) scale(v *ccl.Node) (*ccl.Node, error) {
+	switch v.Kind {
+	case ccl.KindList:
+		list := &ccl.Node{Kind: ccl.KindList, List: make([]*ccl.Node, len(v.List))}
+		for i, elem := range v.List {
+			var err error
+			if list.List[i], err = s.scale(elem); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case ccl.KindNumber:
+		x, err := strconv.ParseInt(v.Number, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("scale %s: %s isn't an integer", s.Path, v.Number)
+		}
+		if x != 0 && (x*s.Factor/s.Factor != x || x == math.MinInt64 && s.Factor == -1) {
+			return nil, fmt.Errorf("scale %s: %s * %d overflows", s.Path, v.Number, s.Factor)
+		}
+		return &ccl.Node{Kind: ccl.KindNumber, Number: strconv.FormatInt(x*s.Factor, 10)}, nil
+	}
+	return nil, fmt.Errorf("scale %s: value is a %s, not a number", s.Path, v.Kind)
+}
@@ -0,0 +1,166 @@
+package cclschema
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"roseh.moe/pkg/ccl"
+)
+
+const migrateSchema = `
+migration {
+    version: 2
+    rename { path: "server.addr" to: "listen" }
+    delete { path: "server.legacy_mode" }
+}
+migration {
+    version: 3
+    map_value { path: "log.level" from: "warning" to: "warn" }
+    scale { path: "timeout_s" factor: 1000 }
+    rename { path: "timeout_s" to: "timeout_ms" }
+}
+`
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+
+	s, err := Parse([]byte(migrateSchema))
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	for _, tc := range []struct {
+		desc    string
+		msg     string
+		from    int
+		want    string
+		version int
+	}{{
+		desc: "FromVersionKey",
+		msg: `schema_version: 1
+# the frontends
+server {
+    # where to listen
+    addr: ":80" # plain http
+    legacy_mode: true
+}
+server { addr: ":443" }
+log { level: ["warning", "info"] }
+timeout_s: 5
+`,
+		want: `schema_version: 3
+# the frontends
+server {
+    # where to listen
+    listen: ":80" # plain http
+}
+server {
+    listen: ":443"
+}
+log {
+    level: ["warn", "info"]
+}
+timeout_ms: 5000
+`,
+		version: 3,
+	}, {
+		desc: "Partial",
+		msg:  `server { addr: ":80" } timeout_s: 0x10`,
+		from: 2,
+		want: `server {
+    addr: ":80"
+}
+timeout_ms: 16000
+`,
+		version: 3,
+	}, {
+		desc:    "UpToDate",
+		msg:     `schema_version: 3 timeout_s: 1`,
+		want:    "schema_version: 3\ntimeout_s: 1\n",
+		version: 3,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			n, err := ccl.Parse([]byte(tc.msg))
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %s", tc.msg, err)
+			}
+			from := tc.from
+			if v, ok := Version(n); ok {
+				from = v
+			}
+			version, err := s.Migrate(n, from)
+			if err != nil {
+				t.Fatalf("Migrate(%q, %d) failed: %s", tc.msg, from, err)
+			}
+			if version != tc.version {
+				t.Errorf("Migrate(%q, %d) = %d, want %d", tc.msg, from, version, tc.version)
+			}
+			if diff := cmp.Diff(tc.want, string(ccl.FormatNode(n))); diff != "" {
+				t.Errorf("Migrate(%q, %d) returned unexpected diff (-want +got):\n%s", tc.msg, from, diff)
+			}
+		})
+	}
+}
+
+func TestMigrate_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc   string
+		schema string
+		msg    string
+	}{
+		{"RenameConflict", `migration { version: 1 rename { path: "a" to: "b" } }`, `a: 1 b: 2`},
+		{"ScaleString", `migration { version: 1 scale { path: "a" factor: 2 } }`, `a: "1"`},
+		{"ScaleFloat", `migration { version: 1 scale { path: "a" factor: 2 } }`, `a: 1.5`},
+		{"ScaleOverflow", `migration { version: 1 scale { path: "a" factor: 0x7fffffffffffffff } }`, `a: 2`},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			s, err := Parse([]byte(tc.schema))
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %s", tc.schema, err)
+			}
+			n, err := ccl.Parse([]byte(tc.msg))
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %s", tc.msg, err)
+			}
+			if _, err := s.Migrate(n, 0); err == nil {
+				t.Errorf("Migrate(%q) succeeded, want error", tc.msg)
+			}
+		})
+	}
+}
+
+func TestParse_InvalidMigration(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want string
+	}{
+		{"NoVersion", `migration { delete { path: "a" } }`, "migration has no version"},
+		{"Order", `migration { version: 2 } migration { version: 1 }`, "migration 1: migrations should be in increasing order of version"},
+		{"UnknownStep", `migration { version: 1 move { path: "a" } }`, `migration 1: unknown step "move"`},
+		{"NoPath", `migration { version: 1 delete {} }`, "migration 1: delete has no path"},
+		{"NoName", `migration { version: 1 rename { path: "a" } }`, "migration 1: rename a has no new name"},
+		{"BadKey", `migration { version: 1 delete { path: "a" to: "b" } }`, `migration 1: delete: unexpected key "to"`},
+		{"MapValueList", `migration { version: 1 map_value { path: "a" from: [1] to: 2 } }`, "migration 1: map_value a: from should be a single scalar"},
+		{"ScaleFloat", `migration { version: 1 scale { path: "a" factor: 1.5 } }`, "migration 1: scale: factor should be an integer"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse([]byte(tc.msg))
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded, want error %q", tc.msg, tc.want)
+			}
+			if got := err.Error(); got != tc.want {
+				t.Errorf("Parse(%q) returned error %q, want %q", tc.msg, got, tc.want)
+			}
+		})
+	}
+}
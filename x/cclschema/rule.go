@@ -0,0 +1,148 @@
+package cclschema
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"roseh.moe/pkg/ccl"
+)
+
+// A Rule is a constraint between the fields of a message. Exactly one of
+// Compare, ExactlyOneOf, AtMostOneOf, and AtLeastOneOf is set.
+type Rule struct {
+	// Compare compares two fields, or a field and a number, e.g.
+	// "max >= min" or "workers <= 64". The operands and the operator are
+	// separated by spaces. The operators are <, <=, >, >=, ==, and !=; the
+	// ordered comparisons only apply to numbers. The rule is skipped unless
+	// every field that it mentions is set.
+	Compare string
+	// ExactlyOneOf, AtMostOneOf, and AtLeastOneOf list the names of fields
+	// of which exactly one, at most one, or at least one must be set.
+	ExactlyOneOf []string
+	AtMostOneOf  []string
+	AtLeastOneOf []string
+	// Message, if set, is reported instead of the default message when the
+	// rule is broken.
+	Message string
+}
+
+var compareOps = []string{"<", "<=", ">", ">=", "==", "!="}
+
+// parseCompare splits a Compare expression into its operands and operator.
+func parseCompare(expr string) (left, op, right string, err error) {
+	parts := strings.Fields(expr)
+	if len(parts) != 3 || !slices.Contains(compareOps, parts[1]) {
+		return "", "", "", fmt.Errorf("compare %q should have the form \"a <op> b\"", expr)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// isLiteral reports whether a Compare operand is a number rather than a
+// field name.
+func isLiteral(operand string) bool {
+	c := operand[0]
+	return c == '-' || c == '+' || c == '.' || '0' <= c && c <= '9'
+}
+
+// number returns the value of a number literal, which is written as it is
+// in a document.
+func number(lit string) (float64, bool) {
+	f, err := ccl.Number(lit).Float64()
+	return f, err == nil
+}
+
+func parseRule(n *ccl.Node, path string, fields []*Field) (*Rule, error) {
+	if n.Kind != ccl.KindMessage {
+		return nil, pathError(path, "rule should be a message")
+	}
+	r := new(Rule)
+	names := func(kv *ccl.Field) ([]string, error) {
+		var names []string
+		for _, v := range values(kv.Value) {
+			if v.Kind != ccl.KindString {
+				return nil, pathError(path, "%s should be a list of strings", kv.Name)
+			}
+			names = append(names, v.String)
+		}
+		return names, nil
+	}
+	var err error
+	for _, kv := range n.Fields {
+		switch kv.Name {
+		case "compare":
+			if kv.Value.Kind != ccl.KindString {
+				return nil, pathError(path, "compare should be a string")
+			}
+			r.Compare = kv.Value.String
+		case "exactly_one_of":
+			r.ExactlyOneOf, err = names(kv)
+		case "at_most_one_of":
+			r.AtMostOneOf, err = names(kv)
+		case "at_least_one_of":
+			r.AtLeastOneOf, err = names(kv)
+		case "message":
+			if kv.Value.Kind != ccl.KindString {
+				return nil, pathError(path, "message should be a string")
+			}
+			r.Message = kv.Value.String
+		default:
+			err = pathError(path, "unknown rule key %q", kv.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := r.check(fields); err != nil {
+		return nil, pathError(path, "%s", err)
+	}
+	return r, nil
+}
+
+// check reports whether r is a valid rule for a message with the given
+// fields.
+func (r *Rule) check(fields []*Field) error {
+	set := 0
+	for _, names := range [][]string{r.ExactlyOneOf, r.AtMostOneOf, r.AtLeastOneOf} {
+		if names == nil {
+			continue
+		}
+		set++
+		if len(names) < 2 {
+			return fmt.Errorf("rule should list at least two fields")
+		}
+		for _, name := range names {
+			if lookup(fields, name) == nil {
+				return fmt.Errorf("rule refers to unknown field %q", name)
+			}
+		}
+	}
+	if r.Compare != "" {
+		set++
+		left, op, right, err := parseCompare(r.Compare)
+		if err != nil {
+			return err
+		}
+		for _, operand := range []string{left, right} {
+			if isLiteral(operand) {
+				if _, ok := number(operand); !ok {
+					return fmt.Errorf("compare %q: invalid number %q", r.Compare, operand)
+				}
+				continue
+			}
+			f := lookup(fields, operand)
+			switch {
+			case f == nil:
+				return fmt.Errorf("compare %q refers to unknown field %q", r.Compare, operand)
+			case f.Repeated || f.Type == Message || f.Type == Map:
+				return fmt.Errorf("compare %q: field %q isn't a single scalar", r.Compare, operand)
+			case op != "==" && op != "!=" && f.Type != Int && f.Type != Float:
+				return fmt.Errorf("compare %q: field %q isn't a number", r.Compare, operand)
+			}
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("rule should have exactly one of compare, exactly_one_of, at_most_one_of, and at_least_one_of")
+	}
+	return nil
+}
@@ -0,0 +1,417 @@
+// Package cclschema describes the fields that a ccl document may contain.
+//
+// A schema can be derived from a Go type with [FromType], or written by hand
+// as a ccl document and read with [Parse]. A hand-written schema lists its
+// fields with repeated field messages:
+//
+//	field {
+//	    name: "listen"
+//	    type: "string"
+//	    repeated: true
+//	    doc: "Addresses to listen on."
+//	}
+//	field {
+//	    name: "log"
+//	    type: "message"
+//	    field {
+//	        name: "level"
+//	        type: "string"
+//	        enum: ["debug", "info", "warn", "error"]
+//	    }
+//	}
+//	field {
+//	    name: "labels"
+//	    type: "map"
+//	    values { type: "string" }
+//	}
+//
+// The types are bool, int, float, string, message, and map. A message field
+// lists its own fields, and a map field describes its values with a values
+// message; map keys are always strings. A field with required: true must be
+// present, and a field with a default, such as default: 8080, has that value
+// when it's not present.
+//
+// The schema and each message field can also have rules that relate its
+// fields to each other:
+//
+//	rule { compare: "max_conns >= min_conns" }
+//	rule { exactly_one_of: ["tls_cert", "acme"] }
+//	rule {
+//	    at_most_one_of: ["debug", "profile"]
+//	    message: "debug and profile can't be enabled at once"
+//	}
+//
+// See [Rule] for details. [Schema.Validate] checks a document against a
+// schema.
+//
+// Finally, a schema can describe how documents written for its older versions
+// are upgraded, as explained in [Migration].
+package cclschema
+
+import (
+	"encoding"
+	"flag"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/cclwkt"
+)
+
+// A Type is the type of a field's values.
+type Type string
+
+const (
+	Bool    Type = "bool"
+	Int     Type = "int"
+	Float   Type = "float"
+	String  Type = "string"
+	Message Type = "message"
+	Map     Type = "map"
+)
+
+var types = []Type{Bool, Int, Float, String, Message, Map}
+
+// A Schema describes the top-level fields of a document.
+type Schema struct {
+	Fields []*Field
+	Rules  []*Rule
+	// Migrations upgrade documents written for older versions of the
+	// schema, in increasing order of version.
+	Migrations []*Migration
+}
+
+// A Field describes a key in a message.
+type Field struct {
+	Name string
+	Type Type
+	// Repeated is set if the field holds a list.
+	Repeated bool
+	Doc      string
+	// Enum, if not empty, lists the values that a string field may have.
+	Enum []string
+	// Required is set if the field must be present.
+	Required bool
+	// Default is the value of the field when it's not present. See
+	// [Schema.ApplyDefaults].
+	Default *ccl.Node
+	// Fields and Rules describe the fields of a message.
+	Fields []*Field
+	Rules  []*Rule
+	// Values describes the values of a map. Its Name is empty.
+	Values *Field
+}
+
+// lookup returns the field with the given name, or nil.
+func lookup(fields []*Field, name string) *Field {
+	if i := slices.IndexFunc(fields, func(f *Field) bool { return f.Name == name }); i >= 0 {
+		return fields[i]
+	}
+	return nil
+}
+
+// Lookup returns the top-level field with the given name, or nil.
+func (s *Schema) Lookup(name string) *Field {
+	return lookup(s.Fields, name)
+}
+
+// Lookup returns the field of a message with the given name, or nil.
+func (f *Field) Lookup(name string) *Field {
+	return lookup(f.Fields, name)
+}
+
+// Parse reads a schema written as a ccl document.
+func Parse(data []byte) (*Schema, error) {
+	n, err := ccl.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	s := new(Schema)
+	for _, kv := range n.Fields {
+		switch kv.Name {
+		case "field", "rule":
+		case "migration":
+			for _, v := range values(kv.Value) {
+				m, err := parseMigration(v)
+				if err != nil {
+					return nil, err
+				}
+				if len(s.Migrations) > 0 && m.Version <= s.Migrations[len(s.Migrations)-1].Version {
+					return nil, fmt.Errorf("migration %d: migrations should be in increasing order of version", m.Version)
+				}
+				s.Migrations = append(s.Migrations, m)
+			}
+		default:
+			return nil, fmt.Errorf("unknown key %q", kv.Name)
+		}
+	}
+	if s.Fields, s.Rules, err = parseFields(n, ""); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseFields reads the field and rule keys of a message.
+func parseFields(n *ccl.Node, path string) ([]*Field, []*Rule, error) {
+	var fields []*Field
+	for _, kv := range n.Fields {
+		if kv.Name != "field" {
+			continue
+		}
+		for _, v := range values(kv.Value) {
+			field, err := parseField(v, path, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			if lookup(fields, field.Name) != nil {
+				return nil, nil, pathError(join(path, field.Name), "field is defined more than once")
+			}
+			fields = append(fields, field)
+		}
+	}
+	var rules []*Rule
+	for _, kv := range n.Fields {
+		if kv.Name != "rule" {
+			continue
+		}
+		for _, v := range values(kv.Value) {
+			rule, err := parseRule(v, path, fields)
+			if err != nil {
+				return nil, nil, err
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return fields, rules, nil
+}
+
+func values(n *ccl.Node) []*ccl.Node {
+	if n.Kind == ccl.KindList {
+		return n.List
+	}
+	return []*ccl.Node{n}
+}
+
+// pathError returns an error about the field at path.
+func pathError(path, format string, args ...any) error {
+	if path == "" {
+		return fmt.Errorf(format, args...)
+	}
+	return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// parseField reads a field message. Map values don't have names.
+func parseField(n *ccl.Node, path string, named bool) (*Field, error) {
+	if n.Kind != ccl.KindMessage {
+		return nil, pathError(path, "field should be a message")
+	}
+	f := new(Field)
+	for _, kv := range n.Fields {
+		if kv.Name == "name" && named {
+			if kv.Value.Kind != ccl.KindString || kv.Value.String == "" {
+				return nil, pathError(path, "name should be a non-empty string")
+			}
+			f.Name = kv.Value.String
+		}
+	}
+	if named && f.Name == "" {
+		return nil, pathError(path, "field has no name")
+	}
+	path = join(path, f.Name)
+	if !named {
+		path += ".values"
+	}
+	str := func(kv *ccl.Field) (string, error) {
+		if kv.Value.Kind != ccl.KindString {
+			return "", pathError(path, "%s should be a string", kv.Name)
+		}
+		return kv.Value.String, nil
+	}
+	var err error
+	for _, kv := range n.Fields {
+		switch kv.Name {
+		case "name":
+			if !named {
+				return nil, pathError(path, "map values don't have names")
+			}
+		case "type":
+			var t string
+			if t, err = str(kv); err == nil && !slices.Contains(types, Type(t)) {
+				err = pathError(path, "unknown type %q", t)
+			}
+			f.Type = Type(t)
+		case "repeated":
+			if kv.Value.Kind != ccl.KindBool {
+				return nil, pathError(path, "repeated should be a bool")
+			}
+			f.Repeated = kv.Value.Bool
+		case "doc":
+			f.Doc, err = str(kv)
+		case "enum":
+			for _, v := range values(kv.Value) {
+				if v.Kind != ccl.KindString {
+					return nil, pathError(path, "enum should be a list of strings")
+				}
+				f.Enum = append(f.Enum, v.String)
+			}
+		case "required":
+			if kv.Value.Kind != ccl.KindBool {
+				return nil, pathError(path, "required should be a bool")
+			}
+			f.Required = kv.Value.Bool
+		case "default":
+			f.Default = kv.Value
+		case "field", "rule":
+		case "values":
+			f.Values, err = parseField(kv.Value, path, false)
+		default:
+			err = pathError(path, "unknown key %q", kv.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if f.Fields, f.Rules, err = parseFields(n, path); err != nil {
+		return nil, err
+	}
+	switch {
+	case f.Type == "":
+		return nil, pathError(path, "field has no type")
+	case (len(f.Fields) > 0 || len(f.Rules) > 0) && f.Type != Message:
+		return nil, pathError(path, "only messages have fields and rules")
+	case (f.Values != nil) != (f.Type == Map):
+		return nil, pathError(path, "a map must have values, and only maps have values")
+	case len(f.Enum) > 0 && f.Type != String:
+		return nil, pathError(path, "only strings can have an enum")
+	case f.Values != nil && f.Values.Repeated:
+		return nil, pathError(path, "map values can't be repeated")
+	case f.Default != nil && f.Required:
+		return nil, pathError(path, "a required field can't have a default")
+	}
+	if f.Default != nil {
+		v := new(validator)
+		v.value(f, f.Default, path, nil)
+		if len(v.diags) > 0 {
+			return nil, pathError(path, "invalid default: %s", v.diags[0].Message)
+		}
+	}
+	return f, nil
+}
+
+var (
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	flagValueType       = reflect.TypeFor[flag.Value]()
+)
+
+// FromType derives a schema from the struct type t, using the same field
+// names as [ccl.Unmarshal]. The doc of each field is taken from its doc
+// struct tag, for example:
+//
+//	Listen []string `ccl:"listen" doc:"Addresses to listen on."`
+//
+// A field with the explicit option in its ccl tag is required, and the
+// values of a field with the enum option are its Enum. A field with the
+// flags option is a list of its flag names.
+//
+// Recursive types aren't supported.
+func FromType(t reflect.Type) (*Schema, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	fields, err := fromStruct(t, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{Fields: fields}, nil
+}
+
+func fromStruct(t reflect.Type, stack []reflect.Type) ([]*Field, error) {
+	if slices.Contains(stack, t) {
+		return nil, fmt.Errorf("recursive type %s isn't supported", t)
+	}
+	stack = append(stack, t)
+	sfs, err := ccl.TypeFields(t)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]*Field, 0, len(sfs))
+	for _, sf := range sfs {
+		f := &Field{Name: sf.Name, Doc: sf.Field.Tag.Get("doc"), Required: sf.Explicit, Enum: sf.Enum}
+		if len(sf.Flags) > 0 {
+			// Flags are usually written as a list of names.
+			f.Type, f.Repeated, f.Enum = String, true, sf.Flags
+		} else if err := fromType(f, sf.Field.Type, stack); err != nil {
+			return nil, fmt.Errorf("field %q of %s: %w", sf.Name, t, err)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// fromType fills in the type of f from the Go type t.
+func fromType(f *Field, t reflect.Type, stack []reflect.Type) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeFor[cclwkt.Tristate]() {
+		// A Tristate is usually written as a bool literal.
+		f.Type = Bool
+		return nil
+	}
+	if t == reflect.TypeFor[ccl.Number]() {
+		// Float accepts every number.
+		f.Type = Float
+		return nil
+	}
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) || reflect.PointerTo(t).Implements(flagValueType) {
+		f.Type = String
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		f.Type = Bool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f.Type = Int
+	case reflect.Float32, reflect.Float64:
+		f.Type = Float
+	case reflect.String:
+		f.Type = String
+	case reflect.Struct:
+		f.Type = Message
+		var err error
+		f.Fields, err = fromStruct(t, stack)
+		return err
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is written as a base64 string.
+			f.Type = String
+			return nil
+		}
+		if f.Repeated {
+			return fmt.Errorf("unsupported type %s", t)
+		}
+		f.Repeated = true
+		return fromType(f, t.Elem(), stack)
+	case reflect.Map:
+		f.Type = Map
+		f.Values = new(Field)
+		if err := fromType(f.Values, t.Elem(), stack); err != nil {
+			return err
+		}
+		if f.Values.Repeated {
+			return fmt.Errorf("unsupported type %s", t)
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", t)
+	}
+	return nil
+}
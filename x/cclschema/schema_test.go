@@ -0,0 +1,253 @@
+package cclschema
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/cclwkt"
+)
+
+const testSchema = `
+field {
+    name: "listen"
+    type: "string"
+    repeated: true
+    doc: "Addresses to listen on."
+}
+field {
+    name: "log"
+    type: "message"
+    field {
+        name: "level"
+        type: "string"
+        enum: ["debug", "info"]
+    }
+}
+field {
+    name: "labels"
+    type: "map"
+    values { type: "string" }
+}
+`
+
+var testSchemaWant = &Schema{Fields: []*Field{
+	{Name: "listen", Type: String, Repeated: true, Doc: "Addresses to listen on."},
+	{Name: "log", Type: Message, Fields: []*Field{
+		{Name: "level", Type: String, Enum: []string{"debug", "info"}},
+	}},
+	{Name: "labels", Type: Map, Values: &Field{Type: String}},
+}}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	got, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	if diff := cmp.Diff(testSchemaWant, got); diff != "" {
+		t.Errorf("Parse returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want string
+	}{{
+		desc: "Syntax",
+		msg:  `field {`,
+		want: "1:8 syntax error: premature EOF",
+	}, {
+		desc: "NoName",
+		msg:  `field { type: "int" }`,
+		want: "field has no name",
+	}, {
+		desc: "NoType",
+		msg:  `field { name: "a" }`,
+		want: "a: field has no type",
+	}, {
+		desc: "UnknownType",
+		msg:  `field { name: "a" type: "integer" }`,
+		want: `a: unknown type "integer"`,
+	}, {
+		desc: "UnknownKey",
+		msg:  `field { name: "a" type: "int" defualt: 1 }`,
+		want: `a: unknown key "defualt"`,
+	}, {
+		desc: "Duplicate",
+		msg:  `field { name: "a" type: "int" } field { name: "a" type: "bool" }`,
+		want: "a: field is defined more than once",
+	}, {
+		desc: "FieldsOnScalar",
+		msg:  `field { name: "a" type: "int" field { name: "b" type: "int" } }`,
+		want: "a: only messages have fields and rules",
+	}, {
+		desc: "MapWithoutValues",
+		msg:  `field { name: "a" type: "map" }`,
+		want: "a: a map must have values, and only maps have values",
+	}, {
+		desc: "EnumOnInt",
+		msg:  `field { name: "a" type: "int" enum: ["x"] }`,
+		want: "a: only strings can have an enum",
+	}, {
+		desc: "BadDefault",
+		msg:  `field { name: "a" type: "string" enum: ["x", "y"] default: "z" }`,
+		want: `a: invalid default: "z" is not one of "x", "y"`,
+	}, {
+		desc: "RequiredDefault",
+		msg:  `field { name: "a" type: "int" required: true default: 1 }`,
+		want: "a: a required field can't have a default",
+	}, {
+		desc: "NestedError",
+		msg:  `field { name: "a" type: "message" field { name: "b" type: 1 } }`,
+		want: "a.b: type should be a string",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse([]byte(tc.msg))
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded, want error %q", tc.msg, tc.want)
+			}
+			if got := err.Error(); got != tc.want {
+				t.Errorf("Parse(%q) returned error %q, want %q", tc.msg, got, tc.want)
+			}
+		})
+	}
+}
+
+// tagsFlag is a flag.Value holding a comma-separated list.
+type tagsFlag []string
+
+func (t *tagsFlag) String() string     { return strings.Join(*t, ",") }
+func (t *tagsFlag) Set(s string) error { *t = strings.Split(s, ","); return nil }
+
+func TestFromType(t *testing.T) {
+	t.Parallel()
+
+	type server struct {
+		Addr    netip.AddrPort `ccl:"addr"`
+		Timeout time.Time      `ccl:"timeout"`
+	}
+	type config struct {
+		Listen  []string          `ccl:"listen" doc:"Addresses to listen on."`
+		Workers *int              `ccl:"workers"`
+		Ratio   float32           `ccl:"ratio"`
+		ID      ccl.Number        `ccl:"id"`
+		Debug   bool              `ccl:"debug,explicit"`
+		Trace   cclwkt.Tristate   `ccl:"trace"`
+		Tags    tagsFlag          `ccl:"tags"`
+		Mode    string            `ccl:"mode,enum=fast|safe"`
+		Perms   uint32            `ccl:"perms,flags=READ:4|WRITE:2"`
+		Key     []byte            `ccl:"key"`
+		Servers []*server         `ccl:"servers"`
+		Labels  map[string]string `ccl:"labels"`
+		Ignored int               `ccl:"-"`
+		Default string
+		private int
+	}
+	got, err := FromType(reflect.TypeFor[*config]())
+	if err != nil {
+		t.Fatalf("FromType failed: %s", err)
+	}
+	want := &Schema{Fields: []*Field{
+		{Name: "listen", Type: String, Repeated: true, Doc: "Addresses to listen on."},
+		{Name: "workers", Type: Int},
+		{Name: "ratio", Type: Float},
+		{Name: "id", Type: Float},
+		{Name: "debug", Type: Bool, Required: true},
+		{Name: "trace", Type: Bool},
+		{Name: "tags", Type: String},
+		{Name: "mode", Type: String, Enum: []string{"fast", "safe"}},
+		{Name: "perms", Type: String, Repeated: true, Enum: []string{"READ", "WRITE"}},
+		{Name: "key", Type: String},
+		{Name: "servers", Type: Message, Repeated: true, Fields: []*Field{
+			{Name: "addr", Type: String},
+			{Name: "timeout", Type: String},
+		}},
+		{Name: "labels", Type: Map, Values: &Field{Type: String}},
+		{Name: "Default", Type: String},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("FromType returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestFromType_Invalid(t *testing.T) {
+	t.Parallel()
+
+	type recursive struct {
+		Next *recursive `ccl:"next"`
+	}
+	for _, tc := range []struct {
+		desc string
+		t    reflect.Type
+	}{
+		{"Recursive", reflect.TypeFor[recursive]()},
+		{"Chan", reflect.TypeFor[struct{ C chan int }]()},
+		{"NestedList", reflect.TypeFor[struct{ L [][]int }]()},
+		{"BadTag", reflect.TypeFor[struct {
+			A int `ccl:"a,bogus"`
+		}]()},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := FromType(tc.t); err == nil {
+				t.Errorf("FromType(%s) succeeded, want error", tc.t)
+			}
+		})
+	}
+}
+
+func TestCompletionManifest(t *testing.T) {
+	t.Parallel()
+
+	got, err := testSchemaWant.CompletionManifest()
+	if err != nil {
+		t.Fatalf("CompletionManifest failed: %s", err)
+	}
+	want := `{
+  "version": 1,
+  "keys": [
+    {
+      "path": "listen",
+      "type": "string",
+      "repeated": true,
+      "doc": "Addresses to listen on."
+    },
+    {
+      "path": "log",
+      "type": "message"
+    },
+    {
+      "path": "log.level",
+      "type": "string",
+      "enum": [
+        "debug",
+        "info"
+      ]
+    },
+    {
+      "path": "labels",
+      "type": "map"
+    },
+    {
+      "path": "labels.*",
+      "type": "string"
+    }
+  ]
+}`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("CompletionManifest returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,287 @@
+package cclschema
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/ccllint"
+)
+
+// The rules reported by Validate.
+var validateRules = []struct{ name, doc string }{
+	{"unknown-key", "keys must be described by the schema"},
+	{"type", "values must have the type given by the schema"},
+	{"enum", "strings must be one of the values listed by the schema"},
+	{"duplicate", "keys that aren't repeated must be set at most once"},
+	{"required", "required keys must be set"},
+	{"constraint", "rules between the fields of a message must hold"},
+}
+
+func init() {
+	for _, r := range validateRules {
+		ccllint.Register(r.name, r.doc)
+	}
+}
+
+// Validate checks the document n, which should be returned by [ccl.Parse],
+// against s. The problems are reported in the same form as by
+// [ccllint.Lint], and can be suppressed with ccl:ignore directives in the
+// same way.
+func (s *Schema) Validate(n *ccl.Node) []ccllint.Diagnostic {
+	v := new(validator)
+	v.message(s.Fields, s.Rules, n, "", nil)
+	return v.diags
+}
+
+type validator struct {
+	diags []ccllint.Diagnostic
+}
+
+func (v *validator) report(path string, ignored []string, rule, format string, args ...any) {
+	if slices.Contains(ignored, rule) {
+		return
+	}
+	v.diags = append(v.diags, ccllint.Diagnostic{Path: path, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+// setField is a key in a document along with the ccl:ignore directives that
+// apply to it.
+type setField struct {
+	path    string
+	ignored []string
+	value   *ccl.Node
+	// index is the position of the key in its message.
+	index int
+}
+
+func (v *validator) message(fields []*Field, rules []*Rule, n *ccl.Node, path string, ignored []string) {
+	set := make(map[string]setField)
+	for i, kv := range n.Fields {
+		names, _ := ccllint.Directives(kv)
+		sf := setField{join(path, kv.Name), append(ignored[:len(ignored):len(ignored)], names...), kv.Value, i}
+		f := lookup(fields, kv.Name)
+		if f == nil {
+			v.report(sf.path, sf.ignored, "unknown-key", "unknown key %q", kv.Name)
+			continue
+		}
+		if _, ok := set[kv.Name]; ok && !f.Repeated {
+			v.report(sf.path, sf.ignored, "duplicate", "key %q is set more than once", kv.Name)
+		} else if !ok {
+			set[kv.Name] = sf
+		}
+		v.value(f, kv.Value, sf.path, sf.ignored)
+	}
+	for _, f := range fields {
+		if _, ok := set[f.Name]; f.Required && !ok {
+			v.report(join(path, f.Name), ignored, "required", "required key %q is missing", f.Name)
+		}
+	}
+	for _, r := range rules {
+		v.rule(r, set, path, ignored)
+	}
+}
+
+func (v *validator) value(f *Field, n *ccl.Node, path string, ignored []string) {
+	if n.Kind != ccl.KindList {
+		v.single(f, n, path, ignored)
+		return
+	}
+	if !f.Repeated {
+		v.report(path, ignored, "type", "expecting a single %s, got a list", f.Type)
+		return
+	}
+	for _, elem := range n.List {
+		v.single(f, elem, path, ignored)
+	}
+}
+
+// matches reports whether n has type t.
+func matches(t Type, n *ccl.Node) bool {
+	switch t {
+	case Bool:
+		return n.Kind == ccl.KindBool
+	case Int:
+		return n.Kind == ccl.KindNumber && isInt(n.Number)
+	case Float:
+		return n.Kind == ccl.KindNumber
+	case String:
+		return n.Kind == ccl.KindString
+	case Message, Map:
+		return n.Kind == ccl.KindMessage
+	}
+	return false
+}
+
+// isInt reports whether a number literal is an integer.
+func isInt(lit string) bool {
+	lit = strings.TrimLeft(lit, "+-")
+	if strings.HasPrefix(lit, "0x") || strings.HasPrefix(lit, "0X") {
+		return true
+	}
+	return !strings.ContainsAny(lit, ".eEin%")
+}
+
+func (v *validator) single(f *Field, n *ccl.Node, path string, ignored []string) {
+	if !matches(f.Type, n) {
+		got := n.Kind.String()
+		if n.Kind == ccl.KindNumber {
+			got = n.Number
+		}
+		v.report(path, ignored, "type", "expecting %s, got %s", f.Type, got)
+		return
+	}
+	switch f.Type {
+	case String:
+		if len(f.Enum) > 0 && !slices.Contains(f.Enum, n.String) {
+			v.report(path, ignored, "enum", "%q is not one of %s", n.String, quoteAll(f.Enum))
+		}
+	case Message:
+		v.message(f.Fields, f.Rules, n, path, ignored)
+	case Map:
+		seen := make(map[string]bool)
+		for _, kv := range n.Fields {
+			names, _ := ccllint.Directives(kv)
+			kvPath, kvIgnored := join(path, kv.Name), append(ignored[:len(ignored):len(ignored)], names...)
+			if seen[kv.Name] {
+				v.report(kvPath, kvIgnored, "duplicate", "key %q is set more than once", kv.Name)
+			}
+			seen[kv.Name] = true
+			v.value(f.Values, kv.Value, kvPath, kvIgnored)
+		}
+	}
+}
+
+func quoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("%q", name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func (v *validator) rule(r *Rule, set map[string]setField, path string, ignored []string) {
+	if r.Compare != "" {
+		v.compare(r, set, path, ignored)
+		return
+	}
+	names, want := r.AtLeastOneOf, "at least one"
+	switch {
+	case r.ExactlyOneOf != nil:
+		names, want = r.ExactlyOneOf, "exactly one"
+	case r.AtMostOneOf != nil:
+		names, want = r.AtMostOneOf, "at most one"
+	}
+	count := 0
+	for _, name := range names {
+		if _, isSet := set[name]; isSet {
+			count++
+		}
+	}
+	ok := count >= 1
+	switch {
+	case r.ExactlyOneOf != nil:
+		ok = count == 1
+	case r.AtMostOneOf != nil:
+		ok = count <= 1
+	}
+	if ok {
+		return
+	}
+	msg := r.Message
+	if msg == "" {
+		msg = fmt.Sprintf("%s of %s must be set", want, strings.Join(names, ", "))
+	}
+	if count == 0 {
+		v.report(path, ignored, "constraint", "%s", msg)
+		return
+	}
+	// Report the problem on the second field that's set, since that's
+	// likely where the conflict was introduced.
+	var setFields []setField
+	for _, name := range names {
+		if sf, isSet := set[name]; isSet {
+			setFields = append(setFields, sf)
+		}
+	}
+	slices.SortFunc(setFields, func(a, b setField) int { return a.index - b.index })
+	v.report(setFields[1].path, setFields[1].ignored, "constraint", "%s", msg)
+}
+
+func (v *validator) compare(r *Rule, set map[string]setField, path string, ignored []string) {
+	left, op, right, err := parseCompare(r.Compare)
+	if err != nil {
+		v.report(path, ignored, "constraint", "%s", err)
+		return
+	}
+	// operand returns the value of an operand as a Node, and the field that
+	// it comes from, if any.
+	var at *setField
+	operand := func(s string) (*ccl.Node, bool) {
+		if isLiteral(s) {
+			return &ccl.Node{Kind: ccl.KindNumber, Number: s}, true
+		}
+		sf, ok := set[s]
+		if !ok || sf.value.Kind == ccl.KindList {
+			return nil, false
+		}
+		if at == nil {
+			at = &sf
+		}
+		return sf.value, true
+	}
+	a, okA := operand(left)
+	b, okB := operand(right)
+	if !okA || !okB || at == nil {
+		return
+	}
+	var holds bool
+	x, okX := number(a.Number)
+	y, okY := number(b.Number)
+	switch {
+	case op == "==":
+		holds = a.Equal(b) || okX && okY && x == y
+	case op == "!=":
+		holds = !a.Equal(b) && !(okX && okY && x == y)
+	case a.Kind != ccl.KindNumber || b.Kind != ccl.KindNumber || !okX || !okY:
+		// Type errors are reported separately.
+		return
+	case op == "<":
+		holds = x < y
+	case op == "<=":
+		holds = x <= y
+	case op == ">":
+		holds = x > y
+	case op == ">=":
+		holds = x >= y
+	}
+	if holds {
+		return
+	}
+	msg := r.Message
+	if msg == "" {
+		msg = fmt.Sprintf("%s doesn't hold", r.Compare)
+		var vals []string
+		for _, s := range []string{left, right} {
+			if !isLiteral(s) {
+				vals = append(vals, fmt.Sprintf("%s is %s", s, describe(set[s].value)))
+			}
+		}
+		msg += ": " + strings.Join(vals, " and ")
+	}
+	v.report(at.path, at.ignored, "constraint", "%s", msg)
+}
+
+// describe returns a short description of a scalar value for messages.
+func describe(n *ccl.Node) string {
+	switch n.Kind {
+	case ccl.KindNumber:
+		return n.Number
+	case ccl.KindString:
+		return fmt.Sprintf("%q", n.String)
+	case ccl.KindBool:
+		return fmt.Sprint(n.Bool)
+	}
+	return n.Kind.String()
+}
@@ -0,0 +1,168 @@
+package cclschema
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"roseh.moe/pkg/ccl"
+	"roseh.moe/pkg/ccl/x/ccllint"
+)
+
+const validateSchema = `
+field { name: "name" type: "string" required: true }
+field { name: "mode" type: "string" enum: ["fast", "safe"] }
+field { name: "ports" type: "int" repeated: true }
+field { name: "ratio" type: "float" }
+field { name: "tls_cert" type: "string" }
+field { name: "acme" type: "bool" }
+field {
+    name: "pool"
+    type: "message"
+    field { name: "min" type: "int" }
+    field { name: "max" type: "int" }
+    rule { compare: "max >= min" }
+    rule { compare: "max <= 0x100" }
+}
+field {
+    name: "labels"
+    type: "map"
+    values { type: "string" }
+}
+rule { exactly_one_of: ["tls_cert", "acme"] }
+`
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	s, err := Parse([]byte(validateSchema))
+	if err != nil {
+		t.Fatalf("Parse failed: %s", err)
+	}
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want []ccllint.Diagnostic
+	}{{
+		desc: "Valid",
+		msg: `
+			name: "web"
+			mode: "fast"
+			ports: 80
+			ports: [443, 8080]
+			ratio: 1
+			acme: true
+			pool { min: 1 max: 0xa }
+			labels { app: "web" "k8s.io/name": "web" }
+		`,
+	}, {
+		desc: "FieldProblems",
+		msg: `
+			mode: "slow"
+			ratio: [1.5]
+			ports: [1.5, 5%]
+			unknown: 1
+			acme: true
+			acme: false
+			labels { a: 1 }
+		`,
+		want: []ccllint.Diagnostic{
+			{Path: "mode", Rule: "enum", Message: `"slow" is not one of "fast", "safe"`},
+			{Path: "ratio", Rule: "type", Message: "expecting a single float, got a list"},
+			{Path: "ports", Rule: "type", Message: "expecting int, got 1.5"},
+			{Path: "ports", Rule: "type", Message: "expecting int, got 5%"},
+			{Path: "unknown", Rule: "unknown-key", Message: `unknown key "unknown"`},
+			{Path: "acme", Rule: "duplicate", Message: `key "acme" is set more than once`},
+			{Path: "labels.a", Rule: "type", Message: "expecting string, got 1"},
+			{Path: "name", Rule: "required", Message: `required key "name" is missing`},
+		},
+	}, {
+		desc: "Compare",
+		msg: `
+			name: "web"
+			acme: true
+			pool { max: 1 min: 2 }
+			pool { min: 2 max: 0x200 }
+		`,
+		want: []ccllint.Diagnostic{
+			{Path: "pool.max", Rule: "constraint", Message: "max >= min doesn't hold: max is 1 and min is 2"},
+			{Path: "pool", Rule: "duplicate", Message: `key "pool" is set more than once`},
+			{Path: "pool.max", Rule: "constraint", Message: "max <= 0x100 doesn't hold: max is 0x200"},
+		},
+	}, {
+		desc: "ExactlyOneOfNone",
+		msg:  `name: "web"`,
+		want: []ccllint.Diagnostic{
+			{Rule: "constraint", Message: "exactly one of tls_cert, acme must be set"},
+		},
+	}, {
+		desc: "ExactlyOneOfBoth",
+		msg: `
+			name: "web"
+			acme: true
+			tls_cert: "cert.pem"
+		`,
+		want: []ccllint.Diagnostic{
+			{Path: "tls_cert", Rule: "constraint", Message: "exactly one of tls_cert, acme must be set"},
+		},
+	}, {
+		desc: "Ignored",
+		msg: `
+			name: "web"
+			acme: true
+			# ccl:ignore constraint -- the cert is used for client auth
+			tls_cert: "cert.pem"
+			# ccl:ignore unknown-key
+			legacy { anything: 1 }
+			pool { max: 1 min: 2 } # ccl:ignore constraint
+		`,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			n, err := ccl.Parse([]byte(tc.msg))
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %s", tc.msg, err)
+			}
+			if diff := cmp.Diff(tc.want, s.Validate(n)); diff != "" {
+				t.Errorf("Validate(%q) returned unexpected diff (-want +got):\n%s", tc.msg, diff)
+			}
+		})
+	}
+}
+
+func TestParse_InvalidRule(t *testing.T) {
+	t.Parallel()
+
+	const fields = `field { name: "a" type: "int" } field { name: "s" type: "string" } field { name: "l" type: "int" repeated: true }`
+	for _, tc := range []struct {
+		desc string
+		rule string
+		want string
+	}{
+		{"Empty", `rule {}`, "rule should have exactly one of compare, exactly_one_of, at_most_one_of, and at_least_one_of"},
+		{"Two", `rule { compare: "a > 1" at_most_one_of: ["a", "s"] }`, "rule should have exactly one of compare, exactly_one_of, at_most_one_of, and at_least_one_of"},
+		{"BadCompare", `rule { compare: "a>1" }`, `compare "a>1" should have the form "a <op> b"`},
+		{"UnknownField", `rule { compare: "a > b" }`, `compare "a > b" refers to unknown field "b"`},
+		{"NotNumber", `rule { compare: "s > 1" }`, `compare "s > 1": field "s" isn't a number`},
+		{"Repeated", `rule { compare: "l == 1" }`, `compare "l == 1": field "l" isn't a single scalar`},
+		{"BadNumber", `rule { compare: "a > 1x" }`, `compare "a > 1x": invalid number "1x"`},
+		{"Octal", `rule { compare: "a > 010" }`, `compare "a > 010": invalid number "010"`},
+		{"Underscore", `rule { compare: "a > 1_000" }`, `compare "a > 1_000": invalid number "1_000"`},
+		{"OneName", `rule { at_least_one_of: ["a"] }`, "rule should list at least two fields"},
+		{"UnknownName", `rule { exactly_one_of: ["a", "b"] }`, `rule refers to unknown field "b"`},
+		{"UnknownKey", `rule { when: "a" }`, `unknown rule key "when"`},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			msg := fields + tc.rule
+			_, err := Parse([]byte(msg))
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded, want error %q", msg, tc.want)
+			}
+			if got := err.Error(); got != tc.want {
+				t.Errorf("Parse(%q) returned error %q, want %q", msg, got, tc.want)
+			}
+		})
+	}
+}
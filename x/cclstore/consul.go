@@ -0,0 +1,65 @@
+package cclstore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Consul is a document stored under a key in Consul's key/value store. Its
+// version is the key's modify index, and Fetch waits for a change with a
+// blocking query.
+type Consul struct {
+	// Address is the URL of the Consul agent, such as
+	// "http://localhost:8500".
+	Address string
+	Key     string
+	// Header holds extra headers to send, such as X-Consul-Token.
+	Header http.Header
+	// Client sends the requests. It defaults to http.DefaultClient.
+	Client *http.Client
+	// Wait is the longest that Consul waits for a change before answering
+	// a blocking query. It defaults to 5m.
+	Wait time.Duration
+}
+
+func (c *Consul) Fetch(ctx context.Context, version string) ([]byte, string, error) {
+	u, err := url.Parse(strings.TrimSuffix(c.Address, "/") + "/v1/kv/" + strings.TrimPrefix(c.Key, "/"))
+	if err != nil {
+		return nil, "", err
+	}
+	q := url.Values{"raw": {""}}
+	if version != "" {
+		wait := c.Wait
+		if wait == 0 {
+			wait = 5 * time.Minute
+		}
+		q.Set("index", version)
+		q.Set("wait", fmt.Sprintf("%ds", int(wait.Seconds())))
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := do(c.Client, req, c.Header, c, http.StatusOK)
+	if err != nil {
+		return nil, "", err
+	}
+	index := resp.Header.Get("X-Consul-Index")
+	data, err := readBody(resp)
+	if err != nil {
+		return nil, "", err
+	}
+	if index == "" {
+		return nil, "", fmt.Errorf("fetching %s: no X-Consul-Index in the response", c)
+	}
+	return data, index, nil
+}
+
+func (c *Consul) String() string {
+	return "consul:" + c.Key
+}
@@ -0,0 +1,65 @@
+package cclstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConsul(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/kv/app/config" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		q := r.URL.Query()
+		if !q.Has("raw") || r.Header.Get("X-Consul-Token") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// The document changes once, at index 8.
+		switch q.Get("index") {
+		case "":
+			w.Header().Set("X-Consul-Index", "7")
+			w.Write([]byte("workers: 4\n"))
+		case "7":
+			if q.Get("wait") != "300s" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("X-Consul-Index", "8")
+			w.Write([]byte("workers: 8\n"))
+		default:
+			w.Header().Set("X-Consul-Index", "8")
+			w.Write([]byte("workers: 8\n"))
+		}
+	}))
+	defer srv.Close()
+
+	c := &Consul{Address: srv.URL + "/", Key: "app/config", Header: http.Header{"X-Consul-Token": {"secret"}}}
+	for _, tc := range []struct {
+		version     string
+		want        string
+		wantVersion string
+	}{
+		{"", "workers: 4\n", "7"},
+		{"7", "workers: 8\n", "8"},
+		{"8", "workers: 8\n", "8"},
+	} {
+		data, version, err := c.Fetch(context.Background(), tc.version)
+		if err != nil {
+			t.Fatalf("Fetch(%q) failed: %s", tc.version, err)
+		}
+		if string(data) != tc.want || version != tc.wantVersion {
+			t.Errorf("Fetch(%q) returned %q, %q, want %q, %q", tc.version, data, version, tc.want, tc.wantVersion)
+		}
+	}
+
+	missing := &Consul{Address: srv.URL, Key: "other"}
+	if _, _, err := missing.Fetch(context.Background(), ""); err == nil || err.Error() != "consul:other doesn't exist" {
+		t.Errorf("Fetch returned error %v, want %q", err, "consul:other doesn't exist")
+	}
+}
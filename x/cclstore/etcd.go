@@ -0,0 +1,114 @@
+package cclstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Etcd is a document stored under a key in etcd, which is read through etcd's
+// JSON gateway to its v3 API. Its version is the key's modification
+// revision, and Fetch waits for a change by watching the key.
+type Etcd struct {
+	// Endpoint is the URL of an etcd server, such as
+	// "http://localhost:2379".
+	Endpoint string
+	Key      string
+	// Header holds extra headers to send, such as Authorization.
+	Header http.Header
+	// Client sends the requests. It defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// etcdKV is a key and value in an etcd response. Bytes are base64-encoded, and
+// 64-bit integers are strings.
+type etcdKV struct {
+	Value       []byte `json:"value"`
+	ModRevision string `json:"mod_revision"`
+}
+
+func (e *Etcd) Fetch(ctx context.Context, version string) ([]byte, string, error) {
+	if version != "" {
+		if err := e.watch(ctx, version); err != nil {
+			return nil, "", err
+		}
+	}
+	var resp struct {
+		Kvs []etcdKV `json:"kvs"`
+	}
+	if err := e.post(ctx, "/v3/kv/range", map[string]any{"key": []byte(e.Key)}, func(d *json.Decoder) error {
+		return d.Decode(&resp)
+	}); err != nil {
+		return nil, "", err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, "", fmt.Errorf("%s doesn't exist", e)
+	}
+	return resp.Kvs[0].Value, resp.Kvs[0].ModRevision, nil
+}
+
+// watch waits until the key is changed or deleted after the given revision.
+func (e *Etcd) watch(ctx context.Context, revision string) error {
+	rev, err := strconv.ParseInt(revision, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid etcd revision %q", revision)
+	}
+	req := map[string]any{"create_request": map[string]any{
+		"key":            []byte(e.Key),
+		"start_revision": strconv.FormatInt(rev+1, 10),
+	}}
+	// The watch streams a response when it's created, followed by one for
+	// each batch of events.
+	return e.post(ctx, "/v3/watch", req, func(d *json.Decoder) error {
+		for {
+			var resp struct {
+				Result struct {
+					Events   []json.RawMessage `json:"events"`
+					Canceled bool              `json:"canceled"`
+				} `json:"result"`
+				Error *struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := d.Decode(&resp); err != nil {
+				return fmt.Errorf("watching %s: %w", e, err)
+			}
+			if resp.Error != nil {
+				return fmt.Errorf("watching %s: %s", e, resp.Error.Message)
+			}
+			// A watch is canceled if the revision has been compacted, in
+			// which case the key may have changed.
+			if len(resp.Result.Events) > 0 || resp.Result.Canceled {
+				return nil
+			}
+		}
+	})
+}
+
+// post sends req as JSON to the given path, and calls decode to read the
+// response.
+func (e *Etcd) post(ctx context.Context, path string, req any, decode func(*json.Decoder) error) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(e.Endpoint, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	resp, err := do(e.Client, r, e.Header, e, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decode(json.NewDecoder(resp.Body))
+}
+
+func (e *Etcd) String() string {
+	return "etcd:" + e.Key
+}
@@ -0,0 +1,75 @@
+package cclstore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEtcd(t *testing.T) {
+	t.Parallel()
+
+	// The key is written at revision 5 and changed at revision 9.
+	changed := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Key           []byte `json:"key"`
+			CreateRequest struct {
+				Key           []byte `json:"key"`
+				StartRevision string `json:"start_revision"`
+			} `json:"create_request"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/v3/kv/range":
+			if string(req.Key) != "app/config" {
+				w.Write([]byte(`{"header": {"revision": "9"}}`))
+				return
+			}
+			select {
+			case <-changed:
+				w.Write([]byte(`{"kvs": [{"value": "d29ya2VyczogOAo=", "mod_revision": "9"}]}`))
+			default:
+				w.Write([]byte(`{"kvs": [{"value": "d29ya2VyczogNAo=", "mod_revision": "5"}]}`))
+			}
+		case "/v3/watch":
+			if string(req.CreateRequest.Key) != "app/config" || req.CreateRequest.StartRevision != "6" {
+				http.Error(w, "bad watch", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"result": {"created": true}}` + "\n"))
+			w.(http.Flusher).Flush()
+			close(changed)
+			w.Write([]byte(`{"result": {"events": [{"kv": {"mod_revision": "9"}}]}}` + "\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	e := &Etcd{Endpoint: srv.URL, Key: "app/config"}
+	data, version, err := e.Fetch(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Fetch failed: %s", err)
+	}
+	if string(data) != "workers: 4\n" || version != "5" {
+		t.Errorf("Fetch returned %q, %q, want %q, %q", data, version, "workers: 4\n", "5")
+	}
+	data, version, err = e.Fetch(context.Background(), version)
+	if err != nil {
+		t.Fatalf("Fetch failed: %s", err)
+	}
+	if string(data) != "workers: 8\n" || version != "9" {
+		t.Errorf("Fetch returned %q, %q, want %q, %q", data, version, "workers: 8\n", "9")
+	}
+
+	missing := &Etcd{Endpoint: srv.URL, Key: "other"}
+	if _, _, err := missing.Fetch(context.Background(), ""); err == nil || err.Error() != "etcd:other doesn't exist" {
+		t.Errorf("Fetch returned error %v, want %q", err, "etcd:other doesn't exist")
+	}
+}
@@ -0,0 +1,66 @@
+package cclstore
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTP is a document served at a URL. Its version is the ETag that the server
+// sends, if any, or else a hash of the document. Since HTTP can't wait for a
+// change, HTTP checks for one every Interval.
+type HTTP struct {
+	URL string
+	// Header holds extra headers to send, such as Authorization.
+	Header http.Header
+	// Client sends the requests. It defaults to http.DefaultClient.
+	Client *http.Client
+	// Interval is how often to check for changes. It defaults to 30s.
+	Interval time.Duration
+}
+
+func (h *HTTP) Fetch(ctx context.Context, version string) ([]byte, string, error) {
+	if version != "" {
+		interval := h.Interval
+		if interval == 0 {
+			interval = 30 * time.Second
+		}
+		if err := sleep(ctx, interval); err != nil {
+			return nil, "", err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if isETag(version) {
+		req.Header.Set("If-None-Match", version)
+	}
+	resp, err := do(h.Client, req, h.Header, h, http.StatusOK, http.StatusNotModified)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, version, nil
+	}
+	data, err := readBody(resp)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag := resp.Header.Get("ETag"); isETag(etag) {
+		return data, etag, nil
+	}
+	return data, hash(data), nil
+}
+
+// isETag reports whether a version is an ETag, which is quoted, rather than a
+// hash.
+func isETag(version string) bool {
+	return strings.HasPrefix(version, `"`) || strings.HasPrefix(version, `W/"`)
+}
+
+func (h *HTTP) String() string {
+	return h.URL
+}
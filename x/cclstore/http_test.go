@@ -0,0 +1,75 @@
+package cclstore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTP(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		etag string
+	}{
+		{desc: "ETag", etag: `"v1"`},
+		{desc: "NoETag"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer token" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				if tc.etag != "" {
+					if r.Header.Get("If-None-Match") == tc.etag {
+						w.WriteHeader(http.StatusNotModified)
+						return
+					}
+					w.Header().Set("ETag", tc.etag)
+				}
+				w.Write([]byte("workers: 4\n"))
+			}))
+			defer srv.Close()
+
+			h := &HTTP{URL: srv.URL, Header: http.Header{"Authorization": {"Bearer token"}}, Interval: time.Millisecond}
+			data, version, err := h.Fetch(context.Background(), "")
+			if err != nil {
+				t.Fatalf("Fetch failed: %s", err)
+			}
+			if string(data) != "workers: 4\n" {
+				t.Errorf("Fetch returned %q, want %q", data, "workers: 4\n")
+			}
+			if tc.etag != "" && version != tc.etag {
+				t.Errorf("Fetch returned version %q, want %q", version, tc.etag)
+			}
+			_, again, err := h.Fetch(context.Background(), version)
+			if err != nil {
+				t.Fatalf("Fetch failed: %s", err)
+			}
+			if again != version {
+				t.Errorf("Fetch of an unchanged document returned version %q, want %q", again, version)
+			}
+		})
+	}
+}
+
+func TestHTTP_Error(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	h := &HTTP{URL: srv.URL}
+	want := "fetching " + srv.URL + ": 403 Forbidden"
+	if _, _, err := h.Fetch(context.Background(), ""); err == nil || err.Error() != want {
+		t.Errorf("Fetch returned error %v, want %q", err, want)
+	}
+}
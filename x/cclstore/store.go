@@ -0,0 +1,172 @@
+// Package cclstore loads ccl configs from where they're stored, such as a web
+// server or a key in etcd or Consul, and keeps them up to date as they
+// change, so that ccl can be used for configs that are managed centrally:
+//
+//	l := &cclstore.Loader[Config]{
+//	    Store: &cclstore.Consul{Address: "http://localhost:8500", Key: "app/config"},
+//	    Validate: (*Config).Check,
+//	}
+//	err := l.Watch(ctx, func(cfg *Config, err error) {
+//	    if err != nil {
+//	        log.Printf("keeping the old config: %s", err)
+//	        return
+//	    }
+//	    apply(cfg)
+//	})
+//
+// A [Store] only has to fetch a document, so other kinds of storage can be
+// added by implementing it.
+package cclstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"roseh.moe/pkg/ccl"
+)
+
+// A Store holds a ccl document.
+type Store interface {
+	// Fetch returns the document and its version, an opaque string that
+	// changes whenever the document does. If version isn't empty, it's the
+	// version returned by an earlier call, and Fetch waits for the
+	// document to change before returning, for as long as the store
+	// supports; it returns the same version if the document hasn't
+	// changed.
+	Fetch(ctx context.Context, version string) (data []byte, newVersion string, err error)
+	// String names the document in errors, like a file name.
+	String() string
+}
+
+// A Loader fetches a config from a Store and unmarshals it into a T, which
+// must be a struct type.
+type Loader[T any] struct {
+	Store Store
+	// Defaults, if set, is a document that's unmarshaled before the one in
+	// the store, so that the stored document only has to set the fields
+	// that differ from it.
+	Defaults []byte
+	// Options configures how the documents are unmarshaled and merged.
+	Options ccl.MergeOptions
+	// Validate, if set, checks each config after it's unmarshaled. A config
+	// that it returns an error for is rejected.
+	Validate func(*T) error
+	// RetryInterval is how long Watch waits before fetching the document
+	// again after an error. It defaults to 5s.
+	RetryInterval time.Duration
+}
+
+// Load fetches the config and returns it.
+func (l *Loader[T]) Load(ctx context.Context) (*T, error) {
+	data, _, err := l.Store.Fetch(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return l.decode(data)
+}
+
+// Watch calls update with the config, and then again each time it changes,
+// until ctx is done, when it returns ctx.Err(). If the config can't be
+// fetched, or a new version of it doesn't parse or validate, update is called
+// with the error instead, and the previous config should be kept. Calls to
+// update aren't concurrent.
+func (l *Loader[T]) Watch(ctx context.Context, update func(cfg *T, err error)) error {
+	retry := l.RetryInterval
+	if retry == 0 {
+		retry = 5 * time.Second
+	}
+	version := ""
+	for {
+		data, v, err := l.Store.Fetch(ctx, version)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			update(nil, err)
+			if err := sleep(ctx, retry); err != nil {
+				return err
+			}
+			continue
+		}
+		if version != "" && v == version {
+			continue
+		}
+		version = v
+		update(l.decode(data))
+	}
+}
+
+func (l *Loader[T]) decode(data []byte) (*T, error) {
+	var layers []ccl.Layer
+	if l.Defaults != nil {
+		layers = append(layers, ccl.Layer{Name: "defaults", Data: l.Defaults})
+	}
+	layers = append(layers, ccl.Layer{Name: l.Store.String(), Data: data})
+	v := new(T)
+	if err := l.Options.Merge(v, layers...); err != nil {
+		return nil, err
+	}
+	if l.Validate != nil {
+		if err := l.Validate(v); err != nil {
+			return nil, fmt.Errorf("%s: %w", l.Store, err)
+		}
+	}
+	return v, nil
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// do sends req with the extra headers and returns the response if its status
+// is one of ok. The caller closes its body.
+func do(client *http.Client, req *http.Request, header http.Header, s Store, ok ...int) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s doesn't exist", s)
+	}
+	return nil, fmt.Errorf("fetching %s: %s", s, resp.Status)
+}
+
+// readBody reads and closes the body of resp, stopping with a
+// [ccl.TooLargeError] if it's larger than a document can be.
+func readBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, ccl.MaxSize+1))
+	if err == nil && len(data) > ccl.MaxSize {
+		return nil, &ccl.TooLargeError{Size: int64(len(data))}
+	}
+	return data, err
+}
+
+// hash returns a version for data that doesn't come with one.
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,140 @@
+package cclstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type config struct {
+	Listen  string `ccl:"listen"`
+	Workers int    `ccl:"workers"`
+}
+
+func (c *config) check() error {
+	if c.Workers < 0 {
+		return fmt.Errorf("workers should be positive")
+	}
+	return nil
+}
+
+// fakeStore returns its versions in turn, and then waits until ctx is done.
+type fakeStore struct {
+	versions []fakeVersion
+}
+
+type fakeVersion struct {
+	data string
+	err  error
+}
+
+func (s *fakeStore) Fetch(ctx context.Context, version string) ([]byte, string, error) {
+	if len(s.versions) == 0 {
+		<-ctx.Done()
+		return nil, "", ctx.Err()
+	}
+	v := s.versions[0]
+	s.versions = s.versions[1:]
+	return []byte(v.data), fmt.Sprint(len(s.versions)), v.err
+}
+
+func (s *fakeStore) String() string {
+	return "fake"
+}
+
+func TestLoader_Load(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc     string
+		defaults string
+		data     string
+		want     *config
+		wantErr  string
+	}{{
+		desc: "Simple",
+		data: `listen: ":80"`,
+		want: &config{Listen: ":80"},
+	}, {
+		desc:     "Defaults",
+		defaults: "listen: \":80\"\nworkers: 4\n",
+		data:     "workers: 8",
+		want:     &config{Listen: ":80", Workers: 8},
+	}, {
+		desc:    "SyntaxError",
+		data:    "listen: ",
+		wantErr: "fake:1:9 syntax error: premature EOF",
+	}, {
+		desc:    "Invalid",
+		data:    "workers: -1",
+		wantErr: "fake: workers should be positive",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			l := &Loader[config]{
+				Store:    &fakeStore{versions: []fakeVersion{{data: tc.data}}},
+				Validate: (*config).check,
+			}
+			if tc.defaults != "" {
+				l.Defaults = []byte(tc.defaults)
+			}
+			got, err := l.Load(context.Background())
+			if err != nil {
+				if err.Error() != tc.wantErr {
+					t.Errorf("Load returned error %q, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if tc.wantErr != "" {
+				t.Fatalf("Load succeeded, want error %q", tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Load returned unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLoader_Watch(t *testing.T) {
+	t.Parallel()
+
+	l := &Loader[config]{
+		Store: &fakeStore{versions: []fakeVersion{
+			{data: "workers: 1"},
+			{err: errors.New("connection refused")},
+			{data: "workers: -1"},
+			{data: "workers: 2"},
+		}},
+		Validate:      (*config).check,
+		RetryInterval: time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var got []string
+	err := l.Watch(ctx, func(cfg *config, err error) {
+		if err != nil {
+			got = append(got, "error: "+err.Error())
+		} else {
+			got = append(got, fmt.Sprint("workers ", cfg.Workers))
+		}
+		if len(got) == 4 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Watch returned %v, want %v", err, context.Canceled)
+	}
+	want := []string{
+		"workers 1",
+		"error: connection refused",
+		"error: fake: workers should be positive",
+		"workers 2",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Watch returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,136 @@
+package cclwkt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A CronSpec is a schedule written in cron syntax, such as "*/15 * * * *" or
+// "0 30 2 * * mon-fri". It has five fields, for the minute, hour, day of
+// month, month, and day of week, or six fields with the second first. Each
+// field is a comma-separated list of values, ranges such as "1-5", or "*",
+// each optionally followed by a step such as "/15". Months and days of the
+// week can also be written with their three-letter English names, and
+// Sunday is either 0 or 7. The shorthands @yearly, @annually, @monthly,
+// @weekly, @daily, @midnight, and @hourly are also accepted.
+//
+// The spec is only validated; it's kept as written for the scheduler that
+// runs it.
+type CronSpec struct {
+	spec string
+}
+
+// String returns the spec as it was written.
+func (c CronSpec) String() string {
+	return c.spec
+}
+
+func (c CronSpec) MarshalText() ([]byte, error) {
+	return []byte(c.spec), nil
+}
+
+func (c *CronSpec) UnmarshalText(text []byte) error {
+	if err := checkCron(string(text)); err != nil {
+		return fmt.Errorf("invalid cron spec %q: %s", text, err)
+	}
+	c.spec = string(text)
+	return nil
+}
+
+var cronShorthands = []string{"@yearly", "@annually", "@monthly", "@weekly", "@daily", "@midnight", "@hourly"}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // names[i] is the value min+i
+}
+
+var (
+	cronSecond = cronField{name: "second", min: 0, max: 59}
+	cronFields = []cronField{
+		{name: "minute", min: 0, max: 59},
+		{name: "hour", min: 0, max: 23},
+		{name: "day of month", min: 1, max: 31},
+		{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+		{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+	}
+)
+
+func checkCron(spec string) error {
+	if strings.HasPrefix(spec, "@") {
+		for _, s := range cronShorthands {
+			if spec == s {
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown shorthand, want one of %s", strings.Join(cronShorthands, ", "))
+	}
+	values := strings.Fields(spec)
+	fields := cronFields
+	switch len(values) {
+	case 5:
+	case 6:
+		fields = append([]cronField{cronSecond}, cronFields...)
+	default:
+		return fmt.Errorf("got %d fields, want 5 or 6", len(values))
+	}
+	for i, v := range values {
+		if err := fields[i].check(v); err != nil {
+			return fmt.Errorf("%s field %q: %s", fields[i].name, v, err)
+		}
+	}
+	return nil
+}
+
+// check validates one field of a spec.
+func (f cronField) check(s string) error {
+	for item := range strings.SplitSeq(s, ",") {
+		rng, step, hasStep := strings.Cut(item, "/")
+		if hasStep {
+			n, err := strconv.Atoi(step)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("step %q should be a positive number", step)
+			}
+		}
+		if rng == "*" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(rng, "-")
+		a, err := f.value(lo)
+		if err != nil {
+			return err
+		}
+		if !isRange {
+			continue
+		}
+		b, err := f.value(hi)
+		if err != nil {
+			return err
+		}
+		if a > b {
+			return fmt.Errorf("range %s is backwards", rng)
+		}
+	}
+	return nil
+}
+
+// value parses a single number or name.
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || s[0] == '+' || s[0] == '-' {
+		if s == "" {
+			return 0, fmt.Errorf("missing value")
+		}
+		return 0, fmt.Errorf("%q isn't a number", s)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("%d is out of range %d-%d", n, f.min, f.max)
+	}
+	return n, nil
+}
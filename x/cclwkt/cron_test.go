@@ -0,0 +1,24 @@
+package cclwkt
+
+import "testing"
+
+func TestCronSpec(t *testing.T) {
+	t.Parallel()
+
+	for _, spec := range []string{
+		"* * * * *",
+		"*/15 9-17 * * 1-5",
+		"0 0 1,15 * *",
+		"30 2 * jan,Jul sun",
+		"0 0 * * 7",
+		"0 0-30/10 * * * *",
+		"@daily",
+	} {
+		var c CronSpec
+		if err := c.UnmarshalText([]byte(spec)); err != nil {
+			t.Errorf("UnmarshalText(%q) failed: %s", spec, err)
+		} else if got := c.String(); got != spec {
+			t.Errorf("UnmarshalText(%q).String() = %q", spec, got)
+		}
+	}
+}
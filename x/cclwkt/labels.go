@@ -0,0 +1,126 @@
+package cclwkt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Labels are Kubernetes-style labels, written as a message of strings:
+//
+//	labels {
+//	    app: "web"
+//	    "app.kubernetes.io/version": "1.4.2"
+//	}
+//
+// The keys and values are checked against the rules that Kubernetes applies
+// to labels, so a bad label is caught when the config is loaded rather than
+// when it's sent to the API server. A key is a name of at most 63
+// characters, optionally preceded by a DNS subdomain prefix and a slash. A
+// value is empty or a name of at most 63 characters. Names start and end
+// with a letter or digit, and may contain '-', '_', and '.' in between.
+//
+// A Labels can also be used as a selector with [Labels.Matches].
+type Labels map[LabelKey]LabelValue
+
+// A LabelKey is a key of [Labels].
+type LabelKey string
+
+// A LabelValue is a value of [Labels].
+type LabelValue string
+
+// Map returns the labels as a map of strings, for use with APIs that expect
+// one.
+func (l Labels) Map() map[string]string {
+	if l == nil {
+		return nil
+	}
+	m := make(map[string]string, len(l))
+	for k, v := range l {
+		m[string(k)] = string(v)
+	}
+	return m
+}
+
+// Matches reports whether every label in l is also in labels with the same
+// value, which is how an equality-based label selector is matched. Empty
+// Labels match everything.
+func (l Labels) Matches(labels map[string]string) bool {
+	for k, v := range l {
+		if got, ok := labels[string(k)]; !ok || got != string(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (k *LabelKey) UnmarshalText(text []byte) error {
+	prefix, name, hasPrefix := strings.Cut(string(text), "/")
+	if !hasPrefix {
+		prefix, name = "", prefix
+	}
+	if hasPrefix {
+		if err := checkSubdomain(prefix); err != nil {
+			return fmt.Errorf("invalid label key %q: prefix %s", text, err)
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("invalid label key %q: name is empty", text)
+	}
+	if err := checkLabelName(name); err != nil {
+		return fmt.Errorf("invalid label key %q: name %s", text, err)
+	}
+	*k = LabelKey(text)
+	return nil
+}
+
+func (v *LabelValue) UnmarshalText(text []byte) error {
+	if len(text) > 0 {
+		if err := checkLabelName(string(text)); err != nil {
+			return fmt.Errorf("invalid label value %q: %s", text, err)
+		}
+	}
+	*v = LabelValue(text)
+	return nil
+}
+
+func isAlnum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// checkLabelName checks the name part of a label key, or a label value.
+func checkLabelName(s string) error {
+	if len(s) > 63 {
+		return fmt.Errorf("is longer than 63 characters")
+	}
+	if !isAlnum(s[0]) || !isAlnum(s[len(s)-1]) {
+		return fmt.Errorf("should start and end with a letter or digit")
+	}
+	for i := range len(s) {
+		if c := s[i]; !isAlnum(c) && c != '-' && c != '_' && c != '.' {
+			return fmt.Errorf("has invalid character %q", c)
+		}
+	}
+	return nil
+}
+
+// checkSubdomain checks the prefix of a label key, which is a lower case DNS
+// subdomain.
+func checkSubdomain(s string) error {
+	if s == "" {
+		return fmt.Errorf("is empty")
+	}
+	if len(s) > 253 {
+		return fmt.Errorf("is longer than 253 characters")
+	}
+	for part := range strings.SplitSeq(s, ".") {
+		if part == "" || part[0] == '-' || part[len(part)-1] == '-' {
+			return fmt.Errorf("%q isn't a valid DNS subdomain", s)
+		}
+		for i := range len(part) {
+			if c := part[i]; !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-') {
+				return fmt.Errorf("%q isn't a valid DNS subdomain", s)
+			}
+		}
+	}
+	return nil
+}
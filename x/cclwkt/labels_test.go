@@ -0,0 +1,97 @@
+package cclwkt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"roseh.moe/pkg/ccl"
+)
+
+func TestLabels(t *testing.T) {
+	t.Parallel()
+
+	var c struct {
+		Labels Labels `ccl:"labels"`
+	}
+	msg := `labels { app: "web" "app.kubernetes.io/version": "1.4.2" empty: "" }`
+	if err := ccl.Unmarshal([]byte(msg), &c); err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %s", msg, err)
+	}
+	want := map[string]string{"app": "web", "app.kubernetes.io/version": "1.4.2", "empty": ""}
+	if diff := cmp.Diff(want, c.Labels.Map()); diff != "" {
+		t.Errorf("Unmarshal(%q) returned unexpected diff (-want +got):\n%s", msg, diff)
+	}
+	got, err := ccl.Marshal(c)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	wantText := `labels {
+    app: "web"
+    "app.kubernetes.io/version": "1.4.2"
+    empty: ""
+}
+`
+	if diff := cmp.Diff(wantText, string(got)); diff != "" {
+		t.Errorf("Marshal returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestLabels_Invalid(t *testing.T) {
+	t.Parallel()
+
+	long := "a"
+	for range 63 {
+		long += "b"
+	}
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want string
+	}{
+		{"KeyChar", `labels { "a b": "x" }`, `invalid label key "a b": name has invalid character ' '`},
+		{"KeyStart", `labels { _a: "x" }`, `invalid label key "_a": name should start and end with a letter or digit`},
+		{"KeyEmptyName", `labels { "example.com/": "x" }`, `invalid label key "example.com/": name is empty`},
+		{"KeyPrefix", `labels { "Example.com/a": "x" }`, `invalid label key "Example.com/a": prefix "Example.com" isn't a valid DNS subdomain`},
+		{"KeyEmptyPrefix", `labels { "/a": "x" }`, `invalid label key "/a": prefix is empty`},
+		{"KeyLong", `labels { ` + long + `: "x" }`, `invalid label key "` + long + `": name is longer than 63 characters`},
+		{"Value", `labels { a: "-x" }`, `invalid label value "-x": should start and end with a letter or digit`},
+		{"ValueChar", `labels { a: "x/y" }`, `invalid label value "x/y": has invalid character '/'`},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var c struct {
+				Labels Labels `ccl:"labels"`
+			}
+			err := ccl.Unmarshal([]byte(tc.msg), &c)
+			if err == nil {
+				t.Fatalf("Unmarshal(%q) succeeded, want error %q", tc.msg, tc.want)
+			}
+			if got := errors.Unwrap(err).Error(); got != tc.want {
+				t.Errorf("Unmarshal(%q) returned error %q, want %q", tc.msg, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLabels_Matches(t *testing.T) {
+	t.Parallel()
+
+	selector := Labels{"app": "web", "tier": "frontend"}
+	for _, tc := range []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{map[string]string{"app": "web", "tier": "frontend", "version": "2"}, true},
+		{map[string]string{"app": "web"}, false},
+		{map[string]string{"app": "web", "tier": "backend"}, false},
+	} {
+		if got := selector.Matches(tc.labels); got != tc.want {
+			t.Errorf("Matches(%v) = %t, want %t", tc.labels, got, tc.want)
+		}
+	}
+	if !(Labels{}).Matches(nil) {
+		t.Errorf("empty Labels don't match nil")
+	}
+}
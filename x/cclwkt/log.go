@@ -0,0 +1,99 @@
+package cclwkt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+)
+
+// A LogConfig holds the settings of a [slog.Handler], written as a message:
+//
+//	log {
+//	    level: "debug"
+//	    format: "json"
+//	    output: "/var/log/app.log"
+//	    sampling: 10%
+//	}
+//
+// Its Handler method returns the handler.
+type LogConfig struct {
+	// Level is the minimum level of records that are logged, written as
+	// its name, such as "debug" or "warn", optionally followed by an
+	// offset, as in "info+2". It defaults to "info".
+	Level slog.Level `ccl:"level"`
+	// Format is "text" for [slog.TextHandler], which is the default, or
+	// "json" for [slog.JSONHandler].
+	Format string `ccl:"format"`
+	// Output is the file that logs are appended to, or "stderr", which is
+	// the default, or "stdout".
+	Output string `ccl:"output"`
+	// Sampling is the fraction of records below the warning level that are
+	// logged, chosen at random. Warnings and errors are always logged. If
+	// it's not set, every record is logged.
+	Sampling *Percent `ccl:"sampling"`
+	// AddSource adds the source file and line of the log call to each
+	// record.
+	AddSource bool `ccl:"add_source"`
+}
+
+// Handler returns a handler for c, opening its output file if it has one.
+// The close function closes the file; it does nothing for stderr and
+// stdout.
+func (c *LogConfig) Handler() (h slog.Handler, close func() error, err error) {
+	if c.Sampling != nil && (*c.Sampling < 0 || *c.Sampling > 1) {
+		return nil, nil, fmt.Errorf("sampling %s should be from 0%% to 100%%", *c.Sampling)
+	}
+	var newHandler func(io.Writer, *slog.HandlerOptions) slog.Handler
+	switch c.Format {
+	case "", "text":
+		newHandler = func(w io.Writer, opts *slog.HandlerOptions) slog.Handler { return slog.NewTextHandler(w, opts) }
+	case "json":
+		newHandler = func(w io.Writer, opts *slog.HandlerOptions) slog.Handler { return slog.NewJSONHandler(w, opts) }
+	default:
+		return nil, nil, fmt.Errorf("invalid log format %q, want \"text\" or \"json\"", c.Format)
+	}
+	var w io.Writer
+	close = func() error { return nil }
+	switch c.Output {
+	case "", "stderr":
+		w = os.Stderr
+	case "stdout":
+		w = os.Stdout
+	default:
+		f, err := os.OpenFile(c.Output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, nil, err
+		}
+		w, close = f, f.Close
+	}
+	h = newHandler(w, &slog.HandlerOptions{Level: c.Level, AddSource: c.AddSource})
+	if c.Sampling != nil && *c.Sampling < 1 {
+		h = &samplingHandler{h, float64(*c.Sampling)}
+	}
+	return h, close, nil
+}
+
+// A samplingHandler passes on the given fraction of the records below
+// slog.LevelWarn to its handler.
+type samplingHandler struct {
+	slog.Handler
+	rate float64
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn && rand.Float64() >= h.rate {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{h.Handler.WithAttrs(attrs), h.rate}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{h.Handler.WithGroup(name), h.rate}
+}
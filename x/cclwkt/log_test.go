@@ -0,0 +1,138 @@
+package cclwkt
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"roseh.moe/pkg/ccl"
+)
+
+func TestLogConfig_Unmarshal(t *testing.T) {
+	t.Parallel()
+
+	msg := `log {
+    level: "debug"
+    format: "json"
+    output: "/var/log/app.log"
+    sampling: 10%
+    add_source: true
+}`
+	var got struct {
+		Log LogConfig `ccl:"log"`
+	}
+	if err := ccl.Unmarshal([]byte(msg), &got); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	want := LogConfig{
+		Level:     slog.LevelDebug,
+		Format:    "json",
+		Output:    "/var/log/app.log",
+		Sampling:  ptr(Percent(.1)),
+		AddSource: true,
+	}
+	if diff := cmp.Diff(want, got.Log); diff != "" {
+		t.Errorf("Unmarshal returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestLogConfig_Handler(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want []string
+	}{{
+		desc: "Default",
+		msg:  ``,
+		want: []string{"level=INFO msg=info", "level=WARN msg=warn"},
+	}, {
+		desc: "Debug",
+		msg:  `level: "debug"`,
+		want: []string{"level=DEBUG msg=debug", "level=INFO msg=info", "level=WARN msg=warn"},
+	}, {
+		desc: "LevelOffset",
+		msg:  `level: "info+2"`,
+		want: []string{"level=WARN msg=warn"},
+	}, {
+		desc: "JSON",
+		msg:  `format: "json"`,
+		want: []string{`"level":"INFO","msg":"info"}`, `"level":"WARN","msg":"warn"}`},
+	}, {
+		desc: "SampleNone",
+		msg:  `level: "debug"  sampling: "0%"`,
+		want: []string{"level=WARN msg=warn"},
+	}, {
+		desc: "SampleAll",
+		msg:  `sampling: "100%"`,
+		want: []string{"level=INFO msg=info", "level=WARN msg=warn"},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var c LogConfig
+			if err := ccl.Unmarshal([]byte(tc.msg), &c); err != nil {
+				t.Fatalf("Unmarshal failed: %s", err)
+			}
+			c.Output = filepath.Join(t.TempDir(), "log")
+			h, closeLog, err := c.Handler()
+			if err != nil {
+				t.Fatalf("Handler failed: %s", err)
+			}
+			logger := slog.New(h)
+			logger.Debug("debug")
+			logger.Info("info")
+			logger.Warn("warn")
+			if err := closeLog(); err != nil {
+				t.Fatalf("closing the log failed: %s", err)
+			}
+			data, err := os.ReadFile(c.Output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+			if len(lines) != len(tc.want) {
+				t.Fatalf("Handler logged %q, want lines ending with %q", lines, tc.want)
+			}
+			for i, line := range lines {
+				if !strings.HasSuffix(line, tc.want[i]) {
+					t.Errorf("line %d = %q, want it to end with %q", i, line, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLogConfig_HandlerError(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc   string
+		config LogConfig
+		want   string
+	}{{
+		desc:   "Format",
+		config: LogConfig{Format: "logfmt"},
+		want:   `invalid log format "logfmt"`,
+	}, {
+		desc:   "Sampling",
+		config: LogConfig{Sampling: ptr(Percent(1.5))},
+		want:   "sampling 150% should be from 0% to 100%",
+	}, {
+		desc:   "Output",
+		config: LogConfig{Output: "/nonexistent/app.log"},
+		want:   "no such file",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if _, _, err := tc.config.Handler(); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Handler() returned error %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package cclwkt
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"regexp/syntax"
+)
+
+// A Regexp is a regular expression in the syntax of the [regexp] package,
+// compiled when it's decoded so that a bad pattern is reported along with
+// the rest of the config's errors. Like regexp.Regexp, it matches anywhere in
+// the input unless it's anchored with ^ and $. The zero value has a nil
+// Regexp.
+type Regexp struct {
+	*regexp.Regexp
+}
+
+func (r Regexp) String() string {
+	if r.Regexp == nil {
+		return ""
+	}
+	return r.Regexp.String()
+}
+
+func (r Regexp) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Regexp) UnmarshalText(text []byte) error {
+	re, err := regexp.Compile(string(text))
+	if err != nil {
+		var syntaxErr *syntax.Error
+		if errors.As(err, &syntaxErr) {
+			return fmt.Errorf("invalid regexp %q: %s: %q", text, syntaxErr.Code, syntaxErr.Expr)
+		}
+		return fmt.Errorf("invalid regexp %q: %s", text, err)
+	}
+	r.Regexp = re
+	return nil
+}
+
+// A Glob is a shell-style pattern in the syntax of [path.Match], such as
+// "*.log" or "/var/lib/[a-z]*". The pattern is checked when it's decoded, so
+// Match never fails.
+type Glob struct {
+	pattern string
+}
+
+// Match reports whether name matches the pattern. As with path.Match, a *
+// doesn't match a slash.
+func (g Glob) Match(name string) bool {
+	ok, _ := path.Match(g.pattern, name)
+	return ok
+}
+
+func (g Glob) String() string {
+	return g.pattern
+}
+
+func (g Glob) MarshalText() ([]byte, error) {
+	return []byte(g.pattern), nil
+}
+
+func (g *Glob) UnmarshalText(text []byte) error {
+	// Match checks the whole pattern even if name doesn't match.
+	if _, err := path.Match(string(text), ""); err != nil {
+		return fmt.Errorf("invalid glob %q: %s", text, err)
+	}
+	g.pattern = string(text)
+	return nil
+}
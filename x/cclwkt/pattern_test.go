@@ -0,0 +1,49 @@
+package cclwkt
+
+import (
+	"testing"
+
+	"roseh.moe/pkg/ccl"
+)
+
+func TestPatterns(t *testing.T) {
+	t.Parallel()
+
+	var c struct {
+		Hosts   Regexp `ccl:"hosts"`
+		Logs    Glob   `ccl:"logs"`
+		Missing Regexp `ccl:"missing"`
+	}
+	msg := `hosts: '^(www|api)\\.example\\.com$' logs: '/var/log/*.log'`
+	if err := ccl.Unmarshal([]byte(msg), &c); err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %s", msg, err)
+	}
+	for _, tc := range []struct {
+		name string
+		got  bool
+		want bool
+	}{
+		{"www.example.com", c.Hosts.MatchString("www.example.com"), true},
+		{"mail.example.com", c.Hosts.MatchString("mail.example.com"), false},
+		{"/var/log/app.log", c.Logs.Match("/var/log/app.log"), true},
+		{"/var/log/app/1.log", c.Logs.Match("/var/log/app/1.log"), false},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("match %q = %t, want %t", tc.name, tc.got, tc.want)
+		}
+	}
+	if c.Missing.Regexp != nil {
+		t.Errorf("Missing.Regexp = %v, want nil", c.Missing.Regexp)
+	}
+
+	got, err := ccl.Marshal(c)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	want := `hosts: "^(www|api)\\.example\\.com$"
+logs: "/var/log/*.log"
+`
+	if string(got) != want {
+		t.Errorf("Marshal returned %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,148 @@
+package cclwkt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// A TLSConfig holds the settings of a TLS client or server, written as a
+// message:
+//
+//	tls {
+//	    cert_file: "/etc/certs/server.pem"
+//	    key_file: "/etc/certs/server.key"
+//	    ca_file: "/etc/certs/ca.pem"
+//	    min_version: "1.3"
+//	}
+//
+// Its Build method loads the files and returns the [tls.Config].
+type TLSConfig struct {
+	// CertFile and KeyFile are the PEM-encoded certificate chain and
+	// private key presented to the other side. They must be set together.
+	CertFile string `ccl:"cert_file"`
+	KeyFile  string `ccl:"key_file"`
+	// CAFile holds the PEM-encoded certificates used to verify the other
+	// side, instead of the system's roots.
+	CAFile string `ccl:"ca_file"`
+	// ServerName is the name that a client expects in the server's
+	// certificate, if it's not the host name that was dialed.
+	ServerName string `ccl:"server_name"`
+	// RequireClientCert makes a server require and verify client
+	// certificates.
+	RequireClientCert bool `ccl:"require_client_cert"`
+	// MinVersion is the oldest version of TLS that's allowed. It defaults
+	// to TLS 1.2.
+	MinVersion TLSVersion `ccl:"min_version"`
+	// CipherSuites are the names of the cipher suites allowed for TLS 1.2
+	// and older, such as "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", as
+	// returned by [tls.CipherSuiteName]. If it's empty, Go's defaults are
+	// used. The cipher suites of TLS 1.3 can't be configured.
+	CipherSuites []string `ccl:"cipher_suites"`
+}
+
+// Build returns the tls.Config for c, loading the certificates that it
+// names. The CA certificates are used to verify both servers and clients.
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: c.ServerName,
+		MinVersion: uint16(c.MinVersion),
+	}
+	if c.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("cert_file and key_file must be set together")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+		config.RootCAs, config.ClientCAs = pool, pool
+	}
+	if c.RequireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	for _, name := range c.CipherSuites {
+		id, err := cipherSuite(name)
+		if err != nil {
+			return nil, err
+		}
+		config.CipherSuites = append(config.CipherSuites, id)
+	}
+	return config, nil
+}
+
+// cipherSuite returns the ID of the cipher suite with the given name.
+func cipherSuite(name string) (uint16, error) {
+	for _, s := range tls.CipherSuites() {
+		if s.Name != name {
+			continue
+		}
+		if !slices.ContainsFunc(s.SupportedVersions, func(v uint16) bool { return v < tls.VersionTLS13 }) {
+			return 0, fmt.Errorf("cipher suite %s is only used by TLS 1.3, whose cipher suites can't be configured", name)
+		}
+		return s.ID, nil
+	}
+	for _, s := range tls.InsecureCipherSuites() {
+		if s.Name == name {
+			return 0, fmt.Errorf("cipher suite %s is insecure", name)
+		}
+	}
+	return 0, fmt.Errorf("unknown cipher suite %q", name)
+}
+
+// A TLSVersion is a version of TLS written as a string: "1.0", "1.1", "1.2",
+// or "1.3". Its value is the version's constant in crypto/tls, such as
+// [tls.VersionTLS13].
+type TLSVersion uint16
+
+var tlsVersions = []struct {
+	name    string
+	version TLSVersion
+}{
+	{"1.0", tls.VersionTLS10},
+	{"1.1", tls.VersionTLS11},
+	{"1.2", tls.VersionTLS12},
+	{"1.3", tls.VersionTLS13},
+}
+
+func (v TLSVersion) String() string {
+	for _, tv := range tlsVersions {
+		if tv.version == v {
+			return tv.name
+		}
+	}
+	return fmt.Sprintf("0x%04x", uint16(v))
+}
+
+func (v TLSVersion) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+func (v *TLSVersion) UnmarshalText(text []byte) error {
+	s := strings.TrimPrefix(strings.TrimPrefix(string(text), "TLS"), " ")
+	for _, tv := range tlsVersions {
+		if s == tv.name {
+			*v = tv.version
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid TLS version %q, want one of \"1.0\", \"1.1\", \"1.2\", or \"1.3\"", text)
+}
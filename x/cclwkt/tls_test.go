@@ -0,0 +1,198 @@
+package cclwkt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"roseh.moe/pkg/ccl"
+)
+
+// writeCert writes a self-signed certificate and its key to dir, as cert.pem
+// and key.pem.
+func writeCert(t *testing.T, dir string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, block := range map[string]*pem.Block{
+		"cert.pem": {Type: "CERTIFICATE", Bytes: der},
+		"key.pem":  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTLSConfig_Build(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeCert(t, dir)
+	msg := `tls {
+    cert_file: "` + dir + `/cert.pem"
+    key_file: "` + dir + `/key.pem"
+    ca_file: "` + dir + `/cert.pem"
+    server_name: "localhost"
+    require_client_cert: true
+    min_version: "1.3"
+    cipher_suites: ["TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"]
+}`
+	var c struct {
+		TLS TLSConfig `ccl:"tls"`
+	}
+	if err := ccl.Unmarshal([]byte(msg), &c); err != nil {
+		t.Fatalf("Unmarshal failed: %s", err)
+	}
+	got, err := c.TLS.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %s", err)
+	}
+	if len(got.Certificates) != 1 {
+		t.Errorf("Build returned %d certificates, want 1", len(got.Certificates))
+	}
+	if got.RootCAs == nil || got.ClientCAs == nil {
+		t.Errorf("Build returned RootCAs %v and ClientCAs %v, want both set", got.RootCAs, got.ClientCAs)
+	}
+	if got.ServerName != "localhost" {
+		t.Errorf("Build returned ServerName %q, want %q", got.ServerName, "localhost")
+	}
+	if got.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("Build returned ClientAuth %s, want %s", got.ClientAuth, tls.RequireAndVerifyClientCert)
+	}
+	if got.MinVersion != tls.VersionTLS13 {
+		t.Errorf("Build returned MinVersion %s, want %s", tls.VersionName(got.MinVersion), tls.VersionName(tls.VersionTLS13))
+	}
+	wantSuites := []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}
+	if diff := cmp.Diff(wantSuites, got.CipherSuites); diff != "" {
+		t.Errorf("Build returned unexpected CipherSuites diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestTLSConfig_BuildDefaults(t *testing.T) {
+	t.Parallel()
+
+	got, err := (&TLSConfig{}).Build()
+	if err != nil {
+		t.Fatalf("Build failed: %s", err)
+	}
+	if got.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Build returned MinVersion %s, want %s", tls.VersionName(got.MinVersion), tls.VersionName(tls.VersionTLS12))
+	}
+	if got.Certificates != nil || got.RootCAs != nil || got.CipherSuites != nil || got.ClientAuth != tls.NoClientCert {
+		t.Errorf("Build() = %+v, want only MinVersion set", got)
+	}
+}
+
+func TestTLSConfig_BuildError(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeCert(t, dir)
+	for _, tc := range []struct {
+		desc   string
+		config TLSConfig
+		want   string
+	}{{
+		desc:   "CertWithoutKey",
+		config: TLSConfig{CertFile: dir + "/cert.pem"},
+		want:   "cert_file and key_file must be set together",
+	}, {
+		desc:   "MissingCert",
+		config: TLSConfig{CertFile: dir + "/missing.pem", KeyFile: dir + "/key.pem"},
+		want:   "no such file",
+	}, {
+		desc:   "MissingCA",
+		config: TLSConfig{CAFile: dir + "/missing.pem"},
+		want:   "no such file",
+	}, {
+		desc:   "CAWithoutCerts",
+		config: TLSConfig{CAFile: dir + "/key.pem"},
+		want:   "no certificates found in",
+	}, {
+		desc:   "UnknownCipherSuite",
+		config: TLSConfig{CipherSuites: []string{"TLS_FAST"}},
+		want:   `unknown cipher suite "TLS_FAST"`,
+	}, {
+		desc:   "InsecureCipherSuite",
+		config: TLSConfig{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		want:   "cipher suite TLS_RSA_WITH_RC4_128_SHA is insecure",
+	}, {
+		desc:   "TLS13CipherSuite",
+		config: TLSConfig{CipherSuites: []string{"TLS_AES_128_GCM_SHA256"}},
+		want:   "only used by TLS 1.3",
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := tc.config.Build(); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Build() returned error %v, want one containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestTLSVersion(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		text string
+		want TLSVersion
+	}{
+		{"1.0", tls.VersionTLS10},
+		{"1.1", tls.VersionTLS11},
+		{"1.2", tls.VersionTLS12},
+		{"1.3", tls.VersionTLS13},
+		{"TLS 1.3", tls.VersionTLS13},
+		{"TLS1.2", tls.VersionTLS12},
+	} {
+		var got TLSVersion
+		if err := got.UnmarshalText([]byte(tc.text)); err != nil {
+			t.Errorf("UnmarshalText(%q) failed: %s", tc.text, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("UnmarshalText(%q) = %s, want %s", tc.text, got, tc.want)
+		}
+	}
+	for _, text := range []string{"", "1", "1.4", "SSL 3.0"} {
+		var v TLSVersion
+		if err := v.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("UnmarshalText(%q) = %s, want error", text, v)
+		}
+	}
+	if got, err := TLSVersion(tls.VersionTLS13).MarshalText(); err != nil || string(got) != "1.3" {
+		t.Errorf("MarshalText() = %q, %v, want %q", got, err, "1.3")
+	}
+}
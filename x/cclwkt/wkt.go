@@ -0,0 +1,439 @@
+// Package cclwkt provides well-known types for values that are common in
+// configs but don't have a natural ccl representation, such as durations and
+// sizes. Most of the types implement [encoding.TextUnmarshaler] and
+// [encoding.TextMarshaler], so they're written as strings in ccl documents:
+//
+//	type Config struct {
+//	    Timeout  cclwkt.Duration  `ccl:"timeout"`   // timeout: "1.5s"
+//	    MaxBody  cclwkt.ByteSize  `ccl:"max_body"`  // max_body: "10MiB"
+//	    Start    cclwkt.Timestamp `ccl:"start"`     // start: "2025-10-28"
+//	    Zone     cclwkt.Location  `ccl:"zone"`      // zone: "Europe/Paris"
+//	    Sampling cclwkt.Percent   `ccl:"sampling"`  // sampling: 2.5%
+//	    Accent   cclwkt.Color     `ccl:"accent"`    // accent: "#1e90ff"
+//	    Listen   cclwkt.HostPort  `ccl:"listen"`    // listen: "[::1]:8080"
+//	    Allow    cclwkt.CIDRList  `ccl:"allow"`     // allow: ["10.0.0.0/8"]
+//	    Backup   cclwkt.CronSpec  `ccl:"backup"`    // backup: "0 3 * * *"
+//	    Hosts    cclwkt.Regexp    `ccl:"hosts"`     // hosts: "^api\\."
+//	    Logs     cclwkt.Glob      `ccl:"logs"`      // logs: "*.log"
+//	    Debug    cclwkt.Tristate  `ccl:"debug"`     // debug: false
+//	    Labels   cclwkt.Labels    `ccl:"labels"`    // labels { app: "web" }
+//	    TLS      cclwkt.TLSConfig `ccl:"tls"`       // tls { ca_file: "ca.pem" }
+//	    Log      cclwkt.LogConfig `ccl:"log"`       // log { level: "debug" }
+//	}
+//
+// Errors from decoding these types are reported by [ccl.Unmarshal] with the
+// position and path of the field, and can be unwrapped with [errors.Unwrap].
+package cclwkt
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Duration is a [time.Duration] written as a string in the format accepted
+// by [time.ParseDuration], for example "300ms" or "1h30m". A number without
+// a unit, such as timeout: 30, is an error rather than a count of
+// nanoseconds, since it's almost always a mistake.
+type Duration time.Duration
+
+// Std returns d as a time.Duration.
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		if _, numErr := strconv.ParseFloat(string(text), 64); numErr == nil {
+			return fmt.Errorf("duration %q has no unit, such as \"s\" or \"ms\"", text)
+		}
+		return fmt.Errorf("invalid duration %q, want a number with a unit, such as \"1.5s\" or \"1h30m\"", text)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// A ByteSize is a number of bytes written with an optional unit, for
+// example "512", "64KB", or "1.5GiB". The units B, KB, MB, GB, TB, and PB are
+// powers of 1000, and KiB, MiB, GiB, TiB, and PiB are powers of 1024. Units
+// aren't case-sensitive, and there may be a space before the unit. A size
+// may be negative, as in "-1KiB", so that every ByteSize can be marshaled and
+// unmarshaled again.
+type ByteSize int64
+
+var byteUnits = []struct {
+	name string
+	size int64
+}{
+	{"PiB", 1 << 50},
+	{"TiB", 1 << 40},
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"PB", 1e15},
+	{"TB", 1e12},
+	{"GB", 1e9},
+	{"MB", 1e6},
+	{"KB", 1e3},
+	{"B", 1},
+}
+
+// String returns the size using the largest unit that represents it exactly.
+func (s ByteSize) String() string {
+	best := byteUnits[len(byteUnits)-1]
+	for _, u := range byteUnits {
+		if s != 0 && s%ByteSize(u.size) == 0 && u.size > best.size {
+			best = u
+		}
+	}
+	return strconv.FormatInt(int64(s)/best.size, 10) + best.name
+}
+
+func (s ByteSize) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *ByteSize) UnmarshalText(text []byte) error {
+	str := string(text)
+	sign := int64(1)
+	if rest, ok := strings.CutPrefix(str, "-"); ok {
+		str, sign = rest, -1
+	} else {
+		str = strings.TrimPrefix(str, "+")
+	}
+	i := strings.IndexFunc(str, func(r rune) bool { return !('0' <= r && r <= '9' || r == '.') })
+	if i < 0 {
+		i = len(str)
+	}
+	num, unit := str[:i], strings.TrimPrefix(str[i:], " ")
+	size := int64(1)
+	if unit != "" {
+		size = 0
+		for _, u := range byteUnits {
+			if strings.EqualFold(unit, u.name) {
+				size = u.size
+			}
+		}
+		if size == 0 {
+			return fmt.Errorf("invalid size %q: unknown unit %q, want one of B, KB, KiB, MB, MiB, GB, GiB, TB, TiB, PB, or PiB", text, unit)
+		}
+	}
+	if n, err := strconv.ParseInt(num, 10, 64); err == nil {
+		if n > math.MaxInt64/size {
+			return fmt.Errorf("size %q is too large", text)
+		}
+		*s = ByteSize(sign * n * size)
+		return nil
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return fmt.Errorf("invalid size %q, want a number with an optional unit, such as \"64KiB\"", text)
+	}
+	bytes := f * float64(size)
+	if bytes >= math.MaxInt64 {
+		return fmt.Errorf("size %q is too large", text)
+	}
+	if bytes != math.Trunc(bytes) {
+		return fmt.Errorf("size %q isn't a whole number of bytes", text)
+	}
+	*s = ByteSize(sign * int64(bytes))
+	return nil
+}
+
+// A Timestamp is a [time.Time] written in RFC 3339 format, such as
+// "2025-10-28T07:41:47Z". A date on its own, such as "2025-10-28", is
+// midnight UTC.
+type Timestamp struct {
+	time.Time
+}
+
+func (t Timestamp) MarshalText() ([]byte, error) {
+	return t.Time.MarshalText()
+}
+
+func (t *Timestamp) UnmarshalText(text []byte) error {
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		if parsed, err := time.Parse(layout, string(text)); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid timestamp %q, want RFC 3339 such as \"2006-01-02T15:04:05Z\" or a date such as \"2006-01-02\"", text)
+}
+
+// A Location is a time zone written as its name in the IANA Time Zone
+// Database, such as "America/New_York", or as "UTC" or "Local". The zero
+// Location is UTC. Names are looked up with [time.LoadLocation] when the
+// config is decoded, so a misspelled zone is caught then. Programs that run
+// where the database might not be installed can import [time/tzdata] to
+// embed a copy of it.
+type Location struct {
+	*time.Location
+}
+
+func (l Location) MarshalText() ([]byte, error) {
+	return []byte(l.Location.String()), nil
+}
+
+// loadLocation is time.LoadLocation, and can be replaced by tests.
+var loadLocation = time.LoadLocation
+
+func (l *Location) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		return errors.New("time zone is empty, want a name such as \"America/New_York\" or \"UTC\"")
+	}
+	loc, err := loadLocation(string(text))
+	if err != nil {
+		// LoadLocation reports a missing database as an unknown zone,
+		// so check for one that's always there.
+		if _, utcErr := loadLocation("Etc/UTC"); utcErr != nil {
+			return fmt.Errorf("can't load time zone %q: the time zone database isn't installed; import time/tzdata to embed it in the program", text)
+		}
+		return fmt.Errorf("unknown time zone %q, want a name such as \"America/New_York\"", text)
+	}
+	l.Location = loc
+	return nil
+}
+
+// A Percent is a fraction written as a percentage, for example 2.5% or
+// "2.5%" for 0.025. A number without a percent sign is an error, since
+// sampling: 2.5 could mean either 2.5% or 250%.
+type Percent float64
+
+// String returns the shortest percentage that's decoded as exactly p.
+func (p Percent) String() string {
+	// Multiplying by 100 adds rounding errors, as in 7.000000000000001%
+	// for 0.07, so the decimal point is moved in the digits of p instead.
+	mant, exp, _ := strings.Cut(strconv.FormatFloat(float64(p), 'e', -1, 64), "e")
+	e, _ := strconv.Atoi(exp)
+	exact := mant + "e" + strconv.Itoa(e+2) + "%"
+	if f, err := strconv.ParseFloat(mant+"e"+strconv.Itoa(e+2), 64); err == nil {
+		lit := strconv.FormatFloat(f, 'f', -1, 64) + "%"
+		var q Percent
+		if len(lit) <= len(exact) && q.UnmarshalText([]byte(lit)) == nil && q == p {
+			return lit
+		}
+	}
+	return exact
+}
+
+func (p Percent) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Percent) UnmarshalText(text []byte) error {
+	num, ok := strings.CutSuffix(string(text), "%")
+	if !ok {
+		return fmt.Errorf("percentage %q should end with %%", text)
+	}
+	num = strings.TrimSpace(num)
+	invalid := fmt.Errorf("invalid percentage %q, want a number followed by %%, such as \"2.5%%\"", text)
+	if num == "" || strings.IndexFunc(num, func(r rune) bool { return !strings.ContainsRune("0123456789.+-eE", r) }) >= 0 {
+		return invalid
+	}
+	// Dividing by 100 adds rounding errors, as in 0.006999999999999999 for
+	// 0.7%, so the exponent is moved instead.
+	exp := 0
+	if i := strings.IndexAny(num, "eE"); i >= 0 {
+		var err error
+		if exp, err = strconv.Atoi(num[i+1:]); err != nil {
+			return invalid
+		}
+		num = num[:i]
+	}
+	f, err := strconv.ParseFloat(num+"e"+strconv.Itoa(exp-2), 64)
+	if err != nil || math.IsInf(f, 0) {
+		return invalid
+	}
+	*p = Percent(f)
+	return nil
+}
+
+// A Color is an sRGB color written in hex as "#rrggbb", or "#rrggbbaa" with an
+// alpha channel, for example "#1e90ff" or "#00000080". Without an alpha
+// channel the color is opaque. Color implements [color.Color], so it can be
+// used with the image packages.
+type Color struct {
+	color.NRGBA
+}
+
+// String returns the color in lower case hex, leaving out the alpha channel
+// if the color is opaque.
+func (c Color) String() string {
+	b := []byte{c.R, c.G, c.B}
+	if c.A != 0xff {
+		b = append(b, c.A)
+	}
+	return "#" + hex.EncodeToString(b)
+}
+
+func (c Color) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Color) UnmarshalText(text []byte) error {
+	digits, ok := strings.CutPrefix(string(text), "#")
+	b, err := hex.DecodeString(digits)
+	if !ok || err != nil || len(b) != 3 && len(b) != 4 {
+		return fmt.Errorf("invalid color %q, want \"#rrggbb\" or \"#rrggbbaa\" in hex", text)
+	}
+	if len(b) == 3 {
+		b = append(b, 0xff)
+	}
+	c.NRGBA = color.NRGBA{b[0], b[1], b[2], b[3]}
+	return nil
+}
+
+// A HostPort is a network address written as "host:port", such as
+// "example.com:443", "10.0.0.1:53", or "[::1]:8080". The host may be empty, as
+// in ":80", which usually means all interfaces. An IPv6 host must be written
+// in brackets. The port must be a number; service names such as "http"
+// aren't allowed.
+type HostPort struct {
+	Host string
+	Port uint16
+}
+
+// String returns the address in a form that can be passed to [net.Dial].
+func (hp HostPort) String() string {
+	return net.JoinHostPort(hp.Host, strconv.Itoa(int(hp.Port)))
+}
+
+func (hp HostPort) MarshalText() ([]byte, error) {
+	return []byte(hp.String()), nil
+}
+
+func (hp *HostPort) UnmarshalText(text []byte) error {
+	host, port, err := net.SplitHostPort(string(text))
+	if err != nil {
+		var addrErr *net.AddrError
+		if errors.As(err, &addrErr) {
+			err = errors.New(addrErr.Err)
+		}
+		return fmt.Errorf("invalid host:port %q: %s", text, err)
+	}
+	if strings.HasPrefix(string(text), "[") {
+		if addr, err := netip.ParseAddr(host); err != nil || !addr.Is6() {
+			return fmt.Errorf("invalid host:port %q: bad IPv6 address %q", text, host)
+		}
+	}
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid host:port %q: port %q should be a number from 0 to 65535", text, port)
+	}
+	*hp = HostPort{host, uint16(n)}
+	return nil
+}
+
+// A CIDR is an IP network written in CIDR notation, such as "10.0.0.0/8" or
+// "2001:db8::/32". Unlike [netip.Prefix], the address can't have bits set
+// after the prefix, so "10.1.2.3/8" is an error rather than a silent
+// synonym for "10.0.0.0/8".
+type CIDR struct {
+	netip.Prefix
+}
+
+func (c *CIDR) UnmarshalText(text []byte) error {
+	prefix, err := netip.ParsePrefix(string(text))
+	if err != nil {
+		if _, addrErr := netip.ParseAddr(string(text)); addrErr == nil {
+			return fmt.Errorf("invalid CIDR %q: missing prefix length, such as /24", text)
+		}
+		return fmt.Errorf("invalid CIDR %q, want an address and prefix length such as \"10.0.0.0/8\"", text)
+	}
+	if masked := prefix.Masked(); masked != prefix {
+		return fmt.Errorf("invalid CIDR %q: address has bits set after the prefix, did you mean %q?", text, masked)
+	}
+	c.Prefix = prefix
+	return nil
+}
+
+// A CIDRList is a list of networks, such as an allow list. It's written as a
+// list of strings.
+type CIDRList []CIDR
+
+// Contains reports whether addr is in any of the networks.
+func (l CIDRList) Contains(addr netip.Addr) bool {
+	for _, c := range l {
+		if c.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// A Tristate is a bool that also remembers whether it was set at all, so
+// that a field that's explicitly false can be told apart from one that isn't
+// mentioned, for example when merging an overlay onto a base config. It's
+// written as a bool literal, such as debug: false, or as the strings "true"
+// and "false". Numbers aren't accepted. The zero value is Unset.
+type Tristate string
+
+const (
+	Unset Tristate = ""
+	False Tristate = "false"
+	True  Tristate = "true"
+)
+
+// Bool returns the value of t, or def if t is Unset.
+func (t Tristate) Bool(def bool) bool {
+	if t == Unset {
+		return def
+	}
+	return t == True
+}
+
+// IsSet reports whether t is True or False.
+func (t Tristate) IsSet() bool {
+	return t != Unset
+}
+
+func (t Tristate) String() string {
+	switch t {
+	case Unset:
+		return "unset"
+	case False:
+		return "false"
+	case True:
+		return "true"
+	default:
+		return fmt.Sprintf("Tristate(%q)", string(t))
+	}
+}
+
+// MarshalText returns "true" or "false". An Unset value can't be marshaled,
+// but [ccl.Marshal] leaves it out since it's the zero value.
+func (t Tristate) MarshalText() ([]byte, error) {
+	if t != False && t != True {
+		return nil, fmt.Errorf("can't marshal %v Tristate", t)
+	}
+	return []byte(t.String()), nil
+}
+
+func (t *Tristate) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "true":
+		*t = True
+	case "false":
+		*t = False
+	default:
+		return fmt.Errorf("invalid tristate %q, want true or false", text)
+	}
+	return nil
+}
@@ -0,0 +1,398 @@
+package cclwkt
+
+import (
+	"errors"
+	"image/color"
+	"math"
+	"net/netip"
+	"testing"
+	"time"
+	_ "time/tzdata" // so that the tests don't depend on the system's database
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"roseh.moe/pkg/ccl"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+type config struct {
+	Timeout  Duration  `ccl:"timeout"`
+	MaxBody  ByteSize  `ccl:"max_body"`
+	Start    Timestamp `ccl:"start"`
+	Sampling Percent   `ccl:"sampling"`
+	Accent   Color     `ccl:"accent"`
+	Overlay  Color     `ccl:"overlay"`
+	Listen   HostPort  `ccl:"listen"`
+	Allow    CIDRList  `ccl:"allow"`
+	Schedule CronSpec  `ccl:"schedule"`
+	Hosts    Regexp    `ccl:"hosts"`
+	Logs     Glob      `ccl:"logs"`
+	Debug    Tristate  `ccl:"debug"`
+	Verbose  *Tristate `ccl:"verbose"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want config
+	}{{
+		desc: "Strings",
+		msg: `
+			timeout: "1m30s"
+			max_body: "1.5 KiB"
+			start: "2025-10-28T07:41:47Z"
+			sampling: "2.5%"
+			accent: "#1E90ff"
+			overlay: "#00000080"
+			listen: "[::1]:8080"
+			allow: ["10.0.0.0/8", "2001:db8::/32"]
+			debug: "true"
+		`,
+		want: config{
+			Timeout:  Duration(90 * time.Second),
+			MaxBody:  1536,
+			Start:    Timestamp{time.Date(2025, 10, 28, 7, 41, 47, 0, time.UTC)},
+			Sampling: 0.025,
+			Accent:   Color{color.NRGBA{0x1e, 0x90, 0xff, 0xff}},
+			Overlay:  Color{color.NRGBA{0, 0, 0, 0x80}},
+			Listen:   HostPort{"::1", 8080},
+			Allow: CIDRList{
+				{netip.MustParsePrefix("10.0.0.0/8")},
+				{netip.MustParsePrefix("2001:db8::/32")},
+			},
+			Debug: True,
+		},
+	}, {
+		desc: "Numbers",
+		msg:  `max_body: 512 sampling: 2.5%`,
+		want: config{MaxBody: 512, Sampling: 0.025},
+	}, {
+		desc: "EmptyHost",
+		msg:  `listen: ":80" allow: "192.168.1.1/32"`,
+		want: config{Listen: HostPort{"", 80}, Allow: CIDRList{{netip.MustParsePrefix("192.168.1.1/32")}}},
+	}, {
+		desc: "Bools",
+		msg:  `debug: false verbose: true`,
+		want: config{Debug: False, Verbose: ptr(True)},
+	}, {
+		desc: "Date",
+		msg:  `start: "2025-10-28" max_body: "10mb"`,
+		want: config{Start: Timestamp{time.Date(2025, 10, 28, 0, 0, 0, 0, time.UTC)}, MaxBody: 10e6},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var got config
+			if err := ccl.Unmarshal([]byte(tc.msg), &got); err != nil {
+				t.Fatalf("Unmarshal(%q) failed: %s", tc.msg, err)
+			}
+			if diff := cmp.Diff(tc.want, got, cmpopts.EquateComparable(netip.Prefix{}, CronSpec{}, Glob{})); diff != "" {
+				t.Errorf("Unmarshal(%q) returned unexpected diff (-want +got):\n%s", tc.msg, diff)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want string
+	}{
+		{"DurationNoUnit", `timeout: "10"`, `duration "10" has no unit, such as "s" or "ms"`},
+		{"DurationNumber", `timeout: 30`, `duration "30" has no unit, such as "s" or "ms"`},
+		{"Duration", `timeout: "10 seconds"`, `invalid duration "10 seconds", want a number with a unit, such as "1.5s" or "1h30m"`},
+		{"SizeUnit", `max_body: "10XB"`, `invalid size "10XB": unknown unit "XB", want one of B, KB, KiB, MB, MiB, GB, GiB, TB, TiB, PB, or PiB`},
+		{"SizeNumber", `max_body: "1.2.3MB"`, `invalid size "1.2.3MB", want a number with an optional unit, such as "64KiB"`},
+		{"SizeTooLarge", `max_body: "9000000PiB"`, `size "9000000PiB" is too large`},
+		{"SizeFraction", `max_body: "1.5B"`, `size "1.5B" isn't a whole number of bytes`},
+		{"Timestamp", `start: "yesterday"`, `invalid timestamp "yesterday", want RFC 3339 such as "2006-01-02T15:04:05Z" or a date such as "2006-01-02"`},
+		{"PercentSign", `sampling: "2.5"`, `percentage "2.5" should end with %`},
+		{"PercentNumber", `sampling: 2.5`, `percentage "2.5" should end with %`},
+		{"Percent", `sampling: "lots%"`, `invalid percentage "lots%", want a number followed by %, such as "2.5%"`},
+		{"ColorHash", `accent: "1e90ff"`, `invalid color "1e90ff", want "#rrggbb" or "#rrggbbaa" in hex`},
+		{"ColorShort", `accent: "#fff"`, `invalid color "#fff", want "#rrggbb" or "#rrggbbaa" in hex`},
+		{"HostPortNoPort", `listen: "example.com"`, `invalid host:port "example.com": missing port in address`},
+		{"HostPortIPv6", `listen: "::1:80"`, `invalid host:port "::1:80": too many colons in address`},
+		{"HostPortBadIPv6", `listen: "[1.2.3]:80"`, `invalid host:port "[1.2.3]:80": bad IPv6 address "1.2.3"`},
+		{"HostPortService", `listen: "localhost:http"`, `invalid host:port "localhost:http": port "http" should be a number from 0 to 65535`},
+		{"HostPortRange", `listen: "localhost:65536"`, `invalid host:port "localhost:65536": port "65536" should be a number from 0 to 65535`},
+		{"CIDRHostBits", `allow: ["10.1.2.3/8"]`, `invalid CIDR "10.1.2.3/8": address has bits set after the prefix, did you mean "10.0.0.0/8"?`},
+		{"CIDRNoPrefix", `allow: ["10.0.0.1"]`, `invalid CIDR "10.0.0.1": missing prefix length, such as /24`},
+		{"CIDR", `allow: ["10.0.0.0/33"]`, `invalid CIDR "10.0.0.0/33", want an address and prefix length such as "10.0.0.0/8"`},
+		{"CronFields", `schedule: "* * *"`, `invalid cron spec "* * *": got 3 fields, want 5 or 6`},
+		{"CronRange", `schedule: "0 24 * * *"`, `invalid cron spec "0 24 * * *": hour field "24": 24 is out of range 0-23`},
+		{"CronName", `schedule: "0 0 * foo *"`, `invalid cron spec "0 0 * foo *": month field "foo": "foo" isn't a number`},
+		{"CronStep", `schedule: "*/0 * * * *"`, `invalid cron spec "*/0 * * * *": minute field "*/0": step "0" should be a positive number`},
+		{"CronBackwards", `schedule: "0 0 * * fri-mon"`, `invalid cron spec "0 0 * * fri-mon": day of week field "fri-mon": range fri-mon is backwards`},
+		{"CronShorthand", `schedule: "@often"`, `invalid cron spec "@often": unknown shorthand, want one of @yearly, @annually, @monthly, @weekly, @daily, @midnight, @hourly`},
+		{"Regexp", `hosts: "(www|api"`, `invalid regexp "(www|api": missing closing ): "(www|api"`},
+		{"RegexpRepeat", `hosts: "a**"`, `invalid regexp "a**": invalid nested repetition operator: "**"`},
+		{"Glob", `logs: "*.[ch"`, `invalid glob "*.[ch": syntax error in pattern`},
+		{"Tristate", `debug: "yes"`, `invalid tristate "yes", want true or false`},
+		{"ColorDigits", `accent: "#1e90fg"`, `invalid color "#1e90fg", want "#rrggbb" or "#rrggbbaa" in hex`},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var c config
+			err := ccl.Unmarshal([]byte(tc.msg), &c)
+			if err == nil {
+				t.Fatalf("Unmarshal(%q) succeeded, want error %q", tc.msg, tc.want)
+			}
+			if got := errors.Unwrap(err).Error(); got != tc.want {
+				t.Errorf("Unmarshal(%q) returned error %q, want %q", tc.msg, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	t.Parallel()
+
+	c := config{
+		Timeout:  Duration(1500 * time.Millisecond),
+		MaxBody:  3 << 20,
+		Start:    Timestamp{time.Date(2025, 10, 28, 7, 41, 47, 0, time.UTC)},
+		Sampling: 0.07,
+		Accent:   Color{color.NRGBA{0x1e, 0x90, 0xff, 0xff}},
+		Overlay:  Color{color.NRGBA{0xff, 0xff, 0xff, 0x0c}},
+		Listen:   HostPort{"2001:db8::1", 443},
+		Allow:    CIDRList{{netip.MustParsePrefix("10.0.0.0/8")}},
+		Debug:    False,
+	}
+	if err := c.Schedule.UnmarshalText([]byte("0 */6 * * MON-FRI")); err != nil {
+		t.Fatalf("UnmarshalText failed: %s", err)
+	}
+	got, err := ccl.Marshal(c)
+	if err != nil {
+		t.Fatalf("Marshal failed: %s", err)
+	}
+	want := `timeout: "1.5s"
+max_body: "3MiB"
+start: "2025-10-28T07:41:47Z"
+sampling: "7%"
+accent: "#1e90ff"
+overlay: "#ffffff0c"
+listen: "[2001:db8::1]:443"
+allow: ["10.0.0.0/8"]
+schedule: "0 */6 * * MON-FRI"
+debug: "false"
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshal returned unexpected diff (-want +got):\n%s", diff)
+	}
+	var c2 config
+	if err := ccl.Unmarshal(got, &c2); err != nil {
+		t.Fatalf("Unmarshal(%q) failed: %s", got, err)
+	}
+	if diff := cmp.Diff(c, c2, cmpopts.EquateComparable(netip.Prefix{}, CronSpec{}, Glob{})); diff != "" {
+		t.Errorf("Marshal round trip returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestByteSize_String(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		in   ByteSize
+		want string
+	}{
+		{0, "0B"},
+		{1, "1B"},
+		{1000, "1KB"},
+		{1024, "1KiB"},
+		{1536, "1536B"},
+		{2500, "2500B"},
+		{5 << 30, "5GiB"},
+		{3e12, "3TB"},
+		{-1024, "-1KiB"},
+	} {
+		if got := tc.in.String(); got != tc.want {
+			t.Errorf("ByteSize(%d).String() = %q, want %q", int64(tc.in), got, tc.want)
+		}
+	}
+}
+
+func TestPercent_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		text string
+		want Percent
+	}{
+		{"0.7%", .007},
+		{"7%", .07},
+		{"2.5%", .025},
+		{"100%", 1},
+		{"0%", 0},
+		{"-3%", -.03},
+		{"30.000000000000004%", Percent(math.Nextafter(.3, 1))},
+		{"66.66666666666666%", 2. / 3},
+		{"1e-298%", 1e-300},
+		{"1.5e2%", 1.5},
+	} {
+		var got Percent
+		if err := got.UnmarshalText([]byte(tc.text)); err != nil {
+			t.Errorf("UnmarshalText(%q) failed: %s", tc.text, err)
+		} else if got != tc.want {
+			t.Errorf("UnmarshalText(%q) = %v, want %v", tc.text, float64(got), float64(tc.want))
+		}
+		text, err := tc.want.MarshalText()
+		if err != nil {
+			t.Errorf("Percent(%v).MarshalText failed: %s", float64(tc.want), err)
+			continue
+		}
+		var back Percent
+		if err := back.UnmarshalText(text); err != nil || back != tc.want {
+			t.Errorf("Percent(%v) marshaled as %q, which decodes as %v (error %v)", float64(tc.want), text, float64(back), err)
+		}
+	}
+}
+
+func TestByteSize_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, in := range []ByteSize{0, 1, -1, 1536, -1024, -5 << 30, 3e12, math.MaxInt64, -math.MaxInt64} {
+		text, err := in.MarshalText()
+		if err != nil {
+			t.Errorf("ByteSize(%d).MarshalText failed: %s", int64(in), err)
+			continue
+		}
+		var got ByteSize
+		if err := got.UnmarshalText(text); err != nil {
+			t.Errorf("ByteSize(%d) marshaled as %q, which doesn't unmarshal: %s", int64(in), text, err)
+		} else if got != in {
+			t.Errorf("ByteSize(%d) marshaled as %q, which unmarshals as %d", int64(in), text, int64(got))
+		}
+	}
+}
+
+func TestCIDRList_Contains(t *testing.T) {
+	t.Parallel()
+
+	l := CIDRList{{netip.MustParsePrefix("10.0.0.0/8")}, {netip.MustParsePrefix("2001:db8::/32")}}
+	for _, tc := range []struct {
+		addr string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"11.0.0.1", false},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+	} {
+		if got := l.Contains(netip.MustParseAddr(tc.addr)); got != tc.want {
+			t.Errorf("Contains(%s) = %t, want %t", tc.addr, got, tc.want)
+		}
+	}
+}
+
+func TestTristate_Bool(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		in   Tristate
+		def  bool
+		want bool
+	}{
+		{Unset, false, false},
+		{Unset, true, true},
+		{False, true, false},
+		{True, false, true},
+	} {
+		if got := tc.in.Bool(tc.def); got != tc.want {
+			t.Errorf("%v.Bool(%t) = %t, want %t", tc.in, tc.def, got, tc.want)
+		}
+	}
+}
+
+func TestTristate_Number(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc string
+		msg  string
+		want string
+	}{
+		{"One", `debug: 1`, `1:8 syntax error: field "debug": invalid tristate "1", want true or false`},
+		{"OutOfRange", `debug: 7`, `1:8 syntax error: field "debug": invalid tristate "7", want true or false`},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var c config
+			err := ccl.Unmarshal([]byte(tc.msg), &c)
+			if err == nil {
+				t.Fatalf("Unmarshal(%q) succeeded with %v, want error %q", tc.msg, c.Debug, tc.want)
+			}
+			if got := err.Error(); got != tc.want {
+				t.Errorf("Unmarshal(%q) returned error %q, want %q", tc.msg, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLocation(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		desc    string
+		msg     string
+		want    string
+		wantErr string
+	}{
+		{desc: "Name", msg: `zone: "America/New_York"`, want: "America/New_York"},
+		{desc: "UTC", msg: `zone: "UTC"`, want: "UTC"},
+		{desc: "Unknown", msg: `zone: "America/Gotham"`, wantErr: `unknown time zone "America/Gotham", want a name such as "America/New_York"`},
+		{desc: "Empty", msg: `zone: ""`, wantErr: `time zone is empty, want a name such as "America/New_York" or "UTC"`},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			var got struct {
+				Zone Location `ccl:"zone"`
+			}
+			err := ccl.Unmarshal([]byte(tc.msg), &got)
+			if tc.wantErr != "" {
+				if err == nil || errors.Unwrap(err).Error() != tc.wantErr {
+					t.Errorf("Unmarshal(%q) returned error %v, want %q", tc.msg, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal(%q) failed: %s", tc.msg, err)
+			}
+			if got.Zone.String() != tc.want {
+				t.Errorf("Unmarshal(%q) returned zone %s, want %s", tc.msg, got.Zone, tc.want)
+			}
+			b, err := ccl.Marshal(got)
+			if err != nil {
+				t.Fatalf("Marshal failed: %s", err)
+			}
+			if string(b) != tc.msg+"\n" {
+				t.Errorf("Marshal returned %q, want %q", b, tc.msg+"\n")
+			}
+		})
+	}
+}
+
+// TestLocation_NoDatabase isn't parallel, since it replaces loadLocation.
+func TestLocation_NoDatabase(t *testing.T) {
+	defer func(load func(string) (*time.Location, error)) { loadLocation = load }(loadLocation)
+	loadLocation = func(name string) (*time.Location, error) {
+		return nil, errors.New("unknown time zone " + name)
+	}
+	var l Location
+	want := `can't load time zone "Europe/Paris": the time zone database isn't installed; import time/tzdata to embed it in the program`
+	if err := l.UnmarshalText([]byte("Europe/Paris")); err == nil || err.Error() != want {
+		t.Errorf("UnmarshalText returned error %v, want %q", err, want)
+	}
+}